@@ -0,0 +1,16 @@
+package api
+
+import "time"
+
+// FederationChange records one change made to a federation.
+type FederationChange struct {
+	Id           int `json:"id"`
+	FederationId int `json:"federation_id"`
+	// Principal identifies who made the change.
+	Principal string    `json:"principal"`
+	At        time.Time `json:"at"`
+	Op        string    `json:"op"`
+	// Before is nil for the change that created the federation.
+	Before *Federation `json:"before"`
+	After  *Federation `json:"after"`
+}
@@ -1,6 +1,28 @@
 package api
 
+import "time"
+
+// Federation is checked by the repositories against its validate tags.
 type Federation struct {
-	Id    int    `json:"id"`
-	Owner string `json:"owner"`
+	Id          int    `json:"id" validate:"min=0"`
+	Owner       string `json:"owner" validate:"required,max=255"`
+	Name        string `json:"name,omitempty" validate:"max=255"`
+	Description string `json:"description,omitempty" validate:"max=1024"`
+	// Labels are key value pairs federations can be selected by.
+	Labels map[string]string `json:"labels,omitempty" validate:"keys=labelKey,values=labelValue"`
+	// ParentId is the id of the federation this one is nested in, nil for
+	// federations at the top.
+	ParentId *int `json:"parent_id,omitempty" validate:"min=1"`
+	// State is changed by the lifecycle actions only. StateChangedAt is
+	// when the federation entered it.
+	State          string     `json:"state,omitempty"`
+	StateChangedAt *time.Time `json:"state_changed_at,omitempty"`
+	// Version is maintained by the repository and increases on every change.
+	Version int `json:"version,omitempty"`
+	// CreatedAt and UpdatedAt are maintained by the repository. they are
+	// unset for federations stored before they existed.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// DeletedAt is set while the federation is soft deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 // test Federation marshal
@@ -24,3 +25,51 @@ func TestFederationMarshal(t *testing.T) {
 		t.Fatalf("Federation = %q want %q", federationStr, want)
 	}
 }
+
+// test Federation marshal with version
+// should include the version
+func TestFederationMarshalVersion(t *testing.T) {
+	// arrange
+	sut := Federation{
+		Id:      1,
+		Owner:   "owner",
+		Version: 2,
+	}
+	want := `{"id":1,"owner":"owner","version":2}`
+
+	// act
+	federationJson, _ := json.Marshal(sut)
+	federationStr := string(federationJson)
+
+	// assert
+	if federationStr != want {
+		t.Fatalf("Federation = %q want %q", federationStr, want)
+	}
+}
+
+// test Federation marshal with details
+// should include the name, description, labels and timestamps
+func TestFederationMarshalDetails(t *testing.T) {
+	// arrange
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sut := Federation{
+		Id:          1,
+		Owner:       "owner",
+		Name:        "name",
+		Description: "description",
+		Labels:      map[string]string{"env": "prod"},
+		Version:     2,
+		CreatedAt:   &at,
+		UpdatedAt:   &at,
+	}
+	want := `{"id":1,"owner":"owner","name":"name","description":"description","labels":{"env":"prod"},"version":2,"created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05Z"}`
+
+	// act
+	federationJson, _ := json.Marshal(sut)
+	federationStr := string(federationJson)
+
+	// assert
+	if federationStr != want {
+		t.Fatalf("Federation = %q want %q", federationStr, want)
+	}
+}
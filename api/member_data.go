@@ -0,0 +1,14 @@
+package api
+
+import "time"
+
+// Member is an organisation taking part in a federation.
+type Member struct {
+	// Id is assigned by the repository.
+	Id           int    `json:"id"`
+	FederationId int    `json:"federation_id"`
+	Organisation string `json:"organisation" validate:"required,max=255"`
+	Role         string `json:"role" validate:"oneof=admin member observer"`
+	// JoinedAt is set by the repository when the member is added.
+	JoinedAt time.Time `json:"joined_at"`
+}
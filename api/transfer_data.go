@@ -0,0 +1,20 @@
+package api
+
+import "time"
+
+// Transfer is a pending or settled handover of a federation to a new owner.
+type Transfer struct {
+	// Id is assigned by the repository.
+	Id           int `json:"id"`
+	FederationId int `json:"federation_id"`
+	// From is the owner when the transfer was created.
+	From   string `json:"from"`
+	To     string `json:"to" validate:"required,max=255"`
+	Status string `json:"status"`
+	// CreatedAt and ExpiresAt are set by the repository. a pending transfer
+	// expires once ExpiresAt has passed.
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ResolvedAt is set when the recipient accepts or rejects the transfer.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"gorest/internal/handlers"
 	"gorest/internal/tools"
@@ -10,6 +14,9 @@ import (
 
 var srv = http.Server{}
 
+// shutdownTimeout bounds how long in-flight requests may take to finish.
+const shutdownTimeout = 10 * time.Second
+
 func init() {
 
 }
@@ -20,10 +27,63 @@ func main() {
 		port = "8080"
 	}
 
-	app := handlers.NewApp(handlers.WithPort(port))
+	cfg := tools.LoadConfig()
+	repo, err := tools.OpenFederationRepository(cfg)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		return
+	}
+	organisations, err := tools.ParseOrganisations(cfg.Organisations)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		return
+	}
+	// nil unless enabled by the configuration.
+	faults, _ := tools.FindRepository[*tools.FaultInjector](repo)
+	cache, _ := tools.FindRepository[*tools.CachedRepository](repo)
+
+	app := handlers.NewApp(
+		handlers.WithPort(port),
+		handlers.WithRepository(repo),
+		handlers.WithClientIds(cfg.ClientIds),
+		handlers.WithRequireIfMatch(cfg.RequireIfMatch),
+		handlers.WithPurge(cfg.DeletedRetention, cfg.PurgeInterval),
+		handlers.WithFaultInjector(faults),
+		handlers.WithCache(cache),
+		handlers.WithTransfers(tools.NewMockTransfers(repo, cfg.TransferTTL)),
+		handlers.WithOwnerTransfers(cfg.OwnerTransfers),
+		handlers.WithOrganisations(organisations),
+	)
+	if err := app.Setup(context.Background()); err != nil {
+		tools.ErrorLogger.Println(err)
+		return
+	}
+
 	srv.Addr = app.GetAddr()
 	srv.Handler = app.NewHandler()
 
+	// shut down gracefully on interrupt, or drain requests after the
+	// server has been shut down elsewhere.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go app.RunPurge(ctx)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			tools.ErrorLogger.Println(err)
+		}
+	}()
+
 	tools.InfoLogger.Printf("starting server on %s...\n", app.GetAddr())
 	tools.ErrorLogger.Println(srv.ListenAndServe())
+
+	stop()
+	<-drained
+	if err := app.Close(); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
 }
@@ -11,8 +11,9 @@ import (
 	"gorest/internal/tools"
 )
 
-// wait time for server startup or shutdown
-var mainWaitTime = 200
+// wait time for server startup or shutdown.
+// leaves room for repository setup retries.
+var mainWaitTime = 500
 
 // test main() server error
 // should log error
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gorest/internal/tools"
+)
+
+// getFaults responds the faults currently injected into the repository.
+func (app *App) getFaults(w http.ResponseWriter, r *http.Request) {
+	if err := writeResponseAlias(app, w, http.StatusOK, app.Faults.Faults()); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// putFaults replaces the faults injected into the repository. an empty
+// object stops injecting faults.
+func (app *App) putFaults(w http.ResponseWriter, r *http.Request) {
+	config := tools.FaultConfig{}
+	if err := readJsonAlias(app, w, r, &config); err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := app.Faults.SetFaults(config); err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+	tools.WarningLogger.Printf("repository faults changed to %v\n", config)
+
+	if err := writeResponseAlias(app, w, http.StatusOK, app.Faults.Faults()); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// getCacheStats responds the counters of the repository cache.
+func (app *App) getCacheStats(w http.ResponseWriter, r *http.Request) {
+	if err := writeResponseAlias(app, w, http.StatusOK, app.Cache.Stats()); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorest/internal/tools"
+)
+
+// test NewHandler() serving /admin/faults with a fault injector
+// should report and replace the faults
+func TestNewHandlerFaults(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	injector := tools.NewFaultInjector(tools.NewMockDb(), tools.FaultConfig{"Setup": {ErrorRate: 0.1}}, 1)
+	sut := NewApp(WithRepository(injector), WithFaultInjector(injector)).NewHandler()
+	want := tools.FaultConfig{"GetFederations": {Latency: time.Second}}
+	put := httptest.NewRequest("PUT", "/admin/faults", strings.NewReader(`{"GetFederations":{"latency":"1s"}}`))
+	put.Header.Set("Authorization", "123456")
+	get := httptest.NewRequest("GET", "/admin/faults", nil)
+	get.Header.Set("Authorization", "123456")
+	putW, getW := httptest.NewRecorder(), httptest.NewRecorder()
+
+	// act
+	sut.ServeHTTP(putW, put)
+	sut.ServeHTTP(getW, get)
+	var got tools.FaultConfig
+	json.Unmarshal(getW.Body.Bytes(), &got)
+
+	// assert
+	if putW.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(PUT /admin/faults) = %d want %d", putW.Code, http.StatusOK)
+	}
+
+	if getW.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("ServeHTTP(GET /admin/faults) = %d, %v want %v", getW.Code, got, want)
+	}
+
+	if !reflect.DeepEqual(injector.Faults(), want) {
+		t.Fatalf("Faults() = %v want %v", injector.Faults(), want)
+	}
+}
+
+// test NewHandler() serving PUT /admin/faults with invalid faults
+// should respond bad request and keep the faults
+func TestNewHandlerFaultsInvalid(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	injector := tools.NewFaultInjector(tools.NewMockDb(), tools.FaultConfig{}, 1)
+	sut := NewApp(WithRepository(injector), WithFaultInjector(injector)).NewHandler()
+	bodies := []string{`{"Setup":{"errorRate":2}}`, `{"Setup":{"latency":"soon"}}`, `{"Explode":{}}`}
+
+	for _, body := range bodies {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/admin/faults", strings.NewReader(body))
+		r.Header.Set("Authorization", "123456")
+
+		// act
+		sut.ServeHTTP(w, r)
+
+		// assert
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("ServeHTTP(PUT /admin/faults %s) = %d want %d", body, w.Code, http.StatusBadRequest)
+		}
+
+		if len(injector.Faults()) != 0 {
+			t.Fatalf("Faults() = %v want none", injector.Faults())
+		}
+	}
+}
+
+// test NewHandler() without a fault injector
+// should not serve /admin/faults
+func TestNewHandlerFaultsDisabled(t *testing.T) {
+	// arrange
+	sut := NewApp().NewHandler()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/admin/faults", nil)
+	r.Header.Set("Authorization", "123456")
+
+	// act
+	sut.ServeHTTP(w, r)
+
+	// assert
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("ServeHTTP(GET /admin/faults) = %d want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// test NewHandler() serving GET /admin/cache with a cache
+// should respond the cache counters
+func TestNewHandlerCacheStats(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	cache := tools.NewCachedRepository(tools.NewMockDb(), time.Minute, 10)
+	sut := NewApp(WithRepository(cache), WithCache(cache)).NewHandler()
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/federations", nil)
+		r.Header.Set("Authorization", "123456")
+		sut.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/admin/cache", nil)
+	r.Header.Set("Authorization", "123456")
+	want := tools.CacheStats{Hits: 1, Misses: 1, Entries: 1}
+
+	// act
+	sut.ServeHTTP(w, r)
+	var got tools.CacheStats
+	json.Unmarshal(w.Body.Bytes(), &got)
+
+	// assert
+	if w.Code != http.StatusOK || got != want {
+		t.Fatalf("ServeHTTP(GET /admin/cache) = %d, %+v want %+v", w.Code, got, want)
+	}
+}
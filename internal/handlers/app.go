@@ -1,13 +1,42 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
+
+	"gorest/internal/tools"
 )
 
 type appOpts struct {
-	Host string
-	Port string
+	Host       string
+	Port       string
+	Repository tools.FederationRepository
+	// Members stores the members of the federations in Repository.
+	Members tools.MembersRepository
+	// Transfers stores the ownership transfers of the federations in
+	// Repository.
+	Transfers tools.TransfersRepository
+	// OwnerTransfers makes owners change through transfers only.
+	OwnerTransfers bool
+	// Organisations maps principals to the organisations they act for in
+	// transfers. principals missing from it may not decide any.
+	Organisations map[string]string
+	SetupRetries  int
+	SetupBackoff  time.Duration
+	// ClientIds is the policy for ids sent on create, see tools.ClientIdsIgnore.
+	ClientIds string
+	// RequireIfMatch makes writes to a federation fail without an If-Match header.
+	RequireIfMatch bool
+	// DeletedRetention is how long RunPurge keeps deleted federations,
+	// 0 keeps them forever.
+	DeletedRetention time.Duration
+	PurgeInterval    time.Duration
+	// Faults, when set, is adjusted through the /admin/faults endpoint.
+	Faults *tools.FaultInjector
+	// Cache, when set, reports its counters on the /admin/cache endpoint.
+	Cache *tools.CachedRepository
 }
 
 type App struct {
@@ -18,12 +47,33 @@ type appConfigFunc func(*appOpts)
 
 var errInternalServerError = errors.New("internal server error")
 
+// default Setup retry policy. the wait doubles after every failed attempt.
+const (
+	defaultSetupRetries = 5
+	defaultSetupBackoff = 100 * time.Millisecond
+)
+
 func NewApp(configs ...appConfigFunc) *App {
-	o := appOpts{}
+	o := appOpts{
+		SetupRetries:   defaultSetupRetries,
+		SetupBackoff:   defaultSetupBackoff,
+		ClientIds:      tools.ClientIdsIgnore,
+		RequireIfMatch: true,
+	}
 	for _, fn := range configs {
 		fn(&o)
 	}
 
+	if o.Repository == nil {
+		o.Repository = tools.NewMockDb()
+	}
+	if o.Members == nil {
+		o.Members = tools.NewMockMembers(o.Repository)
+	}
+	if o.Transfers == nil {
+		o.Transfers = tools.NewMockTransfers(o.Repository, tools.DefaultTransferTTL)
+	}
+
 	return &App{&o}
 }
 
@@ -39,6 +89,154 @@ func WithPort(port string) appConfigFunc {
 	}
 }
 
+// WithRepository sets the repository used by every handler.
+func WithRepository(repo tools.FederationRepository) appConfigFunc {
+	return func(o *appOpts) {
+		o.Repository = repo
+	}
+}
+
+// WithMembers sets the repository of federation members.
+func WithMembers(members tools.MembersRepository) appConfigFunc {
+	return func(o *appOpts) {
+		o.Members = members
+	}
+}
+
+// WithTransfers sets the repository of ownership transfers.
+func WithTransfers(transfers tools.TransfersRepository) appConfigFunc {
+	return func(o *appOpts) {
+		o.Transfers = transfers
+	}
+}
+
+// WithOwnerTransfers sets whether owners change through transfers only,
+// making updates and patches that change the owner fail.
+func WithOwnerTransfers(required bool) appConfigFunc {
+	return func(o *appOpts) {
+		o.OwnerTransfers = required
+	}
+}
+
+// WithOrganisations sets the organisations principals act for in
+// transfers.
+func WithOrganisations(organisations map[string]string) appConfigFunc {
+	return func(o *appOpts) {
+		o.Organisations = organisations
+	}
+}
+
+// WithSetupRetry sets how many times Setup tries the repository and the
+// wait before the first retry.
+func WithSetupRetry(retries int, backoff time.Duration) appConfigFunc {
+	return func(o *appOpts) {
+		o.SetupRetries = retries
+		o.SetupBackoff = backoff
+	}
+}
+
+// WithClientIds sets whether ids sent on create are ignored or rejected.
+func WithClientIds(policy string) appConfigFunc {
+	return func(o *appOpts) {
+		o.ClientIds = policy
+	}
+}
+
+// WithRequireIfMatch sets whether writes to a federation need an If-Match header.
+func WithRequireIfMatch(require bool) appConfigFunc {
+	return func(o *appOpts) {
+		o.RequireIfMatch = require
+	}
+}
+
+// WithPurge sets how long deleted federations are kept and how often
+// RunPurge looks for expired ones.
+func WithPurge(retention, interval time.Duration) appConfigFunc {
+	return func(o *appOpts) {
+		o.DeletedRetention = retention
+		o.PurgeInterval = interval
+	}
+}
+
+// WithFaultInjector exposes the faults of injector on /admin/faults.
+func WithFaultInjector(injector *tools.FaultInjector) appConfigFunc {
+	return func(o *appOpts) {
+		o.Faults = injector
+	}
+}
+
+// WithCache exposes the counters of cache on /admin/cache.
+func WithCache(cache *tools.CachedRepository) appConfigFunc {
+	return func(o *appOpts) {
+		o.Cache = cache
+	}
+}
+
 func (app *App) GetAddr() string {
 	return fmt.Sprintf("%s:%s", app.Host, app.Port)
 }
+
+// Setup prepares the repository once at startup.
+// failed attempts are retried with exponential backoff until SetupRetries
+// is exhausted or ctx is done.
+func (app *App) Setup(ctx context.Context) error {
+	backoff := app.SetupBackoff
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = app.Repository.Setup(ctx); err == nil {
+			return nil
+		}
+
+		if attempt >= app.SetupRetries {
+			return fmt.Errorf("repository setup failed after %d attempts: %w", attempt, err)
+		}
+		tools.WarningLogger.Printf("repository setup attempt %d failed, retrying in %v: %v\n", attempt, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// RunPurge removes federations deleted more than DeletedRetention ago,
+// once at start and then every PurgeInterval, until ctx is done.
+// it returns at once when retention is disabled.
+func (app *App) RunPurge(ctx context.Context) {
+	if app.DeletedRetention <= 0 || app.PurgeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		app.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *App) purge(ctx context.Context) {
+	n, err := app.Repository.PurgeFederations(ctx, time.Now().Add(-app.DeletedRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			tools.ErrorLogger.Printf("purge deleted federations: %v\n", err)
+		}
+		return
+	}
+	if n > 0 {
+		tools.InfoLogger.Printf("purged %d deleted federations\n", n)
+	}
+}
+
+// Close releases the repository. it runs on shutdown.
+func (app *App) Close() error {
+	return app.Repository.Close()
+}
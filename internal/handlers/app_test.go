@@ -1,6 +1,37 @@
 package handlers
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"gorest/internal/tools"
+)
+
+// setupRepositoryMock fails Setup a number of times before succeeding.
+type setupRepositoryMock struct {
+	tools.FederationRepository
+	failures    int
+	setupCalls  int
+	closeCalled bool
+}
+
+func (m *setupRepositoryMock) Setup(context.Context) error {
+	m.setupCalls++
+	if m.setupCalls <= m.failures {
+		return errors.New("test error")
+	}
+	return nil
+}
+
+func (m *setupRepositoryMock) Close() error {
+	m.closeCalled = true
+	return nil
+}
 
 // test NewApp() without options
 // should return default app
@@ -42,6 +73,23 @@ func TestNewAppSuccessPortOption(t *testing.T) {
 	}
 }
 
+// test NewApp() with client ids option
+// should return app with setted policy
+func TestNewAppSuccessClientIdsOption(t *testing.T) {
+	// act
+	app := NewApp(WithClientIds(tools.ClientIdsReject))
+	defaultApp := NewApp()
+
+	// assert
+	if app.ClientIds != tools.ClientIdsReject {
+		t.Fatalf("NewApp() = %q want %q", app.ClientIds, tools.ClientIdsReject)
+	}
+
+	if defaultApp.ClientIds != tools.ClientIdsIgnore {
+		t.Fatalf("NewApp() = %q want %q", defaultApp.ClientIds, tools.ClientIdsIgnore)
+	}
+}
+
 // test GetAddr
 // should return app address
 func TestGetAddr(t *testing.T) {
@@ -57,3 +105,216 @@ func TestGetAddr(t *testing.T) {
 		t.Fatalf("GetAddr() = %q want %q", addr, wantAddr)
 	}
 }
+
+// test NewApp() with repository option
+// should return app with setted repository
+func TestNewAppSuccessRepositoryOption(t *testing.T) {
+	// arrange
+	repo := NewFederationRepositoryMock()
+
+	// act
+	app := NewApp(WithRepository(repo))
+
+	// assert
+	if app.Repository != repo {
+		t.Fatalf("NewApp() = %v want %v", app.Repository, repo)
+	}
+}
+
+// test NewApp() without repository option
+// should return app with in-memory repository
+func TestNewAppDefaultRepository(t *testing.T) {
+	// act
+	app := NewApp()
+
+	// assert
+	if app.Repository == nil {
+		t.Fatal("NewApp() = <nil> want tools.FederationRepository")
+	}
+
+	if app.Members == nil {
+		t.Fatal("NewApp() = <nil> members want tools.MembersRepository")
+	}
+}
+
+// test NewApp() with members option
+// should return app with setted members repository
+func TestNewAppMembersOption(t *testing.T) {
+	// arrange
+	members := tools.NewMockMembers(tools.NewMockDb())
+
+	// act
+	app := NewApp(WithMembers(members))
+
+	// assert
+	if app.Members != members {
+		t.Fatalf("NewApp() = %v want %v", app.Members, members)
+	}
+}
+
+// test NewApp() with transfers options
+// should return app with setted transfers repository and requirement
+func TestNewAppTransfersOptions(t *testing.T) {
+	// arrange
+	transfers := tools.NewMockTransfers(tools.NewMockDb(), time.Hour)
+
+	// act
+	app := NewApp(WithTransfers(transfers), WithOwnerTransfers(true))
+
+	// assert
+	if app.Transfers != transfers || !app.OwnerTransfers {
+		t.Fatalf("NewApp() = %v, %v want %v, true", app.Transfers, app.OwnerTransfers, transfers)
+	}
+}
+
+// test Setup(ctx) with transient repository errors
+// should retry with backoff and succeed
+func TestSetupRetrySuccess(t *testing.T) {
+	// arrange
+	repo := &setupRepositoryMock{failures: 2}
+	sut := NewApp(WithRepository(repo), WithSetupRetry(3, time.Millisecond))
+	defer func() {
+		tools.WarningLogger.SetOutput(os.Stdout)
+	}()
+	var warnBuf bytes.Buffer
+	tools.WarningLogger.SetOutput(&warnBuf)
+	wantLog := regexp.MustCompile("repository setup attempt 2 failed, retrying in 2ms")
+
+	// act
+	err := sut.Setup(context.Background())
+
+	// assert
+	if err != nil {
+		t.Fatalf("Setup(ctx) = %v want <nil>", err)
+	}
+
+	if repo.setupCalls != 3 {
+		t.Fatalf("Setup(ctx) = %d calls want 3", repo.setupCalls)
+	}
+
+	if warnOutput := warnBuf.String(); !wantLog.MatchString(warnOutput) {
+		t.Fatalf("Setup(ctx) = %q want %q", warnOutput, wantLog)
+	}
+}
+
+// test Setup(ctx) with persistent repository errors
+// should stop after the configured retries and return error
+func TestSetupRetryExhausted(t *testing.T) {
+	// arrange
+	repo := &setupRepositoryMock{failures: 10}
+	sut := NewApp(WithRepository(repo), WithSetupRetry(3, time.Millisecond))
+	defer func() {
+		tools.WarningLogger.SetOutput(os.Stdout)
+	}()
+	tools.WarningLogger.SetOutput(&bytes.Buffer{})
+	wantError := "repository setup failed after 3 attempts: test error"
+
+	// act
+	err := sut.Setup(context.Background())
+
+	// assert
+	if err == nil || err.Error() != wantError {
+		t.Fatalf("Setup(ctx) = %v want %q", err, wantError)
+	}
+
+	if repo.setupCalls != 3 {
+		t.Fatalf("Setup(ctx) = %d calls want 3", repo.setupCalls)
+	}
+}
+
+// test Setup(ctx) with cancelled context
+// should stop retrying
+func TestSetupCancelled(t *testing.T) {
+	// arrange
+	repo := &setupRepositoryMock{failures: 10}
+	sut := NewApp(WithRepository(repo), WithSetupRetry(3, time.Hour))
+	defer func() {
+		tools.WarningLogger.SetOutput(os.Stdout)
+	}()
+	tools.WarningLogger.SetOutput(&bytes.Buffer{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// act
+	err := sut.Setup(ctx)
+
+	// assert
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Setup(ctx) = %v want %v", err, context.Canceled)
+	}
+
+	if repo.setupCalls != 1 {
+		t.Fatalf("Setup(ctx) = %d calls want 1", repo.setupCalls)
+	}
+}
+
+// test Close()
+// should close the repository
+func TestClose(t *testing.T) {
+	// arrange
+	repo := &setupRepositoryMock{}
+	sut := NewApp(WithRepository(repo))
+
+	// act
+	err := sut.Close()
+
+	// assert
+	if err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+
+	if !repo.closeCalled {
+		t.Fatal("Close() = repository open want closed")
+	}
+}
+
+// purgeRepositoryMock records purges and stops RunPurge after the first one.
+type purgeRepositoryMock struct {
+	tools.FederationRepository
+	cutoffs []time.Time
+	stop    context.CancelFunc
+}
+
+func (m *purgeRepositoryMock) PurgeFederations(_ context.Context, deletedBefore time.Time) (int, error) {
+	m.cutoffs = append(m.cutoffs, deletedBefore)
+	m.stop()
+	return 0, nil
+}
+
+// test RunPurge(ctx) with a retention
+// should purge federations deleted before the retention period
+func TestRunPurge(t *testing.T) {
+	// arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := &purgeRepositoryMock{stop: cancel}
+	sut := NewApp(WithRepository(repo), WithPurge(time.Hour, time.Hour))
+	before := time.Now().Add(-time.Hour)
+
+	// act
+	sut.RunPurge(ctx)
+
+	// assert
+	if len(repo.cutoffs) != 1 {
+		t.Fatalf("RunPurge(ctx) = %d purges want 1", len(repo.cutoffs))
+	}
+
+	if cutoff := repo.cutoffs[0]; cutoff.Before(before) || cutoff.After(time.Now().Add(-time.Hour)) {
+		t.Fatalf("RunPurge(ctx) = %v want an hour ago", cutoff)
+	}
+}
+
+// test RunPurge(ctx) without retention
+// should return without purging
+func TestRunPurgeDisabled(t *testing.T) {
+	// arrange
+	repo := &purgeRepositoryMock{stop: func() {}}
+	sut := NewApp(WithRepository(repo))
+
+	// act
+	sut.RunPurge(context.Background())
+
+	// assert
+	if len(repo.cutoffs) != 0 {
+		t.Fatalf("RunPurge(ctx) = %d purges want 0", len(repo.cutoffs))
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// maxBatchOperations bounds the operations of one batch. the whole batch
+// also has to fit in the readJson body limit.
+const maxBatchOperations = 1000
+
+// batchRequest is the body of POST /federations:batch.
+type batchRequest struct {
+	// Atomic applies every operation or none.
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchOperation struct {
+	Op         string          `json:"op"`
+	Id         int             `json:"id,omitempty"`
+	Version    int             `json:"version,omitempty"`
+	Federation *api.Federation `json:"federation,omitempty"`
+}
+
+// batchResponse holds a result for every operation, in request order.
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	Status     int                    `json:"status"`
+	Federation *api.Federation        `json:"federation,omitempty"`
+	Message    string                 `json:"msg,omitempty"`
+	Errors     tools.ValidationErrors `json:"errors,omitempty"`
+}
+
+func (app *App) batchFederations(w http.ResponseWriter, r *http.Request) {
+	req := new(batchRequest)
+	if err := readJsonAlias(app, w, r, req); err != nil {
+		tools.ErrorLogger.Println(err)
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		writeResponseAlias(app, w, code, err)
+		return
+	}
+
+	if n := len(req.Operations); n == 0 || n > maxBatchOperations {
+		app.writeError(w, r, &tools.ValidationError{Field: "operations", Message: fmt.Sprintf("must hold between 1 and %d operations", maxBatchOperations)})
+		return
+	}
+
+	// operations breaking the rules of the single endpoints never reach
+	// the repository. index maps the remaining ones back to the request.
+	results := make([]tools.BatchResult, len(req.Operations))
+	ops := make([]tools.BatchOperation, 0, len(req.Operations))
+	index := make([]int, 0, len(req.Operations))
+	for i, op := range req.Operations {
+		if err := app.checkBatchOperation(r.Context(), &op); err != nil {
+			results[i].Err = err
+			continue
+		}
+		ops = append(ops, tools.BatchOperation{Op: op.Op, Id: op.Id, Version: op.Version, Federation: op.Federation})
+		index = append(index, i)
+	}
+
+	switch {
+	case req.Atomic && len(ops) < len(req.Operations):
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = tools.ErrBatchAborted
+			}
+		}
+	case len(ops) > 0:
+		applied, err := app.Repository.ApplyBatch(r.Context(), ops, req.Atomic)
+		if err != nil {
+			app.writeError(w, r, err)
+			return
+		}
+		for j, result := range applied {
+			results[index[j]] = result
+		}
+	}
+
+	res := batchResponse{Results: make([]batchResult, len(results))}
+	for i, result := range results {
+		res.Results[i] = app.batchResult(r, req.Operations[i].Op, result)
+	}
+	if err := writeResponseAlias(app, w, http.StatusOK, res); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// clientIdAssigned returns the violation of an id sent in field while
+// ClientIds is ClientIdsReject.
+func clientIdAssigned(field string) error {
+	return tools.ValidationErrors{{Field: field, Message: "is assigned by the server"}}
+}
+
+// checkBatchOperation applies the client id policy to creates, the
+// If-Match requirement to the versions of updates and deletes and keeps
+// updates from changing owners while they change through transfers only.
+func (app *App) checkBatchOperation(ctx context.Context, op *batchOperation) error {
+	switch op.Op {
+	case tools.BatchCreate:
+		if op.Federation == nil || op.Federation.Id == 0 {
+			return nil
+		}
+		if app.ClientIds == tools.ClientIdsReject {
+			return clientIdAssigned("federation.id")
+		}
+		op.Federation.Id = 0
+	case tools.BatchUpdate, tools.BatchDelete:
+		if op.Version == 0 && app.RequireIfMatch {
+			return errVersionRequired
+		}
+		if op.Op == tools.BatchUpdate && op.Federation != nil {
+			version, err := app.keepOwner(ctx, op.Id, op.Version, op.Federation.Owner)
+			if err != nil {
+				return err
+			}
+			op.Version = version
+		}
+	}
+	return nil
+}
+
+// batchResult reports result with the status the single endpoint would use.
+func (app *App) batchResult(r *http.Request, op string, result tools.BatchResult) batchResult {
+	if result.Err != nil {
+		code, err := app.errorResponse(r, result.Err)
+		return batchResult{Status: code, Message: err.Error(), Errors: violations(err)}
+	}
+
+	code := http.StatusOK
+	if op == tools.BatchCreate {
+		code = http.StatusCreated
+	}
+	return batchResult{Status: code, Federation: result.Federation}
+}
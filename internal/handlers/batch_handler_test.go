@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorest/internal/tools"
+)
+
+// serveBatch posts body to batchFederations and returns the response code
+// and data.
+func serveBatch(t *testing.T, sut *App, body string) (int, any) {
+	t.Helper()
+	receivedCode := 0
+	var receivedData any
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, _ ...http.Header) error {
+		receivedCode = code
+		receivedData = data
+		return nil
+	}
+	readJsonAlias = (*App).readJson
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/federations:batch", strings.NewReader(body))
+
+	sut.batchFederations(w, r)
+	return receivedCode, receivedData
+}
+
+func batchStatuses(data any) []int {
+	res, ok := data.(batchResponse)
+	if !ok {
+		return nil
+	}
+	statuses := make([]int, len(res.Results))
+	for i, result := range res.Results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
+
+// test batchFederations(w http.ResponseWriter, r *http.Request)
+// should respond the status of every operation
+func TestBatchFederationsSuccess(t *testing.T) {
+	// arrange
+	ResetFederationRepositoryMock()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	body := `{"operations":[
+		{"op":"create","federation":{"id":7,"owner":"new"}},
+		{"op":"update","id":1,"version":1,"federation":{"owner":"updated"}},
+		{"op":"delete","id":9,"version":1}
+	]}`
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusNotFound}
+
+	// act
+	code, data := serveBatch(t, sut, body)
+
+	// assert
+	if code != http.StatusOK {
+		t.Fatalf("batchFederations(w, r) = %d want %d", code, http.StatusOK)
+	}
+
+	if statuses := batchStatuses(data); !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("batchFederations(w, r) = %v want %v", statuses, want)
+	}
+
+	if ops := FederationRepositoryMockReceivedBatch; len(ops) != 3 || ops[0].Federation.Id != 0 {
+		t.Fatalf("batchFederations(w, r) = %+v want 3 operations and no client id", ops)
+	}
+}
+
+// test batchFederations(w http.ResponseWriter, r *http.Request) atomic without versions
+// should abort the batch before the repository
+func TestBatchFederationsAtomicVersionRequired(t *testing.T) {
+	// arrange
+	ResetFederationRepositoryMock()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	body := `{"atomic":true,"operations":[
+		{"op":"create","federation":{"owner":"new"}},
+		{"op":"delete","id":1}
+	]}`
+	want := []int{http.StatusFailedDependency, http.StatusPreconditionRequired}
+
+	// act
+	_, data := serveBatch(t, sut, body)
+
+	// assert
+	if statuses := batchStatuses(data); !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("batchFederations(w, r) = %v want %v", statuses, want)
+	}
+
+	if FederationRepositoryMockReceivedBatch != nil {
+		t.Fatalf("batchFederations(w, r) = %v want no repository call", FederationRepositoryMockReceivedBatch)
+	}
+}
+
+// test batchFederations(w http.ResponseWriter, r *http.Request) creating with a client id when rejected
+// should answer the create 422 and run the other operations
+func TestBatchFederationsRejectClientId(t *testing.T) {
+	// arrange
+	ResetFederationRepositoryMock()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()), WithClientIds(tools.ClientIdsReject))
+	body := `{"operations":[
+		{"op":"create","federation":{"id":7,"owner":"new"}},
+		{"op":"update","id":1,"version":1,"federation":{"owner":"updated"}}
+	]}`
+	want := []int{http.StatusUnprocessableEntity, http.StatusOK}
+
+	// act
+	_, data := serveBatch(t, sut, body)
+
+	// assert
+	if statuses := batchStatuses(data); !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("batchFederations(w, r) = %v want %v", statuses, want)
+	}
+
+	if ops := FederationRepositoryMockReceivedBatch; len(ops) != 1 || ops[0].Op != tools.BatchUpdate {
+		t.Fatalf("batchFederations(w, r) = %+v want the update only", ops)
+	}
+}
+
+// test batchFederations(w http.ResponseWriter, r *http.Request) with invalid requests
+// should respond the request error
+func TestBatchFederationsInvalid(t *testing.T) {
+	// arrange
+	ResetFederationRepositoryMock()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	tooLarge := `{"operations":[` + strings.Repeat(`{"op":"create","federation":{"owner":"x"}},`, maxBodyBytes/40) + `{"op":"delete","id":1}]}`
+	tooMany := `{"operations":[` + strings.Repeat(`{"op":"delete","id":1},`, maxBatchOperations) + `{"op":"delete","id":1}]}`
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"operations":[]}`, http.StatusBadRequest},
+		{`{"operations":[{"op":"delete","id":1}]}{}`, http.StatusBadRequest},
+		{tooMany, http.StatusBadRequest},
+		{tooLarge, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		// act
+		code, _ := serveBatch(t, sut, tt.body)
+
+		// assert
+		if code != tt.want {
+			t.Fatalf("batchFederations(%.40s...) = %d want %d", tt.body, code, tt.want)
+		}
+	}
+}
+
+// test batchFederations(w http.ResponseWriter, r *http.Request) with repository error
+// should respond the mapped error
+func TestBatchFederationsRepositoryError(t *testing.T) {
+	// arrange
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = tools.ErrUnavailable
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+
+	// act
+	code, _ := serveBatch(t, sut, `{"operations":[{"op":"delete","id":1,"version":1}]}`)
+
+	// assert
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("batchFederations(w, r) = %d want %d", code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"gorest/internal/tools"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the client
+// goes away before the response is ready.
+const StatusClientClosedRequest = 499
+
+// errorStatus maps repository errors to response codes.
+// it is the only place where storage failures become HTTP.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errUnsupportedPatch), errors.Is(err, errUnsupportedImport):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, errNotAcceptable):
+		return http.StatusNotAcceptable
+	case errors.Is(err, errPreconditionRequired), errors.Is(err, errVersionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, tools.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, tools.ErrBatchAborted):
+		return http.StatusFailedDependency
+	case errors.Is(err, tools.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, tools.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tools.ErrAlreadyExists), errors.Is(err, tools.ErrConflict):
+		return http.StatusConflict
+	case violations(err) != nil:
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, tools.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, tools.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// violations returns the field violations of a value that failed its
+// validation rules, nil for other errors. they are answered with 422, while
+// other ErrValidation failures, like malformed parameters, answer 400.
+func violations(err error) tools.ValidationErrors {
+	var violations tools.ValidationErrors
+	errors.As(err, &violations)
+	return violations
+}
+
+// writeError responds to a failed repository call.
+func (app *App) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, err := app.errorResponse(r, err)
+	if err := writeResponseAlias(app, w, code, err); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// errorResponse returns the status and error to report for err.
+// cancelled requests are logged as warnings and unexpected errors are
+// logged and hidden from the client.
+func (app *App) errorResponse(r *http.Request, err error) (int, error) {
+	code := errorStatus(err)
+	switch code {
+	case StatusClientClosedRequest, http.StatusGatewayTimeout:
+		tools.WarningLogger.Printf("request cancelled: %s %s: %v\n", r.Method, r.URL.Path, err)
+	case http.StatusInternalServerError, http.StatusServiceUnavailable:
+		tools.ErrorLogger.Println(err)
+	}
+
+	if code == http.StatusInternalServerError {
+		err = errInternalServerError
+	}
+	return code, err
+}
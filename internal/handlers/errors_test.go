@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"gorest/internal/tools"
+)
+
+// test errorStatus(error) with every repository error
+// should map each to its response code
+func TestErrorStatus(t *testing.T) {
+	// arrange
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&tools.FederationError{Id: 1, Err: tools.ErrNotFound}, http.StatusNotFound},
+		{&tools.FederationError{Id: 1, Err: tools.ErrAlreadyExists}, http.StatusConflict},
+		{fmt.Errorf("update: %w", tools.ErrConflict), http.StatusConflict},
+		{&tools.FederationError{Id: 1, Err: tools.ErrForbidden}, http.StatusForbidden},
+		{&tools.ValidationError{Field: "id", Message: "must be positive"}, http.StatusBadRequest},
+		{&tools.FederationError{Id: 1, Err: tools.ValidationErrors{{Field: "owner", Rule: "required", Message: "is required"}}}, http.StatusUnprocessableEntity},
+		{tools.ErrUnavailable, http.StatusServiceUnavailable},
+		{context.Canceled, StatusClientClosedRequest},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		// act
+		code := errorStatus(tt.err)
+
+		// assert
+		if code != tt.want {
+			t.Fatalf("errorStatus(%v) = %d want %d", tt.err, code, tt.want)
+		}
+	}
+}
+
+// test writeError(w, r, error) with unexpected error
+// should log it and respond a generic message
+func TestWriteErrorInternal(t *testing.T) {
+	// arrange
+	sut := NewApp()
+	var receivedCode int
+	var receivedError error
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, _ ...http.Header) error {
+		receivedCode = code
+		receivedError = data.(error)
+		return nil
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations", nil)
+	defer func() {
+		tools.ErrorLogger.SetOutput(os.Stderr)
+	}()
+	var errBuf bytes.Buffer
+	tools.ErrorLogger.SetOutput(&errBuf)
+	wantLog := regexp.MustCompile("disk full")
+
+	// act
+	sut.writeError(w, r, errors.New("disk full"))
+
+	// assert
+	if receivedCode != http.StatusInternalServerError {
+		t.Fatalf("writeError(w, r, err) = %d want %d", receivedCode, http.StatusInternalServerError)
+	}
+
+	if receivedError != errInternalServerError {
+		t.Fatalf("writeError(w, r, err) = %q want %q", receivedError, errInternalServerError)
+	}
+
+	errOutput := errBuf.String()
+	if !wantLog.MatchString(errOutput) {
+		t.Fatalf("writeError(w, r, err) = %q want %q", errOutput, wantLog)
+	}
+}
@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// media types of exports and imports.
+const (
+	ndjsonType = "application/x-ndjson"
+	csvType    = "text/csv"
+)
+
+// csvColumns are the columns of a CSV export. imports need id and owner
+// and ignore the columns maintained by the repository. labels are written
+// as a JSON object.
+var csvColumns = []string{"id", "owner", "version", "deleted_at", "name", "description", "labels", "created_at", "updated_at", "state", "state_changed_at", "parent_id"}
+
+// maxImportBytes limits the size of an import, which is read as a stream
+// instead of a single json payload.
+const maxImportBytes = 64 << 20 // 64MB.
+
+// errNotAcceptable is returned for exports in other media types.
+var errNotAcceptable = fmt.Errorf("export must accept %s or %s", ndjsonType, csvType)
+
+// errUnsupportedImport is returned for imports of other media types.
+var errUnsupportedImport = fmt.Errorf("import must be %s or %s", ndjsonType, csvType)
+
+// exportType picks the export media type for an Accept header, NDJSON
+// unless CSV is preferred. it returns false when neither is acceptable.
+func exportType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return ndjsonType, true
+	}
+
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		var candidate string
+		switch mediaType {
+		case ndjsonType, "application/ndjson", "application/*", "*/*":
+			candidate = ndjsonType
+		case csvType, "text/*":
+			candidate = csvType
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best, best != ""
+}
+
+// federationEncoder writes federations in an export format.
+type federationEncoder interface {
+	encode(*api.Federation) error
+	// flush writes the buffered federations.
+	flush() error
+}
+
+type ndjsonEncoder struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNdjsonEncoder(w io.Writer) *ndjsonEncoder {
+	buf := bufio.NewWriter(w)
+	return &ndjsonEncoder{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (e *ndjsonEncoder) encode(fed *api.Federation) error {
+	return e.enc.Encode(fed)
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return e.buf.Flush()
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+// newCsvEncoder writes the header row before any federation.
+func newCsvEncoder(w io.Writer) *csvEncoder {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	e.w.Write(csvColumns)
+	return e
+}
+
+func (e *csvEncoder) encode(fed *api.Federation) error {
+	labels := ""
+	if len(fed.Labels) > 0 {
+		data, err := json.Marshal(fed.Labels)
+		if err != nil {
+			return err
+		}
+		labels = string(data)
+	}
+	return e.w.Write([]string{strconv.Itoa(fed.Id), fed.Owner, strconv.Itoa(fed.Version), csvTime(fed.DeletedAt),
+		fed.Name, fed.Description, labels, csvTime(fed.CreatedAt), csvTime(fed.UpdatedAt), fed.State, csvTime(fed.StateChangedAt), csvParent(fed.ParentId)})
+}
+
+// csvParent formats an optional parent id, empty at the top.
+func csvParent(parentId *int) string {
+	if parentId == nil {
+		return ""
+	}
+	return strconv.Itoa(*parentId)
+}
+
+// csvTime formats an optional time, empty when unset.
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// exportFederations streams every federation matching the listing filters
+// of r, one page of the repository at a time. a failure after the first
+// page aborts the response, so clients never mistake a partial export for
+// a complete one.
+func (app *App) exportFederations(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := exportType(r.Header.Get("Accept"))
+	if !ok {
+		app.writeError(w, r, errNotAcceptable)
+		return
+	}
+
+	query, err := parseFederationQuery(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+	query.Limit, query.Offset, query.Cursor = tools.MaxPageLimit, 0, ""
+
+	page, err := app.Repository.GetFederations(r.Context(), query)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	var enc federationEncoder = newNdjsonEncoder(w)
+	if mediaType == csvType {
+		enc = newCsvEncoder(w)
+	}
+	rc := http.NewResponseController(w)
+
+	for {
+		for _, fed := range page.Federations {
+			if err := enc.encode(fed); err != nil {
+				abortExport(err)
+			}
+		}
+		if err := enc.flush(); err != nil {
+			abortExport(err)
+		}
+		rc.Flush()
+
+		if page.Next == "" {
+			return
+		}
+		query.Cursor = page.Next
+		if page, err = app.Repository.GetFederations(r.Context(), query); err != nil {
+			abortExport(err)
+		}
+	}
+}
+
+// abortExport ends a streaming export whose status was already sent.
+func abortExport(err error) {
+	tools.ErrorLogger.Printf("export aborted: %v\n", err)
+	panic(http.ErrAbortHandler)
+}
+
+// importReport is the response of an import, with a line for every row read.
+type importReport struct {
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Skipped   int          `json:"skipped"`
+	Failed    int          `json:"failed"`
+	Aborted   bool         `json:"aborted,omitempty"`
+	Lines     []importLine `json:"lines"`
+}
+
+type importLine struct {
+	Line    int                    `json:"line"`
+	Id      int                    `json:"id,omitempty"`
+	Outcome string                 `json:"outcome"`
+	Status  int                    `json:"status,omitempty"`
+	Message string                 `json:"msg,omitempty"`
+	Errors  tools.ValidationErrors `json:"errors,omitempty"`
+}
+
+// importFailed is the outcome of rows that could not be imported.
+const importFailed = "failed"
+
+// federationDecoder reads the rows of an import. next returns the line of
+// the row and its federation, an error with the line of an invalid row,
+// or io.EOF after the last row. any other error stops the import.
+type federationDecoder interface {
+	next() (int, *api.Federation, error)
+}
+
+// rowError is an invalid row. the import goes on with the next one.
+type rowError struct {
+	line int
+	err  error
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *rowError) Unwrap() error {
+	return e.err
+}
+
+type ndjsonDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (d *ndjsonDecoder) next() (int, *api.Federation, error) {
+	for {
+		raw, err := d.r.ReadBytes('\n')
+		if len(raw) == 0 && err != nil {
+			return d.line, nil, err
+		}
+		d.line++
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		fed := new(api.Federation)
+		if err := dec.Decode(fed); err != nil {
+			return d.line, nil, &rowError{line: d.line, err: fmt.Errorf("%w: %w", tools.ErrValidation, err)}
+		}
+		if dec.More() {
+			return d.line, nil, &rowError{line: d.line, err: fmt.Errorf("%w: more than one federation on the line", tools.ErrValidation)}
+		}
+		return d.line, fed, nil
+	}
+}
+
+type csvDecoder struct {
+	r         *csv.Reader
+	id, owner int
+	// name, description, labels and parent are optional, -1 when missing.
+	name, description, labels, parent int
+}
+
+// newCsvDecoder reads the header row, which must name the id and owner
+// columns.
+func newCsvDecoder(r io.Reader) (*csvDecoder, error) {
+	d := &csvDecoder{r: csv.NewReader(r), id: -1, owner: -1, name: -1, description: -1, labels: -1, parent: -1}
+	header, err := d.r.Read()
+	if err == io.EOF {
+		return nil, &tools.ValidationError{Field: "header", Message: "is required"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, column := range header {
+		switch column {
+		case "id":
+			d.id = i
+		case "owner":
+			d.owner = i
+		case "name":
+			d.name = i
+		case "description":
+			d.description = i
+		case "labels":
+			d.labels = i
+		case "parent_id":
+			d.parent = i
+		case "version", "deleted_at", "created_at", "updated_at", "state", "state_changed_at":
+		default:
+			return nil, &tools.ValidationError{Field: "header", Message: fmt.Sprintf("has unknown column %q", column)}
+		}
+	}
+	if d.id < 0 || d.owner < 0 {
+		return nil, &tools.ValidationError{Field: "header", Message: "must name the id and owner columns"}
+	}
+	d.r.ReuseRecord = true
+	return d, nil
+}
+
+func (d *csvDecoder) next() (int, *api.Federation, error) {
+	record, err := d.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, &rowError{line: parseErr.StartLine, err: fmt.Errorf("%w: %w", tools.ErrValidation, parseErr.Err)}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	line, _ := d.r.FieldPos(0)
+	id, err := strconv.Atoi(record[d.id])
+	if err != nil {
+		return line, nil, &rowError{line: line, err: &tools.ValidationError{Field: "id", Message: "must be an integer"}}
+	}
+	fed := &api.Federation{Id: id, Owner: record[d.owner]}
+	if d.name >= 0 {
+		fed.Name = record[d.name]
+	}
+	if d.description >= 0 {
+		fed.Description = record[d.description]
+	}
+	if d.labels >= 0 && record[d.labels] != "" {
+		if err := json.Unmarshal([]byte(record[d.labels]), &fed.Labels); err != nil {
+			return line, nil, &rowError{line: line, err: &tools.ValidationError{Field: "labels", Message: "must be a JSON object of strings"}}
+		}
+	}
+	if d.parent >= 0 && record[d.parent] != "" {
+		parentId, err := strconv.Atoi(record[d.parent])
+		if err != nil {
+			return line, nil, &rowError{line: line, err: &tools.ValidationError{Field: "parent_id", Message: "must be an integer"}}
+		}
+		fed.ParentId = &parentId
+	}
+	return line, fed, nil
+}
+
+// importFederations stores the federations streamed in the body under
+// their own ids. the mode parameter says what happens to stored ids:
+// fail (default) reports them and stops the import, skip leaves them and
+// overwrite replaces them. rows imported before a stop stay imported.
+func (app *App) importFederations(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = tools.ImportFail
+	}
+	if mode != tools.ImportSkip && mode != tools.ImportOverwrite && mode != tools.ImportFail {
+		app.writeError(w, r, &tools.ValidationError{Field: "mode", Message: fmt.Sprintf("must be %s, %s or %s", tools.ImportSkip, tools.ImportOverwrite, tools.ImportFail)})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var dec federationDecoder
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case ndjsonType, "application/ndjson":
+		dec = &ndjsonDecoder{r: bufio.NewReader(r.Body)}
+	case csvType:
+		csvDec, err := newCsvDecoder(r.Body)
+		if err != nil {
+			app.writeImportError(w, r, err, 0)
+			return
+		}
+		dec = csvDec
+	default:
+		app.writeError(w, r, errUnsupportedImport)
+		return
+	}
+
+	report := importReport{Lines: []importLine{}}
+	for !report.Aborted {
+		line, fed, err := dec.next()
+		if err == io.EOF {
+			break
+		}
+
+		var outcome string
+		var invalid *rowError
+		switch {
+		case errors.As(err, &invalid):
+			// the report already has the line.
+			err = invalid.err
+		case err != nil:
+			app.writeImportError(w, r, err, line)
+			return
+		default:
+			outcome, err = tools.ImportFederation(r.Context(), app.Repository, fed, mode, app.OwnerTransfers)
+		}
+
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			app.writeError(w, r, ctxErr)
+			return
+		}
+
+		result := importLine{Line: line, Outcome: outcome}
+		if fed != nil {
+			result.Id = fed.Id
+		}
+		switch {
+		case err != nil:
+			var reported error
+			result.Outcome = importFailed
+			result.Status, reported = app.errorResponse(r, err)
+			result.Message, result.Errors = reported.Error(), violations(reported)
+			report.Failed++
+			report.Aborted = mode == tools.ImportFail
+		case outcome == tools.ImportCreated:
+			report.Created++
+		case outcome == tools.ImportUpdated:
+			report.Updated++
+		case outcome == tools.ImportUnchanged:
+			report.Unchanged++
+		default:
+			report.Skipped++
+		}
+		report.Lines = append(report.Lines, result)
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, report); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// writeImportError responds to an import body that could not be read.
+func (app *App) writeImportError(w http.ResponseWriter, r *http.Request, err error, line int) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeResponseAlias(app, w, http.StatusRequestEntityTooLarge, fmt.Errorf("%w after line %d", err, line))
+	case errors.Is(err, tools.ErrValidation):
+		app.writeError(w, r, err)
+	default:
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+	}
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// serveImport posts body to importFederations and returns the response
+// code and data.
+func serveImport(t *testing.T, sut *App, target, contentType, body string) (int, any) {
+	t.Helper()
+	receivedCode := 0
+	var receivedData any
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, _ ...http.Header) error {
+		receivedCode = code
+		receivedData = data
+		return nil
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+
+	sut.importFederations(w, r)
+	return receivedCode, receivedData
+}
+
+func importOutcomes(data any) []string {
+	report, ok := data.(importReport)
+	if !ok {
+		return nil
+	}
+	outcomes := make([]string, len(report.Lines))
+	for i, line := range report.Lines {
+		outcomes[i] = fmt.Sprintf("%d:%s", line.Line, line.Outcome)
+		if line.Status != 0 {
+			outcomes[i] += fmt.Sprintf(":%d", line.Status)
+		}
+	}
+	return outcomes
+}
+
+// test exportType(accept)
+// should pick the preferred supported media type
+func TestExportType(t *testing.T) {
+	// arrange
+	tests := []struct {
+		accept   string
+		wantType string
+		wantOk   bool
+	}{
+		{"", ndjsonType, true},
+		{"*/*", ndjsonType, true},
+		{"application/x-ndjson", ndjsonType, true},
+		{"text/csv", csvType, true},
+		{"application/x-ndjson;q=0.5, text/csv", csvType, true},
+		{"text/csv;q=0, */*;q=0.1", ndjsonType, true},
+		{"application/xml", "", false},
+	}
+
+	for _, tt := range tests {
+		// act
+		got, ok := exportType(tt.accept)
+
+		// assert
+		if got != tt.wantType || ok != tt.wantOk {
+			t.Fatalf("exportType(%q) = %q, %v want %q, %v", tt.accept, got, ok, tt.wantType, tt.wantOk)
+		}
+	}
+}
+
+// test exportFederations(w http.ResponseWriter, r *http.Request) as NDJSON
+// should stream every federation matching the filters, one per line
+func TestExportFederationsNdjson(t *testing.T) {
+	// arrange
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "alice"}, &api.Federation{Id: 2, Owner: "bob"}, &api.Federation{Id: 3, Owner: "alice"})
+	sut := NewApp(WithRepository(repo))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/export?owner=alice&limit=1", nil)
+	want := "{\"id\":1,\"owner\":\"alice\",\"version\":1}\n{\"id\":3,\"owner\":\"alice\",\"version\":1}\n"
+
+	// act
+	sut.exportFederations(w, r)
+
+	// assert
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != ndjsonType {
+		t.Fatalf("exportFederations(w, r) = %d, %q want %d, %q", w.Code, w.Header().Get("Content-Type"), http.StatusOK, ndjsonType)
+	}
+
+	if got := w.Body.String(); got != want {
+		t.Fatalf("exportFederations(w, r) = %q want %q", got, want)
+	}
+}
+
+// test exportFederations(w http.ResponseWriter, r *http.Request) as CSV
+// should stream every page of the repository after a header row
+func TestExportFederationsCsv(t *testing.T) {
+	// arrange
+	n := tools.MaxPageLimit + 5
+	federations := make([]*api.Federation, n)
+	for i := range federations {
+		federations[i] = &api.Federation{Id: i + 1, Owner: fmt.Sprintf("Owner, %d", i+1)}
+	}
+	sut := NewApp(WithRepository(tools.NewMockDb(federations...)))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/export", nil)
+	r.Header.Set("Accept", "text/csv")
+
+	// act
+	sut.exportFederations(w, r)
+	records, err := csv.NewReader(w.Body).ReadAll()
+
+	// assert
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != csvType {
+		t.Fatalf("exportFederations(w, r) = %d, %q want %d, %q", w.Code, w.Header().Get("Content-Type"), http.StatusOK, csvType)
+	}
+
+	if err != nil || len(records) != n+1 || !reflect.DeepEqual(records[0], csvColumns) {
+		t.Fatalf("exportFederations(w, r) = %d records, %v want a header and %d federations", len(records), err, n)
+	}
+
+	if last := records[n]; !reflect.DeepEqual(last, []string{fmt.Sprint(n), fmt.Sprintf("Owner, %d", n), "1", "", "", "", "", "", "", "", "", ""}) {
+		t.Fatalf("exportFederations(w, r) last record = %q want federation %d", last, n)
+	}
+}
+
+// test exportFederations(w http.ResponseWriter, r *http.Request) with failures
+// should respond the error before streaming starts
+func TestExportFederationsErrors(t *testing.T) {
+	// arrange
+	tests := []struct {
+		accept   string
+		target   string
+		wantCode int
+	}{
+		{"application/xml", "/federations/export", http.StatusNotAcceptable},
+		{"", "/federations/export?minId=one", http.StatusBadRequest},
+	}
+	writeResponseAlias = (*App).writeResponse
+
+	for _, tt := range tests {
+		sut := NewApp(WithRepository(tools.NewMockDb()))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.target, nil)
+		r.Header.Set("Accept", tt.accept)
+
+		// act
+		sut.exportFederations(w, r)
+
+		// assert
+		if w.Code != tt.wantCode {
+			t.Fatalf("exportFederations(%s, Accept %q) = %d want %d", tt.target, tt.accept, w.Code, tt.wantCode)
+		}
+	}
+}
+
+// test importFederations(w http.ResponseWriter, r *http.Request) in each mode
+// should import new rows, handle stored ids by mode and report every line
+func TestImportFederationsModes(t *testing.T) {
+	// arrange
+	body := `{"id":1,"owner":"changed"}
+
+{"id":5,"owner":"Owner 5","version":3}
+{"id":6}
+{"id":7,"owner":"Owner 7"}`
+	tests := []struct {
+		mode         string
+		wantOutcomes []string
+		wantOwner    string
+	}{
+		{"", []string{"1:failed:409"}, "Owner 1"},
+		{"skip", []string{"1:skipped", "3:created", "4:failed:400", "5:created"}, "Owner 1"},
+		{"overwrite", []string{"1:updated", "3:created", "4:failed:400", "5:created"}, "changed"},
+	}
+
+	for _, tt := range tests {
+		repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+		sut := NewApp(WithRepository(repo))
+
+		// act
+		code, data := serveImport(t, sut, "/federations/import?mode="+tt.mode, ndjsonType, body)
+
+		// assert
+		if code != http.StatusOK {
+			t.Fatalf("importFederations(mode %q) = %d want %d", tt.mode, code, http.StatusOK)
+		}
+
+		if outcomes := importOutcomes(data); !reflect.DeepEqual(outcomes, tt.wantOutcomes) {
+			t.Fatalf("importFederations(mode %q) = %v want %v", tt.mode, outcomes, tt.wantOutcomes)
+		}
+
+		if fed, _ := repo.GetFederation(context.Background(), 1); fed.Owner != tt.wantOwner {
+			t.Fatalf("GetFederation(1) = %v want %s", fed, tt.wantOwner)
+		}
+	}
+}
+
+// test importFederations(w http.ResponseWriter, r *http.Request) overwriting owners with owner transfers on
+// should fail the rows changing an owner with 422 and import the others
+func TestImportFederationsOwnerTransfers(t *testing.T) {
+	// arrange
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut := NewApp(WithRepository(repo), WithOwnerTransfers(true))
+	body := `{"id":1,"owner":"changed"}
+{"id":2,"owner":"Owner 2","name":"Two"}
+{"id":3,"owner":"Owner 3"}`
+	want := []string{"1:failed:422", "2:updated", "3:created"}
+
+	// act
+	code, data := serveImport(t, sut, "/federations/import?mode=overwrite", ndjsonType, body)
+
+	// assert
+	if outcomes := importOutcomes(data); code != http.StatusOK || !reflect.DeepEqual(outcomes, want) {
+		t.Fatalf("importFederations(overwrite) = %d, %v want %d, %v", code, outcomes, http.StatusOK, want)
+	}
+
+	if report := data.(importReport); len(report.Lines[0].Errors) != 1 || report.Lines[0].Errors[0].Field != "owner" {
+		t.Fatalf("importFederations(overwrite) line 1 = %+v want an owner violation", report.Lines[0])
+	}
+
+	if fed, _ := repo.GetFederation(context.Background(), 1); fed.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(1) = %v want owner Owner 1", fed)
+	}
+}
+
+// test importFederations(w http.ResponseWriter, r *http.Request) with CSV
+// should read the rows by header and report invalid ones with their line
+func TestImportFederationsCsv(t *testing.T) {
+	// arrange
+	repo := tools.NewMockDb()
+	sut := NewApp(WithRepository(repo))
+	body := "owner,id,version,labels,name\n\"Owner, 1\",1,4,\"{\"\"env\"\":\"\"prod\"\"}\",one\nOwner 2,two,1,,\nOwner 3,3\n\"Owner\n4\",4,1,,\nOwner 5,5,1,env=prod,\n"
+	want := importReport{Created: 2, Failed: 3, Lines: []importLine{
+		{Line: 2, Id: 1, Outcome: tools.ImportCreated},
+		{Line: 3, Outcome: importFailed, Status: http.StatusBadRequest, Message: "id must be an integer"},
+		{Line: 4, Outcome: importFailed, Status: http.StatusBadRequest, Message: "invalid: wrong number of fields"},
+		{Line: 5, Id: 4, Outcome: tools.ImportCreated},
+		{Line: 7, Outcome: importFailed, Status: http.StatusBadRequest, Message: "labels must be a JSON object of strings"},
+	}}
+
+	// act
+	code, data := serveImport(t, sut, "/federations/import?mode=skip", "text/csv; charset=utf-8", body)
+
+	// assert
+	if code != http.StatusOK || !reflect.DeepEqual(data, want) {
+		t.Fatalf("importFederations(csv) = %d, %+v want %+v", code, data, want)
+	}
+
+	if fed, _ := repo.GetFederation(context.Background(), 4); fed == nil || fed.Owner != "Owner\n4" {
+		t.Fatalf("GetFederation(4) = %v want the multi-line owner", fed)
+	}
+
+	if fed, _ := repo.GetFederation(context.Background(), 1); fed == nil || fed.Name != "one" || fed.Labels["env"] != "prod" {
+		t.Fatalf("GetFederation(1) = %v want the name and labels", fed)
+	}
+}
+
+// test importFederations(w http.ResponseWriter, r *http.Request) with CSV parents
+// should store the parents and fail rows with invalid or missing ones
+func TestImportFederationsCsvParents(t *testing.T) {
+	// arrange
+	repo := tools.NewMockDb()
+	sut := NewApp(WithRepository(repo))
+	body := "id,owner,parent_id\n1,Owner 1,\n2,Owner 2,1\n3,Owner 3,one\n4,Owner 4,7\n"
+
+	// act
+	code, data := serveImport(t, sut, "/federations/import?mode=skip", csvType, body)
+	report, _ := data.(importReport)
+
+	// assert
+	if code != http.StatusOK || report.Created != 2 || report.Failed != 2 {
+		t.Fatalf("importFederations(csv) = %d, %+v want 2 created and 2 failed", code, data)
+	}
+
+	if report.Lines[2].Status != http.StatusBadRequest || report.Lines[3].Status != http.StatusUnprocessableEntity {
+		t.Fatalf("importFederations(csv) lines = %+v want %d and %d", report.Lines[2:], http.StatusBadRequest, http.StatusUnprocessableEntity)
+	}
+
+	if fed, _ := repo.GetFederation(context.Background(), 2); fed == nil || fed.ParentId == nil || *fed.ParentId != 1 {
+		t.Fatalf("GetFederation(2) = %v want parent 1", fed)
+	}
+}
+
+// test importFederations(w http.ResponseWriter, r *http.Request) with an unusable request
+// should respond the error without importing
+func TestImportFederationsErrors(t *testing.T) {
+	// arrange
+	tests := []struct {
+		target      string
+		contentType string
+		body        string
+		wantCode    int
+	}{
+		{"/federations/import", "application/json", `{"id":1,"owner":"Owner 1"}`, http.StatusUnsupportedMediaType},
+		{"/federations/import?mode=merge", ndjsonType, `{"id":1,"owner":"Owner 1"}`, http.StatusBadRequest},
+		{"/federations/import", csvType, "id,name\n1,Owner 1\n", http.StatusBadRequest},
+		{"/federations/import", csvType, "id\n1\n", http.StatusBadRequest},
+		{"/federations/import", csvType, "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		repo := tools.NewMockDb()
+		sut := NewApp(WithRepository(repo))
+
+		// act
+		code, _ := serveImport(t, sut, tt.target, tt.contentType, tt.body)
+
+		// assert
+		if code != tt.wantCode {
+			t.Fatalf("importFederations(%s, %s) = %d want %d", tt.target, tt.contentType, code, tt.wantCode)
+		}
+
+		if page, _ := repo.GetFederations(context.Background(), tools.FederationQuery{}); page.Total != 0 {
+			t.Fatalf("importFederations(%s, %s) imported %v want nothing", tt.target, tt.contentType, page.Federations)
+		}
+	}
+}
+
+// test NewHandler() exporting from one app and importing into another
+// should copy every federation
+func TestNewHandlerExportImport(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	source := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 4, Owner: "Owner 4", Labels: map[string]string{"env": "prod"}}, &api.Federation{Id: 9, Owner: "Owner 9"}))).NewHandler()
+	targetRepo := tools.NewMockDb()
+	target := NewApp(WithRepository(targetRepo)).NewHandler()
+	exported := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/export", nil)
+	r.Header.Set("Authorization", "123456")
+	r.Header.Set("Accept", "text/csv")
+	source.ServeHTTP(exported, r)
+	w := httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/federations/import", exported.Body)
+	r.Header.Set("Authorization", "123456")
+	r.Header.Set("Content-Type", exported.Header().Get("Content-Type"))
+
+	// act
+	target.ServeHTTP(w, r)
+	var report importReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	page, _ := targetRepo.GetFederations(context.Background(), tools.FederationQuery{})
+
+	// assert
+	if w.Code != http.StatusOK || report.Created != 2 {
+		t.Fatalf("ServeHTTP(POST /federations/import) = %d, %s want 2 created", w.Code, w.Body)
+	}
+
+	if page.Total != 2 || page.Federations[0].Labels["env"] != "prod" || page.Federations[1].Owner != "Owner 9" {
+		t.Fatalf("GetFederations() = %v want the exported federations", page.Federations)
+	}
+}
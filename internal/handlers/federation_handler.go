@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"gorest/api"
 	"gorest/internal/tools"
@@ -11,7 +14,6 @@ import (
 
 var readJsonAlias = (*App).readJson
 var writeResponseAlias = (*App).writeResponse
-var repository = tools.NewFederationRepository
 
 func (app *App) addFederation(w http.ResponseWriter, r *http.Request) {
 	// read federation data from body
@@ -22,17 +24,26 @@ func (app *App) addFederation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// connect to repo
-	repo, err := repository()
+	// ids are assigned by the repository
+	if federation.Id != 0 {
+		if app.ClientIds == tools.ClientIdsReject {
+			app.writeError(w, r, clientIdAssigned("id"))
+			return
+		}
+		federation.Id = 0
+	}
+
+	// insert federation and respond
+	created, err := app.Repository.AddFederation(r.Context(), federation)
 	if err != nil {
-		tools.ErrorLogger.Println(err)
-		writeResponseAlias(app, w, http.StatusInternalServerError, errInternalServerError)
+		app.writeError(w, r, err)
 		return
 	}
 
-	// insert federation and respond
-	code, err := (*repo).AddFederation(federation)
-	if err := writeResponseAlias(app, w, code, err); err != nil {
+	header := http.Header{
+		"Location": {fmt.Sprintf("/federations/%d", created.Id)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusCreated, created, header); err != nil {
 		tools.ErrorLogger.Println(err)
 	}
 }
@@ -45,24 +56,16 @@ func (app *App) GetFederation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repo, err := repository()
+	fed, err := app.Repository.GetFederation(r.Context(), id)
 	if err != nil {
-		tools.ErrorLogger.Println(err)
-		writeResponseAlias(app, w, http.StatusInternalServerError, errInternalServerError)
-		return
-	}
-
-	fed := (*repo).GetFederation(id)
-	if fed == nil {
-		if err := writeResponseAlias(app, w, http.StatusNotFound, fmt.Errorf("federation %d not found", id)); err != nil {
-			tools.ErrorLogger.Println(err)
-		}
+		app.writeError(w, r, err)
 		return
 	}
 
 	// example on how to change response headers
 	header := http.Header{
 		"Content-Type": {"text/plain"},
+		"Etag":         {etag(fed.Version)},
 	}
 	if err := writeResponseAlias(app, w, http.StatusOK, fed, header); err != nil {
 		tools.ErrorLogger.Println(err)
@@ -70,15 +73,39 @@ func (app *App) GetFederation(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *App) getFederations(w http.ResponseWriter, r *http.Request) {
-	repo, err := repository()
+	query, err := parseFederationQuery(r)
 	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	page, err := app.Repository.GetFederations(r.Context(), query)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, page.Federations, pageHeaders(r, page)); err != nil {
 		tools.ErrorLogger.Println(err)
-		writeResponseAlias(app, w, http.StatusInternalServerError, errInternalServerError)
+	}
+}
+
+// searchFederations lists the federations whose owner contains q, best
+// matches first.
+func (app *App) searchFederations(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSearchQuery(r)
+	if err != nil {
+		app.writeError(w, r, err)
 		return
 	}
 
-	federations := (*repo).GetFederations()
-	if err := writeResponseAlias(app, w, http.StatusOK, federations); err != nil {
+	page, err := app.Repository.SearchFederations(r.Context(), query)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, page.Federations, listHeaders(r, page.Total, page.Next, page.Prev)); err != nil {
 		tools.ErrorLogger.Println(err)
 	}
 }
@@ -98,17 +125,95 @@ func (app *App) updateFederation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, err := app.ifMatchVersion(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if version, err = app.keepOwner(r.Context(), id, version, fed.Owner); err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
 	fed.Id = id
+	fed.Version = version
 
-	repo, err := repository()
+	updated, err := app.Repository.UpdateFederation(r.Context(), fed)
 	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	header := http.Header{
+		"Etag": {etag(updated.Version)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusOK, updated, header); err != nil {
 		tools.ErrorLogger.Println(err)
-		writeResponseAlias(app, w, http.StatusInternalServerError, errInternalServerError)
+	}
+}
+
+// patch media types accepted by patchFederation.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// errUnsupportedPatch is returned for PATCH bodies of other media types.
+var errUnsupportedPatch = fmt.Errorf("patch must be %s or %s", mergePatchType, jsonPatchType)
+
+func (app *App) patchFederation(w http.ResponseWriter, r *http.Request) {
+	var parse func([]byte) (tools.FederationPatch, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mergePatchType:
+		parse = tools.ParseMergePatch
+	case jsonPatchType:
+		parse = tools.ParseJSONPatch
+	default:
+		app.writeError(w, r, errUnsupportedPatch)
 		return
 	}
 
-	code, err := (*repo).UpdateFederation(fed)
-	if err := writeResponseAlias(app, w, code, err); err != nil {
+	var body json.RawMessage
+	if err := readJsonAlias(app, w, r, &body); err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	version, err := app.ifMatchVersion(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	patch, err := parse(body)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+	if app.OwnerTransfers {
+		patch = tools.KeepOwner(patch)
+	}
+
+	patched, err := app.Repository.PatchFederation(r.Context(), id, version, patch)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	header := http.Header{
+		"Etag": {etag(patched.Version)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusOK, patched, header); err != nil {
 		tools.ErrorLogger.Println(err)
 	}
 }
@@ -121,15 +226,117 @@ func (app *App) deleteFederation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repo, err := repository()
+	version, err := app.ifMatchVersion(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := app.Repository.DeleteFederation(r.Context(), id, version); err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+	if err := writeResponseAlias(app, w, http.StatusOK, nil); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// federationAction serves the custom methods called as
+// POST /federations/{id}:<action>. the id path value is left without the
+// action for the handler.
+func (app *App) federationAction(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(r.PathValue("id"), ":")
+	r.SetPathValue("id", id)
+
+	switch {
+	case action == "restore":
+		app.restoreFederation(w, r)
+	case tools.IsTransition(action):
+		app.transitionFederation(w, r, action)
+	default:
+		app.writeError(w, r, fmt.Errorf("unknown action %q: %w", action, tools.ErrNotFound))
+	}
+}
+
+func (app *App) restoreFederation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		tools.ErrorLogger.Println(err)
-		writeResponseAlias(app, w, http.StatusInternalServerError, errInternalServerError)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	version, err := app.ifMatchVersion(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	restored, err := app.Repository.RestoreFederation(r.Context(), id, version)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	header := http.Header{
+		"Etag": {etag(restored.Version)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusOK, restored, header); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// transitionFederation runs the lifecycle action, answering 409 with the
+// current state when the state does not allow it.
+func (app *App) transitionFederation(w http.ResponseWriter, r *http.Request, action string) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	version, err := app.ifMatchVersion(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	moved, err := app.Repository.TransitionFederation(r.Context(), id, version, action)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	header := http.Header{
+		"Etag": {etag(moved.Version)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusOK, moved, header); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) getFederationHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	query, err := parseHistoryQuery(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	page, err := app.Repository.GetHistory(r.Context(), id, query)
+	if err != nil {
+		app.writeError(w, r, err)
 		return
 	}
 
-	code, err := (*repo).DeleteFederation(id)
-	if err := writeResponseAlias(app, w, code, err); err != nil {
+	if err := writeResponseAlias(app, w, http.StatusOK, page.Changes, historyHeaders(r, page)); err != nil {
 		tools.ErrorLogger.Println(err)
 	}
 }
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -57,57 +60,11 @@ func TestAddFederationReadError(t *testing.T) {
 	}
 }
 
-// test addFederation(w http.ResponseWriter, r *http.Request) Repository connection error
-// should call repostory, log and respond error
-func TestAddFederationRepoError(t *testing.T) {
-	// arrange
-	sut := NewApp()
-	called := false
-	var receivedError error
-	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
-		return nil
-	}
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
-		receivedError = data.(error)
-		return nil
-	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		return nil, errors.New("test error")
-	}
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest("POST", "/", nil)
-	defer func() {
-		tools.ErrorLogger.SetOutput(os.Stderr)
-	}()
-	var errBuf bytes.Buffer
-	tools.ErrorLogger.SetOutput(&errBuf)
-	wantLog := regexp.MustCompile("test error")
-	wantErrorMessage := "internal server error"
-
-	// act
-	sut.addFederation(w, r)
-
-	// assert
-	if !called {
-		t.Fatalf("addFederation(w, r) = %v want %v", called, true)
-	}
-
-	errOutput := errBuf.String()
-	if !wantLog.MatchString(errOutput) {
-		t.Fatalf("addFederation(w, r) = %q want %q", errOutput, wantLog)
-	}
-
-	if receivedError.Error() != wantErrorMessage {
-		t.Fatalf("addFederation(w, r) = %q want %q", receivedError, wantErrorMessage)
-	}
-}
-
 // test addFederation(w http.ResponseWriter, r *http.Request) respository insert error
 // should respond error
 func TestAddFederationInsertError(t *testing.T) {
 	// arange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedError error
 	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
@@ -118,11 +75,7 @@ func TestAddFederationInsertError(t *testing.T) {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		FederationRepositoryMockReturnCode = 400
-		FederationRepositoryMockReturnError = errors.New("test error")
-		return NewFederationRepositoryMock(), nil
-	}
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: tools.ErrAlreadyExists}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", "/", nil)
 	defer func() {
@@ -130,7 +83,7 @@ func TestAddFederationInsertError(t *testing.T) {
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := "test error"
+	wantErrorMessage := "federation 1 already exists"
 
 	// act
 	sut.addFederation(w, r)
@@ -154,7 +107,7 @@ func TestAddFederationInsertError(t *testing.T) {
 // should call respond and log error
 func TestAddFederationInsertErrorRespondError(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedError error
 	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
@@ -165,11 +118,7 @@ func TestAddFederationInsertErrorRespondError(t *testing.T) {
 		receivedError = data.(error)
 		return errors.New("test error 2")
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		FederationRepositoryMockReturnCode = 400
-		FederationRepositoryMockReturnError = errors.New("test error")
-		return NewFederationRepositoryMock(), nil
-	}
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: tools.ErrAlreadyExists}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", "/", nil)
 	defer func() {
@@ -177,7 +126,7 @@ func TestAddFederationInsertErrorRespondError(t *testing.T) {
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := "test error"
+	wantErrorMessage := "federation 1 already exists"
 	wantLog := regexp.MustCompile("test error 2")
 
 	// act
@@ -199,15 +148,15 @@ func TestAddFederationInsertErrorRespondError(t *testing.T) {
 }
 
 // test addFederation(w http.ResponseWriter, r *http.Request) insert success
-// should insert federation and respond created
+// should ignore the client id, insert federation and respond created with its location
 func TestAddFederationSuccess(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedData any
+	var receivedHeaders []http.Header
 	receivedCode := 0
 	federation := api.Federation{
-		Id:    1,
 		Owner: "Test",
 	}
 	readJsonAlias = func(_ *App, _ http.ResponseWriter, _ *http.Request, data any) error {
@@ -216,21 +165,20 @@ func TestAddFederationSuccess(t *testing.T) {
 		u.Owner = federation.Owner
 		return nil
 	}
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, _ ...http.Header) error {
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, headers ...http.Header) error {
 		called = true
 		receivedCode = code
 		receivedData = data
+		receivedHeaders = headers
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnCode = 201
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", "/", nil)
 	wantCode := 201
+	wantFederation := api.Federation{Id: 3, Owner: "Test"}
+	wantLocation := "/federations/3"
 
 	// act
 	sut.addFederation(w, r)
@@ -240,7 +188,7 @@ func TestAddFederationSuccess(t *testing.T) {
 		t.Fatalf("addFederation(w, r) = %v want %v", called, true)
 	}
 
-	if *FederationRepositoryMockReturnReceivedFed != federation {
+	if !reflect.DeepEqual(*FederationRepositoryMockReturnReceivedFed, federation) {
 		t.Fatalf("addFederation(w, r) = %v want %v", *FederationRepositoryMockReturnReceivedFed, federation)
 	}
 
@@ -248,55 +196,58 @@ func TestAddFederationSuccess(t *testing.T) {
 		t.Fatalf("addFederation(w, r) = %d want %d", receivedCode, wantCode)
 	}
 
-	if receivedData != nil {
-		t.Fatalf("addFederation(w, r) = %v want <nil>", receivedData)
+	if created, ok := receivedData.(*api.Federation); !ok || !reflect.DeepEqual(*created, wantFederation) {
+		t.Fatalf("addFederation(w, r) = %v want %v", receivedData, wantFederation)
+	}
+
+	if len(receivedHeaders) != 1 || receivedHeaders[0].Get("Location") != wantLocation {
+		t.Fatalf("addFederation(w, r) = %v want Location %q", receivedHeaders, wantLocation)
 	}
 }
 
-// test getFederation(w http.ResponseWriter, r *http.Request) Repository connection error
-// should call repostory, log and respond error
-func TestGetFederationBadUrlParam(t *testing.T) {
+// test addFederation(w http.ResponseWriter, r *http.Request) with client id when rejected
+// should respond unprocessable entity without calling the repository
+func TestAddFederationRejectClientId(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()), WithClientIds(tools.ClientIdsReject))
+	receivedCode := 0
 	var receivedError error
-	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
+	readJsonAlias = func(_ *App, _ http.ResponseWriter, _ *http.Request, data any) error {
+		data.(*api.Federation).Id = 7
 		return nil
 	}
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, _ ...http.Header) error {
+		receivedCode = code
 		receivedError = data.(error)
 		return nil
 	}
+	ResetFederationRepositoryMock()
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest("GET", "/federations/abc", nil)
-	r.SetPathValue("id", "abc")
-	defer func() {
-		tools.ErrorLogger.SetOutput(os.Stderr)
-	}()
-	var errBuf bytes.Buffer
-	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := `strconv.Atoi: parsing "abc": invalid syntax`
-	wantLog := regexp.MustCompile(wantErrorMessage)
+	r := httptest.NewRequest("POST", "/", nil)
+	wantErrorMessage := "id is assigned by the server"
 
 	// act
-	sut.GetFederation(w, r)
+	sut.addFederation(w, r)
 
 	// assert
-	errOutput := errBuf.String()
-	if !wantLog.MatchString(errOutput) {
-		t.Fatalf("getFederation(w, r) = %q want %q", errOutput, wantLog)
+	if receivedCode != http.StatusUnprocessableEntity {
+		t.Fatalf("addFederation(w, r) = %d want %d", receivedCode, http.StatusUnprocessableEntity)
 	}
 
 	if receivedError.Error() != wantErrorMessage {
-		t.Fatalf("getFederation(w, r) = %q want %q", receivedError, wantErrorMessage)
+		t.Fatalf("addFederation(w, r) = %q want %q", receivedError, wantErrorMessage)
+	}
+
+	if FederationRepositoryMockReturnReceivedFed != nil {
+		t.Fatalf("addFederation(w, r) = %v want repository not called", FederationRepositoryMockReturnReceivedFed)
 	}
 }
 
 // test getFederation(w http.ResponseWriter, r *http.Request) Repository connection error
 // should call repostory, log and respond error
-func TestGetFederationRepoError(t *testing.T) {
+func TestGetFederationBadUrlParam(t *testing.T) {
 	// arrange
 	sut := NewApp()
-	called := false
 	var receivedError error
 	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
 		return nil
@@ -305,29 +256,21 @@ func TestGetFederationRepoError(t *testing.T) {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		return nil, errors.New("test error")
-	}
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest("GET", "/federations/1", nil)
-	r.SetPathValue("id", "1")
+	r := httptest.NewRequest("GET", "/federations/abc", nil)
+	r.SetPathValue("id", "abc")
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantLog := regexp.MustCompile("test error")
-	wantErrorMessage := "internal server error"
+	wantErrorMessage := `strconv.Atoi: parsing "abc": invalid syntax`
+	wantLog := regexp.MustCompile(wantErrorMessage)
 
 	// act
 	sut.GetFederation(w, r)
 
 	// assert
-	if !called {
-		t.Fatalf("getFederation(w, r) = %v want %v", called, true)
-	}
-
 	errOutput := errBuf.String()
 	if !wantLog.MatchString(errOutput) {
 		t.Fatalf("getFederation(w, r) = %q want %q", errOutput, wantLog)
@@ -342,19 +285,14 @@ func TestGetFederationRepoError(t *testing.T) {
 // should call repostory, and log error
 func TestGetFederationRepoNilRespondError(t *testing.T) {
 	// arrange
-	sut := NewApp()
-	called := false
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	var receivedError error
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
 		receivedError = data.(error)
 		return errors.New("test error")
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/federations/3", nil)
 	r.SetPathValue("id", "3")
@@ -370,10 +308,6 @@ func TestGetFederationRepoNilRespondError(t *testing.T) {
 	sut.GetFederation(w, r)
 
 	// assert
-	if !called {
-		t.Fatalf("getFederation(w, r) = %v want %v", called, true)
-	}
-
 	errOutput := errBuf.String()
 	if !wantLog.MatchString(errOutput) {
 		t.Fatalf("getFederation(w, r) = %q want %q", errOutput, wantLog)
@@ -388,19 +322,14 @@ func TestGetFederationRepoNilRespondError(t *testing.T) {
 // should call repostory, and return not found response
 func TestGetFederationRepoNil(t *testing.T) {
 	// arrange
-	sut := NewApp()
-	called := false
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	var receivedError error
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/federations/3", nil)
 	r.SetPathValue("id", "3")
@@ -410,10 +339,6 @@ func TestGetFederationRepoNil(t *testing.T) {
 	sut.GetFederation(w, r)
 
 	// assert
-	if !called {
-		t.Fatalf("getFederation(w, r) = %v want %v", called, true)
-	}
-
 	if receivedError.Error() != wantErrorMessage {
 		t.Fatalf("getFederation(w, r) = %q want %q", receivedError, wantErrorMessage)
 	}
@@ -423,15 +348,12 @@ func TestGetFederationRepoNil(t *testing.T) {
 // should call repostory, and log error
 func TestGetFederationErrorResponding(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, _ any, _ ...http.Header) error {
 		return errors.New("test error")
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/federations/1", nil)
 	r.SetPathValue("id", "1")
@@ -455,7 +377,7 @@ func TestGetFederationErrorResponding(t *testing.T) {
 // should return federation
 func TestGetFederationSuccess(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	receivedFederation := new(api.Federation)
 	wantFederation := api.Federation{
 		Id:    1,
@@ -465,11 +387,8 @@ func TestGetFederationSuccess(t *testing.T) {
 		receivedFederation = data.(*api.Federation)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/federations/1", nil)
 	r.SetPathValue("id", "1")
@@ -477,67 +396,21 @@ func TestGetFederationSuccess(t *testing.T) {
 	// act
 	sut.GetFederation(w, r)
 
-	if *receivedFederation != wantFederation {
+	if !reflect.DeepEqual(*receivedFederation, wantFederation) {
 		t.Fatalf("getFederation(w, r) = %v want %v", *receivedFederation, wantFederation)
 	}
 }
 
-// test getFederations(w http.ResponseWriter, r *http.Request) Repository connection error
-// should call repostory, log and respond error
-func TestGetFederationsRepoError(t *testing.T) {
-	// arrange
-	sut := NewApp()
-	called := false
-	var receivedError error
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
-		receivedError = data.(error)
-		return nil
-	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		return nil, errors.New("test error")
-	}
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest("GET", "/", nil)
-	defer func() {
-		tools.ErrorLogger.SetOutput(os.Stderr)
-	}()
-	var errBuf bytes.Buffer
-	tools.ErrorLogger.SetOutput(&errBuf)
-	wantLog := regexp.MustCompile("test error")
-	wantErrorMessage := "internal server error"
-
-	// act
-	sut.getFederations(w, r)
-
-	// assert
-	if !called {
-		t.Fatalf("getFederations(w, r) = %v want %v", called, true)
-	}
-
-	errOutput := errBuf.String()
-	if !wantLog.MatchString(errOutput) {
-		t.Fatalf("getFederations(w, r) = %q want %q", errOutput, wantLog)
-	}
-
-	if receivedError.Error() != wantErrorMessage {
-		t.Fatalf("getFederations(w, r) = %q want %q", receivedError, wantErrorMessage)
-	}
-}
-
 // test getFederations(w http.ResponseWriter, r *http.Request) Error reponding
 // should call repostory, and log error
 func TestGetFederationsErrorResponding(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, _ any, _ ...http.Header) error {
 		return errors.New("test error")
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	body := strings.NewReader("")
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/", body)
@@ -564,7 +437,7 @@ func TestGetFederationsSuccess(t *testing.T) {
 		return nil
 	}
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	var receivedFederations []*api.Federation
 	wantFederations := []api.Federation{
 		{Id: 1, Owner: "Owner 1"},
@@ -574,11 +447,8 @@ func TestGetFederationsSuccess(t *testing.T) {
 		receivedFederations = data.([]*api.Federation)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/", nil)
 
@@ -590,81 +460,134 @@ func TestGetFederationsSuccess(t *testing.T) {
 	}
 
 	for i, v := range wantFederations {
-		if *receivedFederations[i] != v {
+		if !reflect.DeepEqual(*receivedFederations[i], v) {
 			t.Fatalf("getFederations(w, r) = %v want %v", *receivedFederations[i], v)
 		}
 	}
 }
 
-// test updateFederation(w http.ResponseWriter, r *http.Request) read error
-// should call readJson, log and respond error
-func TestUpdateFederationReadError(t *testing.T) {
+// test getFederations(w http.ResponseWriter, r *http.Request) with cancelled request
+// should respond client closed request and log warning
+func TestGetFederationsCancelled(t *testing.T) {
 	// arrange
-	sut := NewApp()
-	called := false
-	var receivedError error
-	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
-		called = true
-		return errors.New("test error")
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedCode int
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
 	}
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
-		receivedError = data.(error)
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = context.Canceled
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations", nil)
+	defer func() {
+		tools.WarningLogger.SetOutput(os.Stdout)
+		ResetFederationRepositoryMock()
+	}()
+	var warnBuf bytes.Buffer
+	tools.WarningLogger.SetOutput(&warnBuf)
+	wantLog := regexp.MustCompile("request cancelled: GET /federations: context canceled")
+
+	// act
+	sut.getFederations(w, r)
+
+	// assert
+	if receivedCode != StatusClientClosedRequest {
+		t.Fatalf("getFederations(w, r) = %d want %d", receivedCode, StatusClientClosedRequest)
+	}
+
+	warnOutput := warnBuf.String()
+	if !wantLog.MatchString(warnOutput) {
+		t.Fatalf("getFederations(w, r) = %q want %q", warnOutput, wantLog)
+	}
+}
+
+// test getFederation(w http.ResponseWriter, r *http.Request) with expired deadline
+// should respond gateway timeout
+func TestGetFederationDeadlineExceeded(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedCode int
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
 		return nil
 	}
-	r := httptest.NewRequest("PUT", "/federations/1", nil)
-	r.SetPathValue("id", "1")
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = context.DeadlineExceeded
 	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/1", nil)
+	r.SetPathValue("id", "1")
 	defer func() {
-		tools.ErrorLogger.SetOutput(os.Stderr)
+		tools.WarningLogger.SetOutput(os.Stdout)
+		ResetFederationRepositoryMock()
 	}()
-	var errBuf bytes.Buffer
-	tools.ErrorLogger.SetOutput(&errBuf)
-	wantLog := regexp.MustCompile("test error")
-	wantErrorMessage := "test error"
+	tools.WarningLogger.SetOutput(&bytes.Buffer{})
 
 	// act
-	sut.updateFederation(w, r)
+	sut.GetFederation(w, r)
 
 	// assert
-	if !called {
-		t.Fatalf("updateFederation(w, r) = %v want %v", called, true)
+	if receivedCode != http.StatusGatewayTimeout {
+		t.Fatalf("GetFederation(w, r) = %d want %d", receivedCode, http.StatusGatewayTimeout)
 	}
+}
 
-	errOutput := errBuf.String()
-	if !wantLog.MatchString(errOutput) {
-		t.Fatalf("updateFederation(w, r) = %q want %q", errOutput, wantLog)
+// test deleteFederation(w http.ResponseWriter, r *http.Request) with cancelled request
+// should respond client closed request
+func TestDeleteFederationCancelled(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedCode int
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
 	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = context.Canceled
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("DELETE", "/federations/1", nil)
+	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
+	defer func() {
+		tools.WarningLogger.SetOutput(os.Stdout)
+		ResetFederationRepositoryMock()
+	}()
+	tools.WarningLogger.SetOutput(&bytes.Buffer{})
 
-	if receivedError.Error() != wantErrorMessage {
-		t.Fatalf("updateFederation(w, r) = %q want %q", receivedError, wantErrorMessage)
+	// act
+	sut.deleteFederation(w, r)
+
+	// assert
+	if receivedCode != StatusClientClosedRequest {
+		t.Fatalf("deleteFederation(w, r) = %d want %d", receivedCode, StatusClientClosedRequest)
 	}
 }
 
-// test updateFederation(w http.ResponseWriter, r *http.Request) url param parse error
-// should call readJson, log and respond url param error
-func TestUpdateFederationUrlParamError(t *testing.T) {
+// test updateFederation(w http.ResponseWriter, r *http.Request) read error
+// should call readJson, log and respond error
+func TestUpdateFederationReadError(t *testing.T) {
 	// arrange
 	sut := NewApp()
 	called := false
 	var receivedError error
 	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
 		called = true
-		return nil
+		return errors.New("test error")
 	}
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
 		receivedError = data.(error)
 		return nil
 	}
-	r := httptest.NewRequest("PUT", "/federations/abc", nil)
-	r.SetPathValue("id", "abc")
+	r := httptest.NewRequest("PUT", "/federations/1", nil)
+	r.SetPathValue("id", "1")
 	w := httptest.NewRecorder()
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := `strconv.Atoi: parsing "abc": invalid syntax`
-	wantLog := regexp.MustCompile(wantErrorMessage)
+	wantLog := regexp.MustCompile("test error")
+	wantErrorMessage := "test error"
 
 	// act
 	sut.updateFederation(w, r)
@@ -684,34 +607,31 @@ func TestUpdateFederationUrlParamError(t *testing.T) {
 	}
 }
 
-// test updateFederation(w http.ResponseWriter, r *http.Request) Repository connection error
-// should call repostory, log and respond error
-func TestUpdateFederationRepoError(t *testing.T) {
+// test updateFederation(w http.ResponseWriter, r *http.Request) url param parse error
+// should call readJson, log and respond url param error
+func TestUpdateFederationUrlParamError(t *testing.T) {
 	// arrange
 	sut := NewApp()
 	called := false
 	var receivedError error
 	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
+		called = true
 		return nil
 	}
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		return nil, errors.New("test error")
-	}
+	r := httptest.NewRequest("PUT", "/federations/abc", nil)
+	r.SetPathValue("id", "abc")
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest("PUT", "/federations/1", nil)
-	r.SetPathValue("id", "1")
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantLog := regexp.MustCompile("test error")
-	wantErrorMessage := "internal server error"
+	wantErrorMessage := `strconv.Atoi: parsing "abc": invalid syntax`
+	wantLog := regexp.MustCompile(wantErrorMessage)
 
 	// act
 	sut.updateFederation(w, r)
@@ -735,7 +655,7 @@ func TestUpdateFederationRepoError(t *testing.T) {
 // should respond error
 func TestUpdateFederationUpdateError(t *testing.T) {
 	// arange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedError error
 	readJsonAlias = func(*App, http.ResponseWriter, *http.Request, any) error {
@@ -746,20 +666,17 @@ func TestUpdateFederationUpdateError(t *testing.T) {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		FederationRepositoryMockReturnCode = 404
-		FederationRepositoryMockReturnError = errors.New("test error")
-		return NewFederationRepositoryMock(), nil
-	}
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: tools.ErrNotFound}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("PUT", "/federations/1", nil)
 	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := "test error"
+	wantErrorMessage := "federation 1 not found"
 
 	// act
 	sut.updateFederation(w, r)
@@ -783,7 +700,7 @@ func TestUpdateFederationUpdateError(t *testing.T) {
 // should call respond and log error
 func TestUpdateFederationUpdateErrorRespondError(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedError error
 	federation := api.Federation{
@@ -801,20 +718,17 @@ func TestUpdateFederationUpdateErrorRespondError(t *testing.T) {
 		receivedError = data.(error)
 		return errors.New("test error 2")
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		FederationRepositoryMockReturnCode = 404
-		FederationRepositoryMockReturnError = errors.New("test error")
-		return NewFederationRepositoryMock(), nil
-	}
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: tools.ErrNotFound}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("PUT", "/federations/1", nil)
 	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := "test error"
+	wantErrorMessage := "federation 1 not found"
 	wantLog := regexp.MustCompile("test error 2")
 
 	// act
@@ -839,9 +753,10 @@ func TestUpdateFederationUpdateErrorRespondError(t *testing.T) {
 // should call update federation and respond success
 func TestUpdateFederationSuccess(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedData any
+	var receivedHeaders []http.Header
 	receivedCode := 0
 	federation := api.Federation{
 		Id:    3,
@@ -853,22 +768,21 @@ func TestUpdateFederationSuccess(t *testing.T) {
 		u.Owner = federation.Owner
 		return nil
 	}
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, _ ...http.Header) error {
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, headers ...http.Header) error {
 		called = true
 		receivedCode = code
 		receivedData = data
+		receivedHeaders = headers
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnCode = 200
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("PUT", "/federations/1", nil)
 	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
 	wantCode := 200
+	wantFederation := api.Federation{Id: 1, Owner: "Test", Version: 2}
 
 	// act
 	sut.updateFederation(w, r)
@@ -882,8 +796,16 @@ func TestUpdateFederationSuccess(t *testing.T) {
 		t.Fatalf("updateFederation(w, r) = %d want %d", receivedCode, wantCode)
 	}
 
-	if receivedData != nil {
-		t.Fatalf("updateFederation(w, r) = %v want <nil>", receivedData)
+	if updated, ok := receivedData.(*api.Federation); !ok || !reflect.DeepEqual(*updated, wantFederation) {
+		t.Fatalf("updateFederation(w, r) = %v want %v", receivedData, wantFederation)
+	}
+
+	if FederationRepositoryMockReturnReceivedFed.Version != 1 {
+		t.Fatalf("updateFederation(w, r) = version %d want 1", FederationRepositoryMockReturnReceivedFed.Version)
+	}
+
+	if len(receivedHeaders) != 1 || receivedHeaders[0].Get("ETag") != `"2"` {
+		t.Fatalf("updateFederation(w, r) = %v want ETag %q", receivedHeaders, `"2"`)
 	}
 }
 
@@ -897,9 +819,6 @@ func TestDeleteFederationUrlParamError(t *testing.T) {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		return nil, errors.New("test error")
-	}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("DELETE", "/federations/abc", nil)
 	r.SetPathValue("id", "abc")
@@ -925,55 +844,11 @@ func TestDeleteFederationUrlParamError(t *testing.T) {
 	}
 }
 
-// test deleteFederation(w http.ResponseWriter, r *http.Request) Repository connection error
-// should call repostory, log and respond error
-func TestDeleteFederationRepoError(t *testing.T) {
-	// arrange
-	sut := NewApp()
-	called := false
-	var receivedError error
-	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
-		receivedError = data.(error)
-		return nil
-	}
-	repository = func() (*tools.FederationRepository, error) {
-		called = true
-		return nil, errors.New("test error")
-	}
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest("DELETE", "/federations/3", nil)
-	r.SetPathValue("id", "3")
-	defer func() {
-		tools.ErrorLogger.SetOutput(os.Stderr)
-	}()
-	var errBuf bytes.Buffer
-	tools.ErrorLogger.SetOutput(&errBuf)
-	wantLog := regexp.MustCompile("test error")
-	wantErrorMessage := "internal server error"
-
-	// act
-	sut.deleteFederation(w, r)
-
-	// assert
-	if !called {
-		t.Fatalf("deleteFederation(w, r) = %v want %v", called, true)
-	}
-
-	errOutput := errBuf.String()
-	if !wantLog.MatchString(errOutput) {
-		t.Fatalf("deleteFederation(w, r) = %q want %q", errOutput, wantLog)
-	}
-
-	if receivedError.Error() != wantErrorMessage {
-		t.Fatalf("deleteFederation(w, r) = %q want %q", receivedError, wantErrorMessage)
-	}
-}
-
 // test deleteFederation(w http.ResponseWriter, r *http.Request) respository delete error
 // should respond error
 func TestDeleteFederationDeleteError(t *testing.T) {
 	// arange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedError error
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
@@ -981,20 +856,17 @@ func TestDeleteFederationDeleteError(t *testing.T) {
 		receivedError = data.(error)
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		FederationRepositoryMockReturnCode = 404
-		FederationRepositoryMockReturnError = errors.New("test error")
-		return NewFederationRepositoryMock(), nil
-	}
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: tools.ErrNotFound}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("DELETE", "/federations/1", nil)
 	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := "test error"
+	wantErrorMessage := "federation 1 not found"
 
 	// act
 	sut.deleteFederation(w, r)
@@ -1018,7 +890,7 @@ func TestDeleteFederationDeleteError(t *testing.T) {
 // should call respond and log error
 func TestDeleteFederationDeleteErrorRespondError(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedError error
 	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, data any, _ ...http.Header) error {
@@ -1026,20 +898,17 @@ func TestDeleteFederationDeleteErrorRespondError(t *testing.T) {
 		receivedError = data.(error)
 		return errors.New("test error 2")
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		FederationRepositoryMockReturnCode = 404
-		FederationRepositoryMockReturnError = errors.New("test error")
-		return NewFederationRepositoryMock(), nil
-	}
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: tools.ErrNotFound}
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("DELETE", "/federations/1", nil)
 	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
 	defer func() {
 		tools.ErrorLogger.SetOutput(os.Stderr)
 	}()
 	var errBuf bytes.Buffer
 	tools.ErrorLogger.SetOutput(&errBuf)
-	wantErrorMessage := "test error"
+	wantErrorMessage := "federation 1 not found"
 	wantLog := regexp.MustCompile("test error 2")
 
 	// act
@@ -1064,7 +933,7 @@ func TestDeleteFederationDeleteErrorRespondError(t *testing.T) {
 // should call delete federation and respond success
 func TestDeleteFederationSuccess(t *testing.T) {
 	// arrange
-	sut := NewApp()
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
 	called := false
 	var receivedData any
 	receivedCode := 0
@@ -1074,15 +943,12 @@ func TestDeleteFederationSuccess(t *testing.T) {
 		receivedData = data
 		return nil
 	}
-	repository = func() (*tools.FederationRepository, error) {
-		ResetFederationRepositoryMock()
-		FederationRepositoryMockReturnCode = 200
-		FederationRepositoryMockReturnError = nil
-		return NewFederationRepositoryMock(), nil
-	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = nil
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("DELETE", "/federations/1", nil)
 	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"1"`)
 	wantCode := 200
 
 	// act
@@ -1101,3 +967,299 @@ func TestDeleteFederationSuccess(t *testing.T) {
 		t.Fatalf("deleteFederation(w, r) = %v want <nil>", receivedData)
 	}
 }
+
+// test restoreFederation(w http.ResponseWriter, r *http.Request) Restore error
+// should respond the mapped repository error
+func TestRestoreFederationNotDeleted(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	receivedCode := 0
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	FederationRepositoryMockReturnError = &tools.FederationError{Id: 1, Err: fmt.Errorf("%w: not deleted", tools.ErrConflict)}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/federations/1:restore", nil)
+	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"2"`)
+
+	// act
+	sut.restoreFederation(w, r)
+
+	// assert
+	if receivedCode != http.StatusConflict {
+		t.Fatalf("restoreFederation(w, r) = %d want %d", receivedCode, http.StatusConflict)
+	}
+}
+
+// test restoreFederation(w http.ResponseWriter, r *http.Request)
+// should respond the restored federation and its ETag
+func TestRestoreFederationSuccess(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	receivedCode := 0
+	var receivedData any
+	var receivedHeaders []http.Header
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, headers ...http.Header) error {
+		receivedCode = code
+		receivedData = data
+		receivedHeaders = headers
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/federations/1:restore", nil)
+	r.SetPathValue("id", "1")
+	r.Header.Set("If-Match", `"2"`)
+	want := api.Federation{Id: 1, Owner: "Owner 1", Version: 3}
+
+	// act
+	sut.restoreFederation(w, r)
+
+	// assert
+	if receivedCode != http.StatusOK {
+		t.Fatalf("restoreFederation(w, r) = %d want %d", receivedCode, http.StatusOK)
+	}
+
+	if restored, ok := receivedData.(*api.Federation); !ok || !reflect.DeepEqual(*restored, want) {
+		t.Fatalf("restoreFederation(w, r) = %v want %v", receivedData, want)
+	}
+
+	if len(receivedHeaders) != 1 || receivedHeaders[0].Get("ETag") != `"3"` {
+		t.Fatalf("restoreFederation(w, r) = %v want ETag %q", receivedHeaders, `"3"`)
+	}
+}
+
+// test patchFederation(w http.ResponseWriter, r *http.Request) with another media type
+// should respond 415
+func TestPatchFederationUnsupportedMediaType(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	receivedCode := 0
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PATCH", "/federations/1", strings.NewReader(`{"owner":"new owner"}`))
+	r.SetPathValue("id", "1")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("If-Match", `"1"`)
+
+	// act
+	sut.patchFederation(w, r)
+
+	// assert
+	if receivedCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("patchFederation(w, r) = %d want %d", receivedCode, http.StatusUnsupportedMediaType)
+	}
+
+	if FederationRepositoryMockReceivedPatch != nil {
+		t.Fatalf("patchFederation(w, r) = %v want no repository call", FederationRepositoryMockReceivedPatch)
+	}
+}
+
+// test patchFederation(w http.ResponseWriter, r *http.Request) with a malformed patch
+// should respond 400
+func TestPatchFederationInvalidPatch(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	receivedCode := 0
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
+	}
+	readJsonAlias = (*App).readJson
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PATCH", "/federations/1", strings.NewReader(`[{"op":"explode","path":"/owner"}]`))
+	r.SetPathValue("id", "1")
+	r.Header.Set("Content-Type", "application/json-patch+json")
+	r.Header.Set("If-Match", `"1"`)
+
+	// act
+	sut.patchFederation(w, r)
+
+	// assert
+	if receivedCode != http.StatusBadRequest {
+		t.Fatalf("patchFederation(w, r) = %d want %d", receivedCode, http.StatusBadRequest)
+	}
+}
+
+// test patchFederation(w http.ResponseWriter, r *http.Request)
+// should pass the patch to the repository and respond the patched federation
+func TestPatchFederationSuccess(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	receivedCode := 0
+	var receivedData any
+	var receivedHeaders []http.Header
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, headers ...http.Header) error {
+		receivedCode = code
+		receivedData = data
+		receivedHeaders = headers
+		return nil
+	}
+	readJsonAlias = (*App).readJson
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PATCH", "/federations/1", strings.NewReader(`{"owner":"patched"}`))
+	r.SetPathValue("id", "1")
+	r.Header.Set("Content-Type", "application/merge-patch+json; charset=utf-8")
+	r.Header.Set("If-Match", `"1"`)
+	want := api.Federation{Id: 1, Owner: "patched", Version: 2}
+
+	// act
+	sut.patchFederation(w, r)
+
+	// assert
+	if receivedCode != http.StatusOK {
+		t.Fatalf("patchFederation(w, r) = %d want %d", receivedCode, http.StatusOK)
+	}
+
+	if FederationRepositoryMockReceivedPatch == nil {
+		t.Fatal("patchFederation(w, r) = <nil> patch want merge patch")
+	}
+
+	if patched, ok := receivedData.(*api.Federation); !ok || !reflect.DeepEqual(*patched, want) {
+		t.Fatalf("patchFederation(w, r) = %v want %v", receivedData, want)
+	}
+
+	if len(receivedHeaders) != 1 || receivedHeaders[0].Get("ETag") != `"2"` {
+		t.Fatalf("patchFederation(w, r) = %v want ETag %q", receivedHeaders, `"2"`)
+	}
+}
+
+// test getFederationHistory(w http.ResponseWriter, r *http.Request) success
+// should pass the query and respond the changes with page headers
+func TestGetFederationHistorySuccess(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedCode int
+	var receivedChanges []*api.FederationChange
+	var receivedHeader http.Header
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, headers ...http.Header) error {
+		receivedCode = code
+		receivedChanges = data.([]*api.FederationChange)
+		receivedHeader = headers[0]
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/1/history?limit=5&cursor=abc", nil)
+	r.SetPathValue("id", "1")
+	wantQuery := tools.HistoryQuery{Limit: 5, Cursor: "abc"}
+
+	// act
+	sut.getFederationHistory(w, r)
+
+	// assert
+	if receivedCode != http.StatusOK || len(receivedChanges) != 1 {
+		t.Fatalf("getFederationHistory(w, r) = %d, %v want %d and one change", receivedCode, receivedChanges, http.StatusOK)
+	}
+
+	if FederationRepositoryMockReceivedHistoryQuery != wantQuery {
+		t.Fatalf("getFederationHistory(w, r) query = %+v want %+v", FederationRepositoryMockReceivedHistoryQuery, wantQuery)
+	}
+
+	if got := receivedHeader.Get("Link"); got != `</federations/1/history?cursor=next&limit=5>; rel="next"` {
+		t.Fatalf("getFederationHistory(w, r) Link = %q", got)
+	}
+}
+
+// test getFederationHistory(w http.ResponseWriter, r *http.Request) with bad input
+// should respond bad request or not found
+func TestGetFederationHistoryErrors(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedCode int
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	tests := []struct {
+		id, query string
+		want      int
+	}{
+		{"one", "", http.StatusBadRequest},
+		{"1", "?limit=ten", http.StatusBadRequest},
+		{"9", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/federations/"+tt.id+"/history"+tt.query, nil)
+		r.SetPathValue("id", tt.id)
+
+		// act
+		sut.getFederationHistory(httptest.NewRecorder(), r)
+
+		// assert
+		if receivedCode != tt.want {
+			t.Fatalf("getFederationHistory(%s%s) = %d want %d", tt.id, tt.query, receivedCode, tt.want)
+		}
+	}
+}
+
+// test searchFederations(w http.ResponseWriter, r *http.Request)
+// should pass the query to the repository and link the adjacent pages
+func TestSearchFederationsSuccess(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedCode int
+	var receivedFeds []*api.Federation
+	var receivedHeader http.Header
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, data any, headers ...http.Header) error {
+		receivedCode = code
+		receivedFeds = data.([]*api.Federation)
+		receivedHeader = headers[0]
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/search?q=own&limit=2&cursor=abc", nil)
+	wantQuery := tools.SearchQuery{Q: "own", Limit: 2, Cursor: "abc"}
+	wantLink := `</federations/search?cursor=next&limit=2&q=own>; rel="next", </federations/search?cursor=prev&limit=2&q=own>; rel="prev"`
+
+	// act
+	sut.searchFederations(w, r)
+
+	// assert
+	if receivedCode != http.StatusOK || len(receivedFeds) != 2 || receivedFeds[0].Id != 2 {
+		t.Fatalf("searchFederations(w, r) = %d, %v want %d and the ranked federations", receivedCode, receivedFeds, http.StatusOK)
+	}
+
+	if FederationRepositoryMockReceivedSearch != wantQuery {
+		t.Fatalf("searchFederations(w, r) query = %+v want %+v", FederationRepositoryMockReceivedSearch, wantQuery)
+	}
+
+	if got := receivedHeader.Get("Link"); got != wantLink {
+		t.Fatalf("searchFederations(w, r) Link = %q want %q", got, wantLink)
+	}
+}
+
+// test searchFederations(w http.ResponseWriter, r *http.Request) with bad input
+// should respond bad request
+func TestSearchFederationsErrors(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(tools.NewMockDb()))
+	var receivedCode int
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, code int, _ any, _ ...http.Header) error {
+		receivedCode = code
+		return nil
+	}
+	for _, query := range []string{"", "?q=+", "?q=a&limit=ten", "?q=a&limit=5000", "?q=a&cursor=%25"} {
+		r := httptest.NewRequest("GET", "/federations/search"+query, nil)
+
+		// act
+		sut.searchFederations(httptest.NewRecorder(), r)
+
+		// assert
+		if receivedCode != http.StatusBadRequest {
+			t.Fatalf("searchFederations(%s) = %d want %d", query, receivedCode, http.StatusBadRequest)
+		}
+	}
+}
@@ -17,11 +17,19 @@ func (app *App) writeResponse(w http.ResponseWriter, code int, data any, headers
 
 	// if data is not empty prepare payload
 	if data != nil {
-		// if response is an error convert to marshable type with msg field
+		// if response is an error convert to marshable type with msg field,
+		// the list of invalid fields and the current state, if any
 		if e, ok := data.(error); ok {
-			data = &struct {
-				Message string `json:"msg"`
-			}{e.Error()}
+			body := &struct {
+				Message string                 `json:"msg"`
+				Errors  tools.ValidationErrors `json:"errors,omitempty"`
+				State   string                 `json:"state,omitempty"`
+			}{Message: e.Error(), Errors: violations(e)}
+			var stateErr *tools.StateError
+			if errors.As(e, &stateErr) {
+				body.State = stateErr.State
+			}
+			data = body
 		}
 
 		payload, err = json.Marshal(data)
@@ -49,12 +57,14 @@ func (app *App) writeResponse(w http.ResponseWriter, code int, data any, headers
 	return nil
 }
 
+// maxBodyBytes limits the size of json payloads read by readJson.
+const maxBodyBytes = 1048576 // 1MB.
+
 // readJson is a helper function to read json payloads into data.
 // it returns any possible errors.
 func (app *App) readJson(w http.ResponseWriter, r *http.Request, data any) error {
 	// limits the size read to 1MB.
-	var maxBytes int64 = 1048576 // 1MB.
-	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
 	dec := json.NewDecoder(r.Body)
 
 	// read json into data.
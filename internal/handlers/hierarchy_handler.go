@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"gorest/internal/tools"
+)
+
+// getChildren lists the live children of a federation, taking the
+// listing parameters of getFederations.
+func (app *App) getChildren(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	query, err := parseFederationQuery(r)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+	query.ParentId = id
+
+	if _, err := app.Repository.GetFederation(r.Context(), id); err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+	page, err := app.Repository.GetFederations(r.Context(), query)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, page.Federations, pageHeaders(r, page)); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// getDescendants lists the live descendants of a federation level by
+// level, down to the depth parameter when it is set.
+func (app *App) getDescendants(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	depth := 0
+	if value := r.URL.Query().Get("depth"); value != "" {
+		if depth, err = strconv.Atoi(value); err != nil {
+			app.writeError(w, r, &tools.ValidationError{Field: "depth", Message: "must be an integer"})
+			return
+		}
+	}
+
+	descendants, err := tools.Descendants(r.Context(), app.Repository, id, depth)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, descendants); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// getAncestors lists the ancestors of a federation, its parent first.
+func (app *App) getAncestors(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	ancestors, err := tools.Ancestors(r.Context(), app.Repository, id)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, ancestors); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// hierarchyIds returns the ids of the federations listed in body.
+func hierarchyIds(t *testing.T, body string) []int {
+	t.Helper()
+	var federations []*api.Federation
+	if err := json.Unmarshal([]byte(body), &federations); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v want <nil>", body, err)
+	}
+	ids := make([]int, len(federations))
+	for i, fed := range federations {
+		ids[i] = fed.Id
+	}
+	return ids
+}
+
+// test the children, descendants and ancestors endpoints on the tree 1 > 2 > 3
+// should list the federations around the one asked for
+func TestHierarchyHandlers(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))).NewHandler()
+	serve(sut, "POST", "/federations", `{"owner":"Owner 2","parent_id":1}`)
+	serve(sut, "POST", "/federations", `{"owner":"Owner 3","parent_id":2}`)
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/federations/1/children", "[2]"},
+		{"/federations/3/children", "[]"},
+		{"/federations/1/descendants", "[2 3]"},
+		{"/federations/1/descendants?depth=1", "[2]"},
+		{"/federations/3/ancestors", "[2 1]"},
+		{"/federations?parentId=2", "[3]"},
+	}
+
+	for _, tt := range tests {
+		// act
+		w := serve(sut, "GET", tt.target, "")
+
+		// assert
+		if w.Code != http.StatusOK || fmt.Sprint(hierarchyIds(t, w.Body.String())) != tt.want {
+			t.Fatalf("ServeHTTP(GET %s) = %d, %s want %s", tt.target, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+// test the hierarchy endpoints and writes with missing federations, cycles and invalid input
+// should answer 404, 422, 409 and 400
+func TestHierarchyHandlersErrors(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))).NewHandler()
+	serve(sut, "POST", "/federations", `{"owner":"Owner 2","parent_id":1}`)
+	tests := []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"GET", "/federations/7/children", "", http.StatusNotFound},
+		{"GET", "/federations/7/descendants", "", http.StatusNotFound},
+		{"GET", "/federations/7/ancestors", "", http.StatusNotFound},
+		{"GET", "/federations/1/descendants?depth=-1", "", http.StatusBadRequest},
+		{"GET", "/federations/1/descendants?depth=all", "", http.StatusBadRequest},
+		{"GET", "/federations/one/children", "", http.StatusBadRequest},
+		{"POST", "/federations", `{"owner":"Owner 3","parent_id":7}`, http.StatusUnprocessableEntity},
+		{"POST", "/federations", `{"owner":"Owner 3","parent_id":0}`, http.StatusUnprocessableEntity},
+		{"PUT", "/federations/1", `{"owner":"Owner 1","parent_id":2}`, http.StatusUnprocessableEntity},
+		{"DELETE", "/federations/1", "", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		// act
+		w := serve(sut, tt.method, tt.target, tt.body)
+
+		// assert
+		if w.Code != tt.want {
+			t.Fatalf("ServeHTTP(%s %s) = %d, %s want %d", tt.method, tt.target, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+// test deleting a parent under the cascade policy
+// should delete its descendants and remove their members
+func TestHierarchyHandlersCascade(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	repo, err := tools.OpenFederationRepository(tools.Config{Store: tools.StoreMemory, ParentDelete: tools.DeleteCascade})
+	if err != nil {
+		t.Fatalf("OpenFederationRepository(cascade) = %v want <nil>", err)
+	}
+	sut := NewApp(WithRepository(repo)).NewHandler()
+	var parent, child api.Federation
+	json.Unmarshal(serve(sut, "POST", "/federations", `{"owner":"Parent"}`).Body.Bytes(), &parent)
+	json.Unmarshal(serve(sut, "POST", "/federations", fmt.Sprintf(`{"owner":"Child","parent_id":%d}`, parent.Id)).Body.Bytes(), &child)
+	added := serve(sut, "POST", fmt.Sprintf("/federations/%d/members", child.Id), `{"organisation":"Org 1","role":"member"}`)
+
+	// act
+	deleted := serve(sut, "DELETE", fmt.Sprintf("/federations/%d", parent.Id), "")
+	serve(sut, "POST", fmt.Sprintf("/federations/%d:restore", parent.Id), "")
+	restored := serve(sut, "POST", fmt.Sprintf("/federations/%d:restore", child.Id), "")
+	members := serve(sut, "GET", fmt.Sprintf("/federations/%d/members", child.Id), "")
+
+	// assert
+	if added.Code != http.StatusCreated {
+		t.Fatalf("ServeHTTP(POST child members) = %d, %s want %d", added.Code, added.Body, http.StatusCreated)
+	}
+
+	if deleted.Code != http.StatusOK || restored.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(DELETE parent, restore child) = %d, %s want %d", deleted.Code, restored.Body, http.StatusOK)
+	}
+
+	if members.Code != http.StatusOK || strings.TrimSpace(members.Body.String()) != "[]" {
+		t.Fatalf("ServeHTTP(GET child members) = %d, %s want no members", members.Code, members.Body)
+	}
+}
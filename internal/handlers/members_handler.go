@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// memberRole is the body of a role update.
+type memberRole struct {
+	Role string `json:"role"`
+}
+
+func (app *App) getMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	members, err := app.Members.GetMembers(r.Context(), id)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, members); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) addMember(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	member := new(api.Member)
+	if err := readJsonAlias(app, w, r, member); err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	added, err := app.Members.AddMember(r.Context(), id, member)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	header := http.Header{
+		"Location": {fmt.Sprintf("/federations/%d/members/%d", id, added.Id)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusCreated, added, header); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) getMember(w http.ResponseWriter, r *http.Request) {
+	id, memberId, err := memberPath(r)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	member, err := app.Members.GetMember(r.Context(), id, memberId)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, member); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) updateMemberRole(w http.ResponseWriter, r *http.Request) {
+	id, memberId, err := memberPath(r)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	role := new(memberRole)
+	if err := readJsonAlias(app, w, r, role); err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	member, err := app.Members.UpdateMemberRole(r.Context(), id, memberId, role.Role)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, member); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) removeMember(w http.ResponseWriter, r *http.Request) {
+	id, memberId, err := memberPath(r)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := app.Members.RemoveMember(r.Context(), id, memberId); err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, nil); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// memberPath reads the federation and member ids of a member path.
+func memberPath(r *http.Request) (int, int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	memberId, err := strconv.Atoi(r.PathValue("memberId"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, memberId, nil
+}
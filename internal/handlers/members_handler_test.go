@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// test the members endpoints adding, reading, updating and removing a member
+// should answer like the federation endpoints do
+func TestMembersHandlers(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))).NewHandler()
+
+	// act
+	added := serve(sut, "POST", "/federations/1/members", `{"organisation":"Acme"}`)
+	serve(sut, "POST", "/federations/1/members", `{"organisation":"Globex","role":"observer"}`)
+	updated := serve(sut, "PUT", "/federations/1/members/1/role", `{"role":"admin"}`)
+	removed := serve(sut, "DELETE", "/federations/1/members/2", "")
+	got := serve(sut, "GET", "/federations/1/members/1", "")
+	listed := serve(sut, "GET", "/federations/1/members", "")
+	var member api.Member
+	json.Unmarshal(got.Body.Bytes(), &member)
+	var members []*api.Member
+	json.Unmarshal(listed.Body.Bytes(), &members)
+
+	// assert
+	if added.Code != http.StatusCreated || added.Header().Get("Location") != "/federations/1/members/1" {
+		t.Fatalf("ServeHTTP(POST /federations/1/members) = %d, %v want %d with its Location", added.Code, added.Header(), http.StatusCreated)
+	}
+
+	if updated.Code != http.StatusOK || removed.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(PUT role, DELETE member) = %d, %d want %d", updated.Code, removed.Code, http.StatusOK)
+	}
+
+	if got.Code != http.StatusOK || member.Organisation != "Acme" || member.Role != tools.RoleAdmin || member.FederationId != 1 {
+		t.Fatalf("ServeHTTP(GET /federations/1/members/1) = %d, %s want the admin Acme", got.Code, got.Body)
+	}
+
+	if listed.Code != http.StatusOK || len(members) != 1 || members[0].Id != 1 {
+		t.Fatalf("ServeHTTP(GET /federations/1/members) = %d, %s want member 1", listed.Code, listed.Body)
+	}
+}
+
+// test the members endpoints with missing federations, missing members and invalid input
+// should answer 404, 409, 422 and 400
+func TestMembersHandlersErrors(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))).NewHandler()
+	serve(sut, "POST", "/federations/1/members", `{"organisation":"Acme"}`)
+	tests := []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"GET", "/federations/7/members", "", http.StatusNotFound},
+		{"POST", "/federations/7/members", `{"organisation":"Globex"}`, http.StatusNotFound},
+		{"GET", "/federations/7/members/1", "", http.StatusNotFound},
+		{"GET", "/federations/1/members/7", "", http.StatusNotFound},
+		{"PUT", "/federations/1/members/7/role", `{"role":"admin"}`, http.StatusNotFound},
+		{"DELETE", "/federations/1/members/7", "", http.StatusNotFound},
+		{"POST", "/federations/1/members", `{"organisation":"ACME"}`, http.StatusConflict},
+		{"POST", "/federations/1/members", `{"organisation":""}`, http.StatusUnprocessableEntity},
+		{"PUT", "/federations/1/members/1/role", `{"role":"owner"}`, http.StatusUnprocessableEntity},
+		{"POST", "/federations/1/members", `{"organisation":`, http.StatusBadRequest},
+		{"GET", "/federations/one/members", "", http.StatusBadRequest},
+		{"GET", "/federations/1/members/one", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		// act
+		w := serve(sut, tt.method, tt.target, tt.body)
+
+		// assert
+		if w.Code != tt.want {
+			t.Fatalf("ServeHTTP(%s %s) = %d, %s want %d", tt.method, tt.target, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+// test deleting a federation with members, alone or in a batch
+// should remove its members, so they are gone once it is restored
+func TestMembersHandlersCascade(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"}))).NewHandler()
+	serve(sut, "POST", "/federations/1/members", `{"organisation":"Acme"}`)
+	serve(sut, "POST", "/federations/2/members", `{"organisation":"Acme"}`)
+
+	// act
+	deleted := serve(sut, "DELETE", "/federations/1", "")
+	batch := serve(sut, "POST", "/federations:batch", `{"operations":[{"op":"delete","id":2,"version":1}]}`)
+	whileDeleted := serve(sut, "GET", "/federations/1/members", "")
+	serve(sut, "POST", "/federations/1:restore", "")
+	serve(sut, "POST", "/federations/2:restore", "")
+	restored := []*httptest.ResponseRecorder{
+		serve(sut, "GET", "/federations/1/members", ""),
+		serve(sut, "GET", "/federations/2/members", ""),
+	}
+
+	// assert
+	if deleted.Code != http.StatusOK || batch.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(DELETE, batch delete) = %d, %d want %d", deleted.Code, batch.Code, http.StatusOK)
+	}
+
+	if whileDeleted.Code != http.StatusNotFound {
+		t.Fatalf("ServeHTTP(GET /federations/1/members) = %d want %d", whileDeleted.Code, http.StatusNotFound)
+	}
+
+	for i, w := range restored {
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+			t.Fatalf("ServeHTTP(GET /federations/%d/members) = %d, %s want no members", i+1, w.Code, w.Body)
+		}
+	}
+}
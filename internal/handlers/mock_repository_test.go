@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"sort"
+	"time"
 
 	"gorest/api"
 	"gorest/internal/tools"
@@ -9,44 +11,75 @@ import (
 
 type FederationRepositoryMock struct{}
 
-var FederationRepositoryMockReturnCode = 0
 var FederationRepositoryMockReturnError error = nil
 var FederationRepositoryMockReturnReceivedFed *api.Federation = nil
+var FederationRepositoryMockReceivedQuery tools.FederationQuery
+var FederationRepositoryMockReceivedPatch tools.FederationPatch
+var FederationRepositoryMockReceivedBatch []tools.BatchOperation
+var FederationRepositoryMockReceivedHistoryQuery tools.HistoryQuery
+var FederationRepositoryMockReceivedSearch tools.SearchQuery
 var federationData = map[int]*api.Federation{
 	1: {Id: 1, Owner: "Owner 1"},
 	2: {Id: 2, Owner: "Owner 2"},
 }
 
 func ResetFederationRepositoryMock() {
-	FederationRepositoryMockReturnCode = 0
 	FederationRepositoryMockReturnError = nil
 	FederationRepositoryMockReturnReceivedFed = nil
+	FederationRepositoryMockReceivedQuery = tools.FederationQuery{}
+	FederationRepositoryMockReceivedPatch = nil
+	FederationRepositoryMockReceivedBatch = nil
+	FederationRepositoryMockReceivedHistoryQuery = tools.HistoryQuery{}
+	FederationRepositoryMockReceivedSearch = tools.SearchQuery{}
 	federationData = map[int]*api.Federation{
 		1: {Id: 1, Owner: "Owner 1"},
 		2: {Id: 2, Owner: "Owner 2"},
 	}
 }
 
-func NewFederationRepositoryMock() *tools.FederationRepository {
-	var repo tools.FederationRepository = new(FederationRepositoryMock)
-	return &repo
+func NewFederationRepositoryMock() tools.FederationRepository {
+	return new(FederationRepositoryMock)
 }
 
-func (db *FederationRepositoryMock) Setup() error {
+func (db *FederationRepositoryMock) Setup(context.Context) error {
 	return FederationRepositoryMockReturnError
 }
 
-func (db *FederationRepositoryMock) AddFederation(federation *api.Federation) (int, error) {
+func (db *FederationRepositoryMock) Close() error {
+	return FederationRepositoryMockReturnError
+}
+
+func (db *FederationRepositoryMock) AddFederation(_ context.Context, federation *api.Federation) (*api.Federation, error) {
 	FederationRepositoryMockReturnReceivedFed = federation
-	return FederationRepositoryMockReturnCode, FederationRepositoryMockReturnError
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	created := *federation
+	if created.Id == 0 {
+		created.Id = len(federationData) + 1
+	}
+	return &created, nil
 }
 
-func (db *FederationRepositoryMock) GetFederation(id int) *api.Federation {
-	federation := federationData[id]
-	return federation
+func (db *FederationRepositoryMock) GetFederation(_ context.Context, id int) (*api.Federation, error) {
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	federation, ok := federationData[id]
+	if !ok {
+		return nil, &tools.FederationError{Id: id, Err: tools.ErrNotFound}
+	}
+	return federation, nil
 }
 
-func (db *FederationRepositoryMock) GetFederations() []*api.Federation {
+func (db *FederationRepositoryMock) GetFederations(_ context.Context, query tools.FederationQuery) (*tools.FederationPage, error) {
+	FederationRepositoryMockReceivedQuery = query
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
 	feds := make([]*api.Federation, 0, len(federationData))
 	for _, fed := range federationData {
 		feds = append(feds, fed)
@@ -55,13 +88,92 @@ func (db *FederationRepositoryMock) GetFederations() []*api.Federation {
 	sort.Slice(feds, func(i, j int) bool {
 		return feds[i].Id < feds[j].Id
 	})
-	return feds
+	return &tools.FederationPage{Federations: feds, Total: len(feds)}, nil
+}
+
+func (db *FederationRepositoryMock) UpdateFederation(_ context.Context, federation *api.Federation) (*api.Federation, error) {
+	FederationRepositoryMockReturnReceivedFed = federation
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	updated := *federation
+	updated.Version++
+	return &updated, nil
+}
+
+func (db *FederationRepositoryMock) PatchFederation(_ context.Context, id int, version int, patch tools.FederationPatch) (*api.Federation, error) {
+	FederationRepositoryMockReceivedPatch = patch
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	return &api.Federation{Id: id, Owner: "patched", Version: version + 1}, nil
+}
+
+func (db *FederationRepositoryMock) DeleteFederation(_ context.Context, id int, version int) error {
+	return FederationRepositoryMockReturnError
+}
+
+func (db *FederationRepositoryMock) RestoreFederation(_ context.Context, id int, version int) (*api.Federation, error) {
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	return &api.Federation{Id: id, Owner: "Owner 1", Version: version + 1}, nil
+}
+
+func (db *FederationRepositoryMock) TransitionFederation(_ context.Context, id int, version int, action string) (*api.Federation, error) {
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	return &api.Federation{Id: id, Owner: "Owner 1", State: tools.StateActive, Version: version + 1}, nil
+}
+
+func (db *FederationRepositoryMock) PurgeFederations(context.Context, time.Time) (int, error) {
+	if FederationRepositoryMockReturnError != nil {
+		return 0, FederationRepositoryMockReturnError
+	}
+	return 1, nil
 }
 
-func (db *FederationRepositoryMock) UpdateFederation(federation *api.Federation) (int, error) {
-	return FederationRepositoryMockReturnCode, FederationRepositoryMockReturnError
+func (db *FederationRepositoryMock) ApplyBatch(_ context.Context, ops []tools.BatchOperation, atomic bool) ([]tools.BatchResult, error) {
+	FederationRepositoryMockReceivedBatch = ops
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	results := make([]tools.BatchResult, len(ops))
+	for i, op := range ops {
+		if _, ok := federationData[op.Id]; !ok && op.Op != tools.BatchCreate {
+			results[i].Err = &tools.FederationError{Id: op.Id, Err: tools.ErrNotFound}
+			continue
+		}
+		results[i].Federation = &api.Federation{Id: op.Id, Version: op.Version + 1}
+	}
+	return results, nil
 }
 
-func (db *FederationRepositoryMock) DeleteFederation(id int) (int, error) {
-	return FederationRepositoryMockReturnCode, FederationRepositoryMockReturnError
+func (db *FederationRepositoryMock) GetHistory(_ context.Context, id int, query tools.HistoryQuery) (*tools.HistoryPage, error) {
+	FederationRepositoryMockReceivedHistoryQuery = query
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	federation, ok := federationData[id]
+	if !ok {
+		return nil, &tools.FederationError{Id: id, Err: tools.ErrNotFound}
+	}
+	change := &api.FederationChange{Id: 1, FederationId: id, Principal: "alice", Op: tools.ChangeCreate, After: federation}
+	return &tools.HistoryPage{Changes: []*api.FederationChange{change}, Total: 2, Next: "next"}, nil
+}
+
+func (db *FederationRepositoryMock) SearchFederations(_ context.Context, query tools.SearchQuery) (*tools.SearchPage, error) {
+	FederationRepositoryMockReceivedSearch = query
+	if FederationRepositoryMockReturnError != nil {
+		return nil, FederationRepositoryMockReturnError
+	}
+
+	return &tools.SearchPage{Federations: []*api.Federation{federationData[2], federationData[1]}, Total: 3, Next: "next", Prev: "prev"}, nil
 }
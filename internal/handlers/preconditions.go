@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorest/internal/tools"
+)
+
+// errPreconditionRequired is returned for writes without an If-Match header
+// when the app requires one.
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// errVersionRequired is the batch counterpart of errPreconditionRequired.
+var errVersionRequired = errors.New("version is required")
+
+// etag returns the entity tag of a federation version.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatchVersion returns the version required by the If-Match header of r.
+// "*" and, when allowed, a missing header return 0, which matches any
+// version. tags that can never match, such as weak or listed ones, return
+// tools.ErrVersionMismatch.
+func (app *App) ifMatchVersion(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch value {
+	case "":
+		if app.RequireIfMatch {
+			return 0, errPreconditionRequired
+		}
+		return 0, nil
+	case "*":
+		return 0, nil
+	}
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, `"`) {
+		return 0, tools.ErrVersionMismatch
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version <= 0 {
+		return 0, tools.ErrVersionMismatch
+	}
+	return version, nil
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"gorest/internal/tools"
+)
+
+// test ifMatchVersion(r *http.Request) with If-Match values
+// should return the version or the precondition error
+func TestIfMatchVersion(t *testing.T) {
+	// arrange
+	tests := []struct {
+		header  string
+		require bool
+		want    int
+		err     error
+	}{
+		{"", true, 0, errPreconditionRequired},
+		{"", false, 0, nil},
+		{"*", true, 0, nil},
+		{`"3"`, true, 3, nil},
+		{` "3" `, true, 3, nil},
+		{`W/"3"`, true, 0, tools.ErrVersionMismatch},
+		{`"1", "2"`, true, 0, tools.ErrVersionMismatch},
+		{`"0"`, true, 0, tools.ErrVersionMismatch},
+		{"3", true, 0, tools.ErrVersionMismatch},
+	}
+
+	for _, tt := range tests {
+		app := NewApp(WithRequireIfMatch(tt.require))
+		r := httptest.NewRequest("PUT", "/federations/1", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+
+		// act
+		version, err := app.ifMatchVersion(r)
+
+		// assert
+		if version != tt.want || !errors.Is(err, tt.err) {
+			t.Fatalf("ifMatchVersion(%q) = %d, %v want %d, %v", tt.header, version, err, tt.want, tt.err)
+		}
+	}
+}
+
+// test errorStatus(err error) with precondition errors
+// should return 428 and 412
+func TestErrorStatusPreconditions(t *testing.T) {
+	// act
+	required := errorStatus(errPreconditionRequired)
+	mismatch := errorStatus(&tools.FederationError{Id: 1, Err: tools.ErrVersionMismatch})
+
+	// assert
+	if required != 428 {
+		t.Fatalf("errorStatus(errPreconditionRequired) = %d want 428", required)
+	}
+
+	if mismatch != 412 {
+		t.Fatalf("errorStatus(ErrVersionMismatch) = %d want 412", mismatch)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorest/internal/tools"
+)
+
+// parseFederationQuery reads the listing parameters of r:
+// owner, ownerPrefix, minId, maxId, sort (prefix with - to sort
+// descending), limit, offset, cursor, includeDeleted, labelSelector,
+// state and parentId.
+func parseFederationQuery(r *http.Request) (tools.FederationQuery, error) {
+	values := r.URL.Query()
+	query := tools.FederationQuery{
+		Owner:         values.Get("owner"),
+		OwnerPrefix:   values.Get("ownerPrefix"),
+		Sort:          values.Get("sort"),
+		Cursor:        values.Get("cursor"),
+		LabelSelector: values.Get("labelSelector"),
+		State:         values.Get("state"),
+	}
+	if strings.HasPrefix(query.Sort, "-") {
+		query.Sort = query.Sort[1:]
+		query.Desc = true
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"minId", &query.MinId},
+		{"maxId", &query.MaxId},
+		{"limit", &query.Limit},
+		{"offset", &query.Offset},
+		{"parentId", &query.ParentId},
+	}
+	for _, param := range ints {
+		value := values.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return query, &tools.ValidationError{Field: param.name, Message: "must be an integer"}
+		}
+		*param.dst = n
+	}
+
+	if value := values.Get("includeDeleted"); value != "" {
+		includeDeleted, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, &tools.ValidationError{Field: "includeDeleted", Message: "must be a boolean"}
+		}
+		query.IncludeDeleted = includeDeleted
+	}
+
+	return query, nil
+}
+
+// parseHistoryQuery reads the history parameters of r: limit and cursor.
+func parseHistoryQuery(r *http.Request) (tools.HistoryQuery, error) {
+	values := r.URL.Query()
+	query := tools.HistoryQuery{Cursor: values.Get("cursor")}
+	if value := values.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return query, &tools.ValidationError{Field: "limit", Message: "must be an integer"}
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
+
+// parseSearchQuery reads the search parameters of r.
+func parseSearchQuery(r *http.Request) (tools.SearchQuery, error) {
+	values := r.URL.Query()
+	query := tools.SearchQuery{Q: values.Get("q"), Cursor: values.Get("cursor")}
+	if value := values.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return query, &tools.ValidationError{Field: "limit", Message: "must be an integer"}
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
+
+// pageHeaders returns the X-Total-Count and Link headers of page.
+// links keep the request parameters and replace offset with a cursor.
+func pageHeaders(r *http.Request, page *tools.FederationPage) http.Header {
+	return listHeaders(r, page.Total, page.Next, page.Prev)
+}
+
+// historyHeaders returns the X-Total-Count and Link headers of page.
+func historyHeaders(r *http.Request, page *tools.HistoryPage) http.Header {
+	return listHeaders(r, page.Total, page.Next, "")
+}
+
+// listHeaders returns the X-Total-Count header and a Link header with the
+// next and prev cursors that are set.
+func listHeaders(r *http.Request, total int, next, prev string) http.Header {
+	header := http.Header{
+		"X-Total-Count": {strconv.Itoa(total)},
+	}
+
+	var links []string
+	for _, link := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if link.cursor == "" {
+			continue
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(r.URL, link.cursor), link.rel))
+	}
+	if len(links) > 0 {
+		header.Set("Link", strings.Join(links, ", "))
+	}
+
+	return header
+}
+
+func pageURL(u *url.URL, cursor string) string {
+	values := u.Query()
+	values.Del("offset")
+	values.Set("cursor", cursor)
+	return u.Path + "?" + values.Encode()
+}
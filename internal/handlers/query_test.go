@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorest/internal/tools"
+)
+
+// test parseFederationQuery(r *http.Request) with every parameter
+// should fill the query
+func TestParseFederationQuery(t *testing.T) {
+	// arrange
+	r := httptest.NewRequest("GET", "/federations?owner=bob&ownerPrefix=b&minId=2&maxId=9&sort=-owner&limit=5&offset=10&cursor=abc&includeDeleted=true&labelSelector=env%3Dprod%2Ctier%21%3Dgold&state=active", nil)
+	want := tools.FederationQuery{
+		Owner:       "bob",
+		OwnerPrefix: "b",
+		MinId:       2,
+		MaxId:       9,
+		Sort:        "owner",
+		Desc:        true,
+		Limit:       5,
+		Offset:      10,
+		Cursor:      "abc",
+
+		IncludeDeleted: true,
+		LabelSelector:  "env=prod,tier!=gold",
+		State:          "active",
+	}
+
+	// act
+	query, err := parseFederationQuery(r)
+
+	// assert
+	if err != nil {
+		t.Fatalf("parseFederationQuery(r) = %v want <nil>", err)
+	}
+
+	if query != want {
+		t.Fatalf("parseFederationQuery(r) = %+v want %+v", query, want)
+	}
+}
+
+// test parseFederationQuery(r *http.Request) with malformed parameters
+// should return validation error
+func TestParseFederationQueryInvalid(t *testing.T) {
+	// arrange
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"/federations?limit=ten", "limit must be an integer"},
+		{"/federations?includeDeleted=maybe", "includeDeleted must be a boolean"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+
+		// act
+		_, err := parseFederationQuery(r)
+
+		// assert
+		if !errors.Is(err, tools.ErrValidation) || err.Error() != tt.wantErr {
+			t.Fatalf("parseFederationQuery(%s) = %v want %q", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+// test pageHeaders(r *http.Request, *tools.FederationPage) with adjacent pages
+// should set total count and next and prev links
+func TestPageHeaders(t *testing.T) {
+	// arrange
+	r := httptest.NewRequest("GET", "/federations?owner=bob&offset=2&limit=2", nil)
+	page := &tools.FederationPage{Total: 7, Next: "n", Prev: "p"}
+	wantLink := `</federations?cursor=n&limit=2&owner=bob>; rel="next", </federations?cursor=p&limit=2&owner=bob>; rel="prev"`
+
+	// act
+	header := pageHeaders(r, page)
+
+	// assert
+	if got := header.Get("X-Total-Count"); got != "7" {
+		t.Fatalf("pageHeaders(r, page) X-Total-Count = %q want %q", got, "7")
+	}
+
+	if got := header.Get("Link"); got != wantLink {
+		t.Fatalf("pageHeaders(r, page) Link = %q want %q", got, wantLink)
+	}
+}
+
+// test getFederations(w http.ResponseWriter, r *http.Request) with listing parameters
+// should pass the query to the repository and respond page headers
+func TestGetFederationsQuery(t *testing.T) {
+	// arrange
+	sut := NewApp(WithRepository(NewFederationRepositoryMock()))
+	var receivedHeaders []http.Header
+	writeResponseAlias = func(_ *App, _ http.ResponseWriter, _ int, _ any, headers ...http.Header) error {
+		receivedHeaders = headers
+		return nil
+	}
+	ResetFederationRepositoryMock()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations?owner=Owner%201&sort=-id", nil)
+	wantQuery := tools.FederationQuery{Owner: "Owner 1", Sort: "id", Desc: true}
+
+	// act
+	sut.getFederations(w, r)
+
+	// assert
+	if FederationRepositoryMockReceivedQuery != wantQuery {
+		t.Fatalf("getFederations(w, r) = %+v want %+v", FederationRepositoryMockReceivedQuery, wantQuery)
+	}
+
+	if len(receivedHeaders) != 1 || receivedHeaders[0].Get("X-Total-Count") != "2" {
+		t.Fatalf("getFederations(w, r) = %v want X-Total-Count 2", receivedHeaders)
+	}
+}
@@ -20,8 +20,41 @@ func (app *App) NewHandler() http.Handler {
 	federationRouter.HandleFunc(http.MethodPost, "", app.addFederation)
 	federationRouter.HandleFunc(http.MethodGet, "/{id}", app.GetFederation)
 	federationRouter.HandleFunc(http.MethodGet, "", app.getFederations)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/history", app.getFederationHistory)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/members", app.getMembers)
+	federationRouter.HandleFunc(http.MethodPost, "/{id}/members", app.addMember)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/members/{memberId}", app.getMember)
+	federationRouter.HandleFunc(http.MethodPut, "/{id}/members/{memberId}/role", app.updateMemberRole)
+	federationRouter.HandleFunc(http.MethodDelete, "/{id}/members/{memberId}", app.removeMember)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/transfers", app.getTransfers)
+	federationRouter.HandleFunc(http.MethodPost, "/{id}/transfers", app.createTransfer)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/transfers/{transferId}", app.getTransfer)
+	federationRouter.HandleFunc(http.MethodPost, "/{id}/transfers/{transferId}/accept", app.acceptTransfer)
+	federationRouter.HandleFunc(http.MethodPost, "/{id}/transfers/{transferId}/reject", app.rejectTransfer)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/children", app.getChildren)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/descendants", app.getDescendants)
+	federationRouter.HandleFunc(http.MethodGet, "/{id}/ancestors", app.getAncestors)
+	federationRouter.HandleFunc(http.MethodGet, "/search", app.searchFederations)
+	federationRouter.HandleFunc(http.MethodGet, "/export", app.exportFederations)
+	federationRouter.HandleFunc(http.MethodPost, "/import", app.importFederations)
+	federationRouter.HandleFunc(http.MethodPost, ":batch", app.batchFederations)
 	federationRouter.HandleFunc(http.MethodPut, "/{id}", app.updateFederation)
+	federationRouter.HandleFunc(http.MethodPatch, "/{id}", app.patchFederation)
 	federationRouter.HandleFunc(http.MethodDelete, "/{id}", app.deleteFederation)
+	federationRouter.HandleFunc(http.MethodPost, "/{id}", app.federationAction)
+
+	adminRouter := routeGroup{
+		basePath: "/admin",
+		ServeMux: mux,
+	}
+	adminRouter.Use(middleware.Authorize)
+	if app.Faults != nil {
+		adminRouter.HandleFunc(http.MethodGet, "/faults", app.getFaults)
+		adminRouter.HandleFunc(http.MethodPut, "/faults", app.putFaults)
+	}
+	if app.Cache != nil {
+		adminRouter.HandleFunc(http.MethodGet, "/cache", app.getCacheStats)
+	}
 
 	return mux
 }
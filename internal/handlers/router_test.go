@@ -1,12 +1,27 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+
+	"gorest/api"
+	"gorest/internal/tools"
 )
 
+// serve sends an authorized request matching any version to handler.
+func serve(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "123456")
+	r.Header.Set("If-Match", "*")
+	handler.ServeHTTP(w, r)
+	return w
+}
+
 // test handler health check
 // should write 200 as response
 func TestNewHandlerHealthcheck(t *testing.T) {
@@ -45,3 +60,231 @@ func TestNewHandlerSuccess(t *testing.T) {
 		t.Fatalf(`NewHandler() = %q want "*chi.Mux"`, reflect.TypeOf(handler))
 	}
 }
+
+// test handler federation actions
+// should restore federations and answer 404 to unknown actions
+func TestNewHandlerFederationActions(t *testing.T) {
+	// arrange
+	ResetFederationRepositoryMock()
+	writeResponseAlias = (*App).writeResponse
+	app := NewApp(WithRepository(NewFederationRepositoryMock()), WithRequireIfMatch(false))
+	sut := app.NewHandler()
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/federations/1:restore", http.StatusOK},
+		{"/federations/1:explode", http.StatusNotFound},
+		{"/federations/one:restore", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", tt.path, nil)
+		r.Header.Set("Authorization", "123456")
+
+		// act
+		sut.ServeHTTP(w, r)
+
+		// assert
+		if w.Code != tt.want {
+			t.Fatalf("ServeHTTP(POST %s) = %d want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+// test NewHandler() serving federation history against a real repository
+// should list the changes newest first with the principal of the token
+func TestNewHandlerFederationHistory(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	app := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})), WithRequireIfMatch(false))
+	sut := app.NewHandler()
+	for _, method := range []string{"PUT", "DELETE"} {
+		r := httptest.NewRequest(method, "/federations/1", strings.NewReader(`{"owner":"new owner"}`))
+		r.Header.Set("Authorization", "123456")
+		sut.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/1/history?limit=1", nil)
+	r.Header.Set("Authorization", "123456")
+
+	// act
+	sut.ServeHTTP(w, r)
+	var changes []*api.FederationChange
+	json.Unmarshal(w.Body.Bytes(), &changes)
+
+	// assert
+	if w.Code != http.StatusOK || len(changes) != 1 {
+		t.Fatalf("ServeHTTP(GET /federations/1/history) = %d, %s want one change", w.Code, w.Body)
+	}
+
+	if got := changes[0]; got.Op != tools.ChangeDelete || got.Principal == tools.AnonymousPrincipal || got.Before.Owner != "new owner" {
+		t.Fatalf("ServeHTTP(GET /federations/1/history)[0] = %+v want the delete by the token holder", got)
+	}
+
+	if got := w.Header().Get("X-Total-Count"); got != "2" {
+		t.Fatalf("ServeHTTP(GET /federations/1/history) X-Total-Count = %q want %q", got, "2")
+	}
+
+	if got := w.Header().Get("Link"); !strings.Contains(got, `rel="next"`) {
+		t.Fatalf("ServeHTTP(GET /federations/1/history) Link = %q want a next link", got)
+	}
+}
+
+// test NewHandler() searching federations against a real repository
+// should rank the matching owners and not take search for an id
+func TestNewHandlerSearchFederations(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Malice"}, &api.Federation{Id: 2, Owner: "Bob"}, &api.Federation{Id: 3, Owner: "Alice"})
+	sut := NewApp(WithRepository(repo)).NewHandler()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations/search?q=ALIC", nil)
+	r.Header.Set("Authorization", "123456")
+
+	// act
+	sut.ServeHTTP(w, r)
+	var feds []*api.Federation
+	json.Unmarshal(w.Body.Bytes(), &feds)
+
+	// assert
+	if w.Code != http.StatusOK || len(feds) != 2 || feds[0].Id != 3 || feds[1].Id != 1 {
+		t.Fatalf("ServeHTTP(GET /federations/search) = %d, %s want federations 3 and 1", w.Code, w.Body)
+	}
+
+	if got := w.Header().Get("X-Total-Count"); got != "2" {
+		t.Fatalf("ServeHTTP(GET /federations/search) X-Total-Count = %q want %q", got, "2")
+	}
+}
+
+// test NewHandler() creating labeled federations and listing them by label
+// should stamp them and select them by labelSelector
+func TestNewHandlerLabelSelector(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb())).NewHandler()
+	bodies := []string{
+		`{"owner":"Owner 1","name":"one","labels":{"env":"prod","tier":"gold"},"created_at":"2000-01-01T00:00:00Z"}`,
+		`{"owner":"Owner 2","labels":{"env":"prod"}}`,
+		`{"owner":"Owner 3"}`,
+	}
+	var first api.Federation
+	for i, body := range bodies {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/federations", strings.NewReader(body))
+		r.Header.Set("Authorization", "123456")
+		sut.ServeHTTP(w, r)
+		if i == 0 {
+			json.Unmarshal(w.Body.Bytes(), &first)
+		}
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/federations?labelSelector=env%3Dprod,tier!%3Dgold", nil)
+	r.Header.Set("Authorization", "123456")
+
+	// act
+	sut.ServeHTTP(w, r)
+	var feds []*api.Federation
+	json.Unmarshal(w.Body.Bytes(), &feds)
+
+	// assert
+	if first.Name != "one" || first.CreatedAt == nil || first.CreatedAt.Year() == 2000 || first.UpdatedAt == nil {
+		t.Fatalf("ServeHTTP(POST /federations) = %+v want the name and server timestamps", first)
+	}
+
+	if w.Code != http.StatusOK || len(feds) != 1 || feds[0].Owner != "Owner 2" {
+		t.Fatalf("ServeHTTP(GET /federations?labelSelector) = %d, %s want Owner 2", w.Code, w.Body)
+	}
+}
+
+// test NewHandler() writing federations that break several rules
+// should respond 422 listing every violation
+func TestNewHandlerValidation(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))).NewHandler()
+	want := tools.ValidationErrors{
+		{Field: "owner", Rule: "required", Message: "is required"},
+		{Field: "name", Rule: "max", Message: "must be at most 255 characters"},
+		{Field: "labels.env", Rule: "values", Message: "must be at most 63 letters, digits, '-', '_' or '.', starting and ending with a letter or digit"},
+	}
+	body := `{"owner":" ","name":"` + strings.Repeat("n", 256) + `","labels":{"env":"a b"}}`
+	tests := []struct {
+		method string
+		target string
+	}{
+		{"POST", "/federations"},
+		{"PUT", "/federations/1"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(body))
+		r.Header.Set("Authorization", "123456")
+		r.Header.Set("If-Match", "*")
+
+		// act
+		sut.ServeHTTP(w, r)
+		var response struct {
+			Errors tools.ValidationErrors `json:"errors"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+
+		// assert
+		if w.Code != http.StatusUnprocessableEntity || !reflect.DeepEqual(response.Errors, want) {
+			t.Fatalf("ServeHTTP(%s %s) = %d, %s want %d with %v", tt.method, tt.target, w.Code, w.Body, http.StatusUnprocessableEntity, want)
+		}
+	}
+}
+
+// test NewHandler() moving a federation through its lifecycle
+// should answer the new state, 409 with the current state and filter lists by state
+func TestNewHandlerLifecycle(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb())).NewHandler()
+	serve(sut, "POST", "/federations", `{"owner":"Owner 1","name":"one"}`)
+	serve(sut, "POST", "/federations", `{"owner":"Owner 2"}`)
+
+	// act
+	activated := serve(sut, "POST", "/federations/1:activate", "")
+	again := serve(sut, "POST", "/federations/1:activate", "")
+	refused := serve(sut, "POST", "/federations/2:activate", "")
+	listed := serve(sut, "GET", "/federations?state=active", "")
+	invalid := serve(sut, "GET", "/federations?state=paused", "")
+	var fed api.Federation
+	json.Unmarshal(activated.Body.Bytes(), &fed)
+	var conflict struct {
+		Message string `json:"msg"`
+		State   string `json:"state"`
+	}
+	json.Unmarshal(again.Body.Bytes(), &conflict)
+	var feds []*api.Federation
+	json.Unmarshal(listed.Body.Bytes(), &feds)
+
+	// assert
+	if activated.Code != http.StatusOK || fed.State != tools.StateActive || fed.StateChangedAt == nil || activated.Header().Get("Etag") != `"2"` {
+		t.Fatalf("ServeHTTP(POST /federations/1:activate) = %d, %s want the active federation", activated.Code, activated.Body)
+	}
+
+	if again.Code != http.StatusConflict || conflict.State != tools.StateActive || conflict.Message != "federation 1 cannot activate while active" {
+		t.Fatalf("ServeHTTP(POST /federations/1:activate) again = %d, %s want %d in state active", again.Code, again.Body, http.StatusConflict)
+	}
+
+	if refused.Code != http.StatusConflict || !strings.Contains(refused.Body.String(), `"state":"draft"`) {
+		t.Fatalf("ServeHTTP(POST /federations/2:activate) = %d, %s want %d in state draft", refused.Code, refused.Body, http.StatusConflict)
+	}
+
+	if listed.Code != http.StatusOK || len(feds) != 1 || feds[0].Id != 1 {
+		t.Fatalf("ServeHTTP(GET /federations?state=active) = %d, %s want federation 1", listed.Code, listed.Body)
+	}
+
+	if invalid.Code != http.StatusBadRequest {
+		t.Fatalf("ServeHTTP(GET /federations?state=paused) = %d want %d", invalid.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// transferRequest is the body creating a transfer. to is the organisation
+// offered the federation.
+type transferRequest struct {
+	To string `json:"to"`
+}
+
+func (app *App) getTransfers(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	transfers, err := app.Transfers.GetTransfers(r.Context(), id)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, transfers); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) createTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	req := new(transferRequest)
+	if err := readJsonAlias(app, w, r, req); err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	created, err := app.Transfers.CreateTransfer(app.actingFor(r.Context()), id, req.To)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	header := http.Header{
+		"Location": {fmt.Sprintf("/federations/%d/transfers/%d", id, created.Id)},
+	}
+	if err := writeResponseAlias(app, w, http.StatusCreated, created, header); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) getTransfer(w http.ResponseWriter, r *http.Request) {
+	id, transferId, err := transferPath(r)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	transfer, err := app.Transfers.GetTransfer(r.Context(), id, transferId)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, transfer); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+func (app *App) acceptTransfer(w http.ResponseWriter, r *http.Request) {
+	app.decideTransfer(w, r, app.Transfers.AcceptTransfer)
+}
+
+func (app *App) rejectTransfer(w http.ResponseWriter, r *http.Request) {
+	app.decideTransfer(w, r, app.Transfers.RejectTransfer)
+}
+
+// decideTransfer settles a transfer with decide on behalf of the
+// organisation the principal making the request acts for, which has to be
+// the one the transfer was offered to.
+func (app *App) decideTransfer(w http.ResponseWriter, r *http.Request, decide func(context.Context, int, int) (*api.Transfer, error)) {
+	id, transferId, err := transferPath(r)
+	if err != nil {
+		tools.ErrorLogger.Println(err)
+		writeResponseAlias(app, w, http.StatusBadRequest, err)
+		return
+	}
+
+	transfer, err := decide(app.actingFor(r.Context()), id, transferId)
+	if err != nil {
+		app.writeError(w, r, err)
+		return
+	}
+
+	if err := writeResponseAlias(app, w, http.StatusOK, transfer); err != nil {
+		tools.ErrorLogger.Println(err)
+	}
+}
+
+// actingFor returns ctx carrying the organisation its principal acts for,
+// none when Organisations does not list it.
+func (app *App) actingFor(ctx context.Context) context.Context {
+	return tools.WithOrganisation(ctx, app.Organisations[tools.PrincipalFrom(ctx)])
+}
+
+// transferPath reads the federation and transfer ids of a transfer path.
+func transferPath(r *http.Request) (int, int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	transferId, err := strconv.Atoi(r.PathValue("transferId"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, transferId, nil
+}
+
+// keepOwner fails writes changing the owner of federation id to owner
+// while owners change through transfers only. it returns the version to
+// write: a write without one is pinned to the version checked, so a
+// transfer accepted in between is never undone.
+func (app *App) keepOwner(ctx context.Context, id int, version int, owner string) (int, error) {
+	if !app.OwnerTransfers {
+		return version, nil
+	}
+
+	stored, err := app.Repository.GetFederation(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if stored.Owner != owner {
+		return 0, &tools.FederationError{Id: id, Err: tools.ErrOwnerTransferred}
+	}
+	if version == 0 {
+		version = stored.Version
+	}
+	return version, nil
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// servePrincipal is the principal holding the credential serve sends.
+const servePrincipal = "token:8d969eef6eca"
+
+// actingAs returns a handler sharing repo and transfers whose requests act
+// for organisation.
+func actingAs(repo tools.FederationRepository, transfers tools.TransfersRepository, organisation string) http.Handler {
+	organisations := map[string]string{servePrincipal: organisation}
+	return NewApp(WithRepository(repo), WithTransfers(transfers), WithOrganisations(organisations)).NewHandler()
+}
+
+// test the transfers endpoints creating, rejecting and accepting transfers
+// should hand the federation over once the recipient accepts
+func TestTransfersHandlers(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	store := tools.NewMockTransfers(repo, time.Hour)
+	owner := actingAs(repo, store, "Owner 1")
+	recipient := actingAs(repo, store, "Owner 2")
+
+	// act
+	created := serve(owner, "POST", "/federations/1/transfers", `{"to":"Owner 2"}`)
+	rejected := serve(recipient, "POST", "/federations/1/transfers/1/reject", "")
+	serve(owner, "POST", "/federations/1/transfers", `{"to":"Owner 2"}`)
+	accepted := serve(recipient, "POST", "/federations/1/transfers/2/accept", "")
+	got := serve(owner, "GET", "/federations/1/transfers/2", "")
+	listed := serve(owner, "GET", "/federations/1/transfers", "")
+	fed := serve(owner, "GET", "/federations/1", "")
+	var transfer api.Transfer
+	json.Unmarshal(got.Body.Bytes(), &transfer)
+	var transfers []*api.Transfer
+	json.Unmarshal(listed.Body.Bytes(), &transfers)
+	var federation api.Federation
+	json.Unmarshal(fed.Body.Bytes(), &federation)
+
+	// assert
+	if created.Code != http.StatusCreated || created.Header().Get("Location") != "/federations/1/transfers/1" {
+		t.Fatalf("ServeHTTP(POST /federations/1/transfers) = %d, %v want %d with its Location", created.Code, created.Header(), http.StatusCreated)
+	}
+
+	if rejected.Code != http.StatusOK || accepted.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(reject, accept) = %d, %d want %d", rejected.Code, accepted.Code, http.StatusOK)
+	}
+
+	if got.Code != http.StatusOK || transfer.Status != tools.TransferAccepted || transfer.From != "Owner 1" || transfer.To != "Owner 2" {
+		t.Fatalf("ServeHTTP(GET /federations/1/transfers/2) = %d, %s want the accepted transfer", got.Code, got.Body)
+	}
+
+	if listed.Code != http.StatusOK || len(transfers) != 2 || transfers[0].Status != tools.TransferRejected {
+		t.Fatalf("ServeHTTP(GET /federations/1/transfers) = %d, %s want both transfers", listed.Code, listed.Body)
+	}
+
+	if federation.Owner != "Owner 2" {
+		t.Fatalf("ServeHTTP(GET /federations/1) = %s want owner Owner 2", fed.Body)
+	}
+}
+
+// test deciding a transfer as the organisation that created it
+// should answer 403, so the owner cannot hand the federation to itself in
+// place of the recipient
+func TestTransfersHandlersCreatorDecides(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := actingAs(repo, tools.NewMockTransfers(repo, time.Hour), "Owner 1")
+	serve(sut, "POST", "/federations/1/transfers", `{"to":"Owner 2"}`)
+
+	// act
+	accepted := serve(sut, "POST", "/federations/1/transfers/1/accept", "")
+	rejected := serve(sut, "POST", "/federations/1/transfers/1/reject", "")
+	fed, _ := repo.GetFederation(context.Background(), 1)
+
+	// assert
+	if accepted.Code != http.StatusForbidden || rejected.Code != http.StatusForbidden {
+		t.Fatalf("ServeHTTP(accept, reject) = %d, %d want %d", accepted.Code, rejected.Code, http.StatusForbidden)
+	}
+
+	if fed.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(1) = %+v want owner Owner 1", fed)
+	}
+}
+
+// test offering a federation for an organisation other than its owner
+// should answer 403 and create no transfer
+func TestTransfersHandlersNotOwner(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	transfers := tools.NewMockTransfers(repo, time.Hour)
+	sut := actingAs(repo, transfers, "Owner 2")
+
+	// act
+	w := serve(sut, "POST", "/federations/1/transfers", `{"to":"Owner 3"}`)
+	listed, _ := transfers.GetTransfers(context.Background(), 1)
+
+	// assert
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("ServeHTTP(POST /federations/1/transfers) = %d, %s want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+
+	if len(listed) != 0 {
+		t.Fatalf("GetTransfers(1) = %+v want no transfers", listed)
+	}
+}
+
+// test the transfers endpoints with missing federations, strangers and invalid input
+// should answer 404, 403, 409, 422 and 400
+func TestTransfersHandlersErrors(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := actingAs(repo, tools.NewMockTransfers(repo, time.Hour), "Owner 1")
+	serve(sut, "POST", "/federations/1/transfers", `{"to":"Owner 2"}`)
+	tests := []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"GET", "/federations/7/transfers", "", http.StatusNotFound},
+		{"POST", "/federations/7/transfers", `{"to":"Owner 2"}`, http.StatusNotFound},
+		{"GET", "/federations/1/transfers/7", "", http.StatusNotFound},
+		{"POST", "/federations/1/transfers/7/accept", "", http.StatusNotFound},
+		{"POST", "/federations/1/transfers/1/accept", "", http.StatusForbidden},
+		{"POST", "/federations/1/transfers/1/reject", "", http.StatusForbidden},
+		{"POST", "/federations/1/transfers", `{"to":"Owner 3"}`, http.StatusConflict},
+		{"POST", "/federations/1/transfers", `{"to":""}`, http.StatusUnprocessableEntity},
+		{"POST", "/federations/1/transfers", `{"to":`, http.StatusBadRequest},
+		{"GET", "/federations/1/transfers/one", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		// act
+		w := serve(sut, tt.method, tt.target, tt.body)
+
+		// assert
+		if w.Code != tt.want {
+			t.Fatalf("ServeHTTP(%s %s) = %d, %s want %d", tt.method, tt.target, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+// test updates, patches and batches changing the owner with owner transfers on
+// should answer 422 on the owner and leave it untouched, while other changes go through
+func TestOwnerTransfersRequired(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	sut := NewApp(WithRepository(tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})), WithOwnerTransfers(true)).NewHandler()
+	patch := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PATCH", "/federations/1", strings.NewReader(body))
+		r.Header.Set("Authorization", "123456")
+		r.Header.Set("If-Match", "*")
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+		sut.ServeHTTP(w, r)
+		return w
+	}
+
+	// act
+	updated := serve(sut, "PUT", "/federations/1", `{"owner":"Owner 2"}`)
+	patched := patch(`{"owner":"Owner 2"}`)
+	batch := serve(sut, "POST", "/federations:batch", `{"operations":[{"op":"update","id":1,"version":1,"federation":{"owner":"Owner 2"}}]}`)
+	renamed := serve(sut, "PUT", "/federations/1", `{"owner":"Owner 1","name":"One"}`)
+	relabelled := patch(`{"labels":{"env":"prod"}}`)
+	fed := serve(sut, "GET", "/federations/1", "")
+	var res batchResponse
+	json.Unmarshal(batch.Body.Bytes(), &res)
+	var federation api.Federation
+	json.Unmarshal(fed.Body.Bytes(), &federation)
+
+	// assert
+	for _, w := range []*httptest.ResponseRecorder{updated, patched} {
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"errors":[{"field":"owner"`) {
+			t.Fatalf("ServeHTTP(PUT, PATCH owner) = %d, %s want %d listing the owner", w.Code, w.Body, http.StatusUnprocessableEntity)
+		}
+	}
+
+	if len(res.Results) != 1 || res.Results[0].Status != http.StatusUnprocessableEntity {
+		t.Fatalf("ServeHTTP(POST /federations:batch) = %s want the update answering %d", batch.Body, http.StatusUnprocessableEntity)
+	}
+
+	if renamed.Code != http.StatusOK || relabelled.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(PUT name, PATCH labels) = %d, %d want %d", renamed.Code, relabelled.Code, http.StatusOK)
+	}
+
+	if federation.Owner != "Owner 1" || federation.Name != "One" {
+		t.Fatalf("ServeHTTP(GET /federations/1) = %s want Owner 1 named One", fed.Body)
+	}
+}
+
+// test deleting a federation with a pending transfer
+// should remove it, so the restored federation has none
+func TestTransfersHandlersCascade(t *testing.T) {
+	// arrange
+	writeResponseAlias = (*App).writeResponse
+	readJsonAlias = (*App).readJson
+	repo := tools.NewMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := actingAs(repo, tools.NewMockTransfers(repo, time.Hour), "Owner 1")
+	serve(sut, "POST", "/federations/1/transfers", `{"to":"Owner 2"}`)
+
+	// act
+	serve(sut, "DELETE", "/federations/1", "")
+	serve(sut, "POST", "/federations/1:restore", "")
+	w := serve(sut, "GET", "/federations/1/transfers", "")
+
+	// assert
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("ServeHTTP(GET /federations/1/transfers) = %d, %s want no transfers", w.Code, w.Body)
+	}
+}
@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 
 	"gorest/internal/tools"
 )
 
+// Authorize rejects requests without a valid credential and passes the
+// principal holding it to next in the request context.
 func Authorize(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Authorization")
@@ -14,6 +18,13 @@ func Authorize(next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(tools.WithPrincipal(r.Context(), principal(token))))
 	})
 }
+
+// principal identifies the holder of credential without revealing it, so
+// it can be stored and shown in the change history.
+func principal(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
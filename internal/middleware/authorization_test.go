@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 
 	"gorest/internal/tools"
@@ -120,3 +121,25 @@ func TestAuthorizeSuccess(t *testing.T) {
 		t.Fatalf("Authorize(nextHandler) = %q want %q", infOutput, want)
 	}
 }
+
+// test Authorize call with good token
+// should pass a principal that does not reveal the token
+func TestAuthorizePrincipal(t *testing.T) {
+	// arrange
+	var got string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = tools.PrincipalFrom(r.Context())
+	})
+
+	sut := Authorize(nextHandler)
+	req := httptest.NewRequest("GET", "http://test", nil)
+	req.Header.Set("Authorization", "123456")
+
+	// act
+	sut.ServeHTTP(httptest.NewRecorder(), req)
+
+	// assert
+	if got != principal("123456") || got == tools.AnonymousPrincipal || strings.Contains(got, "123456") {
+		t.Fatalf("PrincipalFrom(ctx) = %q want the principal of the token", got)
+	}
+}
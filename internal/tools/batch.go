@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+
+	"gorest/api"
+)
+
+// batch operations accepted by ApplyBatch.
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// ErrBatchAborted is the result of operations that were not applied
+// because another operation of an atomic batch failed.
+var ErrBatchAborted = errors.New("batch aborted")
+
+// BatchOperation is one write of a batch.
+type BatchOperation struct {
+	Op string
+	// Id selects the federation to update or delete.
+	Id int
+	// Version is the version expected in storage, 0 matches any version.
+	Version int
+	// Federation holds the new federation or the updated fields.
+	Federation *api.Federation
+}
+
+// BatchResult is the outcome of one operation, Err is nil on success.
+type BatchResult struct {
+	Federation *api.Federation
+	Err        error
+}
+
+// validate checks the fields op needs.
+func (op BatchOperation) validate() error {
+	switch op.Op {
+	case BatchCreate, BatchUpdate:
+		if op.Federation == nil {
+			return &ValidationError{Field: "federation", Message: fmt.Sprintf("is required to %s", op.Op)}
+		}
+	case BatchDelete:
+	default:
+		return &ValidationError{Field: "op", Message: fmt.Sprintf("must be %s, %s or %s", BatchCreate, BatchUpdate, BatchDelete)}
+	}
+	return nil
+}
+
+// runBatch runs ops in order with exec. in atomic mode it stops at the
+// first failure, marks every other operation aborted and reports false so
+// the caller discards the changes.
+func runBatch(ops []BatchOperation, atomic bool, exec func(BatchOperation) (*api.Federation, error)) ([]BatchResult, bool) {
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		fed, err := op.Federation, op.validate()
+		if err == nil {
+			fed, err = exec(op)
+		}
+		if err == nil {
+			results[i] = BatchResult{Federation: fed}
+			continue
+		}
+
+		results[i] = BatchResult{Err: err}
+		if atomic {
+			for j := range results {
+				if j != i {
+					results[j] = BatchResult{Err: ErrBatchAborted}
+				}
+			}
+			return results, false
+		}
+	}
+	return results, true
+}
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorest/api"
+)
+
+// batchOperations creates two federations, updates 1, deletes 2 and
+// finally fails to delete the missing federation 9.
+func batchOperations() []BatchOperation {
+	return []BatchOperation{
+		{Op: BatchCreate, Federation: &api.Federation{Owner: "new 1"}},
+		{Op: BatchCreate, Federation: &api.Federation{Owner: "new 2"}},
+		{Op: BatchUpdate, Id: 1, Version: 1, Federation: &api.Federation{Owner: "updated"}},
+		{Op: BatchDelete, Id: 2},
+		{Op: BatchDelete, Id: 9},
+	}
+}
+
+// checkBatchResults compares the ids and errors of results.
+func checkBatchResults(t *testing.T, results []BatchResult, ids []int, errs []error) {
+	t.Helper()
+	if len(results) != len(errs) {
+		t.Fatalf("ApplyBatch(ops) = %d results want %d", len(results), len(errs))
+	}
+
+	for i, result := range results {
+		if errs[i] != nil {
+			if !errors.Is(result.Err, errs[i]) {
+				t.Fatalf("ApplyBatch(ops)[%d] = %v want %v", i, result.Err, errs[i])
+			}
+			continue
+		}
+		if result.Err != nil || result.Federation == nil || result.Federation.Id != ids[i] {
+			t.Fatalf("ApplyBatch(ops)[%d] = %v, %v want federation %d", i, result.Federation, result.Err, ids[i])
+		}
+	}
+}
+
+// test runBatch(ops, atomic, exec) with an invalid operation
+// should report it without calling exec
+func TestRunBatchInvalid(t *testing.T) {
+	// arrange
+	ops := []BatchOperation{{Op: "upsert"}, {Op: BatchCreate}}
+	calls := 0
+	exec := func(BatchOperation) (*api.Federation, error) {
+		calls++
+		return nil, nil
+	}
+
+	// act
+	results, ok := runBatch(ops, false, exec)
+
+	// assert
+	if !ok || calls != 0 {
+		t.Fatalf("runBatch(ops) = %v, %d calls want true, 0 calls", ok, calls)
+	}
+
+	for i, result := range results {
+		if !errors.Is(result.Err, ErrValidation) {
+			t.Fatalf("runBatch(ops)[%d] = %v want %v", i, result.Err, ErrValidation)
+		}
+	}
+}
+
+// test ApplyBatch(ops, false)
+// should apply every operation that can be applied
+func TestMockDbApplyBatch(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+
+	// act
+	results, err := sut.ApplyBatch(context.Background(), batchOperations(), false)
+
+	// assert
+	if err != nil {
+		t.Fatalf("ApplyBatch(ops) = %v want <nil>", err)
+	}
+
+	checkBatchResults(t, results, []int{3, 4, 1, 2, 0}, []error{nil, nil, nil, nil, ErrNotFound})
+
+	if fed, _ := sut.GetFederation(context.Background(), 1); fed == nil || fed.Owner != "updated" {
+		t.Fatalf("GetFederation(1) = %v want updated", fed)
+	}
+
+	if fed, _ := sut.GetFederation(context.Background(), 2); fed != nil {
+		t.Fatalf("GetFederation(2) = %v want deleted", fed)
+	}
+}
+
+// test ApplyBatch(ops, true) with a failing operation
+// should apply nothing and abort the other operations
+func TestMockDbApplyBatchAtomic(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	want := map[int]*api.Federation{
+		1: {Id: 1, Owner: "Owner 1", Version: 1},
+		2: {Id: 2, Owner: "Owner 2", Version: 1},
+	}
+
+	// act
+	results, err := sut.ApplyBatch(context.Background(), batchOperations(), true)
+
+	// assert
+	if err != nil {
+		t.Fatalf("ApplyBatch(ops) = %v want <nil>", err)
+	}
+
+	checkBatchResults(t, results, nil, []error{ErrBatchAborted, ErrBatchAborted, ErrBatchAborted, ErrBatchAborted, ErrNotFound})
+
+	if !reflect.DeepEqual(sut.federations, want) {
+		t.Fatalf("ApplyBatch(ops) = %v want %v unchanged", sut.federations, want)
+	}
+}
+
+// test ApplyBatch(ops, true) without failures
+// should apply every operation
+func TestMockDbApplyBatchAtomicSuccess(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	ops := batchOperations()[:4]
+
+	// act
+	results, err := sut.ApplyBatch(context.Background(), ops, true)
+
+	// assert
+	if err != nil {
+		t.Fatalf("ApplyBatch(ops) = %v want <nil>", err)
+	}
+
+	checkBatchResults(t, results, []int{3, 4, 1, 2}, []error{nil, nil, nil, nil})
+
+	if len(sut.federations) != 4 || sut.lastId != 4 {
+		t.Fatalf("ApplyBatch(ops) = %d federations, last id %d want 4, 4", len(sut.federations), sut.lastId)
+	}
+}
@@ -0,0 +1,298 @@
+package tools
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorest/api"
+)
+
+// defaultCacheEntries bounds the entries of a CachedRepository configured
+// without a maximum.
+const defaultCacheEntries = 1000
+
+// CacheStats counts the lookups of a CachedRepository.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+// CachedRepository is a read-through cache in front of another
+// FederationRepository. it keeps the results of GetFederation,
+// GetFederations and SearchFederations for a TTL and evicts the least
+// recently used entries beyond its maximum. every write drops the cached
+// federation and every cached listing, since any write may change a
+// listing.
+type CachedRepository struct {
+	repo       FederationRepository
+	ttl        time.Duration
+	maxEntries int
+	// now is a variable so tests can control expiry.
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the entries, most recently used first.
+	lru *list.List
+	// generation increases on every write. a read only fills the cache if
+	// no write started while it ran, so stale results are never stored.
+	generation uint64
+	stats      CacheStats
+}
+
+// cacheEntry is a cached result, owned by the cache.
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+// NewCachedRepository wraps repo with a cache keeping results for ttl.
+// maxEntries <= 0 selects the default maximum.
+func NewCachedRepository(repo FederationRepository, ttl time.Duration, maxEntries int) *CachedRepository {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+
+	return &CachedRepository{
+		repo:       repo,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Unwrap returns the cached repository.
+func (c *CachedRepository) Unwrap() FederationRepository {
+	return c.repo
+}
+
+// Stats returns the counters of the cache.
+func (c *CachedRepository) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// get returns the live entry for key and the current generation.
+func (c *CachedRepository) get(key string) (any, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			return entry.value, true, c.generation
+		}
+		c.remove(elem)
+	}
+	c.stats.Misses++
+	return nil, false, c.generation
+}
+
+// put stores value under key unless a write happened since generation.
+func (c *CachedRepository) put(key string, value any, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: c.now().Add(c.ttl)})
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops elem. callers must hold mu.
+func (c *CachedRepository) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// invalidate drops the entries a write to the federations ids may have
+// changed: the federations themselves and every listing.
+func (c *CachedRepository) invalidate(ids ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, id := range ids {
+		if elem, ok := c.entries[federationKey(id)]; ok {
+			c.remove(elem)
+		}
+	}
+	for key, elem := range c.entries {
+		if key[0] == 'q' {
+			c.remove(elem)
+		}
+	}
+}
+
+// invalidateAll empties the cache, for writes to unknown federations.
+func (c *CachedRepository) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+// federationKey, queryKey and searchKey name cache entries. listings and
+// searches start with q so invalidate can find them.
+func federationKey(id int) string {
+	return "f" + strconv.Itoa(id)
+}
+
+func queryKey(query FederationQuery) string {
+	data, _ := json.Marshal(query)
+	return "q" + string(data)
+}
+
+func searchKey(query SearchQuery) string {
+	data, _ := json.Marshal(query)
+	return "qsearch" + string(data)
+}
+
+// copyPage returns a copy of page sharing no federations with it.
+func copyPage(page *FederationPage) *FederationPage {
+	copied := *page
+	copied.Federations = make([]*api.Federation, len(page.Federations))
+	for i, fed := range page.Federations {
+		copied.Federations[i] = copyFederation(fed)
+	}
+	return &copied
+}
+
+// copySearchPage returns a copy of page sharing no federations with it.
+func copySearchPage(page *SearchPage) *SearchPage {
+	copied := *page
+	copied.Federations = make([]*api.Federation, len(page.Federations))
+	for i, fed := range page.Federations {
+		copied.Federations[i] = copyFederation(fed)
+	}
+	return &copied
+}
+
+func (c *CachedRepository) Setup(ctx context.Context) error {
+	return c.repo.Setup(ctx)
+}
+
+func (c *CachedRepository) Close() error {
+	c.invalidateAll()
+	return c.repo.Close()
+}
+
+func (c *CachedRepository) GetFederation(ctx context.Context, id int) (*api.Federation, error) {
+	key := federationKey(id)
+	value, ok, generation := c.get(key)
+	if ok {
+		return copyFederation(value.(*api.Federation)), nil
+	}
+
+	fed, err := c.repo.GetFederation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, copyFederation(fed), generation)
+	return fed, nil
+}
+
+func (c *CachedRepository) GetFederations(ctx context.Context, query FederationQuery) (*FederationPage, error) {
+	key := queryKey(query)
+	value, ok, generation := c.get(key)
+	if ok {
+		return copyPage(value.(*FederationPage)), nil
+	}
+
+	page, err := c.repo.GetFederations(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, copyPage(page), generation)
+	return page, nil
+}
+
+func (c *CachedRepository) SearchFederations(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	key := searchKey(query)
+	value, ok, generation := c.get(key)
+	if ok {
+		return copySearchPage(value.(*SearchPage)), nil
+	}
+
+	page, err := c.repo.SearchFederations(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, copySearchPage(page), generation)
+	return page, nil
+}
+
+func (c *CachedRepository) AddFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	fed, err := c.repo.AddFederation(ctx, federation)
+	if err == nil {
+		c.invalidate(fed.Id)
+	}
+	return fed, err
+}
+
+func (c *CachedRepository) UpdateFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	defer c.invalidate(federation.Id)
+	return c.repo.UpdateFederation(ctx, federation)
+}
+
+func (c *CachedRepository) PatchFederation(ctx context.Context, id int, version int, patch FederationPatch) (*api.Federation, error) {
+	defer c.invalidate(id)
+	return c.repo.PatchFederation(ctx, id, version, patch)
+}
+
+func (c *CachedRepository) ApplyBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	// creates may take any id.
+	defer c.invalidateAll()
+	return c.repo.ApplyBatch(ctx, ops, atomic)
+}
+
+func (c *CachedRepository) DeleteFederation(ctx context.Context, id int, version int) error {
+	// the delete policy may delete or orphan any descendant.
+	defer c.invalidateAll()
+	return c.repo.DeleteFederation(ctx, id, version)
+}
+
+func (c *CachedRepository) RestoreFederation(ctx context.Context, id int, version int) (*api.Federation, error) {
+	defer c.invalidate(id)
+	return c.repo.RestoreFederation(ctx, id, version)
+}
+
+func (c *CachedRepository) TransitionFederation(ctx context.Context, id int, version int, action string) (*api.Federation, error) {
+	defer c.invalidate(id)
+	return c.repo.TransitionFederation(ctx, id, version, action)
+}
+
+func (c *CachedRepository) PurgeFederations(ctx context.Context, deletedBefore time.Time) (int, error) {
+	defer c.invalidateAll()
+	return c.repo.PurgeFederations(ctx, deletedBefore)
+}
+
+// GetHistory is not cached, every write changes it.
+func (c *CachedRepository) GetHistory(ctx context.Context, id int, query HistoryQuery) (*HistoryPage, error) {
+	return c.repo.GetHistory(ctx, id, query)
+}
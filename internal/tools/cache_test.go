@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// countingRepository counts the reads reaching the repository behind a cache.
+type countingRepository struct {
+	*mockDb
+	gets, lists int
+}
+
+func (r *countingRepository) GetFederation(ctx context.Context, id int) (*api.Federation, error) {
+	r.gets++
+	return r.mockDb.GetFederation(ctx, id)
+}
+
+func (r *countingRepository) GetFederations(ctx context.Context, query FederationQuery) (*FederationPage, error) {
+	r.lists++
+	return r.mockDb.GetFederations(ctx, query)
+}
+
+func newCountingCache(ttl time.Duration, maxEntries int) (*CachedRepository, *countingRepository) {
+	repo := &countingRepository{mockDb: newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})}
+	return NewCachedRepository(repo, ttl, maxEntries), repo
+}
+
+// test CachedRepository reads of the same federation and listing
+// should reach the repository once and count hits and misses
+func TestCachedRepositoryHits(t *testing.T) {
+	// arrange
+	sut, repo := newCountingCache(time.Minute, 0)
+
+	// act
+	for i := 0; i < 3; i++ {
+		sut.GetFederation(context.Background(), 1)
+		sut.GetFederations(context.Background(), FederationQuery{Limit: 10})
+	}
+	fed, _ := sut.GetFederation(context.Background(), 1)
+	fed.Owner = "mutated by caller"
+	again, _ := sut.GetFederation(context.Background(), 1)
+
+	// assert
+	if repo.gets != 1 || repo.lists != 1 {
+		t.Fatalf("repository reads = %d gets, %d lists want 1, 1", repo.gets, repo.lists)
+	}
+
+	if want := (CacheStats{Hits: 6, Misses: 2, Entries: 2}); sut.Stats() != want {
+		t.Fatalf("Stats() = %+v want %+v", sut.Stats(), want)
+	}
+
+	if again.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(1) = %q want the cached value", again.Owner)
+	}
+}
+
+// test CachedRepository reads after the TTL
+// should read the repository again
+func TestCachedRepositoryExpiry(t *testing.T) {
+	// arrange
+	sut, repo := newCountingCache(time.Minute, 0)
+	now := time.Now()
+	sut.now = func() time.Time { return now }
+	sut.GetFederation(context.Background(), 1)
+
+	// act
+	now = now.Add(time.Minute)
+	sut.GetFederation(context.Background(), 1)
+
+	// assert
+	if repo.gets != 2 {
+		t.Fatalf("repository gets = %d want 2", repo.gets)
+	}
+}
+
+// test CachedRepository with more reads than entries
+// should evict the least recently used entry
+func TestCachedRepositoryEviction(t *testing.T) {
+	// arrange
+	sut, repo := newCountingCache(time.Minute, 2)
+	sut.GetFederation(context.Background(), 1)
+	sut.GetFederation(context.Background(), 2)
+	sut.GetFederation(context.Background(), 1)
+
+	// act
+	sut.GetFederations(context.Background(), FederationQuery{})
+	sut.GetFederation(context.Background(), 1)
+	sut.GetFederation(context.Background(), 2)
+
+	// assert
+	if repo.gets != 3 {
+		t.Fatalf("repository gets = %d want 3", repo.gets)
+	}
+
+	if stats := sut.Stats(); stats.Evictions != 2 || stats.Entries != 2 {
+		t.Fatalf("Stats() = %+v want 2 evictions and 2 entries", stats)
+	}
+}
+
+// test CachedRepository reads after writes
+// should not return stale federations or listings
+func TestCachedRepositoryInvalidation(t *testing.T) {
+	// arrange
+	sut, _ := newCountingCache(time.Minute, 0)
+	ctx := context.Background()
+	writes := []struct {
+		name  string
+		write func() error
+		check func() bool
+	}{
+		{"AddFederation", func() error {
+			_, err := sut.AddFederation(ctx, &api.Federation{Id: 3, Owner: "Owner 3"})
+			return err
+		}, func() bool {
+			page, _ := sut.GetFederations(ctx, FederationQuery{})
+			return page.Total == 3
+		}},
+		{"UpdateFederation", func() error {
+			_, err := sut.UpdateFederation(ctx, &api.Federation{Id: 1, Owner: "new owner"})
+			return err
+		}, func() bool {
+			fed, _ := sut.GetFederation(ctx, 1)
+			return fed.Owner == "new owner"
+		}},
+		{"DeleteFederation", func() error {
+			return sut.DeleteFederation(ctx, 2, 0)
+		}, func() bool {
+			_, err := sut.GetFederation(ctx, 2)
+			page, _ := sut.GetFederations(ctx, FederationQuery{})
+			return err != nil && page.Total == 2
+		}},
+		{"ApplyBatch", func() error {
+			_, err := sut.ApplyBatch(ctx, []BatchOperation{{Op: BatchUpdate, Id: 3, Federation: &api.Federation{Owner: "batch owner"}}}, true)
+			return err
+		}, func() bool {
+			fed, _ := sut.GetFederation(ctx, 3)
+			return fed.Owner == "batch owner"
+		}},
+	}
+
+	for _, tt := range writes {
+		sut.GetFederation(ctx, 1)
+		sut.GetFederation(ctx, 2)
+		sut.GetFederation(ctx, 3)
+		sut.GetFederations(ctx, FederationQuery{})
+
+		// act
+		if err := tt.write(); err != nil {
+			t.Fatalf("%s() = %v want <nil>", tt.name, err)
+		}
+
+		// assert
+		if !tt.check() {
+			t.Fatalf("reads after %s() returned cached data", tt.name)
+		}
+	}
+}
+
+// test CachedRepository read racing a write
+// should not store the result read before the write
+func TestCachedRepositoryStaleFill(t *testing.T) {
+	// arrange
+	sut, _ := newCountingCache(time.Minute, 0)
+	_, _, generation := sut.get(federationKey(1))
+	stale, _ := sut.repo.GetFederation(context.Background(), 1)
+	sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "new owner"})
+
+	// act
+	sut.put(federationKey(1), stale, generation)
+	fed, _ := sut.GetFederation(context.Background(), 1)
+
+	// assert
+	if fed.Owner != "new owner" {
+		t.Fatalf("GetFederation(1) = %q want %q", fed.Owner, "new owner")
+	}
+}
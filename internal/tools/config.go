@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// repository backends selectable through Config.Store.
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+	StoreSQL    = "sql"
+)
+
+// policies for ids sent by clients, selectable through Config.ClientIds.
+const (
+	ClientIdsIgnore = "ignore"
+	ClientIdsReject = "reject"
+)
+
+// Config holds the federation settings read from the environment.
+type Config struct {
+	// Store selects the FederationRepository backend. defaults to StoreMemory.
+	Store string
+	// DataDir is the directory used by the file store.
+	DataDir string
+	// CompactEvery is the number of log records the file store writes
+	// before compacting them into a snapshot.
+	CompactEvery int
+	// SQLDriver and SQLDSN identify the database used by the sql store.
+	// the driver must be registered with database/sql by the program.
+	SQLDriver string
+	SQLDSN    string
+	// SQLPlaceholder is the driver's placeholder style, question (default) or dollar.
+	SQLPlaceholder string
+	// IdGenerator names the generator of new federation ids, sequence
+	// (default), random or time.
+	IdGenerator string
+	// ClientIds says what happens to ids sent on create, ignore (default)
+	// or reject.
+	ClientIds string
+	// RequireIfMatch makes updates and deletes without an If-Match header
+	// fail. defaults to true.
+	RequireIfMatch bool
+	// DeletedRetention is how long deleted federations are kept before they
+	// are purged, 0 keeps them forever. defaults to 30 days.
+	DeletedRetention time.Duration
+	// PurgeInterval is the time between purges. defaults to an hour.
+	PurgeInterval time.Duration
+	// FaultInjection wraps the repository in a FaultInjector. it is set
+	// when Faults is.
+	FaultInjection bool
+	// Faults is the JSON FaultConfig the injector starts with.
+	Faults string
+	// FaultSeed seeds the injector, 0 picks a random seed.
+	FaultSeed int64
+	// CacheTTL is how long reads are cached, 0 (default) disables the cache.
+	CacheTTL time.Duration
+	// CacheEntries bounds the cached reads, 0 selects 1000.
+	CacheEntries int
+	// SeedFile is a JSON or NDJSON file of federations stored by Setup. the
+	// memory and file stores start with two sample federations without it.
+	SeedFile string
+	// SeedMode says what happens to seed federations already stored, skip
+	// (default) or upsert.
+	SeedMode string
+	// OwnerTransfers makes owners change through transfers only, updates
+	// and patches changing the owner fail. defaults to false.
+	OwnerTransfers bool
+	// TransferTTL is how long a transfer stays pending. defaults to
+	// DefaultTransferTTL.
+	TransferTTL time.Duration
+	// Organisations lists the organisations principals act for in
+	// transfers, see ParseOrganisations.
+	Organisations string
+	// ParentDelete says what happens to the live children of a deleted
+	// federation, restrict (default), cascade or orphan.
+	ParentDelete string
+}
+
+// default retention of deleted federations.
+const (
+	defaultDeletedRetention = 30 * 24 * time.Hour
+	defaultPurgeInterval    = time.Hour
+)
+
+// LoadConfig reads the federation configuration from environment variables:
+//
+//	FEDERATION_STORE             memory (default), file or sql
+//	FEDERATION_DATA_DIR          file store directory, defaults to ./data
+//	FEDERATION_COMPACT_EVERY     log records between snapshots
+//	FEDERATION_SQL_DRIVER        database/sql driver name
+//	FEDERATION_SQL_DSN           database/sql data source name
+//	FEDERATION_SQL_PLACEHOLDER   question (default) or dollar
+//	FEDERATION_ID_GENERATOR      sequence (default), random or time
+//	FEDERATION_CLIENT_IDS        ignore (default) or reject
+//	FEDERATION_REQUIRE_IF_MATCH  true (default) or false
+//	FEDERATION_DELETED_RETENTION 720h (default), 0 keeps deleted federations
+//	FEDERATION_PURGE_INTERVAL    1h (default) between purges
+//	FEDERATION_FAULT_INJECTION   true wraps the store in a fault injector
+//	FEDERATION_FAULTS            JSON faults per method, enables injection
+//	FEDERATION_FAULT_SEED        seed of the injected faults
+//	FEDERATION_CACHE_TTL         caches reads for this long, 0 (default) disables
+//	FEDERATION_CACHE_ENTRIES     cached reads, defaults to 1000
+//	FEDERATION_SEED_FILE         JSON or NDJSON federations stored on setup
+//	FEDERATION_SEED_MODE         skip (default) or upsert stored federations
+//	FEDERATION_OWNER_TRANSFERS   true changes owners through transfers only
+//	FEDERATION_TRANSFER_TTL      72h (default) before pending transfers expire
+//	FEDERATION_ORGANISATIONS     principal=organisation pairs acting in transfers
+//	FEDERATION_PARENT_DELETE     restrict (default), cascade or orphan children
+func LoadConfig() Config {
+	cfg := Config{
+		Store:            os.Getenv("FEDERATION_STORE"),
+		DataDir:          os.Getenv("FEDERATION_DATA_DIR"),
+		SQLDriver:        os.Getenv("FEDERATION_SQL_DRIVER"),
+		SQLDSN:           os.Getenv("FEDERATION_SQL_DSN"),
+		SQLPlaceholder:   os.Getenv("FEDERATION_SQL_PLACEHOLDER"),
+		IdGenerator:      os.Getenv("FEDERATION_ID_GENERATOR"),
+		ClientIds:        os.Getenv("FEDERATION_CLIENT_IDS"),
+		RequireIfMatch:   true,
+		DeletedRetention: defaultDeletedRetention,
+		PurgeInterval:    defaultPurgeInterval,
+		Faults:           os.Getenv("FEDERATION_FAULTS"),
+		SeedFile:         os.Getenv("FEDERATION_SEED_FILE"),
+		SeedMode:         os.Getenv("FEDERATION_SEED_MODE"),
+		TransferTTL:      DefaultTransferTTL,
+		Organisations:    os.Getenv("FEDERATION_ORGANISATIONS"),
+		ParentDelete:     os.Getenv("FEDERATION_PARENT_DELETE"),
+	}
+	if cfg.Store == "" {
+		cfg.Store = StoreMemory
+	}
+	if cfg.IdGenerator == "" {
+		cfg.IdGenerator = IdSequence
+	}
+	if cfg.ClientIds == "" {
+		cfg.ClientIds = ClientIdsIgnore
+	}
+	if cfg.ParentDelete == "" {
+		cfg.ParentDelete = DeleteRestrict
+	}
+	if cfg.SeedMode == "" {
+		cfg.SeedMode = SeedSkip
+	}
+	if cfg.DataDir == "" {
+		cfg.DataDir = "./data"
+	}
+	if n, err := strconv.Atoi(os.Getenv("FEDERATION_COMPACT_EVERY")); err == nil {
+		cfg.CompactEvery = n
+	}
+	if b, err := strconv.ParseBool(os.Getenv("FEDERATION_REQUIRE_IF_MATCH")); err == nil {
+		cfg.RequireIfMatch = b
+	}
+	if d, err := time.ParseDuration(os.Getenv("FEDERATION_DELETED_RETENTION")); err == nil && d >= 0 {
+		cfg.DeletedRetention = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("FEDERATION_PURGE_INTERVAL")); err == nil && d > 0 {
+		cfg.PurgeInterval = d
+	}
+	if b, err := strconv.ParseBool(os.Getenv("FEDERATION_FAULT_INJECTION")); err == nil {
+		cfg.FaultInjection = b
+	}
+	cfg.FaultInjection = cfg.FaultInjection || cfg.Faults != ""
+	if n, err := strconv.ParseInt(os.Getenv("FEDERATION_FAULT_SEED"), 10, 64); err == nil {
+		cfg.FaultSeed = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("FEDERATION_CACHE_TTL")); err == nil && d >= 0 {
+		cfg.CacheTTL = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("FEDERATION_CACHE_ENTRIES")); err == nil && n > 0 {
+		cfg.CacheEntries = n
+	}
+	if b, err := strconv.ParseBool(os.Getenv("FEDERATION_OWNER_TRANSFERS")); err == nil {
+		cfg.OwnerTransfers = b
+	}
+	if d, err := time.ParseDuration(os.Getenv("FEDERATION_TRANSFER_TTL")); err == nil && d > 0 {
+		cfg.TransferTTL = d
+	}
+
+	return cfg
+}
@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+// test LoadConfig() without environment
+// should return defaults
+func TestLoadConfigDefaults(t *testing.T) {
+	// arrange
+	t.Setenv("FEDERATION_STORE", "")
+	t.Setenv("FEDERATION_DATA_DIR", "")
+	t.Setenv("FEDERATION_COMPACT_EVERY", "")
+	t.Setenv("FEDERATION_SQL_DRIVER", "")
+	t.Setenv("FEDERATION_SQL_DSN", "")
+	t.Setenv("FEDERATION_SQL_PLACEHOLDER", "")
+	t.Setenv("FEDERATION_ID_GENERATOR", "")
+	t.Setenv("FEDERATION_CLIENT_IDS", "")
+	t.Setenv("FEDERATION_REQUIRE_IF_MATCH", "")
+	t.Setenv("FEDERATION_DELETED_RETENTION", "")
+	t.Setenv("FEDERATION_PURGE_INTERVAL", "")
+	t.Setenv("FEDERATION_FAULT_INJECTION", "")
+	t.Setenv("FEDERATION_FAULTS", "")
+	t.Setenv("FEDERATION_FAULT_SEED", "")
+	t.Setenv("FEDERATION_CACHE_TTL", "")
+	t.Setenv("FEDERATION_CACHE_ENTRIES", "")
+	t.Setenv("FEDERATION_SEED_FILE", "")
+	t.Setenv("FEDERATION_SEED_MODE", "")
+	t.Setenv("FEDERATION_OWNER_TRANSFERS", "")
+	t.Setenv("FEDERATION_TRANSFER_TTL", "")
+	t.Setenv("FEDERATION_ORGANISATIONS", "")
+	t.Setenv("FEDERATION_PARENT_DELETE", "")
+	want := Config{
+		Store:            StoreMemory,
+		DataDir:          "./data",
+		IdGenerator:      IdSequence,
+		ClientIds:        ClientIdsIgnore,
+		RequireIfMatch:   true,
+		DeletedRetention: 30 * 24 * time.Hour,
+		PurgeInterval:    time.Hour,
+		SeedMode:         SeedSkip,
+		TransferTTL:      72 * time.Hour,
+		ParentDelete:     DeleteRestrict,
+	}
+
+	// act
+	cfg := LoadConfig()
+
+	// assert
+	if cfg != want {
+		t.Fatalf("LoadConfig() = %v want %v", cfg, want)
+	}
+}
+
+// test LoadConfig() with environment
+// should return configured values
+func TestLoadConfigEnv(t *testing.T) {
+	// arrange
+	t.Setenv("FEDERATION_STORE", "file")
+	t.Setenv("FEDERATION_DATA_DIR", "/data")
+	t.Setenv("FEDERATION_COMPACT_EVERY", "10")
+	t.Setenv("FEDERATION_SQL_DRIVER", "postgres")
+	t.Setenv("FEDERATION_SQL_DSN", "postgres://localhost/gorest")
+	t.Setenv("FEDERATION_SQL_PLACEHOLDER", "dollar")
+	t.Setenv("FEDERATION_ID_GENERATOR", "time")
+	t.Setenv("FEDERATION_CLIENT_IDS", "reject")
+	t.Setenv("FEDERATION_REQUIRE_IF_MATCH", "false")
+	t.Setenv("FEDERATION_DELETED_RETENTION", "0")
+	t.Setenv("FEDERATION_PURGE_INTERVAL", "10m")
+	t.Setenv("FEDERATION_FAULT_INJECTION", "")
+	t.Setenv("FEDERATION_FAULTS", `{"*":{"errorRate":0.1}}`)
+	t.Setenv("FEDERATION_FAULT_SEED", "42")
+	t.Setenv("FEDERATION_CACHE_TTL", "30s")
+	t.Setenv("FEDERATION_CACHE_ENTRIES", "50")
+	t.Setenv("FEDERATION_SEED_FILE", "/seed/federations.ndjson")
+	t.Setenv("FEDERATION_SEED_MODE", "upsert")
+	t.Setenv("FEDERATION_OWNER_TRANSFERS", "true")
+	t.Setenv("FEDERATION_TRANSFER_TTL", "24h")
+	t.Setenv("FEDERATION_ORGANISATIONS", "token:8d969eef6eca=Owner 1")
+	t.Setenv("FEDERATION_PARENT_DELETE", "cascade")
+	want := Config{
+		Store:          StoreFile,
+		DataDir:        "/data",
+		CompactEvery:   10,
+		SQLDriver:      "postgres",
+		SQLDSN:         "postgres://localhost/gorest",
+		SQLPlaceholder: PlaceholderDollar,
+		IdGenerator:    IdTime,
+		ClientIds:      ClientIdsReject,
+		PurgeInterval:  10 * time.Minute,
+		FaultInjection: true,
+		Faults:         `{"*":{"errorRate":0.1}}`,
+		FaultSeed:      42,
+		CacheTTL:       30 * time.Second,
+		CacheEntries:   50,
+		SeedFile:       "/seed/federations.ndjson",
+		SeedMode:       SeedUpsert,
+		OwnerTransfers: true,
+		TransferTTL:    24 * time.Hour,
+		Organisations:  "token:8d969eef6eca=Owner 1",
+		ParentDelete:   DeleteCascade,
+	}
+
+	// act
+	cfg := LoadConfig()
+
+	// assert
+	if cfg != want {
+		t.Fatalf("LoadConfig() = %v want %v", cfg, want)
+	}
+}
@@ -0,0 +1,49 @@
+package tools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorest/internal/tools"
+	"gorest/internal/tools/repotest"
+)
+
+// opened sets repo up and closes it on cleanup.
+func opened(t *testing.T, repo tools.FederationRepository) tools.FederationRepository {
+	t.Helper()
+	if err := repo.Setup(context.Background()); err != nil {
+		t.Fatalf("Setup() = %v want <nil>", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// test every repository and decorator
+// should honour the FederationRepository contract
+func TestConformance(t *testing.T) {
+	factories := map[string]repotest.Factory{
+		"mockDb": func(t *testing.T) tools.FederationRepository {
+			return opened(t, tools.NewMockDb())
+		},
+		"fileDb": func(t *testing.T) tools.FederationRepository {
+			return opened(t, tools.NewFileDb(t.TempDir(), 0))
+		},
+		// the fakesql driver is registered by the internal tests.
+		"sqlDb": func(t *testing.T) tools.FederationRepository {
+			return opened(t, tools.NewSqlDb("fakesql", t.Name(), ""))
+		},
+		"FaultInjector": func(t *testing.T) tools.FederationRepository {
+			return opened(t, tools.NewFaultInjector(tools.NewMockDb(), nil, 1))
+		},
+		"CachedRepository": func(t *testing.T) tools.FederationRepository {
+			return opened(t, tools.NewCachedRepository(tools.NewMockDb(), time.Minute, 0))
+		},
+	}
+
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			repotest.Run(t, factory)
+		})
+	}
+}
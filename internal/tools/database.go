@@ -1,24 +1,252 @@
 package tools
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
 	"gorest/api"
 )
 
+// FederationRepository stores federations.
+// every method stops early and returns ctx.Err() once ctx is done.
+// writes taking a version only apply when it matches the stored one,
+// 0 matches any version.
+// deleted federations are kept with DeletedAt set until they are purged.
+// only GetFederations with IncludeDeleted and RestoreFederation see them,
+// every other method reports them as not found.
+// every write records a change with the principal of its context, see
+// WithPrincipal, in the history of the federation.
 type FederationRepository interface {
-	Setup() error
-	AddFederation(*api.Federation) (int, error)
-	GetFederation(int) *api.Federation
-	GetFederations() []*api.Federation
-	UpdateFederation(*api.Federation) (int, error)
-	DeleteFederation(int) (int, error)
-}
-
-func NewFederationRepository() (*FederationRepository, error) {
-	var repo FederationRepository = new(mockDb)
-	if err := repo.Setup(); err != nil {
-		ErrorLogger.Println(err.Error())
+	Setup(context.Context) error
+	Close() error
+	AddFederation(context.Context, *api.Federation) (*api.Federation, error)
+	GetFederation(context.Context, int) (*api.Federation, error)
+	GetFederations(context.Context, FederationQuery) (*FederationPage, error)
+	// SearchFederations ranks the live federations whose owner contains the
+	// query, using an index kept up to date by every write.
+	SearchFederations(context.Context, SearchQuery) (*SearchPage, error)
+	UpdateFederation(context.Context, *api.Federation) (*api.Federation, error)
+	PatchFederation(ctx context.Context, id int, version int, patch FederationPatch) (*api.Federation, error)
+	// ApplyBatch runs ops in order and returns a result for each. an atomic
+	// batch applies every operation or none, stopping at the first failure.
+	// the error is only set when the batch could not run at all.
+	ApplyBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error)
+	DeleteFederation(ctx context.Context, id int, version int) error
+	RestoreFederation(ctx context.Context, id int, version int) (*api.Federation, error)
+	// TransitionFederation runs a lifecycle action, such as ActionActivate,
+	// on a live federation. actions the state does not allow fail with a
+	// StateError.
+	TransitionFederation(ctx context.Context, id int, version int, action string) (*api.Federation, error)
+	// PurgeFederations removes federations deleted before deletedBefore for
+	// good and returns how many it removed.
+	PurgeFederations(ctx context.Context, deletedBefore time.Time) (int, error)
+	// GetHistory returns the changes of a federation, deleted or not, newest
+	// first. the history is purged along with the federation.
+	GetHistory(ctx context.Context, id int, query HistoryQuery) (*HistoryPage, error)
+}
+
+// timeNow returns the time recorded by repositories: UTC and truncated to
+// the microseconds most databases keep. it is a variable so tests can
+// control the clock.
+var timeNow = func() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// wrapper is implemented by repositories decorating another one.
+type wrapper interface {
+	Unwrap() FederationRepository
+}
+
+// FindRepository returns the first repository of type T in the chain of
+// decorators starting at repo, like errors.As does for errors.
+func FindRepository[T FederationRepository](repo FederationRepository) (T, bool) {
+	for repo != nil {
+		if found, ok := repo.(T); ok {
+			return found, true
+		}
+		w, ok := repo.(wrapper)
+		if !ok {
+			break
+		}
+		repo = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// idAssigner is implemented by repositories that generate ids.
+type idAssigner interface {
+	setIdGenerator(IdGenerator)
+}
+
+// dependent is implemented by stores keeping data that belongs to
+// federations, like members and transfers, and goes away with them.
+type dependent interface {
+	// removeFederations drops the data of the deleted federations ids.
+	removeFederations(ids []int)
+}
+
+// dependentsHolder is implemented by repositories that tell dependents
+// about every federation they delete or purge.
+type dependentsHolder interface {
+	FederationRepository
+	addDependent(dependent)
+}
+
+// dependents are the stores a repository tells about deletes. they are
+// told once the delete is committed and the repository lock released, as
+// they may be waiting on the repository themselves.
+type dependents struct {
+	mu   sync.Mutex
+	list []dependent
+}
+
+// addDependent implements dependentsHolder.
+func (d *dependents) addDependent(dep dependent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.list = append(d.list, dep)
+}
+
+// removeFederations tells every dependent that the federations ids are
+// deleted.
+func (d *dependents) removeFederations(ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	list := slices.Clone(d.list)
+	d.mu.Unlock()
+	for _, dep := range list {
+		dep.removeFederations(ids)
+	}
+}
+
+// dependOn registers dep with the repository behind federations, when it
+// tells dependents about deletes.
+func dependOn(federations FederationRepository, dep dependent) {
+	if holder, ok := FindRepository[dependentsHolder](federations); ok {
+		holder.addDependent(dep)
+	}
+}
+
+// OpenFederationRepository returns the backend selected by cfg.
+// the caller owns the repository and must call Setup before use and
+// Close on shutdown.
+func OpenFederationRepository(cfg Config) (FederationRepository, error) {
+	ids, err := NewIdGenerator(cfg.IdGenerator)
+	if err != nil {
 		return nil, err
 	}
 
-	return &repo, nil
+	// a seed file replaces the sample federations.
+	var records []SeedRecord
+	samples := defaultFederations
+	if cfg.SeedFile != "" {
+		if cfg.SeedMode != SeedSkip && cfg.SeedMode != SeedUpsert {
+			return nil, fmt.Errorf("unknown seed mode %q", cfg.SeedMode)
+		}
+		if records, err = ReadSeedFile(cfg.SeedFile); err != nil {
+			return nil, err
+		}
+		samples = nil
+	}
+
+	var repo FederationRepository
+	switch cfg.Store {
+	case StoreMemory:
+		repo = NewMockDb(samples...)
+	case StoreFile:
+		repo = NewFileDb(cfg.DataDir, cfg.CompactEvery, samples...)
+	case StoreSQL:
+		repo = NewSqlDb(cfg.SQLDriver, cfg.SQLDSN, cfg.SQLPlaceholder)
+	default:
+		return nil, fmt.Errorf("unknown federation store %q", cfg.Store)
+	}
+
+	repo.(idAssigner).setIdGenerator(ids)
+	if cfg.ParentDelete != "" {
+		if !slices.Contains(deletePolicies, cfg.ParentDelete) {
+			return nil, fmt.Errorf("unknown parent delete policy %q", cfg.ParentDelete)
+		}
+		repo.(deletePolicer).setDeletePolicy(cfg.ParentDelete)
+	}
+
+	// seeding goes behind the injected faults, they would fail Setup.
+	if cfg.SeedFile != "" {
+		repo = &seededRepository{FederationRepository: repo, records: records, mode: cfg.SeedMode}
+	}
+
+	if cfg.FaultInjection {
+		faults := FaultConfig{}
+		if cfg.Faults != "" {
+			if faults, err = ParseFaultConfig([]byte(cfg.Faults)); err != nil {
+				return nil, err
+			}
+		}
+		repo = NewFaultInjector(repo, faults, cfg.FaultSeed)
+	}
+	// the cache goes in front of the injected faults, like it would in
+	// front of a real outage.
+	if cfg.CacheTTL > 0 {
+		repo = NewCachedRepository(repo, cfg.CacheTTL, cfg.CacheEntries)
+	}
+	return repo, nil
+}
+
+// the changes below are shared by the repositories' modify.
+
+// updateFields copies the fields a client may update from federation.
+// optional fields it leaves empty keep their stored value, so clients
+// sending only an owner never clear them. PatchFederation clears fields.
+func updateFields(federation *api.Federation) func(*api.Federation) error {
+	return func(fed *api.Federation) error {
+		if err := validateFederation(federation); err != nil {
+			return err
+		}
+		update := copyFederation(federation)
+		fed.Owner = update.Owner
+		if update.Name != "" {
+			fed.Name = update.Name
+		}
+		if update.Description != "" {
+			fed.Description = update.Description
+		}
+		if len(update.Labels) > 0 {
+			fed.Labels = update.Labels
+		}
+		if update.ParentId != nil {
+			fed.ParentId = update.ParentId
+		}
+		return nil
+	}
+}
+
+// stampCreated sets the timestamps of a new federation, which enters its
+// first state as it is created.
+func stampCreated(fed *api.Federation) {
+	now := timeNow()
+	createdAt, updatedAt, stateChangedAt := now, now, now
+	fed.CreatedAt, fed.UpdatedAt, fed.StateChangedAt = &createdAt, &updatedAt, &stateChangedAt
+}
+
+// stampUpdated sets the update time of a changed federation.
+func stampUpdated(fed *api.Federation) {
+	updatedAt := timeNow()
+	fed.UpdatedAt = &updatedAt
+}
+
+func markDeleted(fed *api.Federation) error {
+	deletedAt := timeNow()
+	fed.DeletedAt = &deletedAt
+	return nil
+}
+
+func unmarkDeleted(fed *api.Federation) error {
+	fed.DeletedAt = nil
+	return nil
 }
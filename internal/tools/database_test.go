@@ -1,70 +1,189 @@
 package tools
 
 import (
-	"bytes"
-	"math/rand"
+	"context"
+	"errors"
+	"io/fs"
 	"os"
-	"regexp"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
-// test NewFederationRepositoryError
-// should return nil repository and error
-func TestNewFederationRepositoryErro(t *testing.T) {
+// test OpenFederationRepository(Config) with each store
+// should return the matching backend
+func TestOpenFederationRepositoryStores(t *testing.T) {
 	// arrange
-	r = rand.New(rand.NewSource(1))
-	var errBuf bytes.Buffer
-	ErrorLogger.SetOutput(&errBuf)
-	defer func() {
-		ErrorLogger.SetOutput(os.Stderr)
-	}()
+	tests := []struct {
+		cfg      Config
+		wantType string
+	}{
+		{Config{Store: StoreMemory}, "*tools.mockDb"},
+		{Config{Store: StoreFile, DataDir: t.TempDir()}, "*tools.fileDb"},
+		{Config{Store: StoreSQL, SQLDriver: "fakesql", SQLDSN: t.Name()}, "*tools.sqlDb"},
+		{Config{Store: StoreMemory, FaultInjection: true}, "*tools.FaultInjector"},
+		{Config{Store: StoreMemory, FaultInjection: true, Faults: `{"Setup":{"errorRate":0.1}}`}, "*tools.FaultInjector"},
+		{Config{Store: StoreMemory, FaultInjection: true, CacheTTL: time.Second}, "*tools.CachedRepository"},
+	}
+
+	for _, tt := range tests {
+		// act
+		repo, err := OpenFederationRepository(tt.cfg)
+
+		// assert
+		if err != nil {
+			t.Fatalf("OpenFederationRepository(%v) = %v want <nil>", tt.cfg, err)
+		}
+
+		if got := reflect.TypeOf(repo).String(); got != tt.wantType {
+			t.Fatalf("OpenFederationRepository(%v) = %q want %q", tt.cfg, got, tt.wantType)
+		}
+	}
+}
 
-	wantError := regexp.MustCompile("random error")
-	var wantRepo *FederationRepository = nil
+// test OpenFederationRepository(Config) with unknown store
+// should return error
+func TestOpenFederationRepositoryUnknownStore(t *testing.T) {
+	// arrange
+	wantError := `unknown federation store "nosql"`
 
 	// act
-	repo, err := NewFederationRepository()
+	repo, err := OpenFederationRepository(Config{Store: "nosql"})
 
 	// assert
-	if repo != wantRepo {
-		t.Fatalf("NewFederationRepository() = %v want %v", repo, wantRepo)
+	if repo != nil {
+		t.Fatalf("OpenFederationRepository(cfg) = %v want <nil>", repo)
 	}
 
-	if !wantError.MatchString(err.Error()) {
-		t.Fatalf("NewFederationRepository() = %q want %q", err, wantError)
+	if err == nil || err.Error() != wantError {
+		t.Fatalf("OpenFederationRepository(cfg) = %v want %q", err, wantError)
 	}
+}
+
+// test OpenFederationRepository(Config) with unknown id generator
+// should return error
+func TestOpenFederationRepositoryUnknownIdGenerator(t *testing.T) {
+	// arrange
+	wantError := `unknown id generator "uuid"`
+
+	// act
+	_, err := OpenFederationRepository(Config{Store: StoreMemory, IdGenerator: "uuid"})
 
-	errOutput := errBuf.String()
-	if !wantError.MatchString(errOutput) {
-		t.Fatalf("NewFederationRepository() = %q want %q", errOutput, wantError)
+	// assert
+	if err == nil || err.Error() != wantError {
+		t.Fatalf("OpenFederationRepository(cfg) = %v want %q", err, wantError)
 	}
 }
 
-// test NewFederationRepository success
-// should return *FederationRepository
-func TestNewFederationRepositorySucess(t *testing.T) {
+// test OpenFederationRepository(Config) with a parent delete policy
+// should hand known policies to the store and reject unknown ones
+func TestOpenFederationRepositoryParentDelete(t *testing.T) {
 	// arrange
-	var wantError error = nil
-	var errBuf bytes.Buffer
-	ErrorLogger.SetOutput(&errBuf)
-	defer func() {
-		ErrorLogger.SetOutput(os.Stderr)
-	}()
+	wantError := `unknown parent delete policy "detach"`
+
+	// act
+	repo, err := OpenFederationRepository(Config{Store: StoreMemory, ParentDelete: DeleteOrphan})
+	_, unknownErr := OpenFederationRepository(Config{Store: StoreMemory, ParentDelete: "detach"})
+
+	// assert
+	if err != nil || repo.(*mockDb).deletePolicy != DeleteOrphan {
+		t.Fatalf("OpenFederationRepository(orphan) = %v, %v want a store orphaning children", repo, err)
+	}
 
+	if unknownErr == nil || unknownErr.Error() != wantError {
+		t.Fatalf("OpenFederationRepository(detach) = %v want %q", unknownErr, wantError)
+	}
+}
+
+// test OpenFederationRepository(Config) with invalid faults
+// should return a validation error
+func TestOpenFederationRepositoryInvalidFaults(t *testing.T) {
 	// act
-	repo, err := NewFederationRepository()
+	_, err := OpenFederationRepository(Config{Store: StoreMemory, FaultInjection: true, Faults: `{"Setup":{"errorRate":2}}`})
 
 	// assert
-	if repo == nil {
-		t.Fatal(`NewFederationRepository() = <nil> want "*FederationRepository"`)
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("OpenFederationRepository(cfg) = %v want %v", err, ErrValidation)
 	}
+}
+
+// test FindRepository[T](repo) on a chain of decorators
+// should find every repository of the chain and nothing else
+func TestFindRepository(t *testing.T) {
+	// arrange
+	store := newMockDb()
+	faults := NewFaultInjector(store, nil, 1)
+	sut := NewCachedRepository(faults, time.Second, 0)
+
+	// act
+	gotCache, cacheOk := FindRepository[*CachedRepository](sut)
+	gotFaults, faultsOk := FindRepository[*FaultInjector](sut)
+	gotStore, storeOk := FindRepository[*mockDb](sut)
+	_, sqlOk := FindRepository[*sqlDb](sut)
+
+	// assert
+	if !cacheOk || gotCache != sut || !faultsOk || gotFaults != faults || !storeOk || gotStore != store {
+		t.Fatalf("FindRepository(chain) did not find every decorator")
+	}
+
+	if sqlOk {
+		t.Fatalf("FindRepository[*sqlDb](chain) = true want false")
+	}
+}
+
+// test OpenFederationRepository(Config) with a seed file
+// should replace the sample federations with the seeded ones on Setup
+func TestOpenFederationRepositorySeed(t *testing.T) {
+	// arrange
+	path := filepath.Join(t.TempDir(), "federations.ndjson")
+	os.WriteFile(path, []byte(`{"id":7,"owner":"Owner 7"}`+"\n"), 0o644)
+	repo, err := OpenFederationRepository(Config{Store: StoreMemory, SeedFile: path, SeedMode: SeedSkip})
+	if err != nil {
+		t.Fatalf("OpenFederationRepository(cfg) = %v want <nil>", err)
+	}
+	defer repo.Close()
+
+	// act
+	err = repo.Setup(context.Background())
+	page, _ := repo.GetFederations(context.Background(), FederationQuery{})
+
+	// assert
+	if err != nil {
+		t.Fatalf("Setup() = %v want <nil>", err)
+	}
+
+	if page.Total != 1 || page.Federations[0].Id != 7 {
+		t.Fatalf("GetFederations() = %v want the seeded federation only", page.Federations)
+	}
+}
+
+// test OpenFederationRepository(Config) with an invalid seed
+// should return an error before anything is stored
+func TestOpenFederationRepositoryInvalidSeed(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`[{"id":0,"owner":"Owner"}]`), 0o644)
+	tests := []struct {
+		cfg       Config
+		wantError error
+	}{
+		{Config{Store: StoreMemory, SeedFile: invalid, SeedMode: SeedSkip}, ErrValidation},
+		{Config{Store: StoreMemory, SeedFile: filepath.Join(dir, "missing.json"), SeedMode: SeedSkip}, fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		// act
+		_, err := OpenFederationRepository(tt.cfg)
 
-	if err != wantError {
-		t.Fatalf("NewFederationRepository() = %v want %v", err, wantError)
+		// assert
+		if !errors.Is(err, tt.wantError) {
+			t.Fatalf("OpenFederationRepository(%v) = %v want %v", tt.cfg, err, tt.wantError)
+		}
 	}
 
-	errOutput := errBuf.String()
-	if errOutput != "" {
-		t.Fatalf(`NewFederationRepository() = %q want ""`, errOutput)
+	if _, err := OpenFederationRepository(Config{Store: StoreMemory, SeedFile: invalid, SeedMode: "merge"}); err == nil {
+		t.Fatalf("OpenFederationRepository(seed mode merge) = <nil> want an error")
 	}
 }
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorest/api"
+)
+
+// repository errors. they say what went wrong, not how to report it, so
+// every frontend maps them to its own responses with errors.Is.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrConflict      = errors.New("conflict")
+	ErrValidation    = errors.New("invalid")
+	ErrUnavailable   = errors.New("unavailable")
+	// ErrForbidden is returned when the caller may not act on a resource,
+	// like a transfer offered to someone else.
+	ErrForbidden = errors.New("forbidden")
+	// ErrVersionMismatch is returned when a write expects another version
+	// than the stored one.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// errRepositoryClosed is returned by repositories used before Setup or
+// after Close.
+var errRepositoryClosed = fmt.Errorf("repository closed: %w", ErrUnavailable)
+
+// FederationError is a failure concerning a single federation.
+// it unwraps to the underlying error, usually one of the Err values.
+type FederationError struct {
+	Id  int
+	Err error
+}
+
+func (e *FederationError) Error() string {
+	return fmt.Sprintf("federation %d %v", e.Id, e.Err)
+}
+
+func (e *FederationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError reports an invalid field. it matches ErrValidation.
+// Rule names the validate tag rule the field breaks, if any.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ValidationErrors are all the violations found in a value. it matches
+// ErrValidation and unwraps to each ValidationError.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, violation := range e {
+		messages[i] = violation.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, violation := range e {
+		errs[i] = violation
+	}
+	return errs
+}
+
+// notFound returns the error for a missing federation.
+func notFound(id int) error {
+	return &FederationError{Id: id, Err: ErrNotFound}
+}
+
+// versionMismatch returns the error for a stale version of a federation.
+func versionMismatch(id int) error {
+	return &FederationError{Id: id, Err: ErrVersionMismatch}
+}
+
+// alreadyExists returns the error for a duplicated federation.
+func alreadyExists(id int) error {
+	return &FederationError{Id: id, Err: ErrAlreadyExists}
+}
+
+// notDeleted returns the error for restoring a federation that is not
+// deleted.
+func notDeleted(id int) error {
+	return &FederationError{Id: id, Err: fmt.Errorf("%w: not deleted", ErrConflict)}
+}
+
+// noFreeId returns the error for a generator that kept picking taken ids.
+func noFreeId() error {
+	return fmt.Errorf("%w: no free id after %d attempts", ErrConflict, maxIdAttempts)
+}
+
+// validateFederation checks federation against the validate tags of
+// api.Federation, reporting every invalid field.
+func validateFederation(federation *api.Federation) error {
+	if err := validateStruct(federation); err != nil {
+		return &FederationError{Id: federation.Id, Err: err}
+	}
+	return nil
+}
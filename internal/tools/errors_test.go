@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// test FederationError wrapping a ValidationError
+// should match ErrValidation and expose both errors
+func TestFederationErrorUnwrap(t *testing.T) {
+	// arrange
+	err := fmt.Errorf("add: %w", &FederationError{Id: 3, Err: &ValidationError{Field: "owner", Message: "is required"}})
+	wantMessage := "add: federation 3 owner is required"
+
+	// act
+	var fedErr *FederationError
+	var validationErr *ValidationError
+	isFederationError := errors.As(err, &fedErr)
+	isValidationError := errors.As(err, &validationErr)
+
+	// assert
+	if err.Error() != wantMessage {
+		t.Fatalf("Error() = %q want %q", err, wantMessage)
+	}
+
+	if !errors.Is(err, ErrValidation) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("errors.Is(err, ErrValidation) = false want true")
+	}
+
+	if !isFederationError || fedErr.Id != 3 {
+		t.Fatalf("errors.As(err, *FederationError) = %v want federation 3", fedErr)
+	}
+
+	if !isValidationError || validationErr.Field != "owner" {
+		t.Fatalf("errors.As(err, *ValidationError) = %v want owner", validationErr)
+	}
+}
+
+// test sqlError(error) with lost connection
+// should match ErrUnavailable and keep the driver error
+func TestSqlErrorUnavailable(t *testing.T) {
+	// act
+	err := sqlError(driver.ErrBadConn)
+
+	// assert
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("sqlError(driver.ErrBadConn) = %v want %v", err, ErrUnavailable)
+	}
+
+	if err := sqlError(errors.New("syntax error")); errors.Is(err, ErrUnavailable) {
+		t.Fatalf("sqlError(err) = %v want unchanged", err)
+	}
+}
+
+// test ValidationErrors wrapped in a FederationError
+// should match ErrValidation, list every violation and expose the first
+func TestValidationErrorsUnwrap(t *testing.T) {
+	// arrange
+	err := &FederationError{Id: 0, Err: ValidationErrors{
+		{Field: "id", Rule: "min", Message: "must be at least 0"},
+		{Field: "owner", Rule: "required", Message: "is required"},
+	}}
+	wantMessage := "federation 0 id must be at least 0; owner is required"
+
+	// act
+	var validationErr *ValidationError
+	isValidationError := errors.As(err, &validationErr)
+
+	// assert
+	if err.Error() != wantMessage {
+		t.Fatalf("Error() = %q want %q", err, wantMessage)
+	}
+
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("errors.Is(err, ErrValidation) = false want true")
+	}
+
+	if !isValidationError || validationErr.Field != "id" {
+		t.Fatalf("errors.As(err, *ValidationError) = %v want id", validationErr)
+	}
+}
@@ -0,0 +1,1683 @@
+package tools
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// fakesql is an in-process database/sql driver used by the sql store tests.
+// it implements the subset of standard SQL the store issues: CREATE TABLE,
+// CREATE INDEX, ALTER TABLE ADD COLUMN, INSERT, SELECT, UPDATE and DELETE
+// with WHERE, ORDER BY, LIMIT and OFFSET, a few functions and aggregates,
+// IN subqueries in SELECT and transactions. databases are named by the dsn and live for the
+// duration of the test binary.
+
+func init() {
+	sql.Register("fakesql", fakeDriver{})
+}
+
+var fakeDatabases = struct {
+	sync.Mutex
+	m map[string]*fakeDatabase
+}{m: map[string]*fakeDatabase{}}
+
+// fakeDatabaseFor returns the database behind dsn, creating it if needed.
+func fakeDatabaseFor(dsn string) *fakeDatabase {
+	fakeDatabases.Lock()
+	defer fakeDatabases.Unlock()
+
+	db, ok := fakeDatabases.m[dsn]
+	if !ok {
+		db = &fakeDatabase{tables: map[string]*fakeTable{}}
+		fakeDatabases.m[dsn] = db
+	}
+	return db
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return &fakeConn{db: fakeDatabaseFor(dsn)}, nil
+}
+
+// fakeDatabase serialises statements with mu. a transaction holds mu from
+// Begin until Commit or Rollback.
+type fakeDatabase struct {
+	mu     sync.Mutex
+	tables map[string]*fakeTable
+	// failOn makes statements containing the substring fail.
+	failOn string
+	// statements records every statement executed.
+	statements []string
+}
+
+func (db *fakeDatabase) setFailOn(s string) {
+	db.mu.Lock()
+	db.failOn = s
+	db.mu.Unlock()
+}
+
+type fakeTable struct {
+	columns []string
+	primary int // index of the primary key column, -1 if none
+	rows    [][]driver.Value
+}
+
+func (t *fakeTable) column(name string) int {
+	for i, c := range t.columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *fakeTable) clone() *fakeTable {
+	c := &fakeTable{columns: append([]string(nil), t.columns...), primary: t.primary}
+	for _, row := range t.rows {
+		c.rows = append(c.rows, append([]driver.Value(nil), row...))
+	}
+	return c
+}
+
+type fakeConn struct {
+	db     *fakeDatabase
+	tx     bool
+	backup map[string]*fakeTable
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := parseFakeStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeStmt{conn: c, query: query, stmt: stmt}, nil
+}
+
+func (c *fakeConn) Close() error {
+	if c.tx {
+		c.rollback()
+	}
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.tx = true
+	c.backup = map[string]*fakeTable{}
+	for name, t := range c.db.tables {
+		c.backup[name] = t.clone()
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	if !c.tx {
+		return errors.New("fakesql: commit without transaction")
+	}
+	c.tx, c.backup = false, nil
+	c.db.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	if !c.tx {
+		return errors.New("fakesql: rollback without transaction")
+	}
+	c.rollback()
+	return nil
+}
+
+func (c *fakeConn) rollback() {
+	c.db.tables = c.backup
+	c.tx, c.backup = false, nil
+	c.db.mu.Unlock()
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+	stmt  fakeStatement
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) run(args []driver.Value) (*fakeResult, error) {
+	db := s.conn.db
+	if !s.conn.tx {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+	}
+
+	db.statements = append(db.statements, s.query)
+	if db.failOn != "" && strings.Contains(s.query, db.failOn) {
+		return nil, fmt.Errorf("fakesql: injected failure on %q", db.failOn)
+	}
+
+	return s.stmt.exec(db, args)
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.run(args)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	res, err := s.run(args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: res.columns, rows: res.rows}, nil
+}
+
+type fakeResult struct {
+	affected int64
+	columns  []string
+	rows     [][]driver.Value
+}
+
+func (r *fakeResult) LastInsertId() (int64, error) {
+	return 0, errors.New("fakesql: LastInsertId not supported")
+}
+func (r *fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// statements
+
+type fakeStatement interface {
+	exec(db *fakeDatabase, args []driver.Value) (*fakeResult, error)
+}
+
+type fakeCreateTable struct {
+	table       string
+	ifNotExists bool
+	columns     []string
+	primary     string
+}
+
+func (s *fakeCreateTable) exec(db *fakeDatabase, _ []driver.Value) (*fakeResult, error) {
+	if _, ok := db.tables[s.table]; ok {
+		if s.ifNotExists {
+			return &fakeResult{}, nil
+		}
+		return nil, fmt.Errorf("fakesql: table %s already exists", s.table)
+	}
+
+	t := &fakeTable{columns: s.columns, primary: -1}
+	if s.primary != "" {
+		t.primary = t.column(s.primary)
+	}
+	db.tables[s.table] = t
+	return &fakeResult{}, nil
+}
+
+type fakeCreateIndex struct {
+	table string
+}
+
+func (s *fakeCreateIndex) exec(db *fakeDatabase, _ []driver.Value) (*fakeResult, error) {
+	if _, ok := db.tables[s.table]; !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", s.table)
+	}
+	return &fakeResult{}, nil
+}
+
+type fakeAddColumn struct {
+	table  string
+	column string
+	def    fakeExpr
+}
+
+func (s *fakeAddColumn) exec(db *fakeDatabase, args []driver.Value) (*fakeResult, error) {
+	t, ok := db.tables[s.table]
+	if !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", s.table)
+	}
+	if t.column(s.column) >= 0 {
+		return nil, fmt.Errorf("fakesql: column %s already exists", s.column)
+	}
+
+	var value driver.Value
+	if s.def != nil {
+		v, err := s.def.eval(nil, nil, args)
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	}
+
+	t.columns = append(t.columns, s.column)
+	for i := range t.rows {
+		t.rows[i] = append(t.rows[i], value)
+	}
+	return &fakeResult{}, nil
+}
+
+type fakeInsert struct {
+	table   string
+	columns []string
+	values  [][]fakeExpr
+}
+
+func (s *fakeInsert) exec(db *fakeDatabase, args []driver.Value) (*fakeResult, error) {
+	t, ok := db.tables[s.table]
+	if !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", s.table)
+	}
+
+	for _, exprs := range s.values {
+		row := make([]driver.Value, len(t.columns))
+		for i, name := range s.columns {
+			col := t.column(name)
+			if col < 0 {
+				return nil, fmt.Errorf("fakesql: no such column %s", name)
+			}
+			v, err := exprs[i].eval(nil, nil, args)
+			if err != nil {
+				return nil, err
+			}
+			row[col] = v
+		}
+
+		if t.primary >= 0 {
+			for _, existing := range t.rows {
+				if c, ok := fakeCompare(existing[t.primary], row[t.primary]); ok && c == 0 {
+					return nil, fmt.Errorf("fakesql: duplicate primary key %v", row[t.primary])
+				}
+			}
+		}
+		t.rows = append(t.rows, row)
+	}
+
+	return &fakeResult{affected: int64(len(s.values))}, nil
+}
+
+type fakeOrder struct {
+	expr fakeExpr
+	desc bool
+}
+
+type fakeSelect struct {
+	exprs  []fakeExpr
+	names  []string
+	star   bool
+	table  string
+	where  fakeExpr
+	order  []fakeOrder
+	limit  fakeExpr
+	offset fakeExpr
+}
+
+func (s *fakeSelect) exec(db *fakeDatabase, args []driver.Value) (*fakeResult, error) {
+	t, ok := db.tables[s.table]
+	if !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", s.table)
+	}
+
+	where, err := fakeBindSubqueries(db, s.where, args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := fakeFilter(t, where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.order) > 0 {
+		var sortErr error
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, o := range s.order {
+				a, err := o.expr.eval(t, rows[i], args)
+				if err != nil {
+					sortErr = err
+					return false
+				}
+				b, err := o.expr.eval(t, rows[j], args)
+				if err != nil {
+					sortErr = err
+					return false
+				}
+				c := fakeOrderCompare(a, b)
+				if c == 0 {
+					continue
+				}
+				if o.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+		if sortErr != nil {
+			return nil, sortErr
+		}
+	}
+
+	if s.star {
+		res := &fakeResult{columns: t.columns}
+		rows, err = s.window(rows, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			res.rows = append(res.rows, append([]driver.Value(nil), row...))
+		}
+		return res, nil
+	}
+
+	res := &fakeResult{columns: s.names}
+	if fakeHasAggregate(s.exprs) {
+		row := make([]driver.Value, len(s.exprs))
+		for i, e := range s.exprs {
+			v, err := fakeAggregate(e, t, rows, args)
+			if err != nil {
+				return nil, err
+			}
+			row[i] = v
+		}
+		res.rows = append(res.rows, row)
+		return res, nil
+	}
+
+	rows, err = s.window(rows, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out := make([]driver.Value, len(s.exprs))
+		for i, e := range s.exprs {
+			v, err := e.eval(t, row, args)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		res.rows = append(res.rows, out)
+	}
+	return res, nil
+}
+
+// window applies OFFSET and LIMIT.
+func (s *fakeSelect) window(rows [][]driver.Value, args []driver.Value) ([][]driver.Value, error) {
+	if s.offset != nil {
+		v, err := s.offset.eval(nil, nil, args)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := fakeInt(v)
+		if int(n) >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[n:]
+	}
+	if s.limit != nil {
+		v, err := s.limit.eval(nil, nil, args)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := fakeInt(v)
+		if int(n) < len(rows) {
+			rows = rows[:n]
+		}
+	}
+	return rows, nil
+}
+
+type fakeAssignment struct {
+	column string
+	expr   fakeExpr
+}
+
+type fakeUpdate struct {
+	table string
+	set   []fakeAssignment
+	where fakeExpr
+}
+
+func (s *fakeUpdate) exec(db *fakeDatabase, args []driver.Value) (*fakeResult, error) {
+	t, ok := db.tables[s.table]
+	if !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", s.table)
+	}
+
+	rows, err := fakeFilter(t, s.where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		values := make([]driver.Value, len(s.set))
+		for i, a := range s.set {
+			v, err := a.expr.eval(t, row, args)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		for i, a := range s.set {
+			col := t.column(a.column)
+			if col < 0 {
+				return nil, fmt.Errorf("fakesql: no such column %s", a.column)
+			}
+			row[col] = values[i]
+		}
+	}
+
+	return &fakeResult{affected: int64(len(rows))}, nil
+}
+
+type fakeDelete struct {
+	table string
+	where fakeExpr
+}
+
+func (s *fakeDelete) exec(db *fakeDatabase, args []driver.Value) (*fakeResult, error) {
+	t, ok := db.tables[s.table]
+	if !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", s.table)
+	}
+
+	kept := t.rows[:0]
+	var affected int64
+	for _, row := range t.rows {
+		match := true
+		if s.where != nil {
+			v, err := s.where.eval(t, row, args)
+			if err != nil {
+				return nil, err
+			}
+			match = v == true
+		}
+		if match {
+			affected++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	t.rows = kept
+
+	return &fakeResult{affected: affected}, nil
+}
+
+// fakeFilter returns the rows of t matching where. rows are shared with t.
+func fakeFilter(t *fakeTable, where fakeExpr, args []driver.Value) ([][]driver.Value, error) {
+	var rows [][]driver.Value
+	for _, row := range t.rows {
+		if where != nil {
+			v, err := where.eval(t, row, args)
+			if err != nil {
+				return nil, err
+			}
+			if v != true {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// expressions
+
+type fakeExpr interface {
+	eval(t *fakeTable, row []driver.Value, args []driver.Value) (driver.Value, error)
+}
+
+type fakeLiteral struct{ value driver.Value }
+
+func (e fakeLiteral) eval(*fakeTable, []driver.Value, []driver.Value) (driver.Value, error) {
+	return e.value, nil
+}
+
+type fakeParam struct{ index int }
+
+func (e fakeParam) eval(_ *fakeTable, _ []driver.Value, args []driver.Value) (driver.Value, error) {
+	if e.index >= len(args) {
+		return nil, fmt.Errorf("fakesql: missing argument %d", e.index+1)
+	}
+	return fakeNormalize(args[e.index]), nil
+}
+
+type fakeColumn struct{ name string }
+
+func (e fakeColumn) eval(t *fakeTable, row []driver.Value, _ []driver.Value) (driver.Value, error) {
+	if t == nil {
+		return nil, fmt.Errorf("fakesql: column %s outside of a table", e.name)
+	}
+	col := t.column(e.name)
+	if col < 0 {
+		return nil, fmt.Errorf("fakesql: no such column %s", e.name)
+	}
+	return fakeNormalize(row[col]), nil
+}
+
+type fakeUnary struct {
+	op   string
+	expr fakeExpr
+}
+
+func (e fakeUnary) eval(t *fakeTable, row []driver.Value, args []driver.Value) (driver.Value, error) {
+	v, err := e.expr.eval(t, row, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "NOT":
+		if v == nil {
+			return nil, nil
+		}
+		return v != true, nil
+	case "IS NULL":
+		return v == nil, nil
+	case "IS NOT NULL":
+		return v != nil, nil
+	case "-":
+		if n, ok := v.(int64); ok {
+			return -n, nil
+		}
+		if f, ok := v.(float64); ok {
+			return -f, nil
+		}
+		return nil, fmt.Errorf("fakesql: cannot negate %v", v)
+	}
+	return nil, fmt.Errorf("fakesql: unknown operator %s", e.op)
+}
+
+type fakeBinary struct {
+	op          string
+	left, right fakeExpr
+	escape      fakeExpr
+}
+
+func (e fakeBinary) eval(t *fakeTable, row []driver.Value, args []driver.Value) (driver.Value, error) {
+	l, err := e.left.eval(t, row, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// AND and OR short circuit with three valued logic.
+	switch e.op {
+	case "AND":
+		if l == false {
+			return false, nil
+		}
+		r, err := e.right.eval(t, row, args)
+		if err != nil {
+			return nil, err
+		}
+		if r == false {
+			return false, nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return true, nil
+	case "OR":
+		if l == true {
+			return true, nil
+		}
+		r, err := e.right.eval(t, row, args)
+		if err != nil {
+			return nil, err
+		}
+		if r == true {
+			return true, nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return false, nil
+	}
+
+	r, err := e.right.eval(t, row, args)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	switch e.op {
+	case "+", "-", "*":
+		return fakeArithmetic(e.op, l, r)
+	case "||":
+		return fmt.Sprint(l) + fmt.Sprint(r), nil
+	case "LIKE", "NOT LIKE":
+		escape := ""
+		if e.escape != nil {
+			v, err := e.escape.eval(t, row, args)
+			if err != nil {
+				return nil, err
+			}
+			escape, _ = v.(string)
+		}
+		matched := fakeLike(fmt.Sprint(l), fmt.Sprint(r), escape)
+		return matched == (e.op == "LIKE"), nil
+	}
+
+	c, ok := fakeCompare(l, r)
+	if !ok {
+		return nil, fmt.Errorf("fakesql: cannot compare %T with %T", l, r)
+	}
+	switch e.op {
+	case "=":
+		return c == 0, nil
+	case "<>", "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("fakesql: unknown operator %s", e.op)
+}
+
+type fakeIn struct {
+	expr fakeExpr
+	list []fakeExpr
+	not  bool
+	// sub is a subquery selecting the list. it is replaced by its rows
+	// before the statement runs, see fakeBindSubqueries.
+	sub *fakeSelect
+}
+
+func (e fakeIn) eval(t *fakeTable, row []driver.Value, args []driver.Value) (driver.Value, error) {
+	if e.sub != nil {
+		return nil, errors.New("fakesql: subqueries are only supported in SELECT")
+	}
+	v, err := e.expr.eval(t, row, args)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	for _, item := range e.list {
+		iv, err := item.eval(t, row, args)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := fakeCompare(v, iv); ok && c == 0 {
+			return !e.not, nil
+		}
+	}
+	return e.not, nil
+}
+
+// fakeBindSubqueries runs the non-correlated subqueries of e on db and
+// returns e with their rows inlined as IN lists.
+func fakeBindSubqueries(db *fakeDatabase, e fakeExpr, args []driver.Value) (fakeExpr, error) {
+	switch e := e.(type) {
+	case fakeIn:
+		if e.sub == nil {
+			return e, nil
+		}
+		res, err := e.sub.exec(db, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.columns) != 1 {
+			return nil, errors.New("fakesql: subquery must select one column")
+		}
+		list := make([]fakeExpr, len(res.rows))
+		for i, row := range res.rows {
+			list[i] = fakeLiteral{row[0]}
+		}
+		return fakeIn{expr: e.expr, list: list, not: e.not}, nil
+	case fakeBinary:
+		left, err := fakeBindSubqueries(db, e.left, args)
+		if err != nil {
+			return nil, err
+		}
+		right, err := fakeBindSubqueries(db, e.right, args)
+		if err != nil {
+			return nil, err
+		}
+		e.left, e.right = left, right
+		return e, nil
+	case fakeUnary:
+		expr, err := fakeBindSubqueries(db, e.expr, args)
+		if err != nil {
+			return nil, err
+		}
+		e.expr = expr
+		return e, nil
+	}
+	return e, nil
+}
+
+type fakeCall struct {
+	name string
+	args []fakeExpr
+	star bool
+}
+
+var fakeAggregates = map[string]bool{"COUNT": true, "MAX": true, "MIN": true}
+
+func (e fakeCall) eval(t *fakeTable, row []driver.Value, args []driver.Value) (driver.Value, error) {
+	if fakeAggregates[e.name] {
+		return nil, fmt.Errorf("fakesql: aggregate %s outside of a select list", e.name)
+	}
+
+	values := make([]driver.Value, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(t, row, args)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	switch e.name {
+	case "LOWER", "UPPER":
+		if len(values) != 1 {
+			return nil, fmt.Errorf("fakesql: %s takes one argument", e.name)
+		}
+		if values[0] == nil {
+			return nil, nil
+		}
+		if e.name == "LOWER" {
+			return strings.ToLower(fmt.Sprint(values[0])), nil
+		}
+		return strings.ToUpper(fmt.Sprint(values[0])), nil
+	case "COALESCE":
+		for _, v := range values {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("fakesql: unknown function %s", e.name)
+}
+
+func fakeHasAggregate(exprs []fakeExpr) bool {
+	for _, e := range exprs {
+		if c, ok := e.(fakeCall); ok && fakeAggregates[c.name] {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeAggregate(e fakeExpr, t *fakeTable, rows [][]driver.Value, args []driver.Value) (driver.Value, error) {
+	call, ok := e.(fakeCall)
+	if !ok || !fakeAggregates[call.name] {
+		return nil, errors.New("fakesql: cannot mix aggregates and columns")
+	}
+
+	if call.name == "COUNT" && call.star {
+		return int64(len(rows)), nil
+	}
+	if len(call.args) != 1 {
+		return nil, fmt.Errorf("fakesql: %s takes one argument", call.name)
+	}
+
+	var result driver.Value
+	var count int64
+	for _, row := range rows {
+		v, err := call.args[0].eval(t, row, args)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		count++
+		if result == nil {
+			result = v
+			continue
+		}
+		c, _ := fakeCompare(v, result)
+		if (call.name == "MAX" && c > 0) || (call.name == "MIN" && c < 0) {
+			result = v
+		}
+	}
+
+	if call.name == "COUNT" {
+		return count, nil
+	}
+	return result, nil
+}
+
+// values
+
+// fakeNormalize converts values to the types the engine compares.
+func fakeNormalize(v driver.Value) driver.Value {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	}
+	return v
+}
+
+func fakeInt(v driver.Value) (int64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case float64:
+		return int64(x), true
+	}
+	return 0, false
+}
+
+// fakeCompare orders two non null values of compatible types.
+func fakeCompare(a, b driver.Value) (int, bool) {
+	a, b = fakeNormalize(a), fakeNormalize(b)
+	if ai, ok := fakeInt(a); ok {
+		if bi, ok := fakeInt(b); ok {
+			_, af := a.(float64)
+			_, bf := b.(float64)
+			if af || bf {
+				x, y := fakeFloat(a), fakeFloat(b)
+				switch {
+				case x < y:
+					return -1, true
+				case x > y:
+					return 1, true
+				}
+				return 0, true
+			}
+			switch {
+			case ai < bi:
+				return -1, true
+			case ai > bi:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	}
+	return 0, false
+}
+
+// fakeOrderCompare orders values for ORDER BY with NULLs first.
+func fakeOrderCompare(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := fakeCompare(a, b)
+	return c
+}
+
+func fakeFloat(v driver.Value) float64 {
+	switch x := v.(type) {
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return 0
+}
+
+func fakeArithmetic(op string, a, b driver.Value) (driver.Value, error) {
+	ai, aok := a.(int64)
+	bi, bok := b.(int64)
+	if aok && bok {
+		switch op {
+		case "+":
+			return ai + bi, nil
+		case "-":
+			return ai - bi, nil
+		case "*":
+			return ai * bi, nil
+		}
+	}
+	return nil, fmt.Errorf("fakesql: cannot apply %s to %T and %T", op, a, b)
+}
+
+// fakeLike matches s against a LIKE pattern.
+func fakeLike(s, pattern, escape string) bool {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case escape != "" && string(r) == escape:
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String()).MatchString(s)
+}
+
+// parser
+
+type fakeToken struct {
+	kind  string // ident, number, string, param, op
+	text  string
+	param int
+}
+
+func fakeTokenize(query string) ([]fakeToken, error) {
+	var tokens []fakeToken
+	params := 0
+	rs := []rune(query)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: "ident", text: string(rs[i:j])})
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: "number", text: string(rs[i:j])})
+			i = j
+		case r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == '\'' {
+					if j+1 < len(rs) && rs[j+1] == '\'' {
+						b.WriteRune('\'')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, errors.New("fakesql: unterminated string")
+			}
+			tokens = append(tokens, fakeToken{kind: "string", text: b.String()})
+			i = j + 1
+		case r == '?':
+			tokens = append(tokens, fakeToken{kind: "param", param: params})
+			params++
+			i++
+		case r == '$':
+			j := i + 1
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			n, err := strconv.Atoi(string(rs[i+1 : j]))
+			if err != nil {
+				return nil, fmt.Errorf("fakesql: bad placeholder at %d", i)
+			}
+			tokens = append(tokens, fakeToken{kind: "param", param: n - 1})
+			i = j
+		default:
+			two := ""
+			if i+1 < len(rs) {
+				two = string(rs[i : i+2])
+			}
+			switch two {
+			case "<=", ">=", "<>", "!=", "||":
+				tokens = append(tokens, fakeToken{kind: "op", text: two})
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("(),*=<>+-;", r) {
+				return nil, fmt.Errorf("fakesql: unexpected %q", r)
+			}
+			tokens = append(tokens, fakeToken{kind: "op", text: string(r)})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+type fakeParser struct {
+	tokens []fakeToken
+	pos    int
+}
+
+var fakeStatementCache sync.Map
+
+func parseFakeStatement(query string) (fakeStatement, error) {
+	if stmt, ok := fakeStatementCache.Load(query); ok {
+		return stmt.(fakeStatement), nil
+	}
+
+	tokens, err := fakeTokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &fakeParser{tokens: tokens}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, fmt.Errorf("%w in %q", err, query)
+	}
+	p.accept(";")
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("fakesql: unexpected %q in %q", p.peek().text, query)
+	}
+
+	fakeStatementCache.Store(query, stmt)
+	return stmt, nil
+}
+
+func (p *fakeParser) peek() fakeToken {
+	if p.pos >= len(p.tokens) {
+		return fakeToken{kind: "eof"}
+	}
+	return p.tokens[p.pos]
+}
+
+// is reports whether the next tokens are the given keywords or operators.
+func (p *fakeParser) is(words ...string) bool {
+	for i, w := range words {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		tok := p.tokens[p.pos+i]
+		if (tok.kind != "ident" && tok.kind != "op") || !strings.EqualFold(tok.text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *fakeParser) accept(words ...string) bool {
+	if p.is(words...) {
+		p.pos += len(words)
+		return true
+	}
+	return false
+}
+
+func (p *fakeParser) expect(words ...string) error {
+	if !p.accept(words...) {
+		return fmt.Errorf("fakesql: expected %s near %q", strings.Join(words, " "), p.peek().text)
+	}
+	return nil
+}
+
+func (p *fakeParser) ident() (string, error) {
+	tok := p.peek()
+	if tok.kind != "ident" {
+		return "", fmt.Errorf("fakesql: expected identifier near %q", tok.text)
+	}
+	p.pos++
+	return strings.ToLower(tok.text), nil
+}
+
+func (p *fakeParser) statement() (fakeStatement, error) {
+	switch {
+	case p.accept("CREATE", "TABLE"):
+		return p.createTable()
+	case p.accept("CREATE", "UNIQUE", "INDEX"), p.accept("CREATE", "INDEX"):
+		return p.createIndex()
+	case p.accept("ALTER", "TABLE"):
+		return p.alterTable()
+	case p.accept("INSERT", "INTO"):
+		return p.insert()
+	case p.accept("SELECT"):
+		return p.selectStatement()
+	case p.accept("UPDATE"):
+		return p.update()
+	case p.accept("DELETE", "FROM"):
+		return p.deleteStatement()
+	}
+	return nil, fmt.Errorf("fakesql: unsupported statement near %q", p.peek().text)
+}
+
+func (p *fakeParser) createTable() (fakeStatement, error) {
+	s := &fakeCreateTable{ifNotExists: p.accept("IF", "NOT", "EXISTS")}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.accept("PRIMARY", "KEY") {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			if s.primary, err = p.ident(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		} else {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			s.columns = append(s.columns, name)
+			// skip the type and constraints up to the next column.
+			depth := 0
+			for p.pos < len(p.tokens) {
+				if depth == 0 && (p.is(",") || p.is(")")) {
+					break
+				}
+				if p.accept("PRIMARY", "KEY") {
+					s.primary = name
+					continue
+				}
+				switch p.peek().text {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				}
+				p.pos++
+			}
+		}
+
+		if p.accept(")") {
+			return s, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *fakeParser) createIndex() (fakeStatement, error) {
+	p.accept("IF", "NOT", "EXISTS")
+	if _, err := p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("ON"); err != nil {
+		return nil, err
+	}
+	table, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for depth := 1; depth > 0 && p.pos < len(p.tokens); p.pos++ {
+		switch p.peek().text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+	}
+	return &fakeCreateIndex{table: table}, nil
+}
+
+func (p *fakeParser) alterTable() (fakeStatement, error) {
+	s := &fakeAddColumn{}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("ADD"); err != nil {
+		return nil, err
+	}
+	p.accept("COLUMN")
+	if s.column, err = p.ident(); err != nil {
+		return nil, err
+	}
+	// skip the type, keeping an optional DEFAULT value.
+	for p.pos < len(p.tokens) && !p.is(";") {
+		if p.accept("DEFAULT") {
+			if s.def, err = p.primary(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.pos++
+	}
+	return s, nil
+}
+
+func (p *fakeParser) insert() (fakeStatement, error) {
+	s := &fakeInsert{}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		s.columns = append(s.columns, name)
+		if p.accept(")") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expect("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if len(exprs) != len(s.columns) {
+			return nil, errors.New("fakesql: column and value counts differ")
+		}
+		s.values = append(s.values, exprs)
+		if !p.accept(",") {
+			return s, nil
+		}
+	}
+}
+
+// exprList parses expressions up to and including a closing parenthesis.
+func (p *fakeParser) exprList() ([]fakeExpr, error) {
+	var exprs []fakeExpr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if p.accept(")") {
+			return exprs, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *fakeParser) selectStatement() (fakeStatement, error) {
+	s := &fakeSelect{}
+	if p.accept("*") {
+		s.star = true
+	} else {
+		for {
+			start := p.pos
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			name := ""
+			if p.accept("AS") {
+				if name, err = p.ident(); err != nil {
+					return nil, err
+				}
+			} else if c, ok := e.(fakeColumn); ok {
+				name = c.name
+			} else {
+				name = fmt.Sprintf("column%d", start)
+			}
+			s.exprs = append(s.exprs, e)
+			s.names = append(s.names, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if p.accept("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("ORDER", "BY") {
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			o := fakeOrder{expr: e}
+			if p.accept("DESC") {
+				o.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			s.order = append(s.order, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		if s.limit, err = p.primary(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("OFFSET") {
+		if s.offset, err = p.primary(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (p *fakeParser) update() (fakeStatement, error) {
+	s := &fakeUpdate{}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		s.set = append(s.set, fakeAssignment{column: name, expr: e})
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *fakeParser) deleteStatement() (fakeStatement, error) {
+	s := &fakeDelete{}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.accept("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *fakeParser) expr() (fakeExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = fakeBinary{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *fakeParser) and() (fakeExpr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = fakeBinary{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *fakeParser) not() (fakeExpr, error) {
+	if p.accept("NOT") {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return fakeUnary{op: "NOT", expr: e}, nil
+	}
+	return p.comparison()
+}
+
+func (p *fakeParser) comparison() (fakeExpr, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.accept("IS", "NOT", "NULL"):
+		return fakeUnary{op: "IS NOT NULL", expr: left}, nil
+	case p.accept("IS", "NULL"):
+		return fakeUnary{op: "IS NULL", expr: left}, nil
+	case p.is("NOT", "LIKE"), p.is("LIKE"):
+		op := "LIKE"
+		if p.accept("NOT") {
+			op = "NOT LIKE"
+		}
+		p.accept("LIKE")
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		e := fakeBinary{op: op, left: left, right: right}
+		if p.accept("ESCAPE") {
+			if e.escape, err = p.primary(); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	case p.is("NOT", "IN"), p.is("IN"):
+		not := p.accept("NOT")
+		p.accept("IN")
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if p.accept("SELECT") {
+			sub, err := p.selectStatement()
+			if err != nil {
+				return nil, err
+			}
+			return fakeIn{expr: left, not: not, sub: sub.(*fakeSelect)}, p.expect(")")
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return fakeIn{expr: left, list: list, not: not}, nil
+	}
+
+	for _, op := range []string{"=", "<>", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			return fakeBinary{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *fakeParser) additive() (fakeExpr, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range []string{"+", "-", "*", "||"} {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		left = fakeBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *fakeParser) primary() (fakeExpr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case "param":
+		p.pos++
+		return fakeParam{index: tok.param}, nil
+	case "number":
+		p.pos++
+		if strings.Contains(tok.text, ".") {
+			f, err := strconv.ParseFloat(tok.text, 64)
+			return fakeLiteral{f}, err
+		}
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		return fakeLiteral{n}, err
+	case "string":
+		p.pos++
+		return fakeLiteral{tok.text}, nil
+	case "op":
+		switch tok.text {
+		case "(":
+			p.pos++
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		case "-":
+			p.pos++
+			e, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			return fakeUnary{op: "-", expr: e}, nil
+		}
+	case "ident":
+		p.pos++
+		switch strings.ToUpper(tok.text) {
+		case "NULL":
+			return fakeLiteral{nil}, nil
+		case "TRUE":
+			return fakeLiteral{true}, nil
+		case "FALSE":
+			return fakeLiteral{false}, nil
+		}
+		if p.accept("(") {
+			call := fakeCall{name: strings.ToUpper(tok.text)}
+			if p.accept("*") {
+				call.star = true
+				return call, p.expect(")")
+			}
+			if p.accept(")") {
+				return call, nil
+			}
+			args, err := p.exprList()
+			if err != nil {
+				return nil, err
+			}
+			call.args = args
+			return call, nil
+		}
+		name := strings.ToLower(tok.text)
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		return fakeColumn{name: name}, nil
+	}
+	return nil, fmt.Errorf("fakesql: unexpected %q", tok.text)
+}
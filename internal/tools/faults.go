@@ -0,0 +1,403 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gorest/api"
+)
+
+// ErrInjectedFault is returned by calls failed by a FaultInjector. it
+// matches ErrUnavailable, like a real outage would.
+var ErrInjectedFault = fmt.Errorf("injected fault: %w", ErrUnavailable)
+
+// latency distributions of MethodFaults.
+const (
+	LatencyUniform     = "uniform"
+	LatencyExponential = "exponential"
+)
+
+// AnyMethod is the FaultConfig key for methods without faults of their own,
+// except Setup and Close.
+const AnyMethod = "*"
+
+// lifecycleMethods only get faults when they are named, so a "*" error
+// rate never fails startup or leaves the wrapped repository open.
+var lifecycleMethods = map[string]bool{
+	"Setup": true,
+	"Close": true,
+}
+
+// faultMethods lists the methods a FaultConfig can name.
+var faultMethods = map[string]bool{
+	AnyMethod:              true,
+	"Setup":                true,
+	"Close":                true,
+	"AddFederation":        true,
+	"GetFederation":        true,
+	"GetFederations":       true,
+	"SearchFederations":    true,
+	"UpdateFederation":     true,
+	"PatchFederation":      true,
+	"ApplyBatch":           true,
+	"DeleteFederation":     true,
+	"RestoreFederation":    true,
+	"TransitionFederation": true,
+	"PurgeFederations":     true,
+	"GetHistory":           true,
+}
+
+// MethodFaults are the faults injected into the calls of one method.
+type MethodFaults struct {
+	// ErrorRate is the fraction of calls failing with ErrInjectedFault.
+	ErrorRate float64
+	// Latency delays every call. Jitter adds a random delay drawn from
+	// Distribution: uniform in [0, Jitter) or exponential with mean Jitter.
+	Latency      time.Duration
+	Jitter       time.Duration
+	Distribution string
+	// TimeoutRate is the fraction of calls that hang for Timeout, or until
+	// the context is done when Timeout is 0, and fail with
+	// context.DeadlineExceeded.
+	TimeoutRate float64
+	Timeout     time.Duration
+}
+
+// methodFaultsJSON is the JSON form of MethodFaults, with durations
+// written as time.Duration strings.
+type methodFaultsJSON struct {
+	ErrorRate    float64 `json:"errorRate,omitempty"`
+	Latency      string  `json:"latency,omitempty"`
+	Jitter       string  `json:"jitter,omitempty"`
+	Distribution string  `json:"distribution,omitempty"`
+	TimeoutRate  float64 `json:"timeoutRate,omitempty"`
+	Timeout      string  `json:"timeout,omitempty"`
+}
+
+func (f MethodFaults) MarshalJSON() ([]byte, error) {
+	duration := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return json.Marshal(methodFaultsJSON{
+		ErrorRate:    f.ErrorRate,
+		Latency:      duration(f.Latency),
+		Jitter:       duration(f.Jitter),
+		Distribution: f.Distribution,
+		TimeoutRate:  f.TimeoutRate,
+		Timeout:      duration(f.Timeout),
+	})
+}
+
+func (f *MethodFaults) UnmarshalJSON(data []byte) error {
+	var raw methodFaultsJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		field, value string
+		dst          *time.Duration
+	}{
+		{"latency", raw.Latency, &f.Latency},
+		{"jitter", raw.Jitter, &f.Jitter},
+		{"timeout", raw.Timeout, &f.Timeout},
+	}
+	for _, d := range durations {
+		*d.dst = 0
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return &ValidationError{Field: d.field, Message: "must be a duration such as 250ms"}
+		}
+		*d.dst = parsed
+	}
+	f.ErrorRate, f.Distribution, f.TimeoutRate = raw.ErrorRate, raw.Distribution, raw.TimeoutRate
+	return nil
+}
+
+// validate checks the rates, durations and distribution of f.
+func (f MethodFaults) validate(method string) error {
+	field := func(name string) string { return method + "." + name }
+	switch {
+	case f.ErrorRate < 0 || f.ErrorRate > 1:
+		return &ValidationError{Field: field("errorRate"), Message: "must be between 0 and 1"}
+	case f.TimeoutRate < 0 || f.TimeoutRate > 1:
+		return &ValidationError{Field: field("timeoutRate"), Message: "must be between 0 and 1"}
+	case f.Latency < 0 || f.Jitter < 0 || f.Timeout < 0:
+		return &ValidationError{Field: field("latency"), Message: "durations must not be negative"}
+	}
+	switch f.Distribution {
+	case "", LatencyUniform, LatencyExponential:
+	default:
+		return &ValidationError{Field: field("distribution"), Message: fmt.Sprintf("must be %s or %s", LatencyUniform, LatencyExponential)}
+	}
+	return nil
+}
+
+// FaultConfig maps repository method names to their faults. the AnyMethod
+// entry applies to methods without an entry.
+type FaultConfig map[string]MethodFaults
+
+// Validate checks every entry of c.
+func (c FaultConfig) Validate() error {
+	for method, faults := range c {
+		if !faultMethods[method] {
+			return &ValidationError{Field: method, Message: "is not a repository method"}
+		}
+		if err := faults.validate(method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseFaultConfig reads a JSON FaultConfig such as
+// {"*":{"errorRate":0.1},"GetFederations":{"latency":"1s"}}.
+func ParseFaultConfig(data []byte) (FaultConfig, error) {
+	var config FaultConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%w: faults: %w", ErrValidation, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// FaultInjector is a FederationRepository that injects latency, errors
+// and timeouts into the calls it forwards to another repository. its
+// faults can be changed while it is in use.
+type FaultInjector struct {
+	repo FederationRepository
+
+	mu     sync.Mutex
+	faults FaultConfig
+	// rand decides every fault. a seeded source makes the faults of a
+	// sequence of calls reproducible.
+	rand *rand.Rand
+}
+
+// NewFaultInjector wraps repo with the faults of config. seed 0 picks a
+// random seed. config must be valid.
+func NewFaultInjector(repo FederationRepository, config FaultConfig, seed int64) *FaultInjector {
+	src := randSource()
+	if seed != 0 {
+		src = rand.NewSource(seed)
+	}
+	return &FaultInjector{repo: repo, faults: copyFaultConfig(config), rand: rand.New(src)}
+}
+
+// Unwrap returns the repository the faults are injected into.
+func (f *FaultInjector) Unwrap() FederationRepository {
+	return f.repo
+}
+
+// Faults returns the current faults.
+func (f *FaultInjector) Faults() FaultConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return copyFaultConfig(f.faults)
+}
+
+// SetFaults replaces the faults. calls already waiting keep their faults.
+func (f *FaultInjector) SetFaults(config FaultConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = copyFaultConfig(config)
+	return nil
+}
+
+func copyFaultConfig(config FaultConfig) FaultConfig {
+	copied := make(FaultConfig, len(config))
+	for method, faults := range config {
+		copied[method] = faults
+	}
+	return copied
+}
+
+// fault is the outcome drawn for one call.
+type fault struct {
+	delay   time.Duration
+	fail    bool
+	hang    bool
+	timeout time.Duration
+}
+
+// draw decides the fault of a call to method.
+func (f *FaultInjector) draw(method string) fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	faults, ok := f.faults[method]
+	if !ok && !lifecycleMethods[method] {
+		faults = f.faults[AnyMethod]
+	}
+
+	// draw every value on every call, so a seed yields the same sequence
+	// whatever the faults are.
+	failDraw, hangDraw := f.rand.Float64(), f.rand.Float64()
+	jitter := f.rand.Float64()
+	if exp := f.rand.ExpFloat64(); faults.Distribution == LatencyExponential {
+		jitter = exp
+	}
+	return fault{
+		delay:   faults.Latency + time.Duration(jitter*float64(faults.Jitter)),
+		fail:    failDraw < faults.ErrorRate,
+		hang:    hangDraw < faults.TimeoutRate,
+		timeout: faults.Timeout,
+	}
+}
+
+// inject applies the fault drawn for method. a non-nil error fails the call
+// before it reaches the repository.
+func (f *FaultInjector) inject(ctx context.Context, method string) error {
+	fault := f.draw(method)
+
+	if fault.hang {
+		if fault.timeout == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		if err := sleep(ctx, fault.timeout); err != nil {
+			return err
+		}
+		return context.DeadlineExceeded
+	}
+
+	if err := sleep(ctx, fault.delay); err != nil {
+		return err
+	}
+	if fault.fail {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// sleep waits for d, giving up as soon as ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (f *FaultInjector) Setup(ctx context.Context) error {
+	if err := f.inject(ctx, "Setup"); err != nil {
+		return err
+	}
+	return f.repo.Setup(ctx)
+}
+
+func (f *FaultInjector) Close() error {
+	if err := f.inject(context.Background(), "Close"); err != nil {
+		return err
+	}
+	return f.repo.Close()
+}
+
+func (f *FaultInjector) AddFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	if err := f.inject(ctx, "AddFederation"); err != nil {
+		return nil, err
+	}
+	return f.repo.AddFederation(ctx, federation)
+}
+
+func (f *FaultInjector) GetFederation(ctx context.Context, id int) (*api.Federation, error) {
+	if err := f.inject(ctx, "GetFederation"); err != nil {
+		return nil, err
+	}
+	return f.repo.GetFederation(ctx, id)
+}
+
+func (f *FaultInjector) GetFederations(ctx context.Context, query FederationQuery) (*FederationPage, error) {
+	if err := f.inject(ctx, "GetFederations"); err != nil {
+		return nil, err
+	}
+	return f.repo.GetFederations(ctx, query)
+}
+
+func (f *FaultInjector) SearchFederations(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	if err := f.inject(ctx, "SearchFederations"); err != nil {
+		return nil, err
+	}
+	return f.repo.SearchFederations(ctx, query)
+}
+
+func (f *FaultInjector) UpdateFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	if err := f.inject(ctx, "UpdateFederation"); err != nil {
+		return nil, err
+	}
+	return f.repo.UpdateFederation(ctx, federation)
+}
+
+func (f *FaultInjector) PatchFederation(ctx context.Context, id int, version int, patch FederationPatch) (*api.Federation, error) {
+	if err := f.inject(ctx, "PatchFederation"); err != nil {
+		return nil, err
+	}
+	return f.repo.PatchFederation(ctx, id, version, patch)
+}
+
+func (f *FaultInjector) ApplyBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if err := f.inject(ctx, "ApplyBatch"); err != nil {
+		return nil, err
+	}
+	return f.repo.ApplyBatch(ctx, ops, atomic)
+}
+
+func (f *FaultInjector) DeleteFederation(ctx context.Context, id int, version int) error {
+	if err := f.inject(ctx, "DeleteFederation"); err != nil {
+		return err
+	}
+	return f.repo.DeleteFederation(ctx, id, version)
+}
+
+func (f *FaultInjector) RestoreFederation(ctx context.Context, id int, version int) (*api.Federation, error) {
+	if err := f.inject(ctx, "RestoreFederation"); err != nil {
+		return nil, err
+	}
+	return f.repo.RestoreFederation(ctx, id, version)
+}
+
+func (f *FaultInjector) TransitionFederation(ctx context.Context, id int, version int, action string) (*api.Federation, error) {
+	if err := f.inject(ctx, "TransitionFederation"); err != nil {
+		return nil, err
+	}
+	return f.repo.TransitionFederation(ctx, id, version, action)
+}
+
+func (f *FaultInjector) PurgeFederations(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := f.inject(ctx, "PurgeFederations"); err != nil {
+		return 0, err
+	}
+	return f.repo.PurgeFederations(ctx, deletedBefore)
+}
+
+func (f *FaultInjector) GetHistory(ctx context.Context, id int, query HistoryQuery) (*HistoryPage, error) {
+	if err := f.inject(ctx, "GetHistory"); err != nil {
+		return nil, err
+	}
+	return f.repo.GetHistory(ctx, id, query)
+}
@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// test FaultInjector calls with the same seed
+// should fail the same calls
+func TestFaultInjectorSeeded(t *testing.T) {
+	// arrange
+	faults := FaultConfig{AnyMethod: {ErrorRate: 0.5}}
+	run := func() []bool {
+		sut := NewFaultInjector(newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}), faults, 7)
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := sut.GetFederation(context.Background(), 1)
+			failed = append(failed, errors.Is(err, ErrInjectedFault))
+		}
+		return failed
+	}
+
+	// act
+	first, second := run(), run()
+
+	// assert
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("GetFederation(1) failures = %v then %v want the same", first, second)
+	}
+
+	if !slices.Contains(first, true) || !slices.Contains(first, false) {
+		t.Fatalf("GetFederation(1) failures = %v want some of each", first)
+	}
+}
+
+// test FaultInjector calls with per-method faults
+// should only fail the configured method and report ErrUnavailable
+func TestFaultInjectorPerMethod(t *testing.T) {
+	// arrange
+	sut := NewFaultInjector(newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}), FaultConfig{"Setup": {ErrorRate: 1}}, 1)
+
+	// act
+	setupErr := sut.Setup(context.Background())
+	fed, getErr := sut.GetFederation(context.Background(), 1)
+
+	// assert
+	if !errors.Is(setupErr, ErrUnavailable) {
+		t.Fatalf("Setup() = %v want %v", setupErr, ErrUnavailable)
+	}
+
+	if getErr != nil || fed.Id != 1 {
+		t.Fatalf("GetFederation(1) = %v, %v want federation 1", fed, getErr)
+	}
+}
+
+// test Setup and Close with faults for every method
+// should reach the repository unless they are named
+func TestFaultInjectorAnyMethodLifecycle(t *testing.T) {
+	// arrange
+	repo := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := NewFaultInjector(repo, FaultConfig{AnyMethod: {ErrorRate: 1}}, 1)
+
+	// act
+	setupErr := sut.Setup(context.Background())
+	_, getErr := sut.GetFederation(context.Background(), 1)
+	closeErr := sut.Close()
+	sut.SetFaults(FaultConfig{AnyMethod: {ErrorRate: 1}, "Close": {ErrorRate: 1}})
+	namedErr := sut.Close()
+
+	// assert
+	if setupErr != nil || closeErr != nil {
+		t.Fatalf("Setup(), Close() = %v, %v want <nil>", setupErr, closeErr)
+	}
+
+	if !errors.Is(getErr, ErrInjectedFault) || !errors.Is(namedErr, ErrInjectedFault) {
+		t.Fatalf("GetFederation(1), named Close() = %v, %v want %v", getErr, namedErr, ErrInjectedFault)
+	}
+}
+
+// test FaultInjector calls with latency and timeouts
+// should delay calls and fail hung ones with context.DeadlineExceeded
+func TestFaultInjectorLatencyAndTimeout(t *testing.T) {
+	// arrange
+	sut := NewFaultInjector(newMockDb(), FaultConfig{
+		"Setup":          {Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, Distribution: LatencyExponential},
+		"GetFederations": {TimeoutRate: 1, Timeout: 10 * time.Millisecond},
+		"GetFederation":  {TimeoutRate: 1},
+	}, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	// act
+	start := time.Now()
+	setupErr := sut.Setup(context.Background())
+	setupTook := time.Since(start)
+	_, listErr := sut.GetFederations(context.Background(), FederationQuery{})
+	_, getErr := sut.GetFederation(ctx, 1)
+
+	// assert
+	if setupErr != nil || setupTook < 20*time.Millisecond {
+		t.Fatalf("Setup() = %v after %v want <nil> after 20ms", setupErr, setupTook)
+	}
+
+	if !errors.Is(listErr, context.DeadlineExceeded) {
+		t.Fatalf("GetFederations() = %v want %v", listErr, context.DeadlineExceeded)
+	}
+
+	if !errors.Is(getErr, context.DeadlineExceeded) {
+		t.Fatalf("GetFederation(ctx) = %v want %v", getErr, context.DeadlineExceeded)
+	}
+}
+
+// test FaultInjector.SetFaults(config) at runtime
+// should apply valid faults and reject invalid ones
+func TestFaultInjectorSetFaults(t *testing.T) {
+	// arrange
+	sut := NewFaultInjector(newMockDb(), nil, 1)
+
+	// act
+	invalidErr := sut.SetFaults(FaultConfig{"Explode": {}})
+	validErr := sut.SetFaults(FaultConfig{AnyMethod: {ErrorRate: 1}})
+	_, getErr := sut.GetFederations(context.Background(), FederationQuery{})
+
+	// assert
+	if !errors.Is(invalidErr, ErrValidation) {
+		t.Fatalf("SetFaults(Explode) = %v want %v", invalidErr, ErrValidation)
+	}
+
+	if validErr != nil || !errors.Is(getErr, ErrInjectedFault) {
+		t.Fatalf("SetFaults(*) = %v, GetFederations() = %v want <nil>, %v", validErr, getErr, ErrInjectedFault)
+	}
+
+	if got := sut.Faults(); !reflect.DeepEqual(got, FaultConfig{AnyMethod: {ErrorRate: 1}}) {
+		t.Fatalf("Faults() = %v want the faults set", got)
+	}
+}
+
+// test ParseFaultConfig(data) with valid and invalid documents
+// should round trip durations and reject bad values
+func TestParseFaultConfig(t *testing.T) {
+	// arrange
+	valid := `{"*":{"errorRate":0.1},"GetFederations":{"latency":"1s","jitter":"250ms","distribution":"uniform","timeoutRate":0.5,"timeout":"2s"}}`
+	want := FaultConfig{
+		AnyMethod:        {ErrorRate: 0.1},
+		"GetFederations": {Latency: time.Second, Jitter: 250 * time.Millisecond, Distribution: LatencyUniform, TimeoutRate: 0.5, Timeout: 2 * time.Second},
+	}
+	invalid := []string{
+		`[]`,
+		`{"Explode":{}}`,
+		`{"*":{"errorRate":1.5}}`,
+		`{"*":{"timeoutRate":-1}}`,
+		`{"*":{"latency":"soon"}}`,
+		`{"*":{"latency":"-1s"}}`,
+		`{"*":{"distribution":"normal"}}`,
+	}
+
+	// act
+	got, err := ParseFaultConfig([]byte(valid))
+	data, _ := json.Marshal(got)
+	again, _ := ParseFaultConfig(data)
+
+	// assert
+	if err != nil || !reflect.DeepEqual(got, want) || !reflect.DeepEqual(again, want) {
+		t.Fatalf("ParseFaultConfig(%s) = %v, %v want %v", valid, got, err, want)
+	}
+
+	for _, doc := range invalid {
+		if _, err := ParseFaultConfig([]byte(doc)); !errors.Is(err, ErrValidation) {
+			t.Fatalf("ParseFaultConfig(%s) = %v want %v", doc, err, ErrValidation)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gorest/api"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+
+	// defaultCompactEvery is the number of log records written before the
+	// log is folded into a new snapshot.
+	defaultCompactEvery = 1000
+)
+
+// fileDb is a durable FederationRepository.
+// it keeps the working set in a mockDb and persists every mutation to an
+// append-only write-ahead log that is fsynced before the mutation is applied.
+// the log is periodically compacted into a JSON snapshot.
+type fileDb struct {
+	*mockDb
+	dir          string
+	compactEvery int
+	seed         []*api.Federation
+
+	wal     *os.File
+	seq     uint64 // sequence number of the last committed record
+	records int    // records written since the last snapshot
+}
+
+// snapshot is the on-disk image of the repository at sequence Seq.
+type snapshot struct {
+	Seq         uint64            `json:"seq"`
+	LastId      int               `json:"lastId,omitempty"`
+	Federations []*api.Federation `json:"federations"`
+	// History holds the changes of every federation ordered by id.
+	History      []*api.FederationChange `json:"history,omitempty"`
+	LastChangeId int                     `json:"lastChangeId,omitempty"`
+}
+
+// walRecord is a single committed log entry. all mutations in a record are
+// applied together on recovery.
+type walRecord struct {
+	Seq       uint64     `json:"seq"`
+	Mutations []mutation `json:"mutations"`
+}
+
+// NewFileDb returns a FederationRepository persisted under dir.
+// seed is only written when dir holds no previous data.
+// compactEvery <= 0 selects the default compaction interval.
+func NewFileDb(dir string, compactEvery int, seed ...*api.Federation) FederationRepository {
+	return newFileDb(dir, compactEvery, seed...)
+}
+
+func newFileDb(dir string, compactEvery int, seed ...*api.Federation) *fileDb {
+	if compactEvery <= 0 {
+		compactEvery = defaultCompactEvery
+	}
+
+	db := &fileDb{
+		mockDb:       newMockDb(),
+		dir:          dir,
+		compactEvery: compactEvery,
+		seed:         seed,
+	}
+	// writes fail until Setup has opened the log.
+	db.journal = db
+	return db
+}
+
+// Setup recovers the repository state from disk and opens the log for
+// writing. it is safe to call more than once.
+func (db *fileDb) Setup(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.wal != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(db.dir, 0o755); err != nil {
+		return err
+	}
+
+	db.federations = make(map[int]*api.Federation)
+	db.history = make(map[int][]*api.FederationChange)
+	db.owners = newOwnerIndex()
+	db.seq, db.records, db.lastId, db.lastChangeId = 0, 0, 0, 0
+	fresh, err := db.loadSnapshot()
+	if err != nil {
+		return err
+	}
+
+	walPath := filepath.Join(db.dir, walFile)
+	if _, err := os.Stat(walPath); err == nil {
+		fresh = false
+	}
+
+	wal, err := os.OpenFile(walPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := db.recover(wal); err != nil {
+		wal.Close()
+		return err
+	}
+	db.wal = wal
+
+	// first start: persist the seed as the initial snapshot.
+	if fresh && len(db.seed) > 0 {
+		for _, fed := range db.seed {
+			db.set(withVersion(copyFederation(fed)))
+		}
+		if err := db.compact(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close flushes and closes the log.
+func (db *fileDb) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.wal == nil {
+		return nil
+	}
+
+	err := db.wal.Close()
+	db.wal = nil
+	return err
+}
+
+// loadSnapshot reads the latest snapshot, if any.
+// it reports whether the directory held no snapshot.
+func (db *fileDb) loadSnapshot() (bool, error) {
+	data, err := os.ReadFile(filepath.Join(db.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	snap := new(snapshot)
+	if err := json.Unmarshal(data, snap); err != nil {
+		return false, fmt.Errorf("corrupt snapshot: %w", err)
+	}
+
+	for _, fed := range snap.Federations {
+		db.set(withVersion(fed))
+	}
+	db.lastId = max(db.lastId, snap.LastId)
+	for _, change := range snap.History {
+		db.history[change.FederationId] = append(db.history[change.FederationId], change)
+		db.lastChangeId = max(db.lastChangeId, change.Id)
+	}
+	db.lastChangeId = max(db.lastChangeId, snap.LastChangeId)
+	db.seq = snap.Seq
+	return false, nil
+}
+
+// recover replays log records newer than the snapshot.
+// a torn record at the end of the log, left by a crash during a write,
+// is truncated away. corruption anywhere else is reported as an error.
+func (db *fileDb) recover(wal *os.File) error {
+	reader := bufio.NewReader(wal)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				WarningLogger.Printf("truncating torn record at offset %d of %s\n", offset, wal.Name())
+				if err := wal.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		record := new(walRecord)
+		if err := json.Unmarshal(bytes.TrimSpace(line), record); err != nil {
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				WarningLogger.Printf("truncating torn record at offset %d of %s\n", offset, wal.Name())
+				if err := wal.Truncate(offset); err != nil {
+					return err
+				}
+				break
+			}
+			return fmt.Errorf("corrupt log record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		// records already folded into the snapshot.
+		if record.Seq <= db.seq {
+			continue
+		}
+
+		db.replay(record.Mutations...)
+		db.seq = record.Seq
+		db.records++
+	}
+
+	_, err := wal.Seek(offset, io.SeekStart)
+	return err
+}
+
+// commit appends mutations to the log as one record and fsyncs it.
+// it implements journal and runs with mu held.
+func (db *fileDb) commit(mutations ...mutation) error {
+	if db.wal == nil {
+		return errRepositoryClosed
+	}
+
+	if db.records >= db.compactEvery {
+		if err := db.compact(); err != nil {
+			return err
+		}
+	}
+
+	record := walRecord{Seq: db.seq + 1, Mutations: mutations}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	offset, err := db.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.wal.Write(line)
+	if err == nil {
+		err = db.wal.Sync()
+	}
+	if err != nil {
+		// drop a partially written record so later appends stay readable.
+		db.wal.Truncate(offset)
+		db.wal.Seek(offset, io.SeekStart)
+		return err
+	}
+
+	db.seq = record.Seq
+	db.records++
+	return nil
+}
+
+// compact writes the current state to a new snapshot and truncates the log.
+// the snapshot is written to a temporary file and renamed into place, so a
+// crash leaves either the old or the new snapshot. log records covered by
+// the snapshot are skipped on recovery if the truncate did not happen.
+func (db *fileDb) compact() error {
+	snap := snapshot{
+		Seq:          db.seq,
+		LastId:       db.lastId,
+		Federations:  make([]*api.Federation, 0, len(db.federations)),
+		LastChangeId: db.lastChangeId,
+	}
+	for _, fed := range db.federations {
+		snap.Federations = append(snap.Federations, fed)
+	}
+	sort.Slice(snap.Federations, func(i, j int) bool {
+		return snap.Federations[i].Id < snap.Federations[j].Id
+	})
+	for _, changes := range db.history {
+		snap.History = append(snap.History, changes...)
+	}
+	sort.Slice(snap.History, func(i, j int) bool {
+		return snap.History[i].Id < snap.History[j].Id
+	})
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(db.dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(db.dir, snapshotFile)); err != nil {
+		return err
+	}
+	if err := syncDir(db.dir); err != nil {
+		return err
+	}
+
+	if err := db.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := db.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := db.wal.Sync(); err != nil {
+		return err
+	}
+
+	db.records = 0
+	return nil
+}
+
+// writeFileSync writes data to path and fsyncs it before returning.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
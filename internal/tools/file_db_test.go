@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// openFileDb returns a fileDb on dir that is set up and closed on cleanup.
+func openFileDb(t *testing.T, dir string, compactEvery int, seed ...*api.Federation) *fileDb {
+	t.Helper()
+	db := newFileDb(dir, compactEvery, seed...)
+	if err := db.Setup(context.Background()); err != nil {
+		t.Fatalf("Setup() = %v want <nil>", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// test fileDb restart
+// should recover every committed mutation from the log
+func TestFileDbRecoversMutations(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	dir := t.TempDir()
+	sut := openFileDb(t, dir, 0, &api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.AddFederation(context.Background(), &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut.AddFederation(context.Background(), &api.Federation{Id: 3, Owner: "Owner 3"})
+	sut.UpdateFederation(context.Background(), &api.Federation{Id: 2, Owner: "new owner"})
+	sut.DeleteFederation(context.Background(), 1, 0)
+	sut.Close()
+	want := map[int]*api.Federation{
+		1: {Id: 1, Owner: "Owner 1", Version: 2, UpdatedAt: &at, DeletedAt: &at},
+		2: {Id: 2, Owner: "new owner", Version: 2, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at},
+		3: {Id: 3, Owner: "Owner 3", Version: 1, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at},
+	}
+
+	// act
+	reopened := openFileDb(t, dir, 0, &api.Federation{Id: 1, Owner: "Owner 1"})
+
+	// assert
+	if !reflect.DeepEqual(reopened.federations, want) {
+		t.Fatalf("Setup() = %v want %v", reopened.federations, want)
+	}
+}
+
+// test fileDb first start
+// should write the seed only when the directory is empty
+func TestFileDbSeedsOnlyFreshDirectory(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	seed := &api.Federation{Id: 1, Owner: "Owner 1"}
+	sut := openFileDb(t, dir, 0, seed)
+	sut.DeleteFederation(context.Background(), 1, 0)
+	sut.Close()
+
+	// act
+	reopened := openFileDb(t, dir, 0, seed)
+
+	// assert
+	if fed, _ := reopened.GetFederation(context.Background(), 1); fed != nil {
+		t.Fatalf("GetFederation(1) = %v want <nil>", fed)
+	}
+}
+
+// test fileDb compaction
+// should fold the log into a snapshot and keep data across restarts
+func TestFileDbCompaction(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	sut := openFileDb(t, dir, 2)
+
+	// act
+	sut.AddFederation(context.Background(), &api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.AddFederation(context.Background(), &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut.AddFederation(context.Background(), &api.Federation{Id: 3, Owner: "Owner 3"})
+	sut.Close()
+
+	// assert
+	wal, _ := os.ReadFile(filepath.Join(dir, walFile))
+	if lines := strings.Count(string(wal), "\n"); lines != 1 {
+		t.Fatalf("wal records = %d want 1", lines)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatalf("snapshot = %v want file", err)
+	}
+
+	reopened := openFileDb(t, dir, 2)
+	if len(reopened.federations) != 3 {
+		t.Fatalf("Setup() = %d federations want 3", len(reopened.federations))
+	}
+}
+
+// test fileDb with log records already in the snapshot
+// should skip them on recovery
+func TestFileDbSkipsCompactedRecords(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	sut := openFileDb(t, dir, 0)
+	sut.AddFederation(context.Background(), &api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.DeleteFederation(context.Background(), 1, 0)
+	wal, _ := os.ReadFile(filepath.Join(dir, walFile))
+	sut.RestoreFederation(context.Background(), 1, 0)
+	sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "Owner 1 again"})
+	sut.compact()
+	sut.Close()
+	// simulate a crash between the snapshot rename and the log truncate.
+	os.WriteFile(filepath.Join(dir, walFile), wal, 0o644)
+
+	// act
+	reopened := openFileDb(t, dir, 0)
+
+	// assert
+	if fed, _ := reopened.GetFederation(context.Background(), 1); fed == nil || fed.Owner != "Owner 1 again" {
+		t.Fatalf("GetFederation(1) = %v want %q", fed, "Owner 1 again")
+	}
+}
+
+// test fileDb with a torn record at the end of the log
+// should truncate it and recover earlier records
+func TestFileDbTornRecord(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	sut := openFileDb(t, dir, 0)
+	sut.AddFederation(context.Background(), &api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.Close()
+	walPath := filepath.Join(dir, walFile)
+	good, _ := os.ReadFile(walPath)
+	os.WriteFile(walPath, append(good, []byte(`{"seq":2,"mutat`)...), 0o644)
+
+	// act
+	reopened := openFileDb(t, dir, 0)
+	reopened.AddFederation(context.Background(), &api.Federation{Id: 2, Owner: "Owner 2"})
+	reopened.Close()
+	again := openFileDb(t, dir, 0)
+
+	// assert
+	if len(again.federations) != 2 {
+		t.Fatalf("Setup() = %d federations want 2", len(again.federations))
+	}
+}
+
+// test fileDb with a corrupt record in the middle of the log
+// should return error
+func TestFileDbCorruptRecord(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, walFile), []byte("garbage\n{\"seq\":1,\"mutations\":[]}\n"), 0o644)
+	sut := newFileDb(dir, 0)
+
+	// act
+	err := sut.Setup(context.Background())
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "corrupt log record at offset 0") {
+		t.Fatalf("Setup() = %v want corrupt log record error", err)
+	}
+}
+
+// test fileDb writes before Setup or after Close
+// should fail without changing state
+func TestFileDbClosed(t *testing.T) {
+	// arrange
+	sut := newFileDb(t.TempDir(), 0)
+
+	// act
+	_, err := sut.AddFederation(context.Background(), &api.Federation{Id: 1, Owner: "Owner 1"})
+
+	// assert
+	if err != errRepositoryClosed {
+		t.Fatalf("AddFederation(federation) = %v want %v", err, errRepositoryClosed)
+	}
+
+	if fed, _ := sut.GetFederation(context.Background(), 1); fed != nil {
+		t.Fatalf("GetFederation(1) = %v want <nil>", fed)
+	}
+}
+
+// test fileDb restart after deleting the newest federation
+// should keep counting ids from the deleted one
+func TestFileDbKeepsLastId(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	sut := openFileDb(t, dir, 0, &api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.AddFederation(context.Background(), &api.Federation{Id: 7, Owner: "Owner 7"})
+	sut.DeleteFederation(context.Background(), 7, 0)
+	sut.PurgeFederations(context.Background(), timeNow().Add(time.Second))
+	sut.compact()
+	sut.Close()
+
+	// act
+	reopened := openFileDb(t, dir, 0)
+	created, err := reopened.AddFederation(context.Background(), &api.Federation{Owner: "new owner"})
+
+	// assert
+	if err != nil || created.Id != 8 {
+		t.Fatalf("AddFederation(federation) = %v, %v want federation 8", created, err)
+	}
+}
+
+// test ApplyBatch(ops, false) on fileDb
+// should journal the batch as one record and recover it
+func TestFileDbApplyBatch(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	sut := openFileDb(t, dir, 0)
+	ops := []BatchOperation{
+		{Op: BatchCreate, Federation: &api.Federation{Owner: "Owner 1"}},
+		{Op: BatchCreate, Federation: &api.Federation{Owner: "Owner 2"}},
+	}
+
+	// act
+	_, err := sut.ApplyBatch(context.Background(), ops, false)
+	sut.Close()
+
+	// assert
+	if err != nil {
+		t.Fatalf("ApplyBatch(ops) = %v want <nil>", err)
+	}
+
+	wal, _ := os.ReadFile(filepath.Join(dir, walFile))
+	if lines := strings.Count(string(wal), "\n"); lines != 1 {
+		t.Fatalf("wal records = %d want 1", lines)
+	}
+
+	if reopened := openFileDb(t, dir, 0); len(reopened.federations) != 2 {
+		t.Fatalf("Setup() = %d federations want 2", len(reopened.federations))
+	}
+}
+
+// test reopening a fileDb after writes, before and after compaction
+// should recover the history
+func TestFileDbRecoversHistory(t *testing.T) {
+	for _, compactEvery := range []int{1, 100} {
+		// arrange
+		dir := t.TempDir()
+		db := openFileDb(t, dir, compactEvery)
+		want := recordHistory(t, db)
+		db.Close()
+
+		// act
+		sut := openFileDb(t, dir, compactEvery)
+
+		// assert
+		checkHistory(t, sut, want)
+	}
+}
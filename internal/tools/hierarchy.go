@@ -0,0 +1,188 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"gorest/api"
+)
+
+// policies for the live children of a deleted federation, selectable
+// through Config.ParentDelete.
+const (
+	// DeleteRestrict refuses to delete federations with live children.
+	DeleteRestrict = "restrict"
+	// DeleteCascade deletes the live descendants along with the federation.
+	DeleteCascade = "cascade"
+	// DeleteOrphan moves the live children to the top.
+	DeleteOrphan = "orphan"
+)
+
+// deletePolicies lists the valid delete policies.
+var deletePolicies = []string{DeleteRestrict, DeleteCascade, DeleteOrphan}
+
+// ChangeOrphan is recorded in the history of children whose parent was
+// deleted under DeleteOrphan.
+const ChangeOrphan = "orphan"
+
+// deletePolicer is implemented by repositories that apply a delete policy.
+type deletePolicer interface {
+	setDeletePolicy(string)
+}
+
+// parentOf returns the parent id of fed, 0 for federations at the top.
+func parentOf(fed *api.Federation) int {
+	if fed.ParentId == nil {
+		return 0
+	}
+	return *fed.ParentId
+}
+
+// checkParent checks the parent of after, the result of a write on
+// before, which is nil for new federations. live federations that get a
+// parent or come back from deletion need a live parent that is not one of
+// their descendants. lookup returns the stored federation with an id, nil
+// when there is none.
+func checkParent(before, after *api.Federation, lookup func(int) (*api.Federation, error)) error {
+	if !movesParent(before, after) {
+		return nil
+	}
+
+	// the stored hierarchy has no cycles, so walking up from the parent
+	// ends at the top unless it passes through after.
+	parentId := parentOf(after)
+	seen := map[int]bool{}
+	for id := parentId; id != 0; {
+		if id == after.Id {
+			return invalidParent(after.Id, fmt.Sprintf("would make federation %d its own ancestor", after.Id))
+		}
+		ancestor, err := lookup(id)
+		if err != nil {
+			return err
+		}
+		if ancestor == nil || ancestor.DeletedAt != nil {
+			if id == parentId {
+				return invalidParent(after.Id, fmt.Sprintf("federation %d does not exist", id))
+			}
+			return nil
+		}
+		if seen[id] {
+			return fmt.Errorf("federation %d is its own ancestor", id)
+		}
+		seen[id] = true
+		id = parentOf(ancestor)
+	}
+	return nil
+}
+
+// movesParent reports whether after, the result of a write on before,
+// is a live federation that gets a parent or comes back from deletion
+// under one, the writes checkParent walks the ancestors for.
+func movesParent(before, after *api.Federation) bool {
+	parentId := parentOf(after)
+	switch {
+	case after.DeletedAt != nil, parentId == 0:
+		return false
+	case before != nil && before.DeletedAt == nil && parentOf(before) == parentId:
+		return false
+	}
+	return true
+}
+
+// invalidParent returns the violation of the parent of federation id.
+func invalidParent(id int, message string) error {
+	return &FederationError{Id: id, Err: ValidationErrors{{Field: "parent_id", Message: message}}}
+}
+
+// hasChildren returns the error for deleting a federation with live
+// children under DeleteRestrict.
+func hasChildren(id int, children int) error {
+	return &FederationError{Id: id, Err: fmt.Errorf("has %d live children: %w", children, ErrConflict)}
+}
+
+// orphanOf returns the change moving a child of the federation parentId
+// to the top. it fails with ErrConflict when the child no longer has that
+// parent, as a concurrent write may have moved it since it was listed.
+func orphanOf(parentId int) func(*api.Federation) error {
+	return func(fed *api.Federation) error {
+		if parentOf(fed) != parentId {
+			return &FederationError{Id: fed.Id, Err: fmt.Errorf("no longer a child of federation %d: %w", parentId, ErrConflict)}
+		}
+		fed.ParentId = nil
+		return nil
+	}
+}
+
+// Ancestors returns the ancestors of the live federation id in repo,
+// its parent first.
+func Ancestors(ctx context.Context, repo FederationRepository, id int) ([]*api.Federation, error) {
+	fed, err := repo.GetFederation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors := []*api.Federation{}
+	seen := map[int]bool{id: true}
+	for parentId := parentOf(fed); parentId != 0 && !seen[parentId]; parentId = parentOf(fed) {
+		if fed, err = repo.GetFederation(ctx, parentId); err != nil {
+			return nil, err
+		}
+		seen[parentId] = true
+		ancestors = append(ancestors, fed)
+	}
+	return ancestors, nil
+}
+
+// Descendants returns the live descendants of the live federation id in
+// repo, level by level and by id within a level. depth bounds the levels,
+// 1 returns the children only and 0 every level.
+func Descendants(ctx context.Context, repo FederationRepository, id int, depth int) ([]*api.Federation, error) {
+	if depth < 0 {
+		return nil, invalidQuery("depth", "must not be negative")
+	}
+	if _, err := repo.GetFederation(ctx, id); err != nil {
+		return nil, err
+	}
+
+	// a parent cycle, which only concurrent writes could leave behind, is
+	// walked once.
+	descendants := []*api.Federation{}
+	seen := map[int]bool{id: true}
+	level := []int{id}
+	for d := 1; len(level) > 0 && (depth == 0 || d <= depth); d++ {
+		var next []int
+		for _, parentId := range level {
+			children, err := children(ctx, repo, parentId)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				if seen[child.Id] {
+					continue
+				}
+				seen[child.Id] = true
+				descendants = append(descendants, child)
+				next = append(next, child.Id)
+			}
+		}
+		level = next
+	}
+	return descendants, nil
+}
+
+// children returns every live child of the federation id, by id.
+func children(ctx context.Context, repo FederationRepository, id int) ([]*api.Federation, error) {
+	var children []*api.Federation
+	query := FederationQuery{ParentId: id, Limit: MaxPageLimit}
+	for {
+		page, err := repo.GetFederations(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, page.Federations...)
+		if page.Next == "" {
+			return children, nil
+		}
+		query.Cursor = page.Next
+	}
+}
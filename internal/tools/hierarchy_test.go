@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorest/api"
+)
+
+// hierarchy returns a repository with the tree 1 > 2, 3 > 4 > 5 and the
+// deleted child 6 of 1.
+func hierarchy(t *testing.T) FederationRepository {
+	t.Helper()
+	parent := func(id int) *int { return &id }
+	repo := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: parent(1)},
+		&api.Federation{Id: 3, Owner: "Owner 3", ParentId: parent(1)}, &api.Federation{Id: 4, Owner: "Owner 4", ParentId: parent(3)},
+		&api.Federation{Id: 5, Owner: "Owner 5", ParentId: parent(4)}, &api.Federation{Id: 6, Owner: "Owner 6", ParentId: parent(1)})
+	if err := repo.DeleteFederation(context.Background(), 6, 0); err != nil {
+		t.Fatalf("DeleteFederation(6) = %v want <nil>", err)
+	}
+	return repo
+}
+
+// test orphanOf(parentId) on a child of parentId and on a federation moved elsewhere
+// should move the child to the top and refuse the other
+func TestOrphanOf(t *testing.T) {
+	// arrange
+	parent := func(id int) *int { return &id }
+	child := &api.Federation{Id: 2, ParentId: parent(1)}
+	moved := &api.Federation{Id: 3, ParentId: parent(4)}
+
+	// act
+	err := orphanOf(1)(child)
+	movedErr := orphanOf(1)(moved)
+
+	// assert
+	if err != nil || child.ParentId != nil {
+		t.Fatalf("orphanOf(1)(child) = %v, parent %v want <nil>, none", err, child.ParentId)
+	}
+
+	if !errors.Is(movedErr, ErrConflict) || *moved.ParentId != 4 {
+		t.Fatalf("orphanOf(1)(moved) = %v, parent %d want %v, 4", movedErr, *moved.ParentId, ErrConflict)
+	}
+}
+
+// test Ancestors(repo, id) along the tree
+// should list the parent first and nothing for federations at the top
+func TestAncestors(t *testing.T) {
+	// arrange
+	sut := hierarchy(t)
+	tests := []struct {
+		id   int
+		want []int
+	}{
+		{5, []int{4, 3, 1}},
+		{2, []int{1}},
+		{1, []int{}},
+	}
+
+	for _, tt := range tests {
+		// act
+		got, err := Ancestors(context.Background(), sut, tt.id)
+
+		// assert
+		if err != nil || !reflect.DeepEqual(federationIds(got), tt.want) {
+			t.Fatalf("Ancestors(%d) = %v, %v want %v", tt.id, federationIds(got), err, tt.want)
+		}
+	}
+
+	if _, err := Ancestors(context.Background(), sut, 6); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Ancestors(6) = %v want %v", err, ErrNotFound)
+	}
+}
+
+// test Descendants(repo, id, depth) with every depth
+// should list the live descendants level by level down to depth
+func TestDescendants(t *testing.T) {
+	// arrange
+	sut := hierarchy(t)
+	tests := []struct {
+		id    int
+		depth int
+		want  []int
+	}{
+		{1, 0, []int{2, 3, 4, 5}},
+		{1, 1, []int{2, 3}},
+		{1, 2, []int{2, 3, 4}},
+		{3, 0, []int{4, 5}},
+		{5, 0, []int{}},
+	}
+
+	for _, tt := range tests {
+		// act
+		got, err := Descendants(context.Background(), sut, tt.id, tt.depth)
+
+		// assert
+		if err != nil || !reflect.DeepEqual(federationIds(got), tt.want) {
+			t.Fatalf("Descendants(%d, %d) = %v, %v want %v", tt.id, tt.depth, federationIds(got), err, tt.want)
+		}
+	}
+
+	if _, err := Descendants(context.Background(), sut, 1, -1); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Descendants(1, -1) = %v want %v", err, ErrValidation)
+	}
+
+	if _, err := Descendants(context.Background(), sut, 6, 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Descendants(6, 0) = %v want %v", err, ErrNotFound)
+	}
+}
+
+// test Descendants(repo, id, depth) and a cascading DeleteFederation(id) on a parent cycle
+// should list each federation once and delete each once
+func TestDescendantsCycle(t *testing.T) {
+	// arrange
+	parent := func(id int) *int { return &id }
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1", ParentId: parent(2)}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: parent(1)})
+	sut.setDeletePolicy(DeleteCascade)
+
+	// act
+	got, err := Descendants(context.Background(), sut, 1, 0)
+	deleteErr := sut.DeleteFederation(context.Background(), 1, 0)
+
+	// assert
+	if err != nil || !reflect.DeepEqual(federationIds(got), []int{2}) {
+		t.Fatalf("Descendants(1, 0) = %v, %v want [2]", federationIds(got), err)
+	}
+
+	if _, getErr := sut.GetFederation(context.Background(), 2); deleteErr != nil || !errors.Is(getErr, ErrNotFound) {
+		t.Fatalf("DeleteFederation(1) = %v, federation 2 %v want <nil>, %v", deleteErr, getErr, ErrNotFound)
+	}
+}
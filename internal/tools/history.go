@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"gorest/api"
+)
+
+// operations recorded in the change history.
+const (
+	ChangeCreate  = "create"
+	ChangeUpdate  = "update"
+	ChangePatch   = "patch"
+	ChangeDelete  = "delete"
+	ChangeRestore = "restore"
+)
+
+// HistoryQuery selects a page of the changes of a federation, newest
+// first. Cursor continues a listing where a previous page ended.
+type HistoryQuery struct {
+	Limit  int
+	Cursor string
+}
+
+// HistoryPage is one page of the change history.
+type HistoryPage struct {
+	Changes []*api.FederationChange
+	// Total counts every change of the federation.
+	Total int
+	// Next is the cursor of the page of older changes, empty on the last page.
+	Next string
+}
+
+// historyQuery is a validated HistoryQuery.
+type historyQuery struct {
+	limit int
+	// before selects changes with a smaller id, 0 starts at the newest.
+	before int
+}
+
+// resolve validates q and fills in defaults.
+func (q HistoryQuery) resolve() (*historyQuery, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxPageLimit {
+		return nil, invalidQuery("limit", fmt.Sprintf("must be between 1 and %d", MaxPageLimit))
+	}
+
+	h := &historyQuery{limit: q.Limit}
+	if q.Cursor == "" {
+		return h, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, invalidQuery("cursor", "is malformed")
+	}
+	if h.before, err = strconv.Atoi(string(raw)); err != nil || h.before <= 0 {
+		return nil, invalidQuery("cursor", "is malformed")
+	}
+	return h, nil
+}
+
+// page builds a HistoryPage around the selected changes.
+func (h *historyQuery) page(changes []*api.FederationChange, total int, hasNext bool) *HistoryPage {
+	page := &HistoryPage{Changes: changes, Total: total}
+	if hasNext && len(changes) > 0 {
+		last := changes[len(changes)-1]
+		page.Next = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(last.Id)))
+	}
+	return page
+}
+
+// pageChanges selects a page of changes, which are ordered oldest first.
+func pageChanges(changes []*api.FederationChange, q HistoryQuery) (*HistoryPage, error) {
+	h, err := q.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []*api.FederationChange{}
+	hasNext := false
+	for i := len(changes) - 1; i >= 0; i-- {
+		if h.before != 0 && changes[i].Id >= h.before {
+			continue
+		}
+		if len(selected) == h.limit {
+			hasNext = true
+			break
+		}
+		selected = append(selected, copyChange(changes[i]))
+	}
+	return h.page(selected, len(changes), hasNext), nil
+}
+
+// newChange returns the change record of op turning before into after.
+// before is nil when op created the federation.
+func newChange(principal string, op string, before, after *api.Federation) *api.FederationChange {
+	change := &api.FederationChange{
+		FederationId: after.Id,
+		Principal:    principal,
+		At:           timeNow(),
+		Op:           op,
+		After:        copyFederation(after),
+	}
+	if before != nil {
+		change.Before = copyFederation(before)
+	}
+	return change
+}
+
+// copyChange returns a copy of change sharing no memory with it.
+func copyChange(change *api.FederationChange) *api.FederationChange {
+	c := *change
+	if c.Before != nil {
+		c.Before = copyFederation(c.Before)
+	}
+	if c.After != nil {
+		c.After = copyFederation(c.After)
+	}
+	return &c
+}
@@ -0,0 +1,201 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// recordHistory makes a create, update, delete and restore of federation
+// 3 as "alice" and returns the expected changes, newest first.
+func recordHistory(t *testing.T, repo FederationRepository) []*api.FederationChange {
+	at := stopClock(t)
+	ctx := WithPrincipal(context.Background(), "alice")
+
+	steps := []error{}
+	_, err := repo.AddFederation(ctx, &api.Federation{Id: 3, Owner: "Owner 3"})
+	steps = append(steps, err)
+	_, err = repo.UpdateFederation(ctx, &api.Federation{Id: 3, Owner: "new owner", Version: 1})
+	steps = append(steps, err)
+	steps = append(steps, repo.DeleteFederation(ctx, 3, 2))
+	_, err = repo.RestoreFederation(context.Background(), 3, 3)
+	steps = append(steps, err)
+	if err := errors.Join(steps...); err != nil {
+		t.Fatalf("recordHistory() = %v want <nil>", err)
+	}
+
+	created := &api.Federation{Id: 3, Owner: "Owner 3", Version: 1, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at}
+	updated := &api.Federation{Id: 3, Owner: "new owner", Version: 2, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at}
+	deleted := &api.Federation{Id: 3, Owner: "new owner", Version: 3, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at, DeletedAt: &at}
+	restored := &api.Federation{Id: 3, Owner: "new owner", Version: 4, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at}
+	return []*api.FederationChange{
+		{FederationId: 3, Principal: AnonymousPrincipal, At: at, Op: ChangeRestore, Before: deleted, After: restored},
+		{FederationId: 3, Principal: "alice", At: at, Op: ChangeDelete, Before: updated, After: deleted},
+		{FederationId: 3, Principal: "alice", At: at, Op: ChangeUpdate, Before: created, After: updated},
+		{FederationId: 3, Principal: "alice", At: at, Op: ChangeCreate, After: created},
+	}
+}
+
+// checkHistory pages through the history of federation 3 two changes at a
+// time and compares it with want, ignoring the change ids.
+func checkHistory(t *testing.T, repo FederationRepository, want []*api.FederationChange) {
+	var got []*api.FederationChange
+	query := HistoryQuery{Limit: 2}
+	for {
+		page, err := repo.GetHistory(context.Background(), 3, query)
+		if err != nil {
+			t.Fatalf("GetHistory(3, %+v) = %v want <nil>", query, err)
+		}
+		if page.Total != len(want) {
+			t.Fatalf("GetHistory(3, %+v).Total = %d want %d", query, page.Total, len(want))
+		}
+		got = append(got, page.Changes...)
+		if page.Next == "" {
+			break
+		}
+		query.Cursor = page.Next
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("GetHistory(3) returned %d changes want %d", len(got), len(want))
+	}
+	for i := range got {
+		if i > 0 && got[i].Id >= got[i-1].Id {
+			t.Fatalf("GetHistory(3) ids %d, %d want newest first", got[i-1].Id, got[i].Id)
+		}
+		change := *got[i]
+		change.Id = 0
+		if !reflect.DeepEqual(&change, want[i]) {
+			t.Fatalf("GetHistory(3)[%d] = %+v want %+v", i, change, want[i])
+		}
+	}
+}
+
+// test GetHistory(id, query) after writes to a mockDb
+// should return every change newest first
+func TestMockDbHistory(t *testing.T) {
+	// arrange
+	sut := newMockDb()
+	want := recordHistory(t, sut)
+
+	// act & assert
+	checkHistory(t, sut, want)
+}
+
+// test GetHistory(id, query) for a missing or purged federation
+// should return ErrNotFound
+func TestMockDbHistoryNotFound(t *testing.T) {
+	// arrange
+	sut := newMockDb()
+	recordHistory(t, sut)
+	sut.DeleteFederation(context.Background(), 3, 0)
+	sut.PurgeFederations(context.Background(), timeNow().Add(time.Second))
+
+	for _, id := range []int{3, 4} {
+		// act
+		_, err := sut.GetHistory(context.Background(), id, HistoryQuery{})
+
+		// assert
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetHistory(%d) = %v want %v", id, err, ErrNotFound)
+		}
+	}
+}
+
+// test ApplyBatch(ops, atomic) on a mockDb
+// should record applied operations only
+func TestMockDbHistoryBatch(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	ops := []BatchOperation{
+		{Op: BatchUpdate, Id: 1, Federation: &api.Federation{Owner: "new owner"}},
+		{Op: BatchDelete, Id: 9},
+	}
+
+	// act
+	sut.ApplyBatch(context.Background(), ops, true)
+	sut.ApplyBatch(context.Background(), ops, false)
+	page, err := sut.GetHistory(context.Background(), 1, HistoryQuery{})
+
+	// assert
+	if err != nil || page.Total != 1 || page.Changes[0].Op != ChangeUpdate {
+		t.Fatalf("GetHistory(1) = %+v, %v want one update", page, err)
+	}
+}
+
+// test HistoryQuery.resolve with invalid limits and cursors
+// should return validation errors
+func TestHistoryQueryResolveInvalid(t *testing.T) {
+	// arrange
+	tests := []HistoryQuery{
+		{Limit: -1},
+		{Limit: MaxPageLimit + 1},
+		{Cursor: "%%%"},
+		{Cursor: "YWJj"},
+		{Cursor: "MA"},
+	}
+
+	for _, query := range tests {
+		// act
+		_, err := query.resolve()
+
+		// assert
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("resolve(%+v) = %v want %v", query, err, ErrValidation)
+		}
+	}
+}
+
+// test PrincipalFrom(ctx) with and without a principal
+// should return the principal or AnonymousPrincipal
+func TestPrincipalFrom(t *testing.T) {
+	// arrange
+	tests := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{context.Background(), AnonymousPrincipal},
+		{WithPrincipal(context.Background(), ""), AnonymousPrincipal},
+		{WithPrincipal(context.Background(), "alice"), "alice"},
+	}
+
+	for _, tt := range tests {
+		// act
+		got := PrincipalFrom(tt.ctx)
+
+		// assert
+		if got != tt.want {
+			t.Fatalf("PrincipalFrom(ctx) = %q want %q", got, tt.want)
+		}
+	}
+}
+
+// test ParseOrganisations(s) with valid and malformed pairs
+// should map principals to organisations and refuse pairs missing a side
+func TestParseOrganisations(t *testing.T) {
+	// arrange
+	tests := []struct {
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"token:1=Owner 1, token:2 = Owner 2,", map[string]string{"token:1": "Owner 1", "token:2": "Owner 2"}, false},
+		{"token:1", nil, true},
+		{"=Owner 1", nil, true},
+	}
+
+	for _, tt := range tests {
+		// act
+		got, err := ParseOrganisations(tt.s)
+
+		// assert
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ParseOrganisations(%q) = %v, %v want %v", tt.s, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// id generators selectable through Config.IdGenerator.
+const (
+	IdSequence = "sequence"
+	IdRandom   = "random"
+	IdTime     = "time"
+)
+
+// randSource returns the source of the random generators. it is a
+// variable so tests can make them deterministic.
+var randSource = func() rand.Source {
+	return rand.NewSource(time.Now().UnixNano())
+}
+
+// maxSafeId keeps generated ids exact for clients that decode JSON numbers
+// as float64.
+const maxSafeId = 1<<53 - 1
+
+// maxIdAttempts bounds how many candidates a repository tries before giving
+// up on a new federation.
+const maxIdAttempts = 10
+
+// IdGenerator picks ids for federations created without one.
+type IdGenerator interface {
+	// NextId returns a candidate id. last is the largest id stored so far.
+	// repositories ask again when the candidate is taken.
+	NextId(last int) int
+}
+
+// NewIdGenerator returns the generator called name.
+func NewIdGenerator(name string) (IdGenerator, error) {
+	switch name {
+	case "", IdSequence:
+		return NewSequenceIds(), nil
+	case IdRandom:
+		return NewRandomIds(randSource()), nil
+	case IdTime:
+		return NewTimeIds(randSource()), nil
+	}
+	return nil, fmt.Errorf("unknown id generator %q", name)
+}
+
+type sequenceIds struct{}
+
+// NewSequenceIds returns a generator counting up from the largest id.
+func NewSequenceIds() IdGenerator {
+	return sequenceIds{}
+}
+
+func (sequenceIds) NextId(last int) int {
+	return last + 1
+}
+
+type randomIds struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRandomIds returns a generator of unordered random ids.
+func NewRandomIds(src rand.Source) IdGenerator {
+	return &randomIds{rand: rand.New(src)}
+}
+
+func (g *randomIds) NextId(int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return int(g.rand.Int63n(maxSafeId)) + 1
+}
+
+type timeIds struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+	now  func() time.Time
+}
+
+// NewTimeIds returns a generator of time-ordered ids: milliseconds since the
+// epoch in the high bits and 10 random bits in the low ones.
+func NewTimeIds(src rand.Source) IdGenerator {
+	return &timeIds{rand: rand.New(src), now: time.Now}
+}
+
+func (g *timeIds) NextId(last int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := int(g.now().UnixMilli())<<10 | g.rand.Intn(1<<10)
+	// keep increasing when the clock steps back.
+	if id <= last {
+		id = last + 1
+	}
+	return id
+}
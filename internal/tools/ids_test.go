@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// test NextId(int) on the sequence generator
+// should return the id after last
+func TestSequenceIds(t *testing.T) {
+	// act
+	id := NewSequenceIds().NextId(41)
+
+	// assert
+	if id != 42 {
+		t.Fatalf("NextId(41) = %d want 42", id)
+	}
+}
+
+// test NextId(int) on the random generator
+// should return distinct positive ids that are safe in JSON
+func TestRandomIds(t *testing.T) {
+	// arrange
+	sut := NewRandomIds(rand.NewSource(1))
+	seen := map[int]bool{}
+
+	for i := 0; i < 1000; i++ {
+		// act
+		id := sut.NextId(0)
+
+		// assert
+		if id <= 0 || id > maxSafeId || seen[id] {
+			t.Fatalf("NextId(0) = %d want new id in (0, %d]", id, maxSafeId)
+		}
+		seen[id] = true
+	}
+}
+
+// test NextId(int) on the time generator
+// should order ids by time and stay above last
+func TestTimeIds(t *testing.T) {
+	// arrange
+	sut := NewTimeIds(rand.NewSource(1)).(*timeIds)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sut.now = func() time.Time { return now }
+
+	// act
+	first := sut.NextId(0)
+	now = now.Add(time.Millisecond)
+	second := sut.NextId(first)
+	behind := sut.NextId(second + 1<<20)
+
+	// assert
+	if first>>10 != int(now.Add(-time.Millisecond).UnixMilli()) {
+		t.Fatalf("NextId(0) = %d want current millisecond in high bits", first)
+	}
+
+	if second <= first {
+		t.Fatalf("NextId(first) = %d want > %d", second, first)
+	}
+
+	if behind != second+1<<20+1 {
+		t.Fatalf("NextId(last) = %d want %d", behind, second+1<<20+1)
+	}
+}
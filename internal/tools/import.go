@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorest/api"
+)
+
+// import modes. they say what happens to federations whose id is already
+// stored.
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportFail      = "fail"
+)
+
+// outcomes of ImportFederation.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportSkipped   = "skipped"
+)
+
+// ImportFederation stores federation under its own id and says what it
+// did. a stored federation with the same id is skipped in ImportSkip mode,
+// overwritten in ImportOverwrite mode when its fields differ and reported
+// as ErrAlreadyExists in ImportFail mode. stored federations that are
+// deleted are never overwritten, they fail with ErrAlreadyExists too. with
+// keepOwner, overwriting one with another owner fails with
+// ErrOwnerTransferred, as owners then change through transfers only.
+// federation needs a positive id and an owner, its version, state,
+// timestamps and deletion are left to the repository.
+func ImportFederation(ctx context.Context, repo FederationRepository, federation *api.Federation, mode string, keepOwner bool) (string, error) {
+	if mode != ImportSkip && mode != ImportOverwrite && mode != ImportFail {
+		return "", &ValidationError{Field: "mode", Message: fmt.Sprintf("must be %s, %s or %s", ImportSkip, ImportOverwrite, ImportFail)}
+	}
+
+	switch {
+	case federation.Id <= 0:
+		return "", &FederationError{Id: federation.Id, Err: &ValidationError{Field: "id", Message: "must be positive"}}
+	case federation.Owner == "":
+		return "", &FederationError{Id: federation.Id, Err: &ValidationError{Field: "owner", Message: "is required"}}
+	}
+	federation = copyFederation(federation)
+	federation.Version, federation.CreatedAt, federation.UpdatedAt, federation.DeletedAt = 0, nil, nil, nil
+	federation.State, federation.StateChangedAt = "", nil
+
+	_, err := repo.AddFederation(ctx, federation)
+	switch {
+	case err == nil:
+		return ImportCreated, nil
+	case !errors.Is(err, ErrAlreadyExists) || mode == ImportFail:
+		return "", err
+	case mode == ImportSkip:
+		return ImportSkipped, nil
+	}
+
+	stored, err := repo.GetFederation(ctx, federation.Id)
+	if errors.Is(err, ErrNotFound) {
+		return "", &FederationError{Id: federation.Id, Err: fmt.Errorf("%w: deleted", ErrAlreadyExists)}
+	}
+	if err != nil {
+		return "", err
+	}
+	if keepOwner && stored.Owner != federation.Owner {
+		return "", &FederationError{Id: federation.Id, Err: ErrOwnerTransferred}
+	}
+	imported := copyFederation(stored)
+	if err := updateFields(federation)(imported); err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(imported, stored) {
+		return ImportUnchanged, nil
+	}
+
+	// the version read guards against concurrent writers.
+	if _, err := repo.UpdateFederation(ctx, imported); err != nil {
+		return "", err
+	}
+	return ImportUpdated, nil
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorest/api"
+)
+
+// test ImportFederation(ctx, repo, federation, mode, keepOwner) in every mode
+// should create new federations and handle stored ones by mode, keeping their
+// owners with keepOwner
+func TestImportFederation(t *testing.T) {
+	// arrange
+	tests := []struct {
+		mode        string
+		keepOwner   bool
+		federation  *api.Federation
+		wantOutcome string
+		wantError   error
+		wantOwner   string
+	}{
+		{ImportFail, false, &api.Federation{Id: 3, Owner: "Owner 3"}, ImportCreated, nil, "Owner 3"},
+		{ImportFail, false, &api.Federation{Id: 1, Owner: "new"}, "", ErrAlreadyExists, "Owner 1"},
+		{ImportSkip, false, &api.Federation{Id: 1, Owner: "new"}, ImportSkipped, nil, "Owner 1"},
+		{ImportOverwrite, false, &api.Federation{Id: 1, Owner: "new", Version: 9}, ImportUpdated, nil, "new"},
+		{ImportOverwrite, false, &api.Federation{Id: 1, Owner: "Owner 1"}, ImportUnchanged, nil, "Owner 1"},
+		{ImportOverwrite, true, &api.Federation{Id: 1, Owner: "new"}, "", ErrValidation, "Owner 1"},
+		{ImportOverwrite, true, &api.Federation{Id: 1, Owner: "Owner 1", Name: "One"}, ImportUpdated, nil, "Owner 1"},
+		{ImportOverwrite, false, &api.Federation{Id: 2, Owner: "new"}, "", ErrAlreadyExists, ""},
+		{ImportOverwrite, false, &api.Federation{Id: 0, Owner: "new"}, "", ErrValidation, ""},
+		{ImportOverwrite, false, &api.Federation{Id: 4}, "", ErrValidation, ""},
+		{"merge", false, &api.Federation{Id: 4, Owner: "new"}, "", ErrValidation, ""},
+	}
+
+	for _, tt := range tests {
+		sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+		sut.DeleteFederation(context.Background(), 2, 0)
+
+		// act
+		outcome, err := ImportFederation(context.Background(), sut, tt.federation, tt.mode, tt.keepOwner)
+
+		// assert
+		if outcome != tt.wantOutcome || !errors.Is(err, tt.wantError) || (tt.wantError == nil && err != nil) {
+			t.Fatalf("ImportFederation(%v, %s, %t) = %q, %v want %q, %v", tt.federation, tt.mode, tt.keepOwner, outcome, err, tt.wantOutcome, tt.wantError)
+		}
+
+		if tt.wantOwner == "" {
+			continue
+		}
+		if fed, _ := sut.GetFederation(context.Background(), tt.federation.Id); fed == nil || fed.Owner != tt.wantOwner {
+			t.Fatalf("GetFederation(%d) = %v want %s", tt.federation.Id, fed, tt.wantOwner)
+		}
+	}
+}
+
+// existingRepository reports every federation added as existing, like a
+// repository looking ids up before validating.
+type existingRepository struct {
+	FederationRepository
+}
+
+func (r existingRepository) AddFederation(_ context.Context, federation *api.Federation) (*api.Federation, error) {
+	return nil, alreadyExists(federation.Id)
+}
+
+// test ImportFederation(ctx, repo, federation, ImportOverwrite, false) with an invalid record of a stored federation
+// should report the violation and leave the stored federation untouched
+func TestImportFederationInvalidOverwrite(t *testing.T) {
+	// arrange
+	repo := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := existingRepository{repo}
+	federation := &api.Federation{Id: 1, Owner: "Owner 1", Name: strings.Repeat("x", 256)}
+
+	// act
+	outcome, err := ImportFederation(context.Background(), sut, federation, ImportOverwrite, false)
+	stored, _ := repo.GetFederation(context.Background(), 1)
+
+	// assert
+	if outcome != "" || !errors.Is(err, ErrValidation) {
+		t.Fatalf("ImportFederation(%v, %s, false) = %q, %v want %q, %v", federation, ImportOverwrite, outcome, err, "", ErrValidation)
+	}
+
+	if stored.Name != "" || stored.Version != firstVersion {
+		t.Fatalf("GetFederation(1) = %+v want it untouched", stored)
+	}
+}
@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// label keys and values are short words of letters, digits, '-', '_' and
+// '.', starting and ending with a letter or digit. keys may be prefixed
+// with a '/' separated domain. values may also be empty.
+const maxLabelLength = 63
+
+var (
+	labelWord   = fmt.Sprintf(`[A-Za-z0-9]([A-Za-z0-9._-]{0,%d}[A-Za-z0-9])?`, maxLabelLength-2)
+	labelKey    = regexp.MustCompile(`^(` + labelWord + `/)?` + labelWord + `$`)
+	labelValue  = regexp.MustCompile(`^(` + labelWord + `)?$`)
+	labelFormat = fmt.Sprintf("must be at most %d letters, digits, '-', '_' or '.', starting and ending with a letter or digit", maxLabelLength)
+)
+
+// label selector operators.
+const (
+	labelEquals    = "="
+	labelNotEquals = "!="
+	labelExists    = "exists"
+	labelMissing   = "!exists"
+)
+
+// labelRequirement is one comma separated term of a label selector.
+type labelRequirement struct {
+	key   string
+	op    string
+	value string
+}
+
+// matches reports whether labels meet r. a federation without the key
+// meets a != requirement.
+func (r labelRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch r.op {
+	case labelEquals:
+		return ok && value == r.value
+	case labelNotEquals:
+		return !ok || value != r.value
+	case labelExists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// parseLabelSelector reads a selector such as env=prod,tier!=gold. every
+// term must hold: key=value or key==value, key!=value, key for a present
+// label and !key for a missing one.
+func parseLabelSelector(selector string) ([]labelRequirement, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+
+	var requirements []labelRequirement
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		var r labelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			r.key, r.value, _ = strings.Cut(term, "!=")
+			r.op = labelNotEquals
+		case strings.Contains(term, "=="):
+			r.key, r.value, _ = strings.Cut(term, "==")
+			r.op = labelEquals
+		case strings.Contains(term, "="):
+			r.key, r.value, _ = strings.Cut(term, "=")
+			r.op = labelEquals
+		case strings.HasPrefix(term, "!"):
+			r.key, r.op = term[1:], labelMissing
+		default:
+			r.key, r.op = term, labelExists
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+
+		if !labelKey.MatchString(r.key) || !labelValue.MatchString(r.value) {
+			return nil, invalidQuery("labelSelector", fmt.Sprintf("has an invalid term %q", term))
+		}
+		requirements = append(requirements, r)
+	}
+	return requirements, nil
+}
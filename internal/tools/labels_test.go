@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// test parseLabelSelector(selector)
+// should read every kind of term and reject malformed ones
+func TestParseLabelSelector(t *testing.T) {
+	// arrange
+	tests := []struct {
+		selector string
+		want     []labelRequirement
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"env=prod, tier != gold,team==a", []labelRequirement{{"env", labelEquals, "prod"}, {"tier", labelNotEquals, "gold"}, {"team", labelEquals, "a"}}, false},
+		{"env,!tier", []labelRequirement{{"env", labelExists, ""}, {"tier", labelMissing, ""}}, false},
+		{"example.com/team=", []labelRequirement{{"example.com/team", labelEquals, ""}}, false},
+		{"env=prod,", nil, true},
+		{"=prod", nil, true},
+		{"env=pr od", nil, true},
+		{"env!=a!=b", nil, true},
+	}
+
+	for _, tt := range tests {
+		// act
+		got, err := parseLabelSelector(tt.selector)
+
+		// assert
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("parseLabelSelector(%q) = %v, %v want %v", tt.selector, got, err, tt.want)
+		}
+
+		if err != nil && !errors.Is(err, ErrValidation) {
+			t.Fatalf("parseLabelSelector(%q) = %v want %v", tt.selector, err, ErrValidation)
+		}
+	}
+}
+
+// test labelRequirement.matches(labels)
+// should treat missing labels as different from any value
+func TestLabelRequirementMatches(t *testing.T) {
+	// arrange
+	labels := map[string]string{"env": "prod"}
+	tests := []struct {
+		requirement labelRequirement
+		want        bool
+	}{
+		{labelRequirement{"env", labelEquals, "prod"}, true},
+		{labelRequirement{"env", labelEquals, "dev"}, false},
+		{labelRequirement{"env", labelNotEquals, "prod"}, false},
+		{labelRequirement{"tier", labelNotEquals, "gold"}, true},
+		{labelRequirement{"tier", labelEquals, ""}, false},
+		{labelRequirement{"env", labelExists, ""}, true},
+		{labelRequirement{"env", labelMissing, ""}, false},
+		{labelRequirement{"tier", labelMissing, ""}, true},
+	}
+
+	for _, tt := range tests {
+		// act
+		got := tt.requirement.matches(labels)
+
+		// assert
+		if got != tt.want {
+			t.Fatalf("%+v.matches(%v) = %v want %v", tt.requirement, labels, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorest/api"
+)
+
+// federation states. new federations start as drafts, federations stored
+// before states existed have none and behave as active.
+const (
+	StateDraft     = "draft"
+	StateActive    = "active"
+	StateSuspended = "suspended"
+	StateArchived  = "archived"
+)
+
+// states lists every state in lifecycle order.
+var states = []string{StateDraft, StateActive, StateSuspended, StateArchived}
+
+// lifecycle actions, called as POST /federations/{id}:<action>.
+const (
+	ActionActivate = "activate"
+	ActionSuspend  = "suspend"
+	ActionArchive  = "archive"
+)
+
+// transition moves a federation in one of the states from to the state to.
+// guard, when set, returns why the federation may not move yet.
+type transition struct {
+	from  []string
+	to    string
+	guard func(*api.Federation) string
+}
+
+// transitions is the lifecycle of a federation by action. archived
+// federations never move again.
+var transitions = map[string]transition{
+	ActionActivate: {from: []string{StateDraft, StateSuspended}, to: StateActive, guard: needsName},
+	ActionSuspend:  {from: []string{StateActive}, to: StateSuspended},
+	ActionArchive:  {from: []string{StateDraft, StateActive, StateSuspended}, to: StateArchived},
+}
+
+// needsName keeps federations without a name from going live.
+func needsName(fed *api.Federation) string {
+	if strings.TrimSpace(fed.Name) == "" {
+		return "it needs a name"
+	}
+	return ""
+}
+
+// IsTransition reports whether action moves federations between states.
+func IsTransition(action string) bool {
+	_, ok := transitions[action]
+	return ok
+}
+
+// stateOf returns the state of fed, reading a missing state as active.
+func stateOf(fed *api.Federation) string {
+	if fed.State == "" {
+		return StateActive
+	}
+	return fed.State
+}
+
+// StateError reports an action the state of a federation does not allow.
+// it matches ErrConflict.
+type StateError struct {
+	Action string
+	// State is the current state of the federation.
+	State string
+	// Reason is set when a guard refused the action.
+	Reason string
+}
+
+func (e *StateError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("cannot %s while %s: %s", e.Action, e.State, e.Reason)
+	}
+	return fmt.Sprintf("cannot %s while %s", e.Action, e.State)
+}
+
+func (e *StateError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// applyTransition returns the change running action on a federation. it
+// is recorded in the history under the name of the action.
+func applyTransition(action string) func(*api.Federation) error {
+	return func(fed *api.Federation) error {
+		t, ok := transitions[action]
+		if !ok {
+			return &FederationError{Id: fed.Id, Err: &ValidationError{Field: "action", Message: fmt.Sprintf("%q is not a lifecycle action", action)}}
+		}
+		state := stateOf(fed)
+		if !slices.Contains(t.from, state) {
+			return &FederationError{Id: fed.Id, Err: &StateError{Action: action, State: state}}
+		}
+		if t.guard != nil {
+			if reason := t.guard(fed); reason != "" {
+				return &FederationError{Id: fed.Id, Err: &StateError{Action: action, State: state, Reason: reason}}
+			}
+		}
+
+		changedAt := timeNow()
+		fed.State, fed.StateChangedAt = t.to, &changedAt
+		return nil
+	}
+}
+
+// validateState checks a state filter.
+func validateState(state string) error {
+	if state != "" && !slices.Contains(states, state) {
+		return invalidQuery("state", "must be one of "+strings.Join(states, ", "))
+	}
+	return nil
+}
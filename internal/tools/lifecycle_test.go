@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorest/api"
+)
+
+// test applyTransition(action) from every state
+// should follow the transitions table and report the current state otherwise
+func TestApplyTransition(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	tests := []struct {
+		state  string
+		action string
+		want   string
+	}{
+		{StateDraft, ActionActivate, StateActive},
+		{StateDraft, ActionSuspend, ""},
+		{StateDraft, ActionArchive, StateArchived},
+		{StateActive, ActionActivate, ""},
+		{StateActive, ActionSuspend, StateSuspended},
+		{StateActive, ActionArchive, StateArchived},
+		{StateSuspended, ActionActivate, StateActive},
+		{StateSuspended, ActionSuspend, ""},
+		{StateSuspended, ActionArchive, StateArchived},
+		{StateArchived, ActionActivate, ""},
+		{StateArchived, ActionSuspend, ""},
+		{StateArchived, ActionArchive, ""},
+		{"", ActionSuspend, StateSuspended},
+	}
+
+	for _, tt := range tests {
+		fed := &api.Federation{Id: 1, Owner: "Owner 1", Name: "one", State: tt.state}
+
+		// act
+		err := applyTransition(tt.action)(fed)
+
+		// assert
+		if tt.want != "" {
+			if err != nil || fed.State != tt.want || !reflect.DeepEqual(fed.StateChangedAt, &at) {
+				t.Fatalf("applyTransition(%s) from %q = %v, %+v want %s", tt.action, tt.state, err, fed, tt.want)
+			}
+			continue
+		}
+
+		var stateErr *StateError
+		if !errors.As(err, &stateErr) || !errors.Is(err, ErrConflict) || stateErr.State != stateOf(&api.Federation{State: tt.state}) || fed.State != tt.state {
+			t.Fatalf("applyTransition(%s) from %q = %v want a conflict in state %s", tt.action, tt.state, err, tt.state)
+		}
+	}
+}
+
+// test applyTransition(action) with a failing guard and an unknown action
+// should refuse to move the federation
+func TestApplyTransitionRefused(t *testing.T) {
+	// arrange
+	unnamed := &api.Federation{Id: 1, Owner: "Owner 1", State: StateDraft}
+	wantMessage := "federation 1 cannot activate while draft: it needs a name"
+
+	// act
+	guardErr := applyTransition(ActionActivate)(unnamed)
+	unknownErr := applyTransition("publish")(unnamed)
+
+	// assert
+	var stateErr *StateError
+	if !errors.As(guardErr, &stateErr) || guardErr.Error() != wantMessage || unnamed.State != StateDraft {
+		t.Fatalf("applyTransition(activate) = %v want %q", guardErr, wantMessage)
+	}
+
+	if !errors.Is(unknownErr, ErrValidation) {
+		t.Fatalf("applyTransition(publish) = %v want %v", unknownErr, ErrValidation)
+	}
+}
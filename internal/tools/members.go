@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorest/api"
+)
+
+// member roles, kept in step with the validate tag of api.Member.
+const (
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleObserver = "observer"
+)
+
+// MembersRepository stores the member organisations of federations.
+// every method stops early and returns ctx.Err() once ctx is done.
+// members belong to a live federation: every method reports ErrNotFound
+// for federations that do not exist or are deleted, and the members of a
+// federation are removed when it is deleted.
+// an organisation is a member of a federation at most once.
+type MembersRepository interface {
+	// AddMember stores a copy of member in the federation, with a new id.
+	// the role defaults to RoleMember.
+	AddMember(ctx context.Context, federationId int, member *api.Member) (*api.Member, error)
+	GetMember(ctx context.Context, federationId int, id int) (*api.Member, error)
+	// GetMembers returns the members of a federation by id.
+	GetMembers(ctx context.Context, federationId int) ([]*api.Member, error)
+	UpdateMemberRole(ctx context.Context, federationId int, id int, role string) (*api.Member, error)
+	RemoveMember(ctx context.Context, federationId int, id int) error
+}
+
+// memberNotFound returns the error for a missing member of a federation.
+func memberNotFound(federationId, id int) error {
+	return &FederationError{Id: federationId, Err: fmt.Errorf("member %d %w", id, ErrNotFound)}
+}
+
+// memberExists returns the error for an organisation that already is a
+// member of the federation.
+func memberExists(federationId int, organisation string) error {
+	return &FederationError{Id: federationId, Err: fmt.Errorf("member %q %w", organisation, ErrAlreadyExists)}
+}
+
+// validateMember checks member against the validate tags of api.Member.
+func validateMember(federationId int, member *api.Member) error {
+	if err := validateStruct(member); err != nil {
+		return &FederationError{Id: federationId, Err: err}
+	}
+	return nil
+}
+
+// sameOrganisation reports whether two organisation names are the same,
+// ignoring case and surrounding spaces.
+func sameOrganisation(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
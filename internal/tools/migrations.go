@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration is a versioned schema change.
+// statements of a migration run in a single transaction, followed by run
+// when set, for data changes that need code.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+	run        func(ctx context.Context, tx *sql.Tx, bind func(string) string) error
+}
+
+// federationMigrations evolve the federations schema. append new
+// migrations to the end and never edit one that has been released.
+var federationMigrations = []migration{
+	{
+		version: 1,
+		name:    "create federations",
+		statements: []string{
+			`CREATE TABLE federations (
+				id INTEGER NOT NULL PRIMARY KEY,
+				owner VARCHAR(255) NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "index federations owner",
+		statements: []string{
+			`CREATE INDEX federations_owner_idx ON federations (owner)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "add federations version",
+		statements: []string{
+			`ALTER TABLE federations ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add federations deleted_at",
+		statements: []string{
+			`ALTER TABLE federations ADD COLUMN deleted_at TIMESTAMP`,
+		},
+	},
+	{
+		version: 5,
+		name:    "create federation_history",
+		statements: []string{
+			`CREATE TABLE federation_history (
+				id INTEGER NOT NULL PRIMARY KEY,
+				federation_id INTEGER NOT NULL,
+				principal VARCHAR(255) NOT NULL,
+				changed_at TIMESTAMP NOT NULL,
+				op VARCHAR(16) NOT NULL,
+				before_state TEXT,
+				after_state TEXT NOT NULL
+			)`,
+			`CREATE INDEX federation_history_federation_idx ON federation_history (federation_id, id)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "create federation_owner_grams",
+		statements: []string{
+			`CREATE TABLE federation_owner_grams (
+				gram VARCHAR(16) NOT NULL,
+				federation_id INTEGER NOT NULL
+			)`,
+			`CREATE INDEX federation_owner_grams_gram_idx ON federation_owner_grams (gram, federation_id)`,
+			`CREATE INDEX federation_owner_grams_federation_idx ON federation_owner_grams (federation_id)`,
+		},
+		run: indexOwners,
+	},
+	{
+		version: 7,
+		name:    "add federations details",
+		statements: []string{
+			`ALTER TABLE federations ADD COLUMN name VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE federations ADD COLUMN description VARCHAR(1024) NOT NULL DEFAULT ''`,
+			`ALTER TABLE federations ADD COLUMN labels TEXT`,
+			`ALTER TABLE federations ADD COLUMN created_at TIMESTAMP`,
+			`ALTER TABLE federations ADD COLUMN updated_at TIMESTAMP`,
+		},
+	},
+	{
+		version: 8,
+		name:    "create federation_labels",
+		statements: []string{
+			`CREATE TABLE federation_labels (
+				federation_id INTEGER NOT NULL,
+				name VARCHAR(127) NOT NULL,
+				value VARCHAR(63) NOT NULL
+			)`,
+			`CREATE INDEX federation_labels_name_idx ON federation_labels (name, value, federation_id)`,
+			`CREATE INDEX federation_labels_federation_idx ON federation_labels (federation_id)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "add federations state",
+		statements: []string{
+			`ALTER TABLE federations ADD COLUMN state VARCHAR(16)`,
+			`ALTER TABLE federations ADD COLUMN state_changed_at TIMESTAMP`,
+			`CREATE INDEX federations_state_idx ON federations (state)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "add federations parent",
+		statements: []string{
+			`ALTER TABLE federations ADD COLUMN parent_id INTEGER`,
+			`CREATE INDEX federations_parent_idx ON federations (parent_id)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "create federation_sequences",
+		statements: []string{
+			`CREATE TABLE federation_sequences (
+				name VARCHAR(64) NOT NULL PRIMARY KEY,
+				value INTEGER NOT NULL
+			)`,
+		},
+		run: startSequence(federationsSequence, "federations"),
+	},
+	{
+		version: 12,
+		name:    "start federation_history sequence",
+		run:     startSequence(historySequence, "federation_history"),
+	},
+	{
+		version: 13,
+		name:    "backfill federations timestamps",
+		run:     backfillTimestamps,
+	},
+	{
+		version: 14,
+		name:    "start federation_hierarchy sequence",
+		run:     startCounter(hierarchySequence),
+	},
+}
+
+// backfillTimestamps stamps the federations stored before timestamps
+// existed with the time of the migration, so the timestamp columns can be
+// sorted and paged on without NULLs.
+func backfillTimestamps(ctx context.Context, tx *sql.Tx, bind func(string) string) error {
+	now := timeNow()
+	if _, err := tx.ExecContext(ctx, bind(`UPDATE federations SET created_at = ? WHERE created_at IS NULL`), now); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, bind(`UPDATE federations SET updated_at = created_at WHERE updated_at IS NULL`))
+	return err
+}
+
+// startSequence returns the migration step starting the sequence name at
+// the largest id in table.
+func startSequence(name, table string) func(context.Context, *sql.Tx, func(string) string) error {
+	return func(ctx context.Context, tx *sql.Tx, bind func(string) string) error {
+		var last sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT MAX(id) FROM `+table).Scan(&last); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, bind(`INSERT INTO federation_sequences (name, value) VALUES (?, ?)`), name, last.Int64)
+		return err
+	}
+}
+
+// startCounter returns the migration step starting the sequence name at
+// 0, for sequences counting writes rather than ids.
+func startCounter(name string) func(context.Context, *sql.Tx, func(string) string) error {
+	return func(ctx context.Context, tx *sql.Tx, bind func(string) string) error {
+		_, err := tx.ExecContext(ctx, bind(`INSERT INTO federation_sequences (name, value) VALUES (?, ?)`), name, 0)
+		return err
+	}
+}
+
+// migrate applies every migration newer than the recorded schema version.
+// applied versions are tracked in the schema_migrations table.
+func migrate(ctx context.Context, db *sql.DB, bind func(string) string, migrations []migration) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		if err := applyMigration(ctx, db, bind, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		InfoLogger.Printf("applied migration %d (%s)\n", m.version, m.name)
+	}
+
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, bind func(string) string, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if m.run != nil {
+		if err := m.run(ctx, tx, bind); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, bind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`), m.version, m.name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
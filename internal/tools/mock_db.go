@@ -1,74 +1,608 @@
 package tools
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"math/rand"
-	"net/http"
-	"sort"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
 	"gorest/api"
 )
 
-type mockDb struct{}
+// mockDb is an in-memory FederationRepository.
+// all state lives in the instance and is guarded by mu, so a single
+// mockDb can be shared by concurrent handlers.
+type mockDb struct {
+	mu          sync.RWMutex
+	federations map[int]*api.Federation
+	// lastId is the largest id ever stored. ids are not reused.
+	lastId int
+	ids    IdGenerator
+	// history holds the changes of every federation, oldest first.
+	history map[int][]*api.FederationChange
+	// lastChangeId is the id of the latest change.
+	lastChangeId int
+	// owners indexes the owners of live federations for SearchFederations.
+	owners *ownerIndex
+	// deletePolicy says what happens to the live children of deleted
+	// federations, see DeleteRestrict.
+	deletePolicy string
+	// journal, when set, durably records mutations before they are applied.
+	journal journal
+	// dependents drop their data of deleted federations.
+	dependents
+}
+
+// journal is implemented by repositories that persist the mockDb state.
+// commit is called with mu held, so implementations see writes in order.
+type journal interface {
+	commit(mutations ...mutation) error
+}
+
+// mutation operations.
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// mutation is a single change to the repository state.
+type mutation struct {
+	Op         string          `json:"op"`
+	Id         int             `json:"id"`
+	Federation *api.Federation `json:"federation,omitempty"`
+	// Change is the history record of a put.
+	Change *api.FederationChange `json:"change,omitempty"`
+}
+
+// firstVersion is the version of a new federation. data stored before
+// versions existed is read as firstVersion too.
+const firstVersion = 1
+
+// withVersion gives an unversioned federation the first version.
+func withVersion(federation *api.Federation) *api.Federation {
+	if federation.Version == 0 {
+		federation.Version = firstVersion
+	}
+	return federation
+}
 
-var r = rand.New(rand.NewSource(time.Now().UnixNano()))
+// defaultFederations is the data every process starts with.
+var defaultFederations = []*api.Federation{
+	{Id: 1, Owner: "Owner 1"},
+	{Id: 2, Owner: "Owner 2"},
+}
 
-var federationData = map[int]*api.Federation{
-	1: {Id: 1, Owner: "Owner 1"},
-	2: {Id: 2, Owner: "Owner 2"},
+// NewMockDb returns an in-memory FederationRepository seeded with copies of federations.
+func NewMockDb(federations ...*api.Federation) FederationRepository {
+	return newMockDb(federations...)
 }
 
-func (db *mockDb) Setup() error {
+func newMockDb(federations ...*api.Federation) *mockDb {
+	db := &mockDb{
+		federations:  make(map[int]*api.Federation, len(federations)),
+		history:      map[int][]*api.FederationChange{},
+		ids:          NewSequenceIds(),
+		owners:       newOwnerIndex(),
+		deletePolicy: DeleteRestrict,
+	}
+	for _, fed := range federations {
+		db.set(withVersion(copyFederation(fed)))
+	}
+
+	return db
+}
+
+// copyFederation returns a copy of federation so callers never share
+// memory with the repository. empty labels are dropped.
+func copyFederation(federation *api.Federation) *api.Federation {
+	fed := *federation
+	fed.Labels = nil
+	if len(federation.Labels) > 0 {
+		fed.Labels = maps.Clone(federation.Labels)
+	}
+	if federation.ParentId != nil {
+		parentId := *federation.ParentId
+		fed.ParentId = &parentId
+	}
+	fed.StateChangedAt = copyTime(fed.StateChangedAt)
+	fed.CreatedAt = copyTime(fed.CreatedAt)
+	fed.UpdatedAt = copyTime(fed.UpdatedAt)
+	fed.DeletedAt = copyTime(fed.DeletedAt)
+	return &fed
+}
 
-	if n := r.Intn(10); n == 1 {
-		return errors.New("random error")
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
 	}
+	copied := *t
+	return &copied
+}
+
+// Setup has nothing to prepare. wrap the repository in a FaultInjector to
+// simulate failures.
+func (db *mockDb) Setup(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close is a no-op, the data lives only as long as the instance.
+func (db *mockDb) Close() error {
 	return nil
 }
 
-func (db *mockDb) AddFederation(federation *api.Federation) (int, error) {
-	if _, ok := federationData[federation.Id]; ok {
-		return http.StatusBadRequest, fmt.Errorf("federation %d already exists", federation.Id)
+// setIdGenerator implements idAssigner.
+func (db *mockDb) setIdGenerator(ids IdGenerator) {
+	db.ids = ids
+}
+
+// setDeletePolicy implements deletePolicer.
+func (db *mockDb) setDeletePolicy(policy string) {
+	db.deletePolicy = policy
+}
+
+// AddFederation stores a copy of federation and returns it. a zero id is
+// replaced by one from the id generator.
+func (db *mockDb) AddFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	federationData[federation.Id] = federation
-	return http.StatusCreated, nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := db.begin(ctx)
+	fed, err := tx.add(federation)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+	return fed, nil
 }
 
-func (db *mockDb) GetFederation(id int) *api.Federation {
-	fed := federationData[id]
-	return fed
+func (db *mockDb) GetFederation(ctx context.Context, id int) (*api.Federation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	fed, ok := db.federations[id]
+	if !ok || fed.DeletedAt != nil {
+		return nil, notFound(id)
+	}
+	return copyFederation(fed), nil
+}
+
+func (db *mockDb) GetFederations(ctx context.Context, query FederationQuery) (*FederationPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	federations := make([]*api.Federation, 0, len(db.federations))
+	for _, fed := range db.federations {
+		federations = append(federations, copyFederation(fed))
+	}
+	db.mu.RUnlock()
+
+	return pageFederations(federations, query)
+}
+
+// SearchFederations looks the query up in the owner index.
+func (db *mockDb) SearchFederations(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	q, err := query.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	ids := db.owners.candidates(q.q)
+	candidates := make([]*api.Federation, len(ids))
+	for i, id := range ids {
+		candidates[i] = copyFederation(db.federations[id])
+	}
+	db.mu.RUnlock()
+
+	return pageSearch(candidates, query)
+}
+
+// UpdateFederation changes the owner of a stored federation and returns
+// the new state. federation.Version is the version expected in storage.
+func (db *mockDb) UpdateFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	return db.modify(ctx, ChangeUpdate, federation.Id, federation.Version, false, updateFields(federation))
+}
+
+// PatchFederation applies patch to a live federation and returns the
+// new state.
+func (db *mockDb) PatchFederation(ctx context.Context, id int, version int, patch FederationPatch) (*api.Federation, error) {
+	return db.modify(ctx, ChangePatch, id, version, false, applyPatch(patch))
+}
+
+// DeleteFederation marks the federation as deleted and applies the delete
+// policy to its live children.
+func (db *mockDb) DeleteFederation(ctx context.Context, id int, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.write(ctx, func(tx *txn) error {
+		_, err := tx.delete(id, version)
+		return err
+	})
+}
+
+// RestoreFederation undoes the deletion of a federation and returns it.
+func (db *mockDb) RestoreFederation(ctx context.Context, id int, version int) (*api.Federation, error) {
+	return db.modify(ctx, ChangeRestore, id, version, true, unmarkDeleted)
+}
+
+// TransitionFederation runs a lifecycle action on a live federation and
+// returns the new state.
+func (db *mockDb) TransitionFederation(ctx context.Context, id int, version int, action string) (*api.Federation, error) {
+	return db.modify(ctx, action, id, version, false, applyTransition(action))
+}
+
+// modify runs txn.modify on its own.
+func (db *mockDb) modify(ctx context.Context, op string, id int, version int, deleted bool, change func(*api.Federation) error) (*api.Federation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := db.begin(ctx)
+	fed, err := tx.modify(op, id, version, deleted, change)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+	return fed, nil
+}
+
+// ApplyBatch runs ops under a single lock and journals the applied ones
+// as one record.
+func (db *mockDb) ApplyBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var results []BatchResult
+	err := db.write(ctx, func(tx *txn) error {
+		var ok bool
+		results, ok = runBatch(ops, atomic, func(op BatchOperation) (*api.Federation, error) {
+			switch op.Op {
+			case BatchCreate:
+				return tx.add(op.Federation)
+			case BatchUpdate:
+				return tx.modify(ChangeUpdate, op.Id, op.Version, false, updateFields(op.Federation))
+			default:
+				return tx.delete(op.Id, op.Version)
+			}
+		})
+		if !ok {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, err
+	}
+	return results, nil
 }
 
-func (db *mockDb) GetFederations() []*api.Federation {
-	// simulate delay
-	ticker := time.NewTicker(1 * time.Second)
-	<-ticker.C
+// GetHistory returns a page of the changes of a stored federation.
+func (db *mockDb) GetHistory(ctx context.Context, id int, query HistoryQuery) (*HistoryPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 
-	federations := make([]*api.Federation, 0, len(federationData))
-	for _, fed := range federationData {
-		federations = append(federations, fed)
+	if _, ok := db.federations[id]; !ok {
+		return nil, notFound(id)
+	}
+	return pageChanges(db.history[id], query)
+}
+
+// PurgeFederations removes federations deleted before deletedBefore and
+// their history.
+func (db *mockDb) PurgeFederations(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	sort.Slice(federations, func(i, j int) bool {
-		return federations[i].Id < federations[j].Id
+	var n int
+	err := db.write(ctx, func(tx *txn) error {
+		for id, fed := range db.federations {
+			if fed.DeletedAt != nil && fed.DeletedAt.Before(deletedBefore) {
+				tx.purge(id)
+				n++
+			}
+		}
+		return nil
 	})
-	return federations
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// write runs fn in a txn under the write lock and commits it when fn
+// succeeds. the dependents are told about the federations it deleted once
+// the lock is released.
+func (db *mockDb) write(ctx context.Context, fn func(*txn) error) error {
+	db.mu.Lock()
+	tx := db.begin(ctx)
+	err := fn(tx)
+	if err == nil {
+		err = tx.commit()
+	}
+	db.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	db.dependents.removeFederations(tx.deleted)
+	return nil
+}
+
+// txn stages changes to a mockDb so they can be journaled as a single
+// record. reads see the staged changes. callers must hold the write lock.
+type txn struct {
+	db           *mockDb
+	staged       map[int]*api.Federation
+	lastId       int
+	lastChangeId int
+	// principal is recorded in the history of every change.
+	principal string
+	mutations []mutation
+	// deleted holds the ids of the federations deleted or purged.
+	deleted []int
+}
+
+func (db *mockDb) begin(ctx context.Context) *txn {
+	return &txn{
+		db:           db,
+		staged:       map[int]*api.Federation{},
+		lastId:       db.lastId,
+		lastChangeId: db.lastChangeId,
+		principal:    PrincipalFrom(ctx),
+	}
+}
+
+func (tx *txn) get(id int) (*api.Federation, bool) {
+	if fed, ok := tx.staged[id]; ok {
+		return fed, true
+	}
+	fed, ok := tx.db.federations[id]
+	return fed, ok
+}
+
+// put stages fed, the result of op on before, and its history record.
+func (tx *txn) put(op string, before, fed *api.Federation) {
+	change := newChange(tx.principal, op, before, fed)
+	tx.lastChangeId++
+	change.Id = tx.lastChangeId
+
+	tx.staged[fed.Id] = fed
+	tx.lastId = max(tx.lastId, fed.Id)
+	tx.mutations = append(tx.mutations, mutation{Op: opPut, Id: fed.Id, Federation: fed, Change: change})
+}
+
+// commit journals and applies the staged changes.
+func (tx *txn) commit() error {
+	if len(tx.mutations) == 0 {
+		return nil
+	}
+	return tx.db.apply(tx.mutations...)
 }
 
-func (db *mockDb) UpdateFederation(federation *api.Federation) (int, error) {
-	dbFederation, ok := federationData[federation.Id]
-	if !ok {
-		return http.StatusNotFound, fmt.Errorf("federation %d not found", federation.Id)
+// add stages a copy of federation with a new version and, for a zero id,
+// an id from the id generator.
+func (tx *txn) add(federation *api.Federation) (*api.Federation, error) {
+	if err := validateFederation(federation); err != nil {
+		return nil, err
+	}
+
+	fed := copyFederation(federation)
+	fed.Version = firstVersion
+	fed.State = StateDraft
+	fed.DeletedAt = nil
+	stampCreated(fed)
+	if fed.Id == 0 {
+		id, err := tx.freeId()
+		if err != nil {
+			return nil, err
+		}
+		fed.Id = id
+	} else if _, ok := tx.get(fed.Id); ok {
+		return nil, alreadyExists(fed.Id)
+	}
+	if err := checkParent(nil, fed, tx.lookup); err != nil {
+		return nil, err
 	}
 
-	dbFederation.Owner = federation.Owner
-	return http.StatusOK, nil
+	tx.put(ChangeCreate, nil, fed)
+	return copyFederation(fed), nil
 }
 
-func (db *mockDb) DeleteFederation(id int) (int, error) {
-	delete(federationData, id)
-	return http.StatusOK, nil
+// freeId asks the id generator for an unused id.
+func (tx *txn) freeId() (int, error) {
+	for i := 0; i < maxIdAttempts; i++ {
+		id := tx.db.ids.NextId(tx.lastId)
+		if _, ok := tx.get(id); !ok && id > 0 {
+			return id, nil
+		}
+	}
+	return 0, noFreeId()
+}
+
+// modify applies change to a copy of the stored federation, bumps its
+// version and stages it. nothing is staged when change fails. deleted
+// says whether the federation must be deleted or live. op names the change
+// in the history.
+func (tx *txn) modify(op string, id int, version int, deleted bool, change func(*api.Federation) error) (*api.Federation, error) {
+	stored, ok := tx.get(id)
+	switch {
+	case !ok, !deleted && stored.DeletedAt != nil:
+		return nil, notFound(id)
+	case deleted && stored.DeletedAt == nil:
+		return nil, notDeleted(id)
+	case version != 0 && version != stored.Version:
+		return nil, versionMismatch(id)
+	}
+
+	updated := copyFederation(stored)
+	if err := change(updated); err != nil {
+		return nil, err
+	}
+	if err := checkParent(stored, updated, tx.lookup); err != nil {
+		return nil, err
+	}
+	updated.Version++
+	stampUpdated(updated)
+	tx.put(op, stored, updated)
+	return copyFederation(updated), nil
+}
+
+// savepoint returns a function dropping everything staged since, so a
+// failing operation of a batch leaves none of its changes behind.
+func (tx *txn) savepoint() func() {
+	staged := maps.Clone(tx.staged)
+	mutations, deleted := len(tx.mutations), len(tx.deleted)
+	lastId, lastChangeId := tx.lastId, tx.lastChangeId
+	return func() {
+		tx.staged = staged
+		tx.mutations = tx.mutations[:mutations]
+		tx.deleted = tx.deleted[:deleted]
+		tx.lastId, tx.lastChangeId = lastId, lastChangeId
+	}
+}
+
+// delete stages the deletion of a live federation and applies the delete
+// policy to its live children. nothing is staged when any step fails.
+func (tx *txn) delete(id int, version int) (*api.Federation, error) {
+	rollback := tx.savepoint()
+	fed, err := tx.deleteTree(id, version)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	return fed, nil
+}
+
+// deleteTree implements delete, staging the federation before its
+// children.
+func (tx *txn) deleteTree(id int, version int) (*api.Federation, error) {
+	children := tx.children(id)
+	if len(children) > 0 && tx.db.deletePolicy == DeleteRestrict {
+		return nil, hasChildren(id, len(children))
+	}
+
+	fed, err := tx.modify(ChangeDelete, id, version, false, markDeleted)
+	if err != nil {
+		return nil, err
+	}
+	tx.deleted = append(tx.deleted, id)
+	for _, childId := range children {
+		// a parent cycle, which only concurrent writes could leave behind,
+		// leads back to a federation deleted already.
+		if slices.Contains(tx.deleted, childId) {
+			continue
+		}
+		if tx.db.deletePolicy == DeleteCascade {
+			_, err = tx.deleteTree(childId, 0)
+		} else {
+			_, err = tx.modify(ChangeOrphan, childId, 0, false, orphanOf(id))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fed, nil
+}
+
+// purge stages the removal of the federation id and its history.
+func (tx *txn) purge(id int) {
+	tx.mutations = append(tx.mutations, mutation{Op: opDelete, Id: id})
+	tx.deleted = append(tx.deleted, id)
+}
+
+// children returns the ids of the live children of the federation id, in
+// order.
+func (tx *txn) children(id int) []int {
+	isChild := func(fed *api.Federation) bool {
+		return fed.DeletedAt == nil && parentOf(fed) == id
+	}
+
+	var children []int
+	for childId, fed := range tx.staged {
+		if isChild(fed) {
+			children = append(children, childId)
+		}
+	}
+	for childId, fed := range tx.db.federations {
+		if _, staged := tx.staged[childId]; !staged && isChild(fed) {
+			children = append(children, childId)
+		}
+	}
+	slices.Sort(children)
+	return children
+}
+
+// lookup returns the federation with id as staged, nil when there is none.
+func (tx *txn) lookup(id int) (*api.Federation, error) {
+	fed, _ := tx.get(id)
+	return fed, nil
+}
+
+// apply journals mutations and then applies them to the in-memory state.
+// callers must hold the write lock.
+func (db *mockDb) apply(mutations ...mutation) error {
+	if db.journal != nil {
+		if err := db.journal.commit(mutations...); err != nil {
+			return err
+		}
+	}
+
+	db.replay(mutations...)
+	return nil
+}
+
+// set stores fed and keeps the indexes up to date. callers must hold the
+// write lock.
+func (db *mockDb) set(fed *api.Federation) {
+	db.federations[fed.Id] = fed
+	db.lastId = max(db.lastId, fed.Id)
+	db.owners.put(fed)
+}
+
+// replay applies mutations to the in-memory state without journaling them.
+func (db *mockDb) replay(mutations ...mutation) {
+	for _, m := range mutations {
+		switch m.Op {
+		case opPut:
+			db.set(withVersion(m.Federation))
+			if m.Change != nil {
+				db.history[m.Id] = append(db.history[m.Id], m.Change)
+				db.lastChangeId = max(db.lastChangeId, m.Change.Id)
+			}
+		case opDelete:
+			delete(db.federations, m.Id)
+			delete(db.history, m.Id)
+			db.owners.remove(m.Id)
+		}
+	}
 }
@@ -1,102 +1,175 @@
 package tools
 
 import (
-	"math/rand"
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"gorest/api"
 )
 
-// test setup() with random error
-// should return error
-func TestSetupRandomError(t *testing.T) {
+// test setup() without error
+// should return nil
+func TestSetupSuccess(t *testing.T) {
 	// arrange
-	r = rand.New(rand.NewSource(1))
-	sut := new(mockDb)
+	sut := newMockDb()
 
 	// act
-	err := sut.Setup()
+	err := sut.Setup(context.Background())
 
 	// assert
-	if err == nil {
-		t.Fatal(`setup() = "nil" want "random error"`)
-	}
-
-	if err.Error() != "random error" {
-		t.Fatalf(`setup() = %q want "random error"`, err)
+	if err != nil {
+		t.Fatalf(`setup() = %q want "nil"`, err)
 	}
 }
 
-// test setup() without error
-// should return nil
-func TestSetupSuccess(t *testing.T) {
+// test NewMockDb(...*api.Federation) seed isolation
+// should copy seed data into the instance
+func TestNewMockDbSeedIsolation(t *testing.T) {
 	// arrange
-	r = rand.New(rand.NewSource(2))
-	sut := new(mockDb)
+	seed := &api.Federation{Id: 1, Owner: "Owner 1"}
+	sut := NewMockDb(seed)
+	other := NewMockDb()
 
 	// act
-	err := sut.Setup()
+	seed.Owner = "changed"
 
 	// assert
-	if err != nil {
-		t.Fatalf(`setup() = %q want "nil"`, err)
+	if fed, _ := sut.GetFederation(context.Background(), 1); fed.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(1) = %q want %q", fed.Owner, "Owner 1")
+	}
+
+	if fed, _ := other.GetFederation(context.Background(), 1); fed != nil {
+		t.Fatalf("GetFederation(1) = %v want <nil>", fed)
 	}
 }
 
-// test AddFederation(*api.Federation) (int, err) with duplicated federation
+// test AddFederation(*api.Federation) error with duplicated federation
 // should return error
 func TestAddFederationDuplicated(t *testing.T) {
 	// arrange
 	federation := &api.Federation{
-		Id: 1,
+		Id:    1,
+		Owner: "Owner 2",
 	}
-	sut := new(mockDb)
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
 	wantErr := "federation 1 already exists"
-	wantCode := http.StatusBadRequest
 
 	// act
-	code, err := sut.AddFederation(federation)
+	_, err := sut.AddFederation(context.Background(), federation)
 
 	// assert
-	if code != wantCode {
-		t.Fatalf("AddFederation(federation) = %d want %d", code, wantCode)
-	}
-
 	if err.Error() != wantErr {
 		t.Fatalf("AddFederation(federation) = %q want %q", err, wantErr)
 	}
+
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("AddFederation(federation) = %v want %v", err, ErrAlreadyExists)
+	}
 }
 
-// test AddFederation(*api.Federation) (int, err) success
+// test AddFederation(*api.Federation) error success
 // should create  federation
 func TestAddFederationSuccess(t *testing.T) {
 	// arrange
+	at := stopClock(t)
 	federation := &api.Federation{
 		Id:    123,
 		Owner: "Federation 123",
 	}
-	sut := new(mockDb)
+	sut := newMockDb()
 	var wantErr error = nil
-	wantCode := http.StatusCreated
 
 	// act
-	code, err := sut.AddFederation(federation)
+	_, err := sut.AddFederation(context.Background(), federation)
 
 	// assert
-	if code != wantCode {
-		t.Fatalf("AddFederation(federation) = %d want %d", code, wantCode)
-	}
-
 	if err != wantErr {
 		t.Fatalf("AddFederation(federation) = %v want %v", err, wantErr)
 	}
 
-	var federation123 = sut.GetFederation(123)
-	if federation123 != federation {
+	federation123, _ := sut.GetFederation(context.Background(), 123)
+	federation.Version = 1
+	federation.State, federation.StateChangedAt = StateDraft, &at
+	federation.CreatedAt, federation.UpdatedAt = &at, &at
+	if !reflect.DeepEqual(federation123, federation) {
 		t.Fatalf("AddFederation(federation) = %v want %v", federation123, federation)
 	}
+
+	if federation123 == federation {
+		t.Fatal("AddFederation(federation) stored the caller's pointer want a copy")
+	}
+}
+
+// test AddFederation(*api.Federation) error with invalid id
+// should return validation error
+func TestAddFederationInvalidId(t *testing.T) {
+	// arrange
+	sut := newMockDb()
+	wantErr := "federation -1 id must be at least 0"
+
+	// act
+	_, err := sut.AddFederation(context.Background(), &api.Federation{Id: -1, Owner: "owner"})
+
+	// assert
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("AddFederation(federation) = %v want %v", err, ErrValidation)
+	}
+
+	if err.Error() != wantErr {
+		t.Fatalf("AddFederation(federation) = %q want %q", err, wantErr)
+	}
+}
+
+// test AddFederation(*api.Federation) without id
+// should assign the next id, never reusing deleted ones
+func TestAddFederationGeneratedId(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut.DeleteFederation(context.Background(), 2, 0)
+
+	// act
+	created, err := sut.AddFederation(context.Background(), &api.Federation{Owner: "new owner"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("AddFederation(federation) = %v want <nil>", err)
+	}
+
+	if created.Id != 3 || created.Owner != "new owner" {
+		t.Fatalf("AddFederation(federation) = %v want federation 3", created)
+	}
+
+	if stored, _ := sut.GetFederation(context.Background(), 3); !reflect.DeepEqual(stored, created) {
+		t.Fatalf("GetFederation(3) = %v want %v", stored, created)
+	}
+}
+
+// idsFunc adapts a function to IdGenerator.
+type idsFunc func(last int) int
+
+func (f idsFunc) NextId(last int) int {
+	return f(last)
+}
+
+// test AddFederation(*api.Federation) with a generator returning taken ids
+// should give up with a conflict
+func TestAddFederationNoFreeId(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.setIdGenerator(idsFunc(func(int) int { return 1 }))
+
+	// act
+	_, err := sut.AddFederation(context.Background(), &api.Federation{Owner: "owner"})
+
+	// assert
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("AddFederation(federation) = %v want %v", err, ErrConflict)
+	}
 }
 
 // test GetFederation with bad request
@@ -104,15 +177,19 @@ func TestAddFederationSuccess(t *testing.T) {
 func TestGetFederationNotFound(t *testing.T) {
 	// arrange
 	id := -1
-	sut := new(mockDb)
+	sut := newMockDb()
 
 	// act
-	fed := sut.GetFederation(id)
+	fed, err := sut.GetFederation(context.Background(), id)
 
 	// assert
 	if fed != nil {
 		t.Fatalf("GetFederation(id) = %v want %v", fed, nil)
 	}
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetFederation(id) = %v want %v", err, ErrNotFound)
+	}
 }
 
 // test GetFederation without error
@@ -120,10 +197,10 @@ func TestGetFederationNotFound(t *testing.T) {
 func TestGetFederationSuccess(t *testing.T) {
 	// arrange
 	id := 1
-	sut := new(mockDb)
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
 
 	// act
-	fed := sut.GetFederation(id)
+	fed, _ := sut.GetFederation(context.Background(), id)
 
 	// assert
 	if fed.Id != id {
@@ -135,30 +212,21 @@ func TestGetFederationSuccess(t *testing.T) {
 // should return an ordered slice of federations
 func TestGetFederationsSucess(t *testing.T) {
 	// arrange
-	federationData = map[int]*api.Federation{
-		2: {Id: 2, Owner: "Owner 2"},
-		1: {Id: 1, Owner: "Owner 1"},
-	}
-	sut := new(mockDb)
-	dontWant := []*api.Federation{
-		federationData[2],
-		federationData[1],
-	}
+	sut := newMockDb(
+		&api.Federation{Id: 2, Owner: "Owner 2"},
+		&api.Federation{Id: 1, Owner: "Owner 1"},
+	)
 	want := []*api.Federation{
-		federationData[1],
-		federationData[2],
+		{Id: 1, Owner: "Owner 1", Version: 1},
+		{Id: 2, Owner: "Owner 2", Version: 1},
 	}
 
 	// act
-	federations := sut.GetFederations()
+	page, _ := sut.GetFederations(context.Background(), FederationQuery{})
 
 	// assert
-	if !reflect.DeepEqual(federations, want) {
-		t.Fatalf("GetFederations() = %v want %v", federations, want)
-	}
-
-	if reflect.DeepEqual(federations, dontWant) {
-		t.Fatalf("GetFederations() = %v want %v", federations, dontWant)
+	if !reflect.DeepEqual(page.Federations, want) {
+		t.Fatalf("GetFederations(query) = %v want %v", page.Federations, want)
 	}
 }
 
@@ -167,21 +235,21 @@ func TestGetFederationsSucess(t *testing.T) {
 func TestUpdateFederationNotFound(t *testing.T) {
 	// arrange
 	federation := &api.Federation{Id: -1}
-	sut := new(mockDb)
-	wantCode := http.StatusNotFound
+	sut := newMockDb()
 	wantError := "federation -1 not found"
 
 	// act
-	code, err := sut.UpdateFederation(federation)
+	_, err := sut.UpdateFederation(context.Background(), federation)
 
 	// assert
-	if code != wantCode {
-		t.Fatalf("UpdateFederation(federation) = %d want %d", code, wantCode)
-	}
-
 	if err.Error() != wantError {
 		t.Fatalf("UpdateFederation(federation) = %q want %q", err, wantError)
 	}
+
+	var fedErr *FederationError
+	if !errors.As(err, &fedErr) || fedErr.Id != -1 {
+		t.Fatalf("UpdateFederation(federation) = %v want *FederationError for -1", err)
+	}
 }
 
 // test UpdateFederation(*federation) success
@@ -189,59 +257,438 @@ func TestUpdateFederationNotFound(t *testing.T) {
 func TestUpdateFederationSuccess(t *testing.T) {
 	// arrange
 	federation := &api.Federation{Id: 1, Owner: "new owner"}
-	sut := new(mockDb)
-	wantCode := http.StatusOK
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
 	var wantError error = nil
 
 	// act
-	code, err := sut.UpdateFederation(federation)
+	_, err := sut.UpdateFederation(context.Background(), federation)
 
 	// assert
-	if code != wantCode {
-		t.Fatalf("UpdateFederation(federation) = %d want %d", code, wantCode)
-	}
-
 	if err != wantError {
 		t.Fatalf("UpdateFederation(federation) = %v want %v", err, wantError)
 	}
 
-	if federationData[1].Owner != federation.Owner {
-		t.Fatalf("UpdateFederation(federation) = %q want %q", federationData[1].Owner, federation.Owner)
+	if sut.federations[1].Owner != federation.Owner {
+		t.Fatalf("UpdateFederation(federation) = %q want %q", sut.federations[1].Owner, federation.Owner)
+	}
+
+	if sut.federations[1].Id != federation.Id {
+		t.Fatalf("UpdateFederation(federation) = %d want %d", sut.federations[1].Id, federation.Id)
+	}
+}
+
+// test UpdateFederation(*federation) and DeleteFederation(id, version) with versions
+// should apply matching versions and reject stale ones
+func TestMockDbVersions(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+
+	// act
+	updated, err := sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "new owner", Version: 1})
+	_, staleErr := sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "lost update", Version: 1})
+	staleDeleteErr := sut.DeleteFederation(context.Background(), 1, 1)
+	missingDeleteErr := sut.DeleteFederation(context.Background(), 9, 1)
+	deleteErr := sut.DeleteFederation(context.Background(), 1, 2)
+
+	// assert
+	if err != nil || updated.Version != 2 || updated.Owner != "new owner" {
+		t.Fatalf("UpdateFederation(federation) = %v, %v want version 2", updated, err)
+	}
+
+	if !errors.Is(staleErr, ErrVersionMismatch) {
+		t.Fatalf("UpdateFederation(federation) = %v want %v", staleErr, ErrVersionMismatch)
+	}
+
+	if !errors.Is(staleDeleteErr, ErrVersionMismatch) {
+		t.Fatalf("DeleteFederation(1, 1) = %v want %v", staleDeleteErr, ErrVersionMismatch)
 	}
 
-	if federationData[1].Id != federation.Id {
-		t.Fatalf("UpdateFederation(federation) = %d want %d", federationData[1].Id, federation.Id)
+	if !errors.Is(missingDeleteErr, ErrNotFound) {
+		t.Fatalf("DeleteFederation(9, 1) = %v want %v", missingDeleteErr, ErrNotFound)
+	}
+
+	if deleteErr != nil || sut.federations[1].DeletedAt == nil {
+		t.Fatalf("DeleteFederation(1, 2) = %v want <nil>", deleteErr)
+	}
+}
+
+// test PatchFederation(id, version, patch)
+// should store the patched federation and nothing when the patch fails
+func TestMockDbPatchFederation(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	patch, _ := ParseJSONPatch([]byte(`[{"op":"replace","path":"/owner","value":"new owner"}]`))
+	failing, _ := ParseJSONPatch([]byte(`[{"op":"replace","path":"/owner","value":"lost"},{"op":"test","path":"/owner","value":"x"}]`))
+	want := &api.Federation{Id: 1, Owner: "new owner", Version: 2, UpdatedAt: &at}
+
+	// act
+	patched, err := sut.PatchFederation(context.Background(), 1, 1, patch)
+	_, failErr := sut.PatchFederation(context.Background(), 1, 0, failing)
+	_, staleErr := sut.PatchFederation(context.Background(), 1, 1, patch)
+	_, missingErr := sut.PatchFederation(context.Background(), 2, 0, patch)
+
+	// assert
+	if err != nil || !reflect.DeepEqual(patched, want) {
+		t.Fatalf("PatchFederation(1, 1, patch) = %v, %v want %v", patched, err, want)
+	}
+
+	if !errors.Is(failErr, ErrConflict) || !reflect.DeepEqual(sut.federations[1], want) {
+		t.Fatalf("PatchFederation(1, 0, failing) = %v, %v want %v unchanged", failErr, sut.federations[1], want)
+	}
+
+	if !errors.Is(staleErr, ErrVersionMismatch) {
+		t.Fatalf("PatchFederation(1, 1, patch) = %v want %v", staleErr, ErrVersionMismatch)
+	}
+
+	if !errors.Is(missingErr, ErrNotFound) {
+		t.Fatalf("PatchFederation(2, 0, patch) = %v want %v", missingErr, ErrNotFound)
 	}
 }
 
 // test DeleteFederation(string)
-// should deleteFederation
+// should mark the federation as deleted
 func TestDeleteFederationSucess(t *testing.T) {
 	// arrange
-	federationData = map[int]*api.Federation{
-		1: {Id: 1, Owner: "Owner 1"},
-		2: {Id: 20, Owner: "Owner 2"},
-	}
+	at := stopClock(t)
+	sut := newMockDb(
+		&api.Federation{Id: 1, Owner: "Owner 1"},
+		&api.Federation{Id: 20, Owner: "Owner 2"},
+	)
 	id := 1
-	sut := new(mockDb)
-	wantCode := http.StatusOK
 	var wantError error = nil
+	want := &api.Federation{Id: 1, Owner: "Owner 1", Version: 2, UpdatedAt: &at, DeletedAt: &at}
 
 	// act
-	code, err := sut.DeleteFederation(id)
-	_, ok := federationData[id]
+	err := sut.DeleteFederation(context.Background(), id, 0)
 
 	// assert
-	if code != wantCode {
-		t.Fatalf("DeleteFederation(id) = %d want %d", code, wantCode)
-	}
-
 	if err != wantError {
 		t.Fatalf("DeleteFederation(id) = %v want %v", err, wantError)
 	}
 
-	if ok {
-		t.Fatalf("DeleteFederation(id) = %v want %v", ok, false)
+	if !reflect.DeepEqual(sut.federations[id], want) {
+		t.Fatalf("DeleteFederation(id) = %v want %v", sut.federations[id], want)
+	}
+
+	if fed, err := sut.GetFederation(context.Background(), id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetFederation(id) = %v, %v want %v", fed, err, ErrNotFound)
 	}
+}
+
+// test DeleteFederation(id, version) with missing or deleted federations
+// should return ErrNotFound
+func TestDeleteFederationNotFound(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut.DeleteFederation(context.Background(), 1, 0)
 
+	for _, id := range []int{1, 2} {
+		// act
+		err := sut.DeleteFederation(context.Background(), id, 0)
+
+		// assert
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("DeleteFederation(%d) = %v want %v", id, err, ErrNotFound)
+		}
+	}
+}
+
+// test RestoreFederation(id, version)
+// should undo the deletion and reject live or missing federations
+func TestRestoreFederation(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut.DeleteFederation(context.Background(), 1, 0)
+
+	// act
+	_, staleErr := sut.RestoreFederation(context.Background(), 1, 1)
+	restored, err := sut.RestoreFederation(context.Background(), 1, 2)
+	_, liveErr := sut.RestoreFederation(context.Background(), 2, 0)
+	_, missingErr := sut.RestoreFederation(context.Background(), 3, 0)
+
+	// assert
+	if want := (&api.Federation{Id: 1, Owner: "Owner 1", Version: 3, UpdatedAt: &at}); err != nil || !reflect.DeepEqual(restored, want) {
+		t.Fatalf("RestoreFederation(1, 2) = %v, %v want %v", restored, err, want)
+	}
+
+	if !errors.Is(staleErr, ErrVersionMismatch) {
+		t.Fatalf("RestoreFederation(1, 1) = %v want %v", staleErr, ErrVersionMismatch)
+	}
+
+	if !errors.Is(liveErr, ErrConflict) {
+		t.Fatalf("RestoreFederation(2) = %v want %v", liveErr, ErrConflict)
+	}
+
+	if !errors.Is(missingErr, ErrNotFound) {
+		t.Fatalf("RestoreFederation(3) = %v want %v", missingErr, ErrNotFound)
+	}
+
+	if fed, err := sut.GetFederation(context.Background(), 1); err != nil {
+		t.Fatalf("GetFederation(1) = %v, %v want restored federation", fed, err)
+	}
+}
+
+// test pageFederations(federations, query) with deleted federations
+// should list them only with IncludeDeleted
+func TestPageFederationsIncludeDeleted(t *testing.T) {
+	// arrange
+	deletedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	federations := func() []*api.Federation {
+		return []*api.Federation{{Id: 1}, {Id: 2, DeletedAt: &deletedAt}, {Id: 3}}
+	}
+
+	// act
+	live, _ := pageFederations(federations(), FederationQuery{})
+	all, _ := pageFederations(federations(), FederationQuery{IncludeDeleted: true})
+
+	// assert
+	if ids := federationIds(live.Federations); !reflect.DeepEqual(ids, []int{1, 3}) || live.Total != 2 {
+		t.Fatalf("pageFederations() = %v, %d want [1 3], 2", ids, live.Total)
+	}
+
+	if ids := federationIds(all.Federations); !reflect.DeepEqual(ids, []int{1, 2, 3}) || all.Total != 3 {
+		t.Fatalf("pageFederations(includeDeleted) = %v, %d want [1 2 3], 3", ids, all.Total)
+	}
+}
+
+// test PurgeFederations(deletedBefore)
+// should remove only federations deleted before the cutoff
+func TestPurgeFederations(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut := newMockDb(&api.Federation{Id: 1}, &api.Federation{Id: 2}, &api.Federation{Id: 3})
+	sut.DeleteFederation(context.Background(), 1, 0)
+	timeNow = func() time.Time { return at.Add(time.Hour) }
+	sut.DeleteFederation(context.Background(), 2, 0)
+
+	// act
+	n, err := sut.PurgeFederations(context.Background(), at.Add(time.Minute))
+
+	// assert
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeFederations(cutoff) = %d, %v want 1, <nil>", n, err)
+	}
+
+	if _, ok := sut.federations[1]; ok || len(sut.federations) != 2 {
+		t.Fatalf("PurgeFederations(cutoff) = %v want federations 2 and 3", sut.federations)
+	}
+}
+
+// stopClock makes timeNow return a fixed time until the test ends.
+func stopClock(t *testing.T) time.Time {
+	t.Helper()
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := timeNow
+	timeNow = func() time.Time { return at }
+	t.Cleanup(func() { timeNow = now })
+	return at
+}
+
+// test concurrent access
+// should keep every write and pass the race detector
+func TestMockDbConcurrentAccess(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	workers := 50
+	var wg sync.WaitGroup
+
+	// act
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := 100 + i
+			sut.Setup(context.Background())
+			sut.AddFederation(context.Background(), &api.Federation{Id: id, Owner: "owner"})
+			sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: fmt.Sprintf("owner %d", i)})
+			if fed, _ := sut.GetFederation(context.Background(), 1); fed != nil {
+				fed.Owner = "mutated by caller"
+			}
+			sut.UpdateFederation(context.Background(), &api.Federation{Id: id, Owner: "updated"})
+			if i%2 == 0 {
+				sut.DeleteFederation(context.Background(), id, 0)
+			}
+			if i%10 == 0 {
+				sut.GetFederations(context.Background(), FederationQuery{})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// assert
+	live := 0
+	for _, fed := range sut.federations {
+		if fed.DeletedAt == nil {
+			live++
+		}
+	}
+	if want := 1 + workers/2; live != want {
+		t.Fatalf("live federations = %d want %d", live, want)
+	}
+
+	if fed, _ := sut.GetFederation(context.Background(), 1); fed.Owner == "mutated by caller" {
+		t.Fatalf("GetFederation(1) = %q want repository owned value", fed.Owner)
+	}
+}
+
+// test GetFederations(ctx) with cancelled context
+// should return the context error
+func TestGetFederationsCancelled(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// act
+	page, err := sut.GetFederations(ctx, FederationQuery{})
+
+	// assert
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetFederations(ctx) = %v want %v", err, context.Canceled)
+	}
+
+	if page != nil {
+		t.Fatalf("GetFederations(ctx) = %v want <nil>", page)
+	}
+}
+
+// test mutations with cancelled context
+// should not change state
+func TestMockDbCancelledMutations(t *testing.T) {
+	// arrange
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// act
+	_, addErr := sut.AddFederation(ctx, &api.Federation{Id: 2})
+	_, updateErr := sut.UpdateFederation(ctx, &api.Federation{Id: 1, Owner: "new owner"})
+	deleteErr := sut.DeleteFederation(ctx, 1, 0)
+
+	// assert
+	for _, err := range []error{addErr, updateErr, deleteErr} {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("mutation(ctx) = %v want %v", err, context.Canceled)
+		}
+	}
+
+	if !reflect.DeepEqual(sut.federations, map[int]*api.Federation{1: {Id: 1, Owner: "Owner 1", Version: 1}}) {
+		t.Fatalf("federations = %v want unchanged", sut.federations)
+	}
+}
+
+// test DeleteFederation(id, version) of a parent under every delete policy
+// should refuse it, delete the descendants along or move the children to the top
+func TestMockDbDeletePolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		wantErr  error
+		wantLive []int
+		wantTop  []int
+	}{
+		{DeleteRestrict, ErrConflict, []int{1, 2, 3, 4}, []int{1, 4}},
+		{DeleteCascade, nil, []int{4}, []int{4}},
+		{DeleteOrphan, nil, []int{2, 3, 4}, []int{2, 4}},
+	}
+
+	for _, tt := range tests {
+		// arrange
+		parent := func(id int) *int { return &id }
+		sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: parent(1)},
+			&api.Federation{Id: 3, Owner: "Owner 3", ParentId: parent(2)}, &api.Federation{Id: 4, Owner: "Owner 4"})
+		sut.setDeletePolicy(tt.policy)
+
+		// act
+		err := sut.DeleteFederation(context.Background(), 1, 0)
+		live, _ := sut.GetFederations(context.Background(), FederationQuery{})
+		var top []int
+		for _, fed := range live.Federations {
+			if fed.ParentId == nil {
+				top = append(top, fed.Id)
+			}
+		}
+
+		// assert
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("DeleteFederation(1) under %s = %v want %v", tt.policy, err, tt.wantErr)
+		}
+
+		if got := federationIds(live.Federations); !reflect.DeepEqual(got, tt.wantLive) || !reflect.DeepEqual(top, tt.wantTop) {
+			t.Fatalf("GetFederations() under %s = %v, top %v want %v, top %v", tt.policy, got, top, tt.wantLive, tt.wantTop)
+		}
+	}
+}
+
+// test DeleteFederation(id, version) under DeleteOrphan
+// should record the orphaned child in its history
+func TestMockDbDeleteOrphanHistory(t *testing.T) {
+	// arrange
+	parent := 1
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: &parent})
+	sut.setDeletePolicy(DeleteOrphan)
+
+	// act
+	sut.DeleteFederation(context.Background(), 1, 0)
+	history, err := sut.GetHistory(context.Background(), 2, HistoryQuery{})
+
+	// assert
+	if err != nil || len(history.Changes) == 0 || history.Changes[0].Op != ChangeOrphan || history.Changes[0].After.ParentId != nil {
+		t.Fatalf("GetHistory(2) = %+v, %v want the orphan change first", history, err)
+	}
+}
+
+// test ApplyBatch(ops, false) deleting a parent and its child under DeleteRestrict
+// should refuse the parent alone and delete it once the child is gone
+func TestMockDbDeleteRestrictBatch(t *testing.T) {
+	// arrange
+	parent := 1
+	sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: &parent})
+	ops := []BatchOperation{{Op: BatchDelete, Id: 1}, {Op: BatchDelete, Id: 2}, {Op: BatchDelete, Id: 1}}
+
+	// act
+	results, err := sut.ApplyBatch(context.Background(), ops, false)
+	live, _ := sut.GetFederations(context.Background(), FederationQuery{})
+
+	// assert
+	if err != nil || !errors.Is(results[0].Err, ErrConflict) || results[1].Err != nil || results[2].Err != nil {
+		t.Fatalf("ApplyBatch(ops, false) = %+v, %v want a conflict and two deletes", results, err)
+	}
+
+	if live.Total != 0 {
+		t.Fatalf("GetFederations() = %v want none", federationIds(live.Federations))
+	}
+}
+
+// test txn.savepoint() rolled back after a cascading delete
+// should drop the staged deletes, their history and their ids while keeping
+// what was staged before
+func TestTxnSavepoint(t *testing.T) {
+	// arrange
+	parent := 1
+	db := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: &parent})
+	db.setDeletePolicy(DeleteCascade)
+	sut := db.begin(context.Background())
+	sut.add(&api.Federation{Id: 3, Owner: "Owner 3"})
+
+	// act
+	rollback := sut.savepoint()
+	_, err := sut.delete(1, 0)
+	rollback()
+	commitErr := sut.commit()
+	live, _ := db.GetFederations(context.Background(), FederationQuery{})
+
+	// assert
+	if err != nil || commitErr != nil {
+		t.Fatalf("delete(1, 0), commit() = %v, %v want <nil>, <nil>", err, commitErr)
+	}
+
+	if len(sut.deleted) != 0 || len(sut.mutations) != 1 || sut.lastChangeId != 1 {
+		t.Fatalf("txn = deleted %v, %d mutations, change %d want none, 1, 1", sut.deleted, len(sut.mutations), sut.lastChangeId)
+	}
+
+	if got := federationIds(live.Federations); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("GetFederations() = %v want [1 2 3]", got)
+	}
 }
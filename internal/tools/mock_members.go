@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"gorest/api"
+)
+
+// mockMembers is an in-memory MembersRepository. it asks federations
+// whether a federation is live before touching its members, and drops
+// them when federations deletes it.
+type mockMembers struct {
+	mu          sync.RWMutex
+	federations FederationRepository
+	// members holds the members of every federation by member id.
+	members map[int]map[int]*api.Member
+	// lastId is the largest id ever given to a member. ids are not reused.
+	lastId int
+}
+
+// NewMockMembers returns an empty in-memory MembersRepository for the
+// federations stored in federations.
+func NewMockMembers(federations FederationRepository) MembersRepository {
+	return newMockMembers(federations)
+}
+
+func newMockMembers(federations FederationRepository) *mockMembers {
+	m := &mockMembers{
+		federations: federations,
+		members:     map[int]map[int]*api.Member{},
+	}
+	dependOn(federations, m)
+	return m
+}
+
+// checkFederation returns the error of federationId when it is not live.
+func (m *mockMembers) checkFederation(ctx context.Context, federationId int) error {
+	_, err := m.federations.GetFederation(ctx, federationId)
+	return err
+}
+
+func (m *mockMembers) AddMember(ctx context.Context, federationId int, member *api.Member) (*api.Member, error) {
+	// the federation is checked under the lock, so a delete committing
+	// after the check waits for the member to remove it.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkFederation(ctx, federationId); err != nil {
+		return nil, err
+	}
+
+	added := copyMember(member)
+	added.FederationId = federationId
+	if added.Role == "" {
+		added.Role = RoleMember
+	}
+	if err := validateMember(federationId, added); err != nil {
+		return nil, err
+	}
+
+	for _, stored := range m.members[federationId] {
+		if sameOrganisation(stored.Organisation, added.Organisation) {
+			return nil, memberExists(federationId, added.Organisation)
+		}
+	}
+
+	m.lastId++
+	added.Id = m.lastId
+	added.JoinedAt = timeNow()
+	if m.members[federationId] == nil {
+		m.members[federationId] = map[int]*api.Member{}
+	}
+	m.members[federationId][added.Id] = added
+	return copyMember(added), nil
+}
+
+func (m *mockMembers) GetMember(ctx context.Context, federationId int, id int) (*api.Member, error) {
+	if err := m.checkFederation(ctx, federationId); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	member, ok := m.members[federationId][id]
+	if !ok {
+		return nil, memberNotFound(federationId, id)
+	}
+	return copyMember(member), nil
+}
+
+func (m *mockMembers) GetMembers(ctx context.Context, federationId int) ([]*api.Member, error) {
+	if err := m.checkFederation(ctx, federationId); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	members := make([]*api.Member, 0, len(m.members[federationId]))
+	for _, member := range m.members[federationId] {
+		members = append(members, copyMember(member))
+	}
+	slices.SortFunc(members, func(a, b *api.Member) int {
+		return a.Id - b.Id
+	})
+	return members, nil
+}
+
+func (m *mockMembers) UpdateMemberRole(ctx context.Context, federationId int, id int, role string) (*api.Member, error) {
+	if err := m.checkFederation(ctx, federationId); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	member, ok := m.members[federationId][id]
+	if !ok {
+		return nil, memberNotFound(federationId, id)
+	}
+	updated := copyMember(member)
+	updated.Role = role
+	if err := validateMember(federationId, updated); err != nil {
+		return nil, err
+	}
+	m.members[federationId][id] = updated
+	return copyMember(updated), nil
+}
+
+func (m *mockMembers) RemoveMember(ctx context.Context, federationId int, id int) error {
+	if err := m.checkFederation(ctx, federationId); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.members[federationId][id]; !ok {
+		return memberNotFound(federationId, id)
+	}
+	delete(m.members[federationId], id)
+	return nil
+}
+
+// removeFederations implements dependent.
+func (m *mockMembers) removeFederations(ids []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.members, id)
+	}
+}
+
+// copyMember returns a copy of member sharing no memory with it.
+func copyMember(member *api.Member) *api.Member {
+	m := *member
+	return &m
+}
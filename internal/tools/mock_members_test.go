@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorest/api"
+)
+
+// test mockMembers adding, reading, updating and removing a member
+// should store a copy with an id, the default role and the join time
+func TestMockMembersLifecycle(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	ctx := context.Background()
+	sut := newMockMembers(newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))
+	member := &api.Member{Id: 9, Organisation: "Acme"}
+	want := &api.Member{Id: 1, FederationId: 1, Organisation: "Acme", Role: RoleMember, JoinedAt: at}
+
+	// act
+	added, addErr := sut.AddMember(ctx, 1, member)
+	sut.AddMember(ctx, 1, &api.Member{Organisation: "Globex", Role: RoleObserver})
+	got, getErr := sut.GetMember(ctx, 1, 1)
+	updated, updateErr := sut.UpdateMemberRole(ctx, 1, 1, RoleAdmin)
+	removeErr := sut.RemoveMember(ctx, 1, 2)
+	members, listErr := sut.GetMembers(ctx, 1)
+
+	// assert
+	if addErr != nil || !reflect.DeepEqual(added, want) {
+		t.Fatalf("AddMember(1, member) = %+v, %v want %+v", added, addErr, want)
+	}
+
+	if member.Id != 9 || member.Role != "" {
+		t.Fatalf("AddMember(1, member) changed the caller's member to %+v", member)
+	}
+
+	if getErr != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetMember(1, 1) = %+v, %v want %+v", got, getErr, want)
+	}
+
+	if updateErr != nil || updated.Role != RoleAdmin {
+		t.Fatalf("UpdateMemberRole(1, 1, admin) = %+v, %v want role admin", updated, updateErr)
+	}
+
+	if removeErr != nil {
+		t.Fatalf("RemoveMember(1, 2) = %v want <nil>", removeErr)
+	}
+
+	if listErr != nil || len(members) != 1 || members[0].Id != 1 || members[0].Role != RoleAdmin {
+		t.Fatalf("GetMembers(1) = %+v, %v want the admin member 1", members, listErr)
+	}
+}
+
+// test mockMembers with a missing or deleted federation
+// should report ErrNotFound from every method
+func TestMockMembersMissingFederation(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut := newMockMembers(federations)
+	sut.AddMember(ctx, 2, &api.Member{Organisation: "Acme"})
+	federations.DeleteFederation(ctx, 2, 0)
+
+	for _, id := range []int{2, 3} {
+		// act
+		_, addErr := sut.AddMember(ctx, id, &api.Member{Organisation: "Globex"})
+		_, getErr := sut.GetMember(ctx, id, 1)
+		_, listErr := sut.GetMembers(ctx, id)
+		_, updateErr := sut.UpdateMemberRole(ctx, id, 1, RoleAdmin)
+		removeErr := sut.RemoveMember(ctx, id, 1)
+
+		// assert
+		for _, err := range []error{addErr, getErr, listErr, updateErr, removeErr} {
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("members of federation %d = %v want %v", id, err, ErrNotFound)
+			}
+		}
+	}
+}
+
+// test mockMembers with invalid members and roles
+// should reject them without storing anything
+func TestMockMembersInvalid(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	sut := newMockMembers(newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))
+	sut.AddMember(ctx, 1, &api.Member{Organisation: "Acme"})
+	tests := []struct {
+		member *api.Member
+		want   error
+	}{
+		{&api.Member{Organisation: " acme "}, ErrAlreadyExists},
+		{&api.Member{Organisation: " "}, ErrValidation},
+		{&api.Member{Organisation: "Globex", Role: "owner"}, ErrValidation},
+	}
+
+	for _, tt := range tests {
+		// act
+		_, err := sut.AddMember(ctx, 1, tt.member)
+
+		// assert
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("AddMember(1, %+v) = %v want %v", tt.member, err, tt.want)
+		}
+	}
+
+	_, updateErr := sut.UpdateMemberRole(ctx, 1, 1, "owner")
+	_, missingErr := sut.UpdateMemberRole(ctx, 1, 7, RoleAdmin)
+	members, _ := sut.GetMembers(ctx, 1)
+
+	if !errors.Is(updateErr, ErrValidation) {
+		t.Fatalf("UpdateMemberRole(1, 1, owner) = %v want %v", updateErr, ErrValidation)
+	}
+
+	if !errors.Is(missingErr, ErrNotFound) {
+		t.Fatalf("UpdateMemberRole(1, 7, admin) = %v want %v", missingErr, ErrNotFound)
+	}
+
+	if len(members) != 1 || members[0].Role != RoleMember {
+		t.Fatalf("GetMembers(1) = %+v want the unchanged member", members)
+	}
+}
+
+// test mockMembers after the parent of its federation is deleted under DeleteCascade
+// should remove the members of both, so the restored federations have none
+func TestMockMembersDeleteCascade(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	parent := 1
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: &parent})
+	federations.setDeletePolicy(DeleteCascade)
+	sut := newMockMembers(federations)
+	sut.AddMember(ctx, 1, &api.Member{Organisation: "Acme"})
+	sut.AddMember(ctx, 2, &api.Member{Organisation: "Globex"})
+
+	// act
+	err := federations.DeleteFederation(ctx, 1, 0)
+	federations.RestoreFederation(ctx, 1, 0)
+	federations.RestoreFederation(ctx, 2, 0)
+	parentMembers, _ := sut.GetMembers(ctx, 1)
+	childMembers, _ := sut.GetMembers(ctx, 2)
+
+	// assert
+	if err != nil {
+		t.Fatalf("DeleteFederation(1) = %v want <nil>", err)
+	}
+
+	if len(parentMembers) != 0 || len(childMembers) != 0 {
+		t.Fatalf("GetMembers(1), GetMembers(2) = %+v, %+v want none", parentMembers, childMembers)
+	}
+}
+
+// deletingRepository deletes a federation in the background the first
+// time it is read, and returns once the delete is committed, like a
+// concurrent client deleting it right after the read.
+type deletingRepository struct {
+	FederationRepository
+	once sync.Once
+	// deleted is closed once the background delete returned.
+	deleted chan struct{}
+}
+
+func newDeletingRepository(repo FederationRepository) *deletingRepository {
+	return &deletingRepository{FederationRepository: repo, deleted: make(chan struct{})}
+}
+
+// Unwrap implements wrapper.
+func (r *deletingRepository) Unwrap() FederationRepository {
+	return r.FederationRepository
+}
+
+func (r *deletingRepository) GetFederation(ctx context.Context, id int) (*api.Federation, error) {
+	fed, err := r.FederationRepository.GetFederation(ctx, id)
+	r.once.Do(func() {
+		go func() {
+			defer close(r.deleted)
+			r.FederationRepository.DeleteFederation(context.Background(), id, 0)
+		}()
+		for {
+			if _, err := r.FederationRepository.GetFederation(ctx, id); err != nil {
+				return
+			}
+		}
+	})
+	return fed, err
+}
+
+// test AddMember(federationId, member) with the federation deleted right after it is read
+// should leave no member behind once the delete returned
+func TestMockMembersConcurrentDelete(t *testing.T) {
+	// arrange
+	federations := newDeletingRepository(newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))
+	sut := newMockMembers(federations)
+
+	// act
+	sut.AddMember(context.Background(), 1, &api.Member{Organisation: "Acme"})
+	<-federations.deleted
+
+	// assert
+	if members := sut.members[1]; len(members) != 0 {
+		t.Fatalf("AddMember(1) = %d members left want none", len(members))
+	}
+}
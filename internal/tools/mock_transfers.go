@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"gorest/api"
+)
+
+// mockTransfers is an in-memory TransfersRepository. it changes owners
+// through federations, so accepted transfers show in their history, and
+// drops the transfers of the federations it deletes.
+type mockTransfers struct {
+	mu          sync.Mutex
+	federations FederationRepository
+	// ttl is how long a new transfer stays pending.
+	ttl time.Duration
+	// transfers holds the transfers of every federation by transfer id.
+	transfers map[int]map[int]*api.Transfer
+	// lastId is the largest id ever given to a transfer. ids are not reused.
+	lastId int
+}
+
+// NewMockTransfers returns an empty in-memory TransfersRepository for the
+// federations stored in federations, whose transfers stay pending for ttl.
+func NewMockTransfers(federations FederationRepository, ttl time.Duration) TransfersRepository {
+	return newMockTransfers(federations, ttl)
+}
+
+func newMockTransfers(federations FederationRepository, ttl time.Duration) *mockTransfers {
+	m := &mockTransfers{
+		federations: federations,
+		ttl:         ttl,
+		transfers:   map[int]map[int]*api.Transfer{},
+	}
+	dependOn(federations, m)
+	return m
+}
+
+func (m *mockTransfers) CreateTransfer(ctx context.Context, federationId int, to string) (*api.Transfer, error) {
+	// the federation is read under the lock, so a delete committing after
+	// the read waits for the transfer to remove it.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fed, err := m.federations.GetFederation(ctx, federationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if organisation := OrganisationFrom(ctx); !sameOrganisation(fed.Owner, organisation) {
+		return nil, transferOwner(fed, organisation)
+	}
+
+	created := &api.Transfer{FederationId: federationId, From: fed.Owner, To: to, Status: TransferPending}
+	if err := validateTransfer(fed, created); err != nil {
+		return nil, err
+	}
+
+	for _, stored := range m.transfers[federationId] {
+		if expireTransfer(stored); stored.Status == TransferPending {
+			return nil, transferPending(stored)
+		}
+	}
+
+	m.lastId++
+	created.Id = m.lastId
+	created.CreatedAt = timeNow()
+	created.ExpiresAt = created.CreatedAt.Add(m.ttl)
+	if m.transfers[federationId] == nil {
+		m.transfers[federationId] = map[int]*api.Transfer{}
+	}
+	m.transfers[federationId][created.Id] = created
+	return copyTransfer(created), nil
+}
+
+func (m *mockTransfers) GetTransfer(ctx context.Context, federationId int, id int) (*api.Transfer, error) {
+	if _, err := m.federations.GetFederation(ctx, federationId); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfer, ok := m.transfers[federationId][id]
+	if !ok {
+		return nil, transferNotFound(federationId, id)
+	}
+	expireTransfer(transfer)
+	return copyTransfer(transfer), nil
+}
+
+func (m *mockTransfers) GetTransfers(ctx context.Context, federationId int) ([]*api.Transfer, error) {
+	if _, err := m.federations.GetFederation(ctx, federationId); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfers := make([]*api.Transfer, 0, len(m.transfers[federationId]))
+	for _, transfer := range m.transfers[federationId] {
+		expireTransfer(transfer)
+		transfers = append(transfers, copyTransfer(transfer))
+	}
+	slices.SortFunc(transfers, func(a, b *api.Transfer) int {
+		return a.Id - b.Id
+	})
+	return transfers, nil
+}
+
+func (m *mockTransfers) AcceptTransfer(ctx context.Context, federationId int, id int) (*api.Transfer, error) {
+	return m.settle(ctx, federationId, id, TransferAccepted)
+}
+
+func (m *mockTransfers) RejectTransfer(ctx context.Context, federationId int, id int) (*api.Transfer, error) {
+	return m.settle(ctx, federationId, id, TransferRejected)
+}
+
+// settle moves a pending transfer to status on behalf of its recipient,
+// the organisation of ctx, handing the federation over when status is
+// TransferAccepted. the lock is held throughout, so a transfer settles
+// once.
+func (m *mockTransfers) settle(ctx context.Context, federationId int, id int, status string) (*api.Transfer, error) {
+	fed, err := m.federations.GetFederation(ctx, federationId)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfer, ok := m.transfers[federationId][id]
+	if !ok {
+		return nil, transferNotFound(federationId, id)
+	}
+	if expireTransfer(transfer); transfer.Status != TransferPending {
+		return nil, transferSettled(transfer)
+	}
+	if organisation := OrganisationFrom(ctx); !sameOrganisation(transfer.To, organisation) {
+		return nil, transferRecipient(transfer, organisation)
+	}
+
+	if status == TransferAccepted {
+		if fed.Owner != transfer.From {
+			return nil, &FederationError{Id: federationId, Err: fmt.Errorf("owner changed from %q since transfer %d: %w", transfer.From, id, ErrConflict)}
+		}
+		fed.Owner = transfer.To
+		if _, err := m.federations.UpdateFederation(ctx, fed); err != nil {
+			return nil, err
+		}
+	}
+
+	resolvedAt := timeNow()
+	transfer.Status, transfer.ResolvedAt = status, &resolvedAt
+	return copyTransfer(transfer), nil
+}
+
+// removeFederations implements dependent.
+func (m *mockTransfers) removeFederations(ids []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.transfers, id)
+	}
+}
+
+// copyTransfer returns a copy of transfer sharing no memory with it.
+func copyTransfer(transfer *api.Transfer) *api.Transfer {
+	t := *transfer
+	if transfer.ResolvedAt != nil {
+		resolvedAt := *transfer.ResolvedAt
+		t.ResolvedAt = &resolvedAt
+	}
+	return &t
+}
@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// test mockTransfers creating and accepting a transfer
+// should hand the federation over to the recipient and record it in the history
+func TestMockTransfersAccept(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	ctx := context.Background()
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := newMockTransfers(federations, time.Hour)
+	want := &api.Transfer{Id: 1, FederationId: 1, From: "Owner 1", To: "Owner 2", Status: TransferAccepted, CreatedAt: at, ExpiresAt: at.Add(time.Hour), ResolvedAt: &at}
+
+	// act
+	created, createErr := sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 2")
+	accepted, acceptErr := sut.AcceptTransfer(WithOrganisation(ctx, " owner 2 "), 1, 1)
+	got, getErr := sut.GetTransfer(ctx, 1, 1)
+	fed, _ := federations.GetFederation(ctx, 1)
+	history, _ := federations.GetHistory(ctx, 1, HistoryQuery{})
+
+	// assert
+	if createErr != nil || created.Status != TransferPending || created.From != "Owner 1" {
+		t.Fatalf("CreateTransfer(1, Owner 2) = %+v, %v want a pending transfer from Owner 1", created, createErr)
+	}
+
+	if acceptErr != nil || !reflect.DeepEqual(accepted, want) {
+		t.Fatalf("AcceptTransfer(1, 1) as owner 2 = %+v, %v want %+v", accepted, acceptErr, want)
+	}
+
+	if getErr != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetTransfer(1, 1) = %+v, %v want %+v", got, getErr, want)
+	}
+
+	if fed.Owner != "Owner 2" {
+		t.Fatalf("GetFederation(1) = %+v want owner Owner 2", fed)
+	}
+
+	if len(history.Changes) == 0 || history.Changes[0].After.Owner != "Owner 2" {
+		t.Fatalf("GetHistory(1) = %+v want the handover first", history.Changes)
+	}
+}
+
+// test mockTransfers rejecting a transfer and letting another one expire
+// should settle both leaving the owner untouched
+func TestMockTransfersRejectAndExpire(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	ctx := context.Background()
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := newMockTransfers(federations, time.Hour)
+	sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 2")
+
+	// act
+	rejected, rejectErr := sut.RejectTransfer(WithOrganisation(ctx, "Owner 2"), 1, 1)
+	sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 3")
+	timeNow = func() time.Time { return at.Add(time.Hour) }
+	_, acceptErr := sut.AcceptTransfer(WithOrganisation(ctx, "Owner 3"), 1, 2)
+	transfers, listErr := sut.GetTransfers(ctx, 1)
+	_, createErr := sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 3")
+	fed, _ := federations.GetFederation(ctx, 1)
+
+	// assert
+	if rejectErr != nil || rejected.Status != TransferRejected || rejected.ResolvedAt == nil {
+		t.Fatalf("RejectTransfer(1, 1) as Owner 2 = %+v, %v want it rejected", rejected, rejectErr)
+	}
+
+	if !errors.Is(acceptErr, ErrConflict) {
+		t.Fatalf("AcceptTransfer(1, 2) as Owner 3 = %v want %v", acceptErr, ErrConflict)
+	}
+
+	if listErr != nil || len(transfers) != 2 || transfers[0].Status != TransferRejected || transfers[1].Status != TransferExpired {
+		t.Fatalf("GetTransfers(1) = %+v, %v want rejected and expired", transfers, listErr)
+	}
+
+	if createErr != nil {
+		t.Fatalf("CreateTransfer(1, Owner 3) = %v want <nil> after the expiry", createErr)
+	}
+
+	if fed.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(1) = %+v want owner Owner 1", fed)
+	}
+}
+
+// test mockTransfers with invalid transfers, strangers and settled transfers
+// should refuse them without changing the owner
+func TestMockTransfersInvalid(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"}, &api.Federation{Id: 3, Owner: "Owner 3"})
+	sut := newMockTransfers(federations, time.Hour)
+	sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 2")
+	sut.CreateTransfer(WithOrganisation(ctx, "Owner 2"), 2, "Owner 1")
+	sut.AcceptTransfer(WithOrganisation(ctx, "Owner 1"), 2, 2)
+	federations.DeleteFederation(ctx, 3, 0)
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"CreateTransfer(1, Owner 3) while pending", func() error { _, err := sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 3"); return err }, ErrConflict},
+		{"CreateTransfer(1, Owner 3) as Owner 2", func() error { _, err := sut.CreateTransfer(WithOrganisation(ctx, "Owner 2"), 1, "Owner 3"); return err }, ErrForbidden},
+		{"CreateTransfer(1, Owner 3) without an organisation", func() error { _, err := sut.CreateTransfer(ctx, 1, "Owner 3"); return err }, ErrForbidden},
+		{"CreateTransfer(1, owner 1)", func() error { _, err := sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "owner 1"); return err }, ErrValidation},
+		{"CreateTransfer(1, empty)", func() error { _, err := sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, ""); return err }, ErrValidation},
+		{"AcceptTransfer(1, 1) as Owner 3", func() error { _, err := sut.AcceptTransfer(WithOrganisation(ctx, "Owner 3"), 1, 1); return err }, ErrForbidden},
+		{"AcceptTransfer(1, 1) without an organisation", func() error { _, err := sut.AcceptTransfer(ctx, 1, 1); return err }, ErrForbidden},
+		{"RejectTransfer(1, 1) as Owner 3", func() error { _, err := sut.RejectTransfer(WithOrganisation(ctx, "Owner 3"), 1, 1); return err }, ErrForbidden},
+		{"AcceptTransfer(1, 7) as Owner 2", func() error { _, err := sut.AcceptTransfer(WithOrganisation(ctx, "Owner 2"), 1, 7); return err }, ErrNotFound},
+		{"GetTransfer(1, 2)", func() error { _, err := sut.GetTransfer(ctx, 1, 2); return err }, ErrNotFound},
+		{"GetTransfers(3) of a deleted federation", func() error { _, err := sut.GetTransfers(ctx, 3); return err }, ErrNotFound},
+		{"CreateTransfer(4, Owner 1)", func() error { _, err := sut.CreateTransfer(ctx, 4, "Owner 1"); return err }, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		// act
+		err := tt.call()
+
+		// assert
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s = %v want %v", tt.name, err, tt.want)
+		}
+	}
+
+	_, settledErr := sut.RejectTransfer(WithOrganisation(ctx, "Owner 1"), 2, 2)
+	fed, _ := federations.GetFederation(ctx, 1)
+
+	if !errors.Is(settledErr, ErrConflict) {
+		t.Fatalf("RejectTransfer(2, 2) as Owner 1 = %v want %v", settledErr, ErrConflict)
+	}
+
+	if fed.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(1) = %+v want owner Owner 1", fed)
+	}
+}
+
+// test mockTransfers.AcceptTransfer after the owner changed behind the transfer
+// should refuse to hand the federation over
+func TestMockTransfersOwnerChanged(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := newMockTransfers(federations, time.Hour)
+	sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 2")
+	federations.UpdateFederation(ctx, &api.Federation{Id: 1, Owner: "Owner 3"})
+
+	// act
+	_, err := sut.AcceptTransfer(WithOrganisation(ctx, "Owner 2"), 1, 1)
+	got, _ := sut.GetTransfer(ctx, 1, 1)
+
+	// assert
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("AcceptTransfer(1, 1) as Owner 2 = %v want %v", err, ErrConflict)
+	}
+
+	if got.Status != TransferPending {
+		t.Fatalf("GetTransfer(1, 1) = %+v want it still pending", got)
+	}
+}
+
+// test mockTransfers after its federation is deleted
+// should remove every transfer, so the restored federation has none
+func TestMockTransfersDeleteFederation(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	federations := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})
+	sut := newMockTransfers(federations, time.Hour)
+	sut.CreateTransfer(WithOrganisation(ctx, "Owner 1"), 1, "Owner 2")
+
+	// act
+	federations.DeleteFederation(ctx, 1, 0)
+	federations.RestoreFederation(ctx, 1, 0)
+	transfers, err := sut.GetTransfers(ctx, 1)
+
+	// assert
+	if err != nil || len(transfers) != 0 {
+		t.Fatalf("GetTransfers(1) = %+v, %v want none", transfers, err)
+	}
+}
+
+// test CreateTransfer(federationId, to) with the federation deleted right after it is read
+// should leave no transfer behind once the delete returned
+func TestMockTransfersConcurrentDelete(t *testing.T) {
+	// arrange
+	federations := newDeletingRepository(newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}))
+	sut := newMockTransfers(federations, time.Hour)
+
+	// act
+	sut.CreateTransfer(WithOrganisation(context.Background(), "Owner 1"), 1, "Owner 2")
+	<-federations.deleted
+
+	// assert
+	if transfers := sut.transfers[1]; len(transfers) != 0 {
+		t.Fatalf("CreateTransfer(1) = %d transfers left want none", len(transfers))
+	}
+}
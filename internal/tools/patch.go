@@ -0,0 +1,374 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorest/api"
+)
+
+// FederationPatch is a partial change applied by PatchFederation.
+// repositories apply it to the stored federation while holding it, so the
+// read, the patch and the write happen atomically.
+type FederationPatch interface {
+	// apply returns doc, the JSON form of a federation, with the patch applied.
+	apply(doc any) (any, error)
+}
+
+// mergePatch is a JSON Merge Patch, RFC 7396.
+type mergePatch struct {
+	patch any
+}
+
+// ParseMergePatch reads an application/merge-patch+json document.
+func ParseMergePatch(data []byte) (FederationPatch, error) {
+	var patch any
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, invalidPatch("is not valid JSON")
+	}
+	if _, ok := patch.(map[string]any); !ok {
+		return nil, invalidPatch("must be a JSON object")
+	}
+	return &mergePatch{patch: patch}, nil
+}
+
+func (p *mergePatch) apply(doc any) (any, error) {
+	return mergeValue(doc, p.patch), nil
+}
+
+// mergeValue merges patch into target as described by RFC 7396.
+func mergeValue(target, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	merged, ok := target.(map[string]any)
+	if !ok {
+		merged = map[string]any{}
+	}
+	for name, value := range fields {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = mergeValue(merged[name], value)
+	}
+	return merged
+}
+
+// jsonPatch is a JSON Patch, RFC 6902.
+type jsonPatch []patchOperation
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ParseJSONPatch reads an application/json-patch+json document.
+func ParseJSONPatch(data []byte) (FederationPatch, error) {
+	var ops jsonPatch
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, invalidPatch("must be a JSON array of operations")
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, invalidPatch(fmt.Sprintf("operation %d needs a value", i))
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, invalidPatch(fmt.Sprintf("operation %d needs from", i))
+			}
+		case "remove":
+		default:
+			return nil, invalidPatch(fmt.Sprintf("operation %d has unknown op %q", i, op.Op))
+		}
+		if op.Path == nil {
+			return nil, invalidPatch(fmt.Sprintf("operation %d needs a path", i))
+		}
+	}
+	return ops, nil
+}
+
+func (p jsonPatch) apply(doc any) (any, error) {
+	for i, op := range p {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+func (op patchOperation) apply(doc any) (any, error) {
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, invalidPatch("value is not valid JSON")
+		}
+		switch op.Op {
+		case "add":
+			return addValue(doc, path, value)
+		case "replace":
+			if _, err := getValue(doc, path); err != nil {
+				return nil, err
+			}
+			return setValue(doc, path, value)
+		}
+		current, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w: test failed at %s", ErrConflict, *op.Path)
+		}
+		return doc, nil
+	case "remove":
+		return removeValue(doc, path)
+	}
+
+	from, err := parsePointer(*op.From)
+	if err != nil {
+		return nil, err
+	}
+	value, err := getValue(doc, from)
+	if err != nil {
+		return nil, err
+	}
+	if op.Op == "move" {
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, invalidPatch("cannot move a value into itself")
+		}
+		if doc, err = removeValue(doc, from); err != nil {
+			return nil, err
+		}
+	} else {
+		value = copyValue(value)
+	}
+	return addValue(doc, path, value)
+}
+
+// parsePointer splits a JSON Pointer, RFC 6901, into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, invalidPatch(fmt.Sprintf("path %q must start with /", pointer))
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// errPathNotFound is returned for pointers to missing values.
+var errPathNotFound = errors.New("path not found")
+
+func getValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, pathError(path)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, pathError(path)
+			}
+			doc = node[i]
+		default:
+			return nil, pathError(path)
+		}
+	}
+	return doc, nil
+}
+
+// addValue sets the value at path, inserting it into arrays.
+func addValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return doc, nil
+	case []any:
+		i := len(node)
+		if last != "-" {
+			if i, err = arrayIndex(last, len(node)); err != nil {
+				return nil, pathError(path)
+			}
+		}
+		node = append(node[:i], append([]any{value}, node[i:]...)...)
+		return setValue(doc, path[:len(path)-1], node)
+	}
+	return nil, pathError(path)
+}
+
+// setValue replaces the existing value at path.
+func setValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+	case []any:
+		i, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, pathError(path)
+		}
+		node[i] = value
+	}
+	return doc, nil
+}
+
+func removeValue(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		if _, ok := node[last]; !ok {
+			return nil, pathError(path)
+		}
+		delete(node, last)
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, pathError(path)
+		}
+		node = append(node[:i:i], node[i+1:]...)
+		return setValue(doc, path[:len(path)-1], node)
+	}
+	return nil, pathError(path)
+}
+
+// arrayIndex parses an array index token no larger than max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, errPathNotFound
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, errPathNotFound
+	}
+	return i, nil
+}
+
+func copyValue(value any) any {
+	data, _ := json.Marshal(value)
+	var copied any
+	json.Unmarshal(data, &copied)
+	return copied
+}
+
+func pathError(path []string) error {
+	return invalidPatch(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+}
+
+func invalidPatch(message string) error {
+	return &ValidationError{Field: "patch", Message: message}
+}
+
+// patchFederation applies patch to a copy of federation. the id, version,
+// state and timestamps are managed by the repository and cannot be
+// patched.
+func patchFederation(federation *api.Federation, patch FederationPatch) (*api.Federation, error) {
+	data, err := json.Marshal(federation)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc, err = patch.apply(doc); err != nil {
+		return nil, &FederationError{Id: federation.Id, Err: err}
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+
+	patched := new(api.Federation)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patched); err != nil {
+		return nil, &FederationError{Id: federation.Id, Err: invalidPatch("does not produce a valid federation: " + err.Error())}
+	}
+
+	switch {
+	case patched.Id != federation.Id:
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "id", Message: "is read-only"}}
+	case patched.Version != federation.Version:
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "version", Message: "is read-only"}}
+	case !reflect.DeepEqual(patched.DeletedAt, federation.DeletedAt):
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "deleted_at", Message: "is read-only"}}
+	case patched.State != federation.State:
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "state", Message: "is changed by lifecycle actions only"}}
+	case !reflect.DeepEqual(patched.StateChangedAt, federation.StateChangedAt):
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "state_changed_at", Message: "is read-only"}}
+	case !reflect.DeepEqual(patched.CreatedAt, federation.CreatedAt):
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "created_at", Message: "is read-only"}}
+	case !reflect.DeepEqual(patched.UpdatedAt, federation.UpdatedAt):
+		return nil, &FederationError{Id: federation.Id, Err: &ValidationError{Field: "updated_at", Message: "is read-only"}}
+	}
+	return patched, validateFederation(patched)
+}
+
+// applyPatch returns the change applying patch.
+func applyPatch(patch FederationPatch) func(*api.Federation) error {
+	return func(fed *api.Federation) error {
+		patched, err := patchFederation(fed, patch)
+		if err != nil {
+			return err
+		}
+		*fed = *patched
+		return nil
+	}
+}
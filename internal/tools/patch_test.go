@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorest/api"
+)
+
+// test patchFederation(federation, patch) with merge and json patches
+// should return the patched federation
+func TestPatchFederation(t *testing.T) {
+	// arrange
+	tests := []struct {
+		parse func([]byte) (FederationPatch, error)
+		patch string
+		owner string
+	}{
+		{ParseMergePatch, `{"owner":"new owner"}`, "new owner"},
+		{ParseMergePatch, `{}`, "Owner 1"},
+		{ParseJSONPatch, `[{"op":"replace","path":"/owner","value":"new owner"}]`, "new owner"},
+		{ParseJSONPatch, `[{"op":"test","path":"/owner","value":"Owner 1"},{"op":"replace","path":"/owner","value":"new owner"}]`, "new owner"},
+		{ParseJSONPatch, `[{"op":"test","path":"/version","value":3},{"op":"replace","path":"/owner","value":"new owner"}]`, "new owner"},
+		{ParseJSONPatch, `[{"op":"copy","from":"/owner","path":"/owner"}]`, "Owner 1"},
+		{ParseJSONPatch, `[]`, "Owner 1"},
+	}
+
+	for _, tt := range tests {
+		federation := &api.Federation{Id: 1, Owner: "Owner 1", Version: 3}
+		patch, err := tt.parse([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("parse(%s) = %v want <nil>", tt.patch, err)
+		}
+		want := &api.Federation{Id: 1, Owner: tt.owner, Version: 3}
+
+		// act
+		patched, err := patchFederation(federation, patch)
+
+		// assert
+		if err != nil || !reflect.DeepEqual(patched, want) {
+			t.Fatalf("patchFederation(%s) = %v, %v want %v", tt.patch, patched, err, want)
+		}
+
+		if federation.Owner != "Owner 1" {
+			t.Fatalf("patchFederation(%s) changed the stored federation to %v", tt.patch, federation)
+		}
+	}
+}
+
+// test patchFederation(federation, patch) with patches that cannot apply
+// should return validation or conflict errors
+func TestPatchFederationInvalid(t *testing.T) {
+	// arrange
+	tests := []struct {
+		parse func([]byte) (FederationPatch, error)
+		patch string
+		want  error
+	}{
+		{ParseMergePatch, `{"id":2}`, ErrValidation},
+		{ParseMergePatch, `{"version":null}`, ErrValidation},
+		{ParseMergePatch, `{"color":"red"}`, ErrValidation},
+		{ParseMergePatch, `{"owner":5}`, ErrValidation},
+		{ParseJSONPatch, `[{"op":"test","path":"/owner","value":"someone else"}]`, ErrConflict},
+		{ParseJSONPatch, `[{"op":"remove","path":"/color"}]`, ErrValidation},
+		{ParseJSONPatch, `[{"op":"replace","path":"/color","value":"red"}]`, ErrValidation},
+		{ParseJSONPatch, `[{"op":"add","path":"/version","value":9}]`, ErrValidation},
+		{ParseJSONPatch, `[{"op":"move","from":"/owner","path":"/id"}]`, ErrValidation},
+		{ParseMergePatch, `{"created_at":"2024-01-01T00:00:00Z"}`, ErrValidation},
+		{ParseMergePatch, `{"updated_at":"2024-01-01T00:00:00Z"}`, ErrValidation},
+		{ParseMergePatch, `{"labels":{"env":"a b"}}`, ErrValidation},
+		{ParseMergePatch, `{"owner":null}`, ErrValidation},
+		{ParseMergePatch, `{"state":"active"}`, ErrValidation},
+		{ParseMergePatch, `{"state_changed_at":"2024-01-01T00:00:00Z"}`, ErrValidation},
+		{ParseJSONPatch, `[{"op":"remove","path":"/owner"}]`, ErrValidation},
+	}
+
+	for _, tt := range tests {
+		patch, err := tt.parse([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("parse(%s) = %v want <nil>", tt.patch, err)
+		}
+
+		// act
+		_, err = patchFederation(&api.Federation{Id: 1, Owner: "Owner 1", Version: 3}, patch)
+
+		// assert
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("patchFederation(%s) = %v want %v", tt.patch, err, tt.want)
+		}
+	}
+}
+
+// test ParseMergePatch and ParseJSONPatch with malformed documents
+// should return validation errors
+func TestParsePatchInvalid(t *testing.T) {
+	// arrange
+	tests := []struct {
+		parse func([]byte) (FederationPatch, error)
+		patch string
+	}{
+		{ParseMergePatch, `[]`},
+		{ParseMergePatch, `{`},
+		{ParseJSONPatch, `{}`},
+		{ParseJSONPatch, `[{"op":"explode","path":"/owner"}]`},
+		{ParseJSONPatch, `[{"op":"add","path":"/owner"}]`},
+		{ParseJSONPatch, `[{"op":"copy","path":"/owner"}]`},
+		{ParseJSONPatch, `[{"op":"remove"}]`},
+	}
+
+	for _, tt := range tests {
+		// act
+		_, err := tt.parse([]byte(tt.patch))
+
+		// assert
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("parse(%s) = %v want %v", tt.patch, err, ErrValidation)
+		}
+	}
+}
+
+// test jsonPatch.apply(doc) with the operations of RFC 6902 appendix A
+// should produce the documents of the examples
+func TestJSONPatchApply(t *testing.T) {
+	// arrange
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"replace","path":"/foo/0","value":"qux"}]`, `{"foo":["qux","baz"]}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"copy","from":"/a~1b","path":"/m~0n"}]`, `{"a/b":1,"m~n":1}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"","value":{"baz":1}}]`, `{"baz":1}`},
+	}
+
+	for _, tt := range tests {
+		var doc, want any
+		json.Unmarshal([]byte(tt.doc), &doc)
+		json.Unmarshal([]byte(tt.want), &want)
+		patch, err := ParseJSONPatch([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("ParseJSONPatch(%s) = %v want <nil>", tt.patch, err)
+		}
+
+		// act
+		got, err := patch.apply(doc)
+
+		// assert
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("apply(%s, %s) = %v, %v want %s", tt.doc, tt.patch, got, err, tt.want)
+		}
+	}
+}
+
+// test mergePatch.apply(doc) with the examples of RFC 7396 appendix A
+// should produce the documents of the examples
+func TestMergePatchApply(t *testing.T) {
+	// arrange
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var doc, want any
+		json.Unmarshal([]byte(tt.doc), &doc)
+		json.Unmarshal([]byte(tt.want), &want)
+		patch, _ := ParseMergePatch([]byte(tt.patch))
+
+		// act
+		got, err := patch.apply(doc)
+
+		// assert
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("apply(%s, %s) = %v, %v want %s", tt.doc, tt.patch, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AnonymousPrincipal is recorded for changes made without a principal in
+// the context, for instance by background jobs.
+const AnonymousPrincipal = "anonymous"
+
+type principalKey struct{}
+
+type organisationKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal making the
+// request.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored in ctx by WithPrincipal or
+// AnonymousPrincipal.
+func PrincipalFrom(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok && principal != "" {
+		return principal
+	}
+	return AnonymousPrincipal
+}
+
+// WithOrganisation returns a copy of ctx carrying the organisation the
+// principal making the request acts for.
+func WithOrganisation(ctx context.Context, organisation string) context.Context {
+	return context.WithValue(ctx, organisationKey{}, organisation)
+}
+
+// OrganisationFrom returns the organisation stored in ctx by
+// WithOrganisation, "" when the principal acts for none.
+func OrganisationFrom(ctx context.Context) string {
+	organisation, _ := ctx.Value(organisationKey{}).(string)
+	return organisation
+}
+
+// ParseOrganisations reads the organisations principals act for from a
+// comma separated list of principal=organisation pairs, such as
+// "token:8d969eef6eca=Owner 1".
+func ParseOrganisations(s string) (map[string]string, error) {
+	organisations := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		principal, organisation, ok := strings.Cut(pair, "=")
+		principal, organisation = strings.TrimSpace(principal), strings.TrimSpace(organisation)
+		if !ok || principal == "" || organisation == "" {
+			return nil, fmt.Errorf("organisation %q is not a principal=organisation pair", pair)
+		}
+		organisations[principal] = organisation
+	}
+	return organisations, nil
+}
@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorest/api"
+)
+
+// page size limits for GetFederations.
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// FederationQuery selects a page of federations.
+// zero values disable a filter. Cursor, when set, replaces Offset.
+type FederationQuery struct {
+	Owner       string // exact owner
+	OwnerPrefix string
+	MinId       int // inclusive
+	MaxId       int // inclusive
+	Sort        string
+	Desc        bool
+	Limit       int
+	Offset      int
+	Cursor      string
+	// IncludeDeleted lists soft deleted federations too.
+	IncludeDeleted bool
+	// LabelSelector selects federations by label, such as
+	// env=prod,tier!=gold.
+	LabelSelector string
+	// State lists the federations in one lifecycle state only.
+	State string
+	// ParentId lists the children of one federation only.
+	ParentId int
+}
+
+// FederationPage is one page of a listing.
+type FederationPage struct {
+	Federations []*api.Federation
+	// Total counts every federation matching the filters.
+	Total int
+	// Next and Prev are cursors for the adjacent pages, empty at either end.
+	Next string
+	Prev string
+}
+
+// sortField is a field federations can be sorted on.
+type sortField struct {
+	column string
+	value  func(*api.Federation) any
+	// decode reads a value written to a cursor back into its type.
+	decode func(json.RawMessage) (any, error)
+}
+
+// sortFields lists the fields accepted by FederationQuery.Sort.
+var sortFields = map[string]sortField{
+	"id":         {column: "id", value: func(f *api.Federation) any { return f.Id }, decode: decodeValue[int]},
+	"owner":      {column: "owner", value: func(f *api.Federation) any { return f.Owner }, decode: decodeValue[string]},
+	"name":       {column: "name", value: func(f *api.Federation) any { return f.Name }, decode: decodeValue[string]},
+	"created_at": {column: "created_at", value: func(f *api.Federation) any { return timeValue(f.CreatedAt) }, decode: decodeValue[time.Time]},
+	"updated_at": {column: "updated_at", value: func(f *api.Federation) any { return timeValue(f.UpdatedAt) }, decode: decodeValue[time.Time]},
+}
+
+// timeValue returns the sort value of an optional time, the zero time
+// when unset so it sorts first.
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func decodeValue[T any](raw json.RawMessage) (any, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// cursor marks a position in a listing. it is handed to clients as an
+// opaque base64 token.
+type cursor struct {
+	Sort   string          `json:"s"`
+	Desc   bool            `json:"d,omitempty"`
+	Value  json.RawMessage `json:"v"`
+	Id     int             `json:"id"`
+	Before bool            `json:"b,omitempty"`
+}
+
+// position is a decoded cursor.
+type position struct {
+	value  any
+	id     int
+	before bool
+}
+
+// pageQuery is a validated FederationQuery.
+type pageQuery struct {
+	FederationQuery
+	field sortField
+	// labels are the parsed LabelSelector.
+	labels []labelRequirement
+	// at is the decoded cursor, nil when paging by offset.
+	at *position
+}
+
+func invalidQuery(field, message string) error {
+	return &ValidationError{Field: field, Message: message}
+}
+
+// resolve validates q and fills in defaults.
+func (q FederationQuery) resolve() (*pageQuery, error) {
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	field, ok := sortFields[q.Sort]
+	if !ok {
+		return nil, invalidQuery("sort", fmt.Sprintf("unknown field %q", q.Sort))
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxPageLimit {
+		return nil, invalidQuery("limit", fmt.Sprintf("must be between 1 and %d", MaxPageLimit))
+	}
+	if q.Offset < 0 {
+		return nil, invalidQuery("offset", "must not be negative")
+	}
+
+	labels, err := parseLabelSelector(q.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateState(q.State); err != nil {
+		return nil, err
+	}
+
+	p := &pageQuery{FederationQuery: q, field: field, labels: labels}
+	if q.Cursor == "" {
+		return p, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, invalidQuery("cursor", "is malformed")
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, invalidQuery("cursor", "is malformed")
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return nil, invalidQuery("cursor", "was issued for a different sort")
+	}
+	value, err := field.decode(c.Value)
+	if err != nil {
+		return nil, invalidQuery("cursor", "is malformed")
+	}
+
+	p.Offset = 0
+	p.at = &position{value: value, id: c.Id, before: c.Before}
+	return p, nil
+}
+
+// matches reports whether federation passes the filters.
+func (p *pageQuery) matches(federation *api.Federation) bool {
+	switch {
+	case !p.IncludeDeleted && federation.DeletedAt != nil:
+		return false
+	case p.Owner != "" && federation.Owner != p.Owner:
+		return false
+	case p.OwnerPrefix != "" && !strings.HasPrefix(federation.Owner, p.OwnerPrefix):
+		return false
+	case p.MinId != 0 && federation.Id < p.MinId:
+		return false
+	case p.MaxId != 0 && federation.Id > p.MaxId:
+		return false
+	case p.State != "" && stateOf(federation) != p.State:
+		return false
+	case p.ParentId != 0 && (federation.ParentId == nil || *federation.ParentId != p.ParentId):
+		return false
+	}
+	for _, r := range p.labels {
+		if !r.matches(federation.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare orders federation against a position in the sort order. ties on
+// the sort field are broken by id.
+func (p *pageQuery) compare(federation *api.Federation, at position) int {
+	c := compareValues(p.field.value(federation), at.value)
+	if c == 0 {
+		c = cmp.Compare(federation.Id, at.id)
+	}
+	if p.Desc {
+		return -c
+	}
+	return c
+}
+
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		return cmp.Compare(a, b.(int))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+// positionOf returns the position just after or before federation.
+func (p *pageQuery) positionOf(federation *api.Federation, before bool) position {
+	return position{value: p.field.value(federation), id: federation.Id, before: before}
+}
+
+// cursor returns the token for the position just after or before federation.
+func (p *pageQuery) cursor(federation *api.Federation, before bool) string {
+	value, _ := json.Marshal(p.field.value(federation))
+	raw, _ := json.Marshal(cursor{Sort: p.Sort, Desc: p.Desc, Value: value, Id: federation.Id, Before: before})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// page builds a FederationPage around the selected federations.
+func (p *pageQuery) page(federations []*api.Federation, total int, hasPrev, hasNext bool) *FederationPage {
+	page := &FederationPage{Federations: federations, Total: total}
+	if len(federations) == 0 {
+		return page
+	}
+	if hasPrev {
+		page.Prev = p.cursor(federations[0], true)
+	}
+	if hasNext {
+		page.Next = p.cursor(federations[len(federations)-1], false)
+	}
+	return page
+}
+
+// pageFederations filters, sorts and slices federations in memory.
+// federations must be owned by the caller.
+func pageFederations(federations []*api.Federation, q FederationQuery) (*FederationPage, error) {
+	p, err := q.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]*api.Federation, 0, len(federations))
+	for _, fed := range federations {
+		if p.matches(fed) {
+			matched = append(matched, fed)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *api.Federation) int {
+		return p.compare(a, p.positionOf(b, false))
+	})
+
+	start, end := min(p.Offset, len(matched)), 0
+	switch {
+	case p.at == nil:
+		end = min(start+p.Limit, len(matched))
+	case p.at.before:
+		end, _ = slices.BinarySearchFunc(matched, *p.at, p.compare)
+		start = max(0, end-p.Limit)
+	default:
+		var found bool
+		start, found = slices.BinarySearchFunc(matched, *p.at, p.compare)
+		if found {
+			start++
+		}
+		end = min(start+p.Limit, len(matched))
+	}
+
+	return p.page(matched[start:end], len(matched), start > 0, end < len(matched)), nil
+}
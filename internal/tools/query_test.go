@@ -0,0 +1,173 @@
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorest/api"
+)
+
+// queryFederations is the data set used by listing tests.
+func queryFederations() []*api.Federation {
+	return []*api.Federation{
+		{Id: 1, Owner: "alice", Labels: map[string]string{"env": "prod", "tier": "gold"}, State: StateDraft},
+		{Id: 2, Owner: "bob", Labels: map[string]string{"env": "prod"}, State: StateActive},
+		{Id: 3, Owner: "alice", Labels: map[string]string{"env": "dev", "tier": "silver"}, State: StateSuspended},
+		{Id: 4, Owner: "al_ice"},
+		{Id: 5, Owner: "carol", Labels: map[string]string{"env": "prod", "tier": "silver"}, State: StateArchived},
+		{Id: 6, Owner: "bob", Labels: map[string]string{"example.com/team": ""}},
+	}
+}
+
+// queryCases are listing queries and the ids each must return.
+var queryCases = []struct {
+	query FederationQuery
+	want  []int
+	total int
+}{
+	{FederationQuery{}, []int{1, 2, 3, 4, 5, 6}, 6},
+	{FederationQuery{Limit: 2, Offset: 3}, []int{4, 5}, 6},
+	{FederationQuery{Offset: 10}, []int{}, 6},
+	{FederationQuery{Owner: "bob"}, []int{2, 6}, 2},
+	{FederationQuery{OwnerPrefix: "al"}, []int{1, 3, 4}, 3},
+	{FederationQuery{OwnerPrefix: "al_"}, []int{4}, 1},
+	{FederationQuery{MinId: 2, MaxId: 4}, []int{2, 3, 4}, 3},
+	{FederationQuery{Sort: "owner"}, []int{4, 1, 3, 2, 6, 5}, 6},
+	{FederationQuery{Sort: "owner", Desc: true, Limit: 3}, []int{5, 6, 2}, 6},
+	{FederationQuery{Sort: "id", Desc: true, MinId: 3}, []int{6, 5, 4, 3}, 4},
+	{FederationQuery{LabelSelector: "env=prod"}, []int{1, 2, 5}, 3},
+	{FederationQuery{LabelSelector: "env==prod,tier!=gold"}, []int{2, 5}, 2},
+	{FederationQuery{LabelSelector: "tier"}, []int{1, 3, 5}, 3},
+	{FederationQuery{LabelSelector: "!tier, env != dev", Owner: "bob"}, []int{2, 6}, 2},
+	{FederationQuery{LabelSelector: "example.com/team="}, []int{6}, 1},
+	{FederationQuery{State: StateActive}, []int{2, 4, 6}, 3},
+	{FederationQuery{State: StateDraft}, []int{1}, 1},
+	{FederationQuery{State: StateSuspended, Owner: "alice"}, []int{3}, 1},
+}
+
+func federationIds(federations []*api.Federation) []int {
+	ids := make([]int, 0, len(federations))
+	for _, fed := range federations {
+		ids = append(ids, fed.Id)
+	}
+	return ids
+}
+
+// test pageFederations([]*api.Federation, FederationQuery) with filters, sorting and offsets
+// should return the matching page and total
+func TestPageFederations(t *testing.T) {
+	for _, tt := range queryCases {
+		// act
+		page, err := pageFederations(queryFederations(), tt.query)
+
+		// assert
+		if err != nil {
+			t.Fatalf("pageFederations(%+v) = %v want <nil>", tt.query, err)
+		}
+
+		if ids := federationIds(page.Federations); !reflect.DeepEqual(ids, tt.want) {
+			t.Fatalf("pageFederations(%+v) = %v want %v", tt.query, ids, tt.want)
+		}
+
+		if page.Total != tt.total {
+			t.Fatalf("pageFederations(%+v) total = %d want %d", tt.query, page.Total, tt.total)
+		}
+	}
+}
+
+// walkPages follows Next cursors from the first page and then Prev cursors
+// back, returning the ids of every page visited.
+func walkPages(t *testing.T, list func(FederationQuery) (*FederationPage, error), query FederationQuery) [][]int {
+	t.Helper()
+	var pages [][]int
+
+	page, err := list(query)
+	for err == nil {
+		pages = append(pages, federationIds(page.Federations))
+		if page.Next == "" {
+			break
+		}
+		query.Cursor = page.Next
+		page, err = list(query)
+	}
+	for err == nil && page.Prev != "" {
+		query.Cursor = page.Prev
+		if page, err = list(query); err == nil {
+			pages = append(pages, federationIds(page.Federations))
+		}
+	}
+
+	if err != nil {
+		t.Fatalf("GetFederations(%+v) = %v want <nil>", query, err)
+	}
+	return pages
+}
+
+// test pageFederations([]*api.Federation, FederationQuery) following cursors
+// should visit every page forwards and backwards
+func TestPageFederationsCursor(t *testing.T) {
+	// arrange
+	list := func(query FederationQuery) (*FederationPage, error) {
+		return pageFederations(queryFederations(), query)
+	}
+	want := [][]int{{5, 6}, {2, 3}, {1, 4}, {2, 3}, {5, 6}}
+
+	// act
+	pages := walkPages(t, list, FederationQuery{Sort: "owner", Desc: true, Limit: 2})
+
+	// assert
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("pages = %v want %v", pages, want)
+	}
+}
+
+// test pageFederations([]*api.Federation, FederationQuery) with invalid queries
+// should return validation errors
+func TestPageFederationsInvalid(t *testing.T) {
+	// arrange
+	first, _ := pageFederations(queryFederations(), FederationQuery{Limit: 1})
+	tests := []struct {
+		query FederationQuery
+		field string
+	}{
+		{FederationQuery{Sort: "color"}, "sort"},
+		{FederationQuery{Limit: -1}, "limit"},
+		{FederationQuery{Limit: MaxPageLimit + 1}, "limit"},
+		{FederationQuery{Offset: -1}, "offset"},
+		{FederationQuery{Cursor: "%%%"}, "cursor"},
+		{FederationQuery{Cursor: first.Next, Sort: "owner"}, "cursor"},
+		{FederationQuery{LabelSelector: "env=prod,"}, "labelSelector"},
+		{FederationQuery{LabelSelector: "env=a=b"}, "labelSelector"},
+		{FederationQuery{LabelSelector: "-env"}, "labelSelector"},
+		{FederationQuery{State: "paused"}, "state"},
+	}
+
+	for _, tt := range tests {
+		// act
+		_, err := pageFederations(queryFederations(), tt.query)
+
+		// assert
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+			t.Fatalf("pageFederations(%+v) = %v want invalid %s", tt.query, err, tt.field)
+		}
+	}
+}
+
+// test pageFederations([]*api.Federation, FederationQuery) at both ends
+// should leave Prev empty on the first page and Next empty on the last
+func TestPageFederationsEnds(t *testing.T) {
+	// act
+	first, _ := pageFederations(queryFederations(), FederationQuery{Limit: 3})
+	last, _ := pageFederations(queryFederations(), FederationQuery{Limit: 3, Offset: 3})
+
+	// assert
+	if first.Prev != "" || first.Next == "" {
+		t.Fatalf("pageFederations(first) = %q, %q want no prev and next", first.Prev, first.Next)
+	}
+
+	if last.Prev == "" || last.Next != "" {
+		t.Fatalf("pageFederations(last) = %q, %q want prev and no next", last.Prev, last.Next)
+	}
+}
@@ -0,0 +1,1098 @@
+// Package repotest checks FederationRepository implementations against the
+// contract every backend and decorator must honour.
+//
+// a backend proves it is correct with a test like:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) tools.FederationRepository {
+//			repo := NewBackend()
+//			if err := repo.Setup(context.Background()); err != nil {
+//				t.Fatal(err)
+//			}
+//			t.Cleanup(func() { repo.Close() })
+//			return repo
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorest/api"
+	"gorest/internal/tools"
+)
+
+// Factory returns an empty repository that is ready for use. it is called
+// once per check, so checks never see each other's data. the factory is
+// responsible for closing the repository, usually with t.Cleanup.
+type Factory func(t *testing.T) tools.FederationRepository
+
+// checks lists the contract, one subtest each.
+var checks = []struct {
+	name  string
+	check func(*testing.T, tools.FederationRepository)
+}{
+	{"AddGeneratesIds", checkAddGeneratesIds},
+	{"AddDuplicate", checkAddDuplicate},
+	{"AddInvalid", checkAddInvalid},
+	{"GetMissing", checkGetMissing},
+	{"GetReturnsCopies", checkGetReturnsCopies},
+	{"ListOrdering", checkListOrdering},
+	{"ListPaging", checkListPaging},
+	{"ListDetailsOrdering", checkListDetailsOrdering},
+	{"ListFilters", checkListFilters},
+	{"ListLabels", checkListLabels},
+	{"Details", checkDetails},
+	{"Lifecycle", checkLifecycle},
+	{"Search", checkSearch},
+	{"UpdateMissing", checkUpdateMissing},
+	{"UpdateVersions", checkUpdateVersions},
+	{"Patch", checkPatch},
+	{"DeleteSemantics", checkDeleteSemantics},
+	{"Hierarchy", checkHierarchy},
+	{"DeleteRemovesDependents", checkDeleteRemovesDependents},
+	{"Purge", checkPurge},
+	{"PurgedIdsNotReused", checkPurgedIdsNotReused},
+	{"AtomicBatch", checkAtomicBatch},
+	{"BatchFailures", checkBatchFailures},
+	{"History", checkHistory},
+	{"Cancelled", checkCancelled},
+	{"ConcurrentAccess", checkConcurrentAccess},
+	{"ConcurrentReparent", checkConcurrentReparent},
+	{"ConcurrentWrites", checkConcurrentWrites},
+}
+
+// Run checks the repositories made by newRepository against the contract.
+func Run(t *testing.T, newRepository Factory) {
+	t.Helper()
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, newRepository(t))
+		})
+	}
+}
+
+// add stores federations with the given owners and returns them.
+func add(t *testing.T, repo tools.FederationRepository, owners ...string) []*api.Federation {
+	t.Helper()
+	var added []*api.Federation
+	for _, owner := range owners {
+		fed, err := repo.AddFederation(context.Background(), &api.Federation{Owner: owner})
+		if err != nil {
+			t.Fatalf("AddFederation(%q) = %v want <nil>", owner, err)
+		}
+		added = append(added, fed)
+	}
+	return added
+}
+
+func ids(federations []*api.Federation) []int {
+	ids := make([]int, len(federations))
+	for i, fed := range federations {
+		ids[i] = fed.Id
+	}
+	return ids
+}
+
+func equalIds(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// test AddFederation(federation) without an id
+// should assign distinct ids and the first version
+func checkAddGeneratesIds(t *testing.T, repo tools.FederationRepository) {
+	// act
+	added := add(t, repo, "Owner 1", "Owner 2", "Owner 3")
+
+	// assert
+	seen := map[int]bool{}
+	for _, fed := range added {
+		if fed.Id <= 0 || seen[fed.Id] {
+			t.Fatalf("AddFederation() ids = %v want distinct positive ids", ids(added))
+		}
+		seen[fed.Id] = true
+
+		if fed.Version != 1 {
+			t.Fatalf("AddFederation() = %+v want version 1", fed)
+		}
+	}
+}
+
+// test AddFederation(federation) with a stored id
+// should return ErrAlreadyExists and keep the stored federation
+func checkAddDuplicate(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	stored := add(t, repo, "Owner 1")[0]
+
+	// act
+	_, err := repo.AddFederation(context.Background(), &api.Federation{Id: stored.Id, Owner: "Intruder"})
+
+	// assert
+	if !errors.Is(err, tools.ErrAlreadyExists) {
+		t.Fatalf("AddFederation(%d) = %v want %v", stored.Id, err, tools.ErrAlreadyExists)
+	}
+
+	if fed, _ := repo.GetFederation(context.Background(), stored.Id); fed == nil || fed.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(%d) = %v want the first federation", stored.Id, fed)
+	}
+}
+
+// test AddFederation(federation) and UpdateFederation(federation) breaking
+// several validation rules
+// should return ErrValidation listing every violation
+func checkAddInvalid(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	stored, err := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 1"})
+	if err != nil {
+		t.Fatalf("AddFederation(federation) = %v want <nil>", err)
+	}
+	wantFields := []string{"owner", "name"}
+
+	// act
+	_, addErr := repo.AddFederation(ctx, &api.Federation{Id: -1, Owner: "Owner 1"})
+	_, updateErr := repo.UpdateFederation(ctx, &api.Federation{Id: stored.Id, Name: strings.Repeat("n", 256)})
+
+	// assert
+	if !errors.Is(addErr, tools.ErrValidation) {
+		t.Fatalf("AddFederation(-1) = %v want %v", addErr, tools.ErrValidation)
+	}
+
+	var violations tools.ValidationErrors
+	if !errors.As(updateErr, &violations) || len(violations) != len(wantFields) {
+		t.Fatalf("UpdateFederation(federation) = %v want violations of %v", updateErr, wantFields)
+	}
+	for i, violation := range violations {
+		if violation.Field != wantFields[i] {
+			t.Fatalf("UpdateFederation(federation) = %v want violations of %v", updateErr, wantFields)
+		}
+	}
+
+	if fed, _ := repo.GetFederation(ctx, stored.Id); fed == nil || fed.Version != stored.Version {
+		t.Fatalf("GetFederation(%d) = %v want it unchanged", stored.Id, fed)
+	}
+}
+
+// test GetFederation(id) with a missing id
+// should return ErrNotFound
+func checkGetMissing(t *testing.T, repo tools.FederationRepository) {
+	// act
+	fed, err := repo.GetFederation(context.Background(), 42)
+
+	// assert
+	if !errors.Is(err, tools.ErrNotFound) || fed != nil {
+		t.Fatalf("GetFederation(42) = %v, %v want <nil>, %v", fed, err, tools.ErrNotFound)
+	}
+}
+
+// test GetFederation(id) after changing the returned value
+// should keep the stored federation unchanged
+func checkGetReturnsCopies(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	stored := add(t, repo, "Owner 1")[0]
+	stored.Owner = "mutated by caller"
+	fed, _ := repo.GetFederation(context.Background(), stored.Id)
+	fed.Owner = "mutated by caller"
+
+	// act
+	again, err := repo.GetFederation(context.Background(), stored.Id)
+
+	// assert
+	if err != nil || again.Owner != "Owner 1" {
+		t.Fatalf("GetFederation(%d) = %v, %v want Owner 1", stored.Id, again, err)
+	}
+}
+
+// test GetFederations(query) with each sort
+// should order federations by the field and then by id
+func checkListOrdering(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	added := ids(add(t, repo, "b", "a", "b", "c"))
+	tests := []struct {
+		query tools.FederationQuery
+		want  []int
+	}{
+		{tools.FederationQuery{}, added},
+		{tools.FederationQuery{Desc: true}, []int{added[3], added[2], added[1], added[0]}},
+		{tools.FederationQuery{Sort: "owner"}, []int{added[1], added[0], added[2], added[3]}},
+		{tools.FederationQuery{Sort: "owner", Desc: true}, []int{added[3], added[2], added[0], added[1]}},
+	}
+
+	for _, tt := range tests {
+		// act
+		page, err := repo.GetFederations(context.Background(), tt.query)
+
+		// assert
+		if err != nil || !equalIds(ids(page.Federations), tt.want) || page.Total != len(tt.want) {
+			t.Fatalf("GetFederations(%+v) = %v, %v want %v", tt.query, page, err, tt.want)
+		}
+	}
+}
+
+// test GetFederations(query) following next cursors
+// should visit every federation once, in order
+func checkListPaging(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	want := ids(add(t, repo, "Owner 1", "Owner 2", "Owner 3", "Owner 4", "Owner 5"))
+	query := tools.FederationQuery{Limit: 2}
+	var got []int
+
+	// act
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("GetFederations() kept returning next cursors")
+		}
+		page, err := repo.GetFederations(context.Background(), query)
+		if err != nil {
+			t.Fatalf("GetFederations(%+v) = %v want <nil>", query, err)
+		}
+		got = append(got, ids(page.Federations)...)
+		if page.Next == "" {
+			break
+		}
+		query.Cursor = page.Next
+	}
+
+	// assert
+	if !equalIds(got, want) {
+		t.Fatalf("GetFederations() pages = %v want %v", got, want)
+	}
+
+	if _, err := repo.GetFederations(context.Background(), tools.FederationQuery{Limit: tools.MaxPageLimit + 1}); !errors.Is(err, tools.ErrValidation) {
+		t.Fatalf("GetFederations(limit too large) = %v want %v", err, tools.ErrValidation)
+	}
+}
+
+// test GetFederations(query) sorted on the name and timestamps, a page at a time
+// should order by the field, then by id, across pages
+func checkListDetailsOrdering(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	var added []int
+	for _, name := range []string{"b", "a", "b", "c"} {
+		fed, err := repo.AddFederation(ctx, &api.Federation{Owner: "Owner", Name: name})
+		if err != nil {
+			t.Fatalf("AddFederation(%q) = %v want <nil>", name, err)
+		}
+		added = append(added, fed.Id)
+		time.Sleep(time.Millisecond)
+	}
+	repo.UpdateFederation(ctx, &api.Federation{Id: added[1], Owner: "Owner", Name: "a"})
+	tests := []struct {
+		query tools.FederationQuery
+		want  []int
+	}{
+		{tools.FederationQuery{Sort: "name"}, []int{added[1], added[0], added[2], added[3]}},
+		{tools.FederationQuery{Sort: "name", Desc: true}, []int{added[3], added[2], added[0], added[1]}},
+		{tools.FederationQuery{Sort: "created_at", Desc: true}, []int{added[3], added[2], added[1], added[0]}},
+		{tools.FederationQuery{Sort: "updated_at"}, []int{added[0], added[2], added[3], added[1]}},
+	}
+
+	for _, tt := range tests {
+		// act
+		var got []int
+		query := tt.query
+		query.Limit = 3
+		for pages := 0; ; pages++ {
+			if pages > len(added) {
+				t.Fatalf("GetFederations(%+v) kept returning next cursors", tt.query)
+			}
+			page, err := repo.GetFederations(ctx, query)
+			if err != nil {
+				t.Fatalf("GetFederations(%+v) = %v want <nil>", query, err)
+			}
+			got = append(got, ids(page.Federations)...)
+			if page.Next == "" {
+				break
+			}
+			query.Cursor = page.Next
+		}
+
+		// assert
+		if !equalIds(got, tt.want) {
+			t.Fatalf("GetFederations(%+v) pages = %v want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// test GetFederations(query) with filters
+// should return the matching federations only
+func checkListFilters(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	added := ids(add(t, repo, "alice", "albert", "bob"))
+	tests := []struct {
+		query tools.FederationQuery
+		want  []int
+	}{
+		{tools.FederationQuery{Owner: "bob"}, added[2:]},
+		{tools.FederationQuery{OwnerPrefix: "al"}, added[:2]},
+		{tools.FederationQuery{MinId: added[1]}, added[1:]},
+		{tools.FederationQuery{MaxId: added[1]}, added[:2]},
+	}
+
+	for _, tt := range tests {
+		// act
+		page, err := repo.GetFederations(context.Background(), tt.query)
+
+		// assert
+		if err != nil || !equalIds(ids(page.Federations), tt.want) || page.Total != len(tt.want) {
+			t.Fatalf("GetFederations(%+v) = %v, %v want %v", tt.query, page, err, tt.want)
+		}
+	}
+}
+
+// test GetFederations(query) with label selectors after label changes
+// should select by the current labels, deleted federations included on request
+func checkListLabels(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	var added []int
+	for _, labels := range []map[string]string{{"env": "prod"}, {"env": "dev", "tier": "gold"}, nil, {"env": "prod", "tier": "gold"}} {
+		fed, err := repo.AddFederation(ctx, &api.Federation{Owner: "owner", Labels: labels})
+		if err != nil {
+			t.Fatalf("AddFederation(%v) = %v want <nil>", labels, err)
+		}
+		added = append(added, fed.Id)
+	}
+	repo.UpdateFederation(ctx, &api.Federation{Id: added[0], Owner: "owner", Labels: map[string]string{"env": "dev"}})
+	repo.DeleteFederation(ctx, added[3], 0)
+	tests := []struct {
+		query tools.FederationQuery
+		want  []int
+	}{
+		{tools.FederationQuery{LabelSelector: "env=dev"}, added[:2]},
+		{tools.FederationQuery{LabelSelector: "env=prod"}, nil},
+		{tools.FederationQuery{LabelSelector: "env=prod", IncludeDeleted: true}, added[3:]},
+		{tools.FederationQuery{LabelSelector: "tier!=gold"}, []int{added[0], added[2]}},
+		{tools.FederationQuery{LabelSelector: "!env"}, added[2:3]},
+		{tools.FederationQuery{LabelSelector: "env,tier"}, added[1:2]},
+	}
+
+	for _, tt := range tests {
+		// act
+		page, err := repo.GetFederations(ctx, tt.query)
+
+		// assert
+		if err != nil || !equalIds(ids(page.Federations), tt.want) || page.Total != len(tt.want) {
+			t.Fatalf("GetFederations(%+v) = %v, %v want %v", tt.query, page, err, tt.want)
+		}
+	}
+
+	if _, err := repo.GetFederations(ctx, tools.FederationQuery{LabelSelector: "env=a b"}); !errors.Is(err, tools.ErrValidation) {
+		t.Fatalf("GetFederations(invalid selector) = %v want %v", err, tools.ErrValidation)
+	}
+}
+
+// test AddFederation(federation) and UpdateFederation(federation) with details
+// should store them, keep the details an update leaves out, keep the
+// timestamps to the repository and validate labels
+func checkDetails(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	client := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	federation := &api.Federation{Owner: "Owner 1", Name: "one", Description: "the first", Labels: map[string]string{"env": "prod"}, CreatedAt: &client, UpdatedAt: &client}
+
+	// act
+	added, err := repo.AddFederation(ctx, federation)
+	if err != nil {
+		t.Fatalf("AddFederation(%+v) = %v want <nil>", federation, err)
+	}
+	added.Labels["env"] = "mutated by caller"
+	time.Sleep(time.Millisecond)
+	updated, updateErr := repo.UpdateFederation(ctx, &api.Federation{Id: added.Id, Owner: "Owner 1", Name: "uno", Labels: map[string]string{"tier": "gold"}, CreatedAt: &client})
+	stored, _ := repo.GetFederation(ctx, added.Id)
+	ownerOnly, ownerOnlyErr := repo.UpdateFederation(ctx, &api.Federation{Id: added.Id, Owner: "Owner 2"})
+	_, invalidErr := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 2", Labels: map[string]string{"env": "a b"}})
+	_, invalidUpdateErr := repo.UpdateFederation(ctx, &api.Federation{Id: added.Id, Owner: "Owner 1", Labels: map[string]string{"": "x"}})
+
+	// assert
+	if added.Name != "one" || added.Description != "the first" || added.CreatedAt == nil || added.CreatedAt.Equal(client) || !added.UpdatedAt.Equal(*added.CreatedAt) {
+		t.Fatalf("AddFederation(%+v) = %+v want the details and repository timestamps", federation, added)
+	}
+
+	if updateErr != nil || updated.Name != "uno" || updated.Description != "the first" || len(updated.Labels) != 1 || updated.Labels["tier"] != "gold" {
+		t.Fatalf("UpdateFederation(%d) = %+v, %v want the new details and the description kept", added.Id, updated, updateErr)
+	}
+
+	if ownerOnlyErr != nil || ownerOnly.Owner != "Owner 2" || ownerOnly.Name != "uno" || ownerOnly.Description != "the first" || ownerOnly.Labels["tier"] != "gold" {
+		t.Fatalf("UpdateFederation(%d) with an owner only = %+v, %v want the details kept", added.Id, ownerOnly, ownerOnlyErr)
+	}
+
+	if !updated.CreatedAt.Equal(*added.CreatedAt) || !updated.UpdatedAt.After(*added.UpdatedAt) {
+		t.Fatalf("UpdateFederation(%d) = created %v, updated %v want created %v and a later update", added.Id, updated.CreatedAt, updated.UpdatedAt, added.CreatedAt)
+	}
+
+	if stored == nil || stored.Name != "uno" || stored.Labels["tier"] != "gold" || !stored.UpdatedAt.Equal(*updated.UpdatedAt) {
+		t.Fatalf("GetFederation(%d) = %+v want %+v", added.Id, stored, updated)
+	}
+
+	for _, err := range []error{invalidErr, invalidUpdateErr} {
+		if !errors.Is(err, tools.ErrValidation) {
+			t.Fatalf("write with an invalid label = %v want %v", err, tools.ErrValidation)
+		}
+	}
+}
+
+// test TransitionFederation(id, version, action) through the lifecycle
+// should move federations along the table, record each move and refuse
+// the others with the current state
+func checkLifecycle(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	added, err := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 1", State: tools.StateArchived})
+	if err != nil {
+		t.Fatalf("AddFederation(federation) = %v want <nil>", err)
+	}
+	other, _ := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 2"})
+
+	// act
+	_, unnamedErr := repo.TransitionFederation(ctx, added.Id, 0, tools.ActionActivate)
+	named, _ := repo.UpdateFederation(ctx, &api.Federation{Id: added.Id, Owner: "Owner 1", Name: "one"})
+	time.Sleep(time.Millisecond)
+	active, activeErr := repo.TransitionFederation(ctx, added.Id, named.Version, tools.ActionActivate)
+	_, staleErr := repo.TransitionFederation(ctx, added.Id, named.Version, tools.ActionSuspend)
+	suspended, suspendErr := repo.TransitionFederation(ctx, added.Id, 0, tools.ActionSuspend)
+	page, listErr := repo.GetFederations(ctx, tools.FederationQuery{State: tools.StateSuspended})
+	drafts, _ := repo.GetFederations(ctx, tools.FederationQuery{State: tools.StateDraft})
+	repo.TransitionFederation(ctx, added.Id, 0, tools.ActionArchive)
+	_, archivedErr := repo.TransitionFederation(ctx, added.Id, 0, tools.ActionActivate)
+	history, _ := repo.GetHistory(ctx, added.Id, tools.HistoryQuery{})
+
+	// assert
+	if added.State != tools.StateDraft || added.StateChangedAt == nil || !added.StateChangedAt.Equal(*added.CreatedAt) {
+		t.Fatalf("AddFederation(federation) = %+v want a draft", added)
+	}
+
+	var stateErr *tools.StateError
+	if !errors.As(unnamedErr, &stateErr) || stateErr.State != tools.StateDraft || stateErr.Reason == "" {
+		t.Fatalf("TransitionFederation(activate) without a name = %v want a refusal in state %s", unnamedErr, tools.StateDraft)
+	}
+
+	if activeErr != nil || active.State != tools.StateActive || active.Version != named.Version+1 || !active.StateChangedAt.After(*added.StateChangedAt) {
+		t.Fatalf("TransitionFederation(activate) = %+v, %v want active at version %d", active, activeErr, named.Version+1)
+	}
+
+	if !errors.Is(staleErr, tools.ErrVersionMismatch) {
+		t.Fatalf("TransitionFederation(stale version) = %v want %v", staleErr, tools.ErrVersionMismatch)
+	}
+
+	if suspendErr != nil || suspended.State != tools.StateSuspended {
+		t.Fatalf("TransitionFederation(suspend) = %+v, %v want suspended", suspended, suspendErr)
+	}
+
+	if listErr != nil || len(page.Federations) != 1 || page.Federations[0].Id != added.Id {
+		t.Fatalf("GetFederations(suspended) = %+v, %v want federation %d", page, listErr, added.Id)
+	}
+
+	if len(drafts.Federations) != 1 || drafts.Federations[0].Id != other.Id {
+		t.Fatalf("GetFederations(draft) = %+v want federation %d", drafts, other.Id)
+	}
+
+	if !errors.As(archivedErr, &stateErr) || !errors.Is(archivedErr, tools.ErrConflict) || stateErr.State != tools.StateArchived {
+		t.Fatalf("TransitionFederation(activate) when archived = %v want a conflict in state %s", archivedErr, tools.StateArchived)
+	}
+
+	if len(history.Changes) < 3 || history.Changes[0].Op != tools.ActionArchive || history.Changes[1].Op != tools.ActionSuspend || history.Changes[2].Op != tools.ActionActivate {
+		t.Fatalf("GetHistory(%d) = %+v want the transitions newest first", added.Id, history)
+	}
+}
+
+// test SearchFederations(query) after adds, updates and deletes
+// should rank the live matches and page through them
+func checkSearch(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	added := ids(add(t, repo, "Bob Alicorn", "alice", "Malice", "ALICE cooper", "bob", "alice"))
+	repo.UpdateFederation(ctx, &api.Federation{Id: added[4], Owner: "Alicia"})
+	repo.DeleteFederation(ctx, added[5], 0)
+	tests := []struct {
+		query tools.SearchQuery
+		want  []int
+	}{
+		// exact, prefix, word prefix and then substring matches.
+		{tools.SearchQuery{Q: "ALIC"}, []int{added[1], added[3], added[4], added[0], added[2]}},
+		{tools.SearchQuery{Q: "alice"}, []int{added[1], added[3], added[2]}},
+		{tools.SearchQuery{Q: "b"}, []int{added[0]}},
+		{tools.SearchQuery{Q: "zed"}, []int{}},
+	}
+
+	for _, tt := range tests {
+		// act
+		page, err := repo.SearchFederations(ctx, tt.query)
+
+		// assert
+		if err != nil || !equalIds(ids(page.Federations), tt.want) || page.Total != len(tt.want) {
+			t.Fatalf("SearchFederations(%+v) = %v, %v want %v", tt.query, page, err, tt.want)
+		}
+	}
+
+	query := tools.SearchQuery{Q: "ali", Limit: 2}
+	var got []int
+	for pages := 0; ; pages++ {
+		page, err := repo.SearchFederations(ctx, query)
+		if err != nil || pages > len(added) {
+			t.Fatalf("SearchFederations(%+v) = %v want <nil>", query, err)
+		}
+		got = append(got, ids(page.Federations)...)
+		if page.Next == "" {
+			break
+		}
+		query.Cursor = page.Next
+	}
+	if want := []int{added[1], added[3], added[4], added[0], added[2]}; !equalIds(got, want) {
+		t.Fatalf("SearchFederations(ali) pages = %v want %v", got, want)
+	}
+
+	if _, err := repo.SearchFederations(ctx, tools.SearchQuery{Q: " "}); !errors.Is(err, tools.ErrValidation) {
+		t.Fatalf("SearchFederations(blank) = %v want %v", err, tools.ErrValidation)
+	}
+}
+
+// test UpdateFederation(federation) with a missing id
+// should return ErrNotFound and store nothing
+func checkUpdateMissing(t *testing.T, repo tools.FederationRepository) {
+	// act
+	_, err := repo.UpdateFederation(context.Background(), &api.Federation{Id: 42, Owner: "Owner 42"})
+
+	// assert
+	if !errors.Is(err, tools.ErrNotFound) {
+		t.Fatalf("UpdateFederation(42) = %v want %v", err, tools.ErrNotFound)
+	}
+
+	if _, err := repo.GetFederation(context.Background(), 42); !errors.Is(err, tools.ErrNotFound) {
+		t.Fatalf("GetFederation(42) = %v want %v", err, tools.ErrNotFound)
+	}
+}
+
+// test UpdateFederation(federation) with current, stale and any versions
+// should apply the current and any versions and reject the stale one
+func checkUpdateVersions(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	id := add(t, repo, "Owner 1")[0].Id
+
+	// act
+	updated, err := repo.UpdateFederation(context.Background(), &api.Federation{Id: id, Owner: "Owner 2", Version: 1})
+	_, staleErr := repo.UpdateFederation(context.Background(), &api.Federation{Id: id, Owner: "Owner 3", Version: 1})
+	forced, forcedErr := repo.UpdateFederation(context.Background(), &api.Federation{Id: id, Owner: "Owner 4"})
+
+	// assert
+	if err != nil || updated.Owner != "Owner 2" || updated.Version != 2 {
+		t.Fatalf("UpdateFederation(version 1) = %+v, %v want Owner 2 at version 2", updated, err)
+	}
+
+	if !errors.Is(staleErr, tools.ErrVersionMismatch) {
+		t.Fatalf("UpdateFederation(stale version) = %v want %v", staleErr, tools.ErrVersionMismatch)
+	}
+
+	if forcedErr != nil || forced.Owner != "Owner 4" || forced.Version != 3 {
+		t.Fatalf("UpdateFederation(any version) = %+v, %v want Owner 4 at version 3", forced, forcedErr)
+	}
+}
+
+// test PatchFederation(id, version, patch) with a passing and a failing patch
+// should apply the first atomically and leave the federation after the second
+func checkPatch(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	id := add(t, repo, "Owner 1")[0].Id
+	patch, _ := tools.ParseMergePatch([]byte(`{"owner":"patched"}`))
+	failing, _ := tools.ParseJSONPatch([]byte(`[{"op":"replace","path":"/owner","value":"lost"},{"op":"test","path":"/owner","value":"Owner 1"}]`))
+
+	// act
+	patched, err := repo.PatchFederation(context.Background(), id, 1, patch)
+	_, failErr := repo.PatchFederation(context.Background(), id, 0, failing)
+	stored, _ := repo.GetFederation(context.Background(), id)
+
+	// assert
+	if err != nil || patched.Owner != "patched" || patched.Version != 2 {
+		t.Fatalf("PatchFederation(%d) = %+v, %v want patched at version 2", id, patched, err)
+	}
+
+	if !errors.Is(failErr, tools.ErrConflict) {
+		t.Fatalf("PatchFederation(failing test) = %v want %v", failErr, tools.ErrConflict)
+	}
+
+	if stored.Owner != "patched" || stored.Version != 2 {
+		t.Fatalf("GetFederation(%d) = %+v want the first patch only", id, stored)
+	}
+}
+
+// test DeleteFederation(id, version) and RestoreFederation(id, version)
+// should hide deleted federations until they are restored
+func checkDeleteSemantics(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	added := ids(add(t, repo, "Owner 1", "Owner 2"))
+	ctx := context.Background()
+
+	// act
+	staleErr := repo.DeleteFederation(ctx, added[0], 7)
+	err := repo.DeleteFederation(ctx, added[0], 1)
+	againErr := repo.DeleteFederation(ctx, added[0], 0)
+	missingErr := repo.DeleteFederation(ctx, 42, 0)
+	_, getErr := repo.GetFederation(ctx, added[0])
+	_, updateErr := repo.UpdateFederation(ctx, &api.Federation{Id: added[0], Owner: "ghost"})
+	live, _ := repo.GetFederations(ctx, tools.FederationQuery{})
+	all, _ := repo.GetFederations(ctx, tools.FederationQuery{IncludeDeleted: true})
+	_, liveRestoreErr := repo.RestoreFederation(ctx, added[1], 0)
+	restored, restoreErr := repo.RestoreFederation(ctx, added[0], 2)
+
+	// assert
+	if !errors.Is(staleErr, tools.ErrVersionMismatch) {
+		t.Fatalf("DeleteFederation(stale version) = %v want %v", staleErr, tools.ErrVersionMismatch)
+	}
+
+	if err != nil {
+		t.Fatalf("DeleteFederation(%d) = %v want <nil>", added[0], err)
+	}
+
+	for _, err := range []error{againErr, missingErr, getErr, updateErr} {
+		if !errors.Is(err, tools.ErrNotFound) {
+			t.Fatalf("call on a deleted or missing federation = %v want %v", err, tools.ErrNotFound)
+		}
+	}
+
+	if !equalIds(ids(live.Federations), added[1:]) || !equalIds(ids(all.Federations), added) {
+		t.Fatalf("GetFederations() = %v and %v with deleted want %v and %v", ids(live.Federations), ids(all.Federations), added[1:], added)
+	}
+
+	if deleted := all.Federations[0]; deleted.DeletedAt == nil || deleted.Version != 2 {
+		t.Fatalf("GetFederations(includeDeleted)[0] = %+v want deleted_at at version 2", deleted)
+	}
+
+	if !errors.Is(liveRestoreErr, tools.ErrConflict) {
+		t.Fatalf("RestoreFederation(live) = %v want %v", liveRestoreErr, tools.ErrConflict)
+	}
+
+	if restoreErr != nil || restored.DeletedAt != nil || restored.Version != 3 {
+		t.Fatalf("RestoreFederation(%d) = %+v, %v want a live federation at version 3", added[0], restored, restoreErr)
+	}
+}
+
+// test writes of parents and deletes of parents under the default policy
+// should refuse cycles and missing parents with 422 violations and keep
+// federations with live children
+func checkHierarchy(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	root := add(t, repo, "Owner 1")[0]
+	parent := func(id int) *int { return &id }
+	child, childErr := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 2", ParentId: parent(root.Id)})
+	if childErr != nil {
+		t.Fatalf("AddFederation(child of %d) = %v want <nil>", root.Id, childErr)
+	}
+	grandchild, _ := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 3", ParentId: parent(child.Id)})
+	orphan := add(t, repo, "Owner 4")[0]
+	moved, _ := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 6", ParentId: parent(root.Id)})
+	toTop, _ := tools.ParseMergePatch([]byte(`{"parent_id":null}`))
+
+	// act
+	kept, keptErr := repo.UpdateFederation(ctx, &api.Federation{Id: moved.Id, Owner: "Owner 7"})
+	cleared, clearedErr := repo.PatchFederation(ctx, moved.Id, 0, toTop)
+	_, missingErr := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 5", ParentId: parent(42)})
+	_, cycleErr := repo.UpdateFederation(ctx, &api.Federation{Id: root.Id, Owner: "Owner 1", ParentId: parent(grandchild.Id)})
+	_, selfErr := repo.UpdateFederation(ctx, &api.Federation{Id: root.Id, Owner: "Owner 1", ParentId: parent(root.Id)})
+	restrictErr := repo.DeleteFederation(ctx, root.Id, 0)
+	children, listErr := repo.GetFederations(ctx, tools.FederationQuery{ParentId: root.Id})
+	repo.UpdateFederation(ctx, &api.Federation{Id: grandchild.Id, Owner: "Owner 3", ParentId: parent(orphan.Id)})
+	repo.DeleteFederation(ctx, grandchild.Id, 0)
+	repo.DeleteFederation(ctx, orphan.Id, 0)
+	_, restoreErr := repo.RestoreFederation(ctx, grandchild.Id, 0)
+	leafErr := repo.DeleteFederation(ctx, child.Id, 0)
+
+	// assert
+	for _, err := range []error{missingErr, cycleErr, selfErr} {
+		var violations tools.ValidationErrors
+		if !errors.As(err, &violations) || violations[0].Field != "parent_id" {
+			t.Fatalf("write with an invalid parent = %v want a parent_id violation", err)
+		}
+	}
+
+	if keptErr != nil || kept.ParentId == nil || *kept.ParentId != root.Id {
+		t.Fatalf("UpdateFederation(%d) without a parent = %+v, %v want parent %d kept", moved.Id, kept, keptErr, root.Id)
+	}
+
+	if clearedErr != nil || cleared.ParentId != nil {
+		t.Fatalf("PatchFederation(%d, parent_id null) = %+v, %v want it at the top", moved.Id, cleared, clearedErr)
+	}
+
+	if !errors.Is(restrictErr, tools.ErrConflict) {
+		t.Fatalf("DeleteFederation(parent) = %v want %v", restrictErr, tools.ErrConflict)
+	}
+
+	if listErr != nil || !equalIds(ids(children.Federations), []int{child.Id}) {
+		t.Fatalf("GetFederations(parentId %d) = %+v, %v want federation %d", root.Id, children, listErr, child.Id)
+	}
+
+	if !errors.Is(restoreErr, tools.ErrValidation) {
+		t.Fatalf("RestoreFederation(under a deleted parent) = %v want %v", restoreErr, tools.ErrValidation)
+	}
+
+	if leafErr != nil {
+		t.Fatalf("DeleteFederation(without live children) = %v want <nil>", leafErr)
+	}
+}
+
+// test DeleteFederation(id) and ApplyBatch(delete ops) on federations with
+// members and transfers
+// should remove them along with every committed delete, so restored
+// federations start without any
+func checkDeleteRemovesDependents(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	owners := []string{"Owner 1", "Owner 2", "Owner 3"}
+	added := ids(add(t, repo, owners...))
+	members := tools.NewMockMembers(repo)
+	transfers := tools.NewMockTransfers(repo, time.Hour)
+	for i, id := range added {
+		members.AddMember(ctx, id, &api.Member{Organisation: "Acme"})
+		transfers.CreateTransfer(tools.WithOrganisation(ctx, owners[i]), id, "Owner 9")
+	}
+
+	// act
+	repo.DeleteFederation(ctx, added[0], 0)
+	repo.ApplyBatch(ctx, []tools.BatchOperation{{Op: tools.BatchDelete, Id: added[1]}}, false)
+	repo.ApplyBatch(ctx, []tools.BatchOperation{{Op: tools.BatchDelete, Id: added[2]}, {Op: tools.BatchDelete, Id: 42}}, true)
+	kept, keptErr := members.GetMembers(ctx, added[2])
+	repo.ApplyBatch(ctx, []tools.BatchOperation{{Op: tools.BatchDelete, Id: added[2]}}, true)
+	var left []int
+	for _, id := range added {
+		repo.RestoreFederation(ctx, id, 0)
+		m, _ := members.GetMembers(ctx, id)
+		tr, _ := transfers.GetTransfers(ctx, id)
+		if len(m) > 0 || len(tr) > 0 {
+			left = append(left, id)
+		}
+	}
+
+	// assert
+	if keptErr != nil || len(kept) != 1 {
+		t.Fatalf("GetMembers(%d) after a failed batch = %+v, %v want the member kept", added[2], kept, keptErr)
+	}
+
+	if len(left) > 0 {
+		t.Fatalf("members or transfers of deleted federations %v are left want none", left)
+	}
+}
+
+// test PurgeFederations(deletedBefore) with live and deleted federations
+// should remove deleted federations only, history included
+func checkPurge(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	added := ids(add(t, repo, "Owner 1", "Owner 2"))
+	repo.DeleteFederation(context.Background(), added[0], 0)
+
+	// act
+	early, earlyErr := repo.PurgeFederations(context.Background(), time.Now().Add(-time.Hour))
+	n, err := repo.PurgeFederations(context.Background(), time.Now().Add(time.Hour))
+	all, _ := repo.GetFederations(context.Background(), tools.FederationQuery{IncludeDeleted: true})
+	_, historyErr := repo.GetHistory(context.Background(), added[0], tools.HistoryQuery{})
+
+	// assert
+	if earlyErr != nil || early != 0 {
+		t.Fatalf("PurgeFederations(an hour ago) = %d, %v want 0, <nil>", early, earlyErr)
+	}
+
+	if err != nil || n != 1 || !equalIds(ids(all.Federations), added[1:]) {
+		t.Fatalf("PurgeFederations(in an hour) = %d, %v left %v want 1 purged", n, err, ids(all.Federations))
+	}
+
+	if !errors.Is(historyErr, tools.ErrNotFound) {
+		t.Fatalf("GetHistory(purged) = %v want %v", historyErr, tools.ErrNotFound)
+	}
+}
+
+// test AddFederation(federation) after the newest federation is purged
+// should not hand its id out again
+func checkPurgedIdsNotReused(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	purged := add(t, repo, "Owner 1", "Owner 2")[1].Id
+	repo.DeleteFederation(ctx, purged, 0)
+	repo.PurgeFederations(ctx, time.Now().Add(time.Hour))
+
+	// act
+	fed, err := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 3"})
+
+	// assert
+	if err != nil || fed.Id == purged {
+		t.Fatalf("AddFederation(federation) = %+v, %v want an id other than %d", fed, err, purged)
+	}
+}
+
+// test ApplyBatch(ops, true) with a failing operation
+// should apply nothing and abort the other operations
+func checkAtomicBatch(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	id := add(t, repo, "Owner 1")[0].Id
+	ops := []tools.BatchOperation{
+		{Op: tools.BatchCreate, Federation: &api.Federation{Owner: "Owner 2"}},
+		{Op: tools.BatchUpdate, Id: id, Federation: &api.Federation{Owner: "changed"}},
+		{Op: tools.BatchDelete, Id: 42},
+	}
+
+	// act
+	results, err := repo.ApplyBatch(context.Background(), ops, true)
+	page, _ := repo.GetFederations(context.Background(), tools.FederationQuery{})
+
+	// assert
+	if err != nil || len(results) != len(ops) {
+		t.Fatalf("ApplyBatch(atomic) = %v, %v want %d results", results, err, len(ops))
+	}
+
+	if !errors.Is(results[0].Err, tools.ErrBatchAborted) || !errors.Is(results[1].Err, tools.ErrBatchAborted) || !errors.Is(results[2].Err, tools.ErrNotFound) {
+		t.Fatalf("ApplyBatch(atomic) errors = %v, %v, %v want aborted, aborted, not found", results[0].Err, results[1].Err, results[2].Err)
+	}
+
+	if page.Total != 1 || page.Federations[0].Owner != "Owner 1" {
+		t.Fatalf("GetFederations() = %v want the batch discarded", page.Federations)
+	}
+}
+
+// test ApplyBatch(ops, false) with failing operations between others
+// should apply the others and leave no change of the failed ones, not even
+// to the children a failed delete reached
+func checkBatchFailures(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := context.Background()
+	parent := add(t, repo, "Owner 1")[0]
+	child, childErr := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 2", ParentId: &parent.Id})
+	if childErr != nil {
+		t.Fatalf("AddFederation(child of %d) = %v want <nil>", parent.Id, childErr)
+	}
+	other := add(t, repo, "Owner 3")[0]
+	ops := []tools.BatchOperation{
+		{Op: tools.BatchDelete, Id: parent.Id},
+		{Op: tools.BatchUpdate, Id: child.Id, Version: 7, Federation: &api.Federation{Owner: "changed"}},
+		{Op: tools.BatchUpdate, Id: other.Id, Federation: &api.Federation{Owner: "changed"}},
+	}
+
+	// act
+	results, err := repo.ApplyBatch(ctx, ops, false)
+
+	// assert
+	if err != nil || len(results) != len(ops) || results[0].Err == nil || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("ApplyBatch(ops, false) = %+v, %v want two failures and an update", results, err)
+	}
+
+	for _, fed := range []*api.Federation{parent, child} {
+		page, err := repo.GetHistory(ctx, fed.Id, tools.HistoryQuery{})
+		stored, getErr := repo.GetFederation(ctx, fed.Id)
+		if err != nil || page.Total != 1 || getErr != nil || stored.Version != fed.Version {
+			t.Fatalf("GetHistory(%d), GetFederation(%d) = %+v, %+v want the federation as created", fed.Id, fed.Id, page, stored)
+		}
+	}
+
+	if stored, err := repo.GetFederation(ctx, other.Id); err != nil || stored.Owner != "changed" {
+		t.Fatalf("GetFederation(%d) = %+v, %v want the update applied", other.Id, stored, err)
+	}
+}
+
+// test GetHistory(id, query) after writes by a principal
+// should list every change newest first with the principal
+func checkHistory(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	ctx := tools.WithPrincipal(context.Background(), "alice")
+	fed, err := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 1"})
+	if err != nil {
+		t.Fatalf("AddFederation() = %v want <nil>", err)
+	}
+	repo.UpdateFederation(ctx, &api.Federation{Id: fed.Id, Owner: "Owner 2"})
+	repo.DeleteFederation(ctx, fed.Id, 0)
+	wantOps := []string{tools.ChangeDelete, tools.ChangeUpdate, tools.ChangeCreate}
+
+	// act
+	page, err := repo.GetHistory(context.Background(), fed.Id, tools.HistoryQuery{})
+	_, missingErr := repo.GetHistory(context.Background(), 42, tools.HistoryQuery{})
+
+	// assert
+	if err != nil || page.Total != len(wantOps) || len(page.Changes) != len(wantOps) {
+		t.Fatalf("GetHistory(%d) = %+v, %v want %d changes", fed.Id, page, err, len(wantOps))
+	}
+
+	for i, change := range page.Changes {
+		if change.Op != wantOps[i] || change.Principal != "alice" || change.FederationId != fed.Id {
+			t.Fatalf("GetHistory(%d)[%d] = %+v want %s by alice", fed.Id, i, change, wantOps[i])
+		}
+	}
+
+	if page.Changes[2].Before != nil || page.Changes[1].Before.Owner != "Owner 1" || page.Changes[1].After.Owner != "Owner 2" {
+		t.Fatalf("GetHistory(%d) snapshots = %+v want before and after states", fed.Id, page.Changes)
+	}
+
+	if !errors.Is(missingErr, tools.ErrNotFound) {
+		t.Fatalf("GetHistory(42) = %v want %v", missingErr, tools.ErrNotFound)
+	}
+}
+
+// test calls with a cancelled context
+// should return the context error and change nothing
+func checkCancelled(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	id := add(t, repo, "Owner 1")[0].Id
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// act
+	_, addErr := repo.AddFederation(ctx, &api.Federation{Owner: "Owner 2"})
+	_, updateErr := repo.UpdateFederation(ctx, &api.Federation{Id: id, Owner: "changed"})
+	deleteErr := repo.DeleteFederation(ctx, id, 0)
+	_, listErr := repo.GetFederations(ctx, tools.FederationQuery{})
+
+	// assert
+	for _, err := range []error{addErr, updateErr, deleteErr, listErr} {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("call(cancelled ctx) = %v want %v", err, context.Canceled)
+		}
+	}
+
+	page, _ := repo.GetFederations(context.Background(), tools.FederationQuery{})
+	if page.Total != 1 || page.Federations[0].Owner != "Owner 1" {
+		t.Fatalf("GetFederations() = %v want unchanged", page.Federations)
+	}
+}
+
+// test concurrent adds, updates and reads
+// should lose no writes and never fail a read
+func checkConcurrentAccess(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	const workers, perWorker = 8, 10
+	shared := add(t, repo, "shared")[0].Id
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*3)
+
+	// act
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := repo.AddFederation(context.Background(), &api.Federation{Owner: fmt.Sprintf("worker %d", w)}); err != nil {
+					errs <- err
+				}
+				if _, err := repo.UpdateFederation(context.Background(), &api.Federation{Id: shared, Owner: fmt.Sprintf("worker %d", w)}); err != nil {
+					errs <- err
+				}
+				if _, err := repo.GetFederations(context.Background(), tools.FederationQuery{}); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	// assert
+	for err := range errs {
+		t.Fatalf("concurrent call = %v want <nil>", err)
+	}
+
+	page, err := repo.GetFederations(context.Background(), tools.FederationQuery{Limit: tools.MaxPageLimit})
+	if err != nil || page.Total != workers*perWorker+1 {
+		t.Fatalf("GetFederations() = %v, %v want %d federations", page, err, workers*perWorker+1)
+	}
+
+	if fed, _ := repo.GetFederation(context.Background(), shared); fed.Version != workers*perWorker+1 {
+		t.Fatalf("GetFederation(%d).Version = %d want %d", shared, fed.Version, workers*perWorker+1)
+	}
+}
+
+// test UpdateFederation(federation) moving two federations under each other
+// at once
+// should apply at most one move, so the hierarchy never gets a cycle
+func checkConcurrentReparent(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	const pairs = 20
+	parent := func(id int) *int { return &id }
+	var wg sync.WaitGroup
+	moved := make([][2]error, pairs)
+	added := make([][]*api.Federation, pairs)
+	for i := range added {
+		added[i] = add(t, repo, fmt.Sprintf("Owner %da", i), fmt.Sprintf("Owner %db", i))
+	}
+
+	// act
+	for i, pair := range added {
+		for j := range pair {
+			wg.Add(1)
+			go func(i, j int) {
+				defer wg.Done()
+				fed, other := added[i][j], added[i][1-j]
+				_, moved[i][j] = repo.UpdateFederation(context.Background(), &api.Federation{Id: fed.Id, Owner: fed.Owner, ParentId: parent(other.Id)})
+			}(i, j)
+		}
+	}
+	wg.Wait()
+
+	// assert
+	for i, pair := range added {
+		if moved[i][0] == nil && moved[i][1] == nil {
+			t.Fatalf("UpdateFederation(%d under %d, %d under %d) = both applied want one", pair[0].Id, pair[1].Id, pair[1].Id, pair[0].Id)
+		}
+
+		descendants, err := tools.Descendants(context.Background(), repo, pair[0].Id, 0)
+		if err != nil || len(descendants) > 1 {
+			t.Fatalf("Descendants(%d, 0) = %+v, %v want 1 federation at most", pair[0].Id, descendants, err)
+		}
+	}
+}
+
+// test UpdateFederation(federation) on different federations at once
+// should apply every write and record each in the history with its own id
+func checkConcurrentWrites(t *testing.T, repo tools.FederationRepository) {
+	// arrange
+	const workers, perWorker = 8, 10
+	owners := make([]string, workers)
+	for w := range owners {
+		owners[w] = fmt.Sprintf("worker %d", w)
+	}
+	added := ids(add(t, repo, owners...))
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+
+	// act
+	for w, id := range added {
+		wg.Add(1)
+		go func(w, id int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := repo.UpdateFederation(context.Background(), &api.Federation{Id: id, Owner: fmt.Sprintf("worker %d, write %d", w, i)}); err != nil {
+					errs <- err
+				}
+			}
+		}(w, id)
+	}
+	wg.Wait()
+	close(errs)
+
+	// assert
+	for err := range errs {
+		t.Fatalf("concurrent UpdateFederation() = %v want <nil>", err)
+	}
+
+	seen := map[int]bool{}
+	for _, id := range added {
+		page, err := repo.GetHistory(context.Background(), id, tools.HistoryQuery{Limit: tools.MaxPageLimit})
+		if err != nil || page.Total != perWorker+1 {
+			t.Fatalf("GetHistory(%d) = %+v, %v want %d changes", id, page, err, perWorker+1)
+		}
+		for _, change := range page.Changes {
+			if seen[change.Id] {
+				t.Fatalf("GetHistory(%d) = change id %d want ids unique across federations", id, change.Id)
+			}
+			seen[change.Id] = true
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package tools
+
+import (
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorest/api"
+)
+
+// SearchQuery finds the live federations whose owner contains Q, ignoring
+// case. Cursor, when set, selects a page after the first.
+type SearchQuery struct {
+	Q      string
+	Limit  int
+	Cursor string
+}
+
+// SearchPage is a page of search results, best matches first.
+type SearchPage struct {
+	Federations []*api.Federation
+	// Total counts every match.
+	Total int
+	// Next and Prev are cursors for the adjacent pages, empty at either end.
+	Next string
+	Prev string
+}
+
+// match ranks of search results, best first. ties are broken by id.
+const (
+	rankExact = iota
+	rankPrefix
+	rankWordPrefix
+	rankSubstring
+	rankNone
+)
+
+// searchRank says how well owner matches the lower case query q.
+func searchRank(owner, q string) int {
+	owner = strings.ToLower(owner)
+	i := strings.Index(owner, q)
+	switch {
+	case i < 0:
+		return rankNone
+	case owner == q:
+		return rankExact
+	case i == 0:
+		return rankPrefix
+	case strings.Contains(" "+owner, " "+q):
+		return rankWordPrefix
+	default:
+		return rankSubstring
+	}
+}
+
+// searchQuery is a validated SearchQuery.
+type searchQuery struct {
+	SearchQuery
+	// q is the lower case query.
+	q      string
+	offset int
+}
+
+// resolve validates q and fills in defaults. the cursor is the offset of
+// the page it selects.
+func (q SearchQuery) resolve() (*searchQuery, error) {
+	if strings.TrimSpace(q.Q) == "" {
+		return nil, invalidQuery("q", "is required")
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxPageLimit {
+		return nil, invalidQuery("limit", fmt.Sprintf("must be between 1 and %d", MaxPageLimit))
+	}
+
+	s := &searchQuery{SearchQuery: q, q: strings.ToLower(q.Q)}
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, invalidQuery("cursor", "is malformed")
+		}
+		if s.offset, err = strconv.Atoi(string(raw)); err != nil || s.offset < 0 {
+			return nil, invalidQuery("cursor", "is malformed")
+		}
+	}
+	return s, nil
+}
+
+func searchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// pageSearch ranks the candidates matching query and returns the page it
+// selects. candidates may hold federations that do not match.
+func pageSearch(candidates []*api.Federation, query SearchQuery) (*SearchPage, error) {
+	q, err := query.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		fed  *api.Federation
+		rank int
+	}
+	results := make([]result, 0, len(candidates))
+	for _, fed := range candidates {
+		if rank := searchRank(fed.Owner, q.q); rank != rankNone && fed.DeletedAt == nil {
+			results = append(results, result{fed, rank})
+		}
+	}
+	slices.SortFunc(results, func(a, b result) int {
+		return cmp.Or(cmp.Compare(a.rank, b.rank), cmp.Compare(a.fed.Id, b.fed.Id))
+	})
+
+	page := &SearchPage{Federations: []*api.Federation{}, Total: len(results)}
+	start := min(q.offset, len(results))
+	end := min(start+q.Limit, len(results))
+	for _, r := range results[start:end] {
+		page.Federations = append(page.Federations, r.fed)
+	}
+	if end < len(results) {
+		page.Next = searchCursor(end)
+	}
+	if start > 0 {
+		page.Prev = searchCursor(max(start-q.Limit, 0))
+	}
+	return page, nil
+}
+
+// maxGram is the length of the longest n-grams indexed. queries up to it
+// are answered by one lookup, longer ones by intersecting their maxGrams.
+const maxGram = 3
+
+// ownerGrams returns the distinct n-grams of the lower case owner, from
+// single characters up to maxGram.
+func ownerGrams(owner string) []string {
+	runes := []rune(strings.ToLower(owner))
+	seen := map[string]bool{}
+	var grams []string
+	for n := 1; n <= maxGram; n++ {
+		for i := 0; i+n <= len(runes); i++ {
+			gram := string(runes[i : i+n])
+			if !seen[gram] {
+				seen[gram] = true
+				grams = append(grams, gram)
+			}
+		}
+	}
+	return grams
+}
+
+// queryGrams returns the n-grams every owner containing the lower case
+// query q holds.
+func queryGrams(q string) []string {
+	runes := []rune(q)
+	if len(runes) <= maxGram {
+		return []string{q}
+	}
+	seen := map[string]bool{}
+	var grams []string
+	for i := 0; i+maxGram <= len(runes); i++ {
+		gram := string(runes[i : i+maxGram])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// ownerIndex maps the n-grams of the owners of live federations to their
+// ids. it is not safe for concurrent use.
+type ownerIndex struct {
+	grams map[string]map[int]struct{}
+	// owners holds the indexed owner of every id.
+	owners map[int]string
+}
+
+func newOwnerIndex() *ownerIndex {
+	return &ownerIndex{grams: map[string]map[int]struct{}{}, owners: map[int]string{}}
+}
+
+// put indexes fed, or drops it when it is deleted.
+func (ix *ownerIndex) put(fed *api.Federation) {
+	if owner, ok := ix.owners[fed.Id]; ok && owner == fed.Owner && fed.DeletedAt == nil {
+		return
+	}
+	ix.remove(fed.Id)
+	if fed.DeletedAt != nil {
+		return
+	}
+
+	ix.owners[fed.Id] = fed.Owner
+	for _, gram := range ownerGrams(fed.Owner) {
+		ids, ok := ix.grams[gram]
+		if !ok {
+			ids = map[int]struct{}{}
+			ix.grams[gram] = ids
+		}
+		ids[fed.Id] = struct{}{}
+	}
+}
+
+func (ix *ownerIndex) remove(id int) {
+	owner, ok := ix.owners[id]
+	if !ok {
+		return
+	}
+	delete(ix.owners, id)
+	for _, gram := range ownerGrams(owner) {
+		delete(ix.grams[gram], id)
+		if len(ix.grams[gram]) == 0 {
+			delete(ix.grams, gram)
+		}
+	}
+}
+
+// candidates returns the ids holding every n-gram of the lower case
+// query q. they still have to be checked against q.
+func (ix *ownerIndex) candidates(q string) []int {
+	grams := queryGrams(q)
+	// start from the rarest n-gram.
+	slices.SortFunc(grams, func(a, b string) int {
+		return cmp.Compare(len(ix.grams[a]), len(ix.grams[b]))
+	})
+
+	var ids []int
+	for id := range ix.grams[grams[0]] {
+		found := true
+		for _, gram := range grams[1:] {
+			if _, ok := ix.grams[gram][id]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
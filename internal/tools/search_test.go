@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// test searchRank(owner, q)
+// should prefer exact, then prefix, then word prefix, then substring matches
+func TestSearchRank(t *testing.T) {
+	// arrange
+	tests := []struct {
+		owner string
+		q     string
+		want  int
+	}{
+		{"Alice", "alice", rankExact},
+		{"Alice Cooper", "alice", rankPrefix},
+		{"Cooper, Alice", "alice", rankWordPrefix},
+		{"Bob Alice", "alice", rankWordPrefix},
+		{"Malice", "alice", rankSubstring},
+		{"Bob", "alice", rankNone},
+	}
+
+	for _, tt := range tests {
+		// act
+		got := searchRank(tt.owner, tt.q)
+
+		// assert
+		if got != tt.want {
+			t.Fatalf("searchRank(%q, %q) = %d want %d", tt.owner, tt.q, got, tt.want)
+		}
+	}
+}
+
+// test ownerIndex put, remove and candidates
+// should find the ids holding every n-gram of the query
+func TestOwnerIndex(t *testing.T) {
+	// arrange
+	sut := newOwnerIndex()
+	sut.put(&api.Federation{Id: 1, Owner: "Alice"})
+	sut.put(&api.Federation{Id: 2, Owner: "Malice"})
+	sut.put(&api.Federation{Id: 3, Owner: "Bob"})
+	sut.put(&api.Federation{Id: 3, Owner: "Älicia"})
+	sut.put(&api.Federation{Id: 4, Owner: "alice", DeletedAt: new(time.Time)})
+	sut.put(&api.Federation{Id: 2, Owner: "Malice", DeletedAt: new(time.Time)})
+	sut.put(&api.Federation{Id: 2, Owner: "Malice"})
+	sut.remove(1)
+	sut.put(&api.Federation{Id: 1, Owner: "Alice"})
+	tests := []struct {
+		q    string
+		want []int
+	}{
+		{"alice", []int{1, 2}},
+		{"lic", []int{1, 2, 3}},
+		{"ä", []int{3}},
+		{"bob", nil},
+		{"alicx", nil},
+	}
+
+	for _, tt := range tests {
+		// act
+		got := sut.candidates(tt.q)
+		slices.Sort(got)
+
+		// assert
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("candidates(%q) = %v want %v", tt.q, got, tt.want)
+		}
+	}
+
+	if _, ok := sut.grams["bob"]; ok {
+		t.Fatalf("grams[bob] = present want dropped with the old owner")
+	}
+}
+
+// test pageSearch(candidates, query) with invalid queries
+// should return ErrValidation
+func TestPageSearchInvalid(t *testing.T) {
+	// arrange
+	queries := []SearchQuery{
+		{},
+		{Q: "a", Limit: MaxPageLimit + 1},
+		{Q: "a", Limit: -1},
+		{Q: "a", Cursor: "%%"},
+		{Q: "a", Cursor: searchCursor(-1)},
+	}
+
+	for _, query := range queries {
+		// act
+		_, err := pageSearch(nil, query)
+
+		// assert
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("pageSearch(%+v) = %v want %v", query, err, ErrValidation)
+		}
+	}
+}
+
+// test Setup() on a database created before the owner index
+// should index the owners of the live federations
+func TestSqlDbIndexesExistingOwners(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	db, _ := sql.Open("fakesql", t.Name())
+	if err := migrate(ctx, db, func(query string) string { return query }, federationMigrations[:5]); err != nil {
+		t.Fatalf("migrate(v5) = %v want <nil>", err)
+	}
+	insert := `INSERT INTO federations (id, owner, version, deleted_at) VALUES (?, ?, ?, ?)`
+	db.ExecContext(ctx, insert, 1, "Alice", 1, nil)
+	db.ExecContext(ctx, insert, 2, "Alicia", 2, time.Now())
+	db.Close()
+	sut, _ := openSqlDb(t, "")
+
+	// act
+	page, err := sut.SearchFederations(ctx, SearchQuery{Q: "ali"})
+
+	// assert
+	if err != nil || page.Total != 1 || page.Federations[0].Id != 1 {
+		t.Fatalf("SearchFederations(ali) = %+v, %v want federation 1", page, err)
+	}
+}
+
+// test SearchFederations(query) on a reopened fileDb
+// should rebuild the owner index from the snapshot and the log
+func TestFileDbRecoversOwnerIndex(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	dir := t.TempDir()
+	db := newFileDb(dir, 2, &api.Federation{Id: 1, Owner: "Alice"})
+	db.Setup(ctx)
+	db.AddFederation(ctx, &api.Federation{Id: 2, Owner: "Malice"})
+	db.AddFederation(ctx, &api.Federation{Id: 3, Owner: "Alicia"})
+	db.UpdateFederation(ctx, &api.Federation{Id: 1, Owner: "Bob"})
+	db.Close()
+	sut := newFileDb(dir, 2)
+	sut.Setup(ctx)
+	defer sut.Close()
+
+	// act
+	page, err := sut.SearchFederations(ctx, SearchQuery{Q: "ALI"})
+
+	// assert
+	if got := searchIds(page); err != nil || !reflect.DeepEqual(got, []int{3, 2}) {
+		t.Fatalf("SearchFederations(ALI) = %v, %v want [3 2]", got, err)
+	}
+}
+
+func searchIds(page *SearchPage) []int {
+	if page == nil {
+		return nil
+	}
+	ids := make([]int, len(page.Federations))
+	for i, fed := range page.Federations {
+		ids[i] = fed.Id
+	}
+	return ids
+}
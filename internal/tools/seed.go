@@ -0,0 +1,247 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gorest/api"
+)
+
+// seed modes, selectable through Config.SeedMode. they say what happens
+// to seed records whose id is already stored.
+const (
+	SeedSkip   = "skip"
+	SeedUpsert = "upsert"
+)
+
+// SeedPrincipal is recorded in the history of changes made by seeding.
+const SeedPrincipal = "seed"
+
+// SeedRecord is a federation read from a seed file.
+type SeedRecord struct {
+	// Line is where the record starts in the file, counting from 1.
+	Line       int
+	Federation *api.Federation
+}
+
+// SeedError is a problem with the record starting at Line.
+// it unwraps to the underlying error.
+type SeedError struct {
+	Line int
+	Err  error
+}
+
+func (e *SeedError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *SeedError) Unwrap() error {
+	return e.Err
+}
+
+// SeedReport counts what Seed did with the records.
+type SeedReport struct {
+	Added   int
+	Updated int
+	Skipped int
+}
+
+// ReadSeedFile reads the seed records of the file at path, see ParseSeed.
+func ReadSeedFile(path string) ([]SeedRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("seed: %w", err)
+	}
+	records, err := ParseSeed(data)
+	if err != nil {
+		return nil, fmt.Errorf("seed %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// ParseSeed reads seed records from a JSON array of federations or from
+// NDJSON, one federation per line. every record must have a positive id,
+// an owner and no fields maintained by the repository. the error joins a
+// SeedError for every invalid or duplicated record.
+func ParseSeed(data []byte) ([]SeedRecord, error) {
+	var records []SeedRecord
+	var err error
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		records, err = parseSeedArray(data)
+	} else {
+		records, err = parseSeedLines(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	first := map[int]int{}
+	for _, record := range records {
+		if err := validateSeed(record.Federation); err != nil {
+			errs = append(errs, &SeedError{Line: record.Line, Err: err})
+			continue
+		}
+		if line, ok := first[record.Federation.Id]; ok {
+			errs = append(errs, &SeedError{Line: record.Line, Err: fmt.Errorf("%w: id %d is already seeded on line %d", ErrValidation, record.Federation.Id, line)})
+			continue
+		}
+		first[record.Federation.Id] = record.Line
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return records, nil
+}
+
+// parseSeedArray reads the federations of a JSON array.
+func parseSeedArray(data []byte) ([]SeedRecord, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if _, err := dec.Token(); err != nil {
+		return nil, &SeedError{Line: 1, Err: err}
+	}
+
+	var records []SeedRecord
+	for dec.More() {
+		line := lineAt(data, nextValue(data, dec.InputOffset()))
+		var fed api.Federation
+		if err := dec.Decode(&fed); err != nil {
+			return nil, &SeedError{Line: line, Err: fmt.Errorf("%w: %w", ErrValidation, err)}
+		}
+		records = append(records, SeedRecord{Line: line, Federation: &fed})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, &SeedError{Line: lineAt(data, len(data)), Err: err}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &SeedError{Line: lineAt(data, int(dec.InputOffset())), Err: fmt.Errorf("%w: data after the array", ErrValidation)}
+	}
+	return records, nil
+}
+
+// parseSeedLines reads one federation per non-blank line.
+func parseSeedLines(data []byte) ([]SeedRecord, error) {
+	var records []SeedRecord
+	for i, raw := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var fed api.Federation
+		if err := dec.Decode(&fed); err != nil {
+			return nil, &SeedError{Line: i + 1, Err: fmt.Errorf("%w: %w", ErrValidation, err)}
+		}
+		if dec.More() {
+			return nil, &SeedError{Line: i + 1, Err: fmt.Errorf("%w: more than one federation on the line", ErrValidation)}
+		}
+		records = append(records, SeedRecord{Line: i + 1, Federation: &fed})
+	}
+	return records, nil
+}
+
+// nextValue returns the offset of the array element following offset,
+// skipping whitespace and the comma separating elements.
+func nextValue(data []byte, offset int64) int {
+	i := int(offset)
+	for i < len(data) && bytes.IndexByte([]byte(" \t\r\n,"), data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// lineAt returns the line of data holding offset, counting from 1.
+func lineAt(data []byte, offset int) int {
+	return bytes.Count(data[:min(offset, len(data))], []byte("\n")) + 1
+}
+
+// validateSeed checks a seed federation.
+func validateSeed(fed *api.Federation) error {
+	switch {
+	case fed.Id <= 0:
+		return &ValidationError{Field: "id", Message: "must be positive"}
+	case fed.Owner == "":
+		return &ValidationError{Field: "owner", Message: "is required"}
+	case fed.Version != 0:
+		return &ValidationError{Field: "version", Message: "is maintained by the repository"}
+	case fed.DeletedAt != nil:
+		return &ValidationError{Field: "deleted_at", Message: "is maintained by the repository"}
+	case fed.State != "":
+		return &ValidationError{Field: "state", Message: "is maintained by the repository"}
+	case fed.StateChangedAt != nil:
+		return &ValidationError{Field: "state_changed_at", Message: "is maintained by the repository"}
+	case fed.CreatedAt != nil:
+		return &ValidationError{Field: "created_at", Message: "is maintained by the repository"}
+	case fed.UpdatedAt != nil:
+		return &ValidationError{Field: "updated_at", Message: "is maintained by the repository"}
+	}
+	return validateStruct(fed)
+}
+
+// Seed adds the records to repo. records whose id is stored are skipped
+// or, in SeedUpsert mode, overwrite the stored federation when they
+// differ from it. deleted federations are always skipped. Seed stops at
+// the first record it fails to store, the records before it stay stored.
+func Seed(ctx context.Context, repo FederationRepository, records []SeedRecord, mode string) (SeedReport, error) {
+	var report SeedReport
+	importMode := ImportSkip
+	switch mode {
+	case SeedSkip:
+	case SeedUpsert:
+		importMode = ImportOverwrite
+	default:
+		return report, &ValidationError{Field: "seed mode", Message: fmt.Sprintf("must be %s or %s", SeedSkip, SeedUpsert)}
+	}
+	ctx = WithPrincipal(ctx, SeedPrincipal)
+
+	for _, record := range records {
+		outcome, err := ImportFederation(ctx, repo, record.Federation, importMode, false)
+		switch {
+		case errors.Is(err, ErrAlreadyExists):
+			// the stored federation is deleted. other conflicts, like a
+			// concurrent write, fail the seed.
+			report.Skipped++
+		case err != nil:
+			return report, &SeedError{Line: record.Line, Err: err}
+		case outcome == ImportCreated:
+			report.Added++
+		case outcome == ImportUpdated:
+			report.Updated++
+		default:
+			report.Skipped++
+		}
+	}
+	return report, nil
+}
+
+// seededRepository seeds the repository it wraps during Setup. Setup may
+// be retried, so seeding must leave seeded data unchanged.
+type seededRepository struct {
+	FederationRepository
+	records []SeedRecord
+	mode    string
+}
+
+// Unwrap returns the seeded repository.
+func (s *seededRepository) Unwrap() FederationRepository {
+	return s.FederationRepository
+}
+
+func (s *seededRepository) Setup(ctx context.Context) error {
+	if err := s.FederationRepository.Setup(ctx); err != nil {
+		return err
+	}
+
+	report, err := Seed(ctx, s.FederationRepository, s.records, s.mode)
+	if err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+	InfoLogger.Printf("seeded %d federations: %d added, %d updated, %d skipped\n", len(s.records), report.Added, report.Updated, report.Skipped)
+	return nil
+}
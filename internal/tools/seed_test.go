@@ -0,0 +1,219 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorest/api"
+)
+
+// seedLines returns the lines of records.
+func seedLines(records []SeedRecord) []int {
+	lines := make([]int, len(records))
+	for i, record := range records {
+		lines[i] = record.Line
+	}
+	return lines
+}
+
+// seedErrorLines returns the lines of the SeedErrors joined in err.
+func seedErrorLines(err error) []int {
+	var lines []int
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return lines
+	}
+	for _, err := range joined.Unwrap() {
+		var seedErr *SeedError
+		if errors.As(err, &seedErr) {
+			lines = append(lines, seedErr.Line)
+		}
+	}
+	return lines
+}
+
+// test ParseSeed(data) with a JSON array and with NDJSON
+// should return the federations with the line they start on
+func TestParseSeed(t *testing.T) {
+	// arrange
+	tests := []struct {
+		data      string
+		wantLines []int
+	}{
+		{"[\n  {\"id\": 1, \"owner\": \"Owner 1\"},\n\n  {\n    \"id\": 2,\n    \"owner\": \"Owner 2\"\n  }\n]\n", []int{2, 4}},
+		{"{\"id\":1,\"owner\":\"Owner 1\"}\n\n{\"id\":2,\"owner\":\"Owner 2\"}\n", []int{1, 3}},
+		{"", nil},
+	}
+	wantFederations := []*api.Federation{{Id: 1, Owner: "Owner 1"}, {Id: 2, Owner: "Owner 2"}}
+
+	for _, tt := range tests {
+		// act
+		records, err := ParseSeed([]byte(tt.data))
+
+		// assert
+		if err != nil {
+			t.Fatalf("ParseSeed(%q) = %v want <nil>", tt.data, err)
+		}
+
+		if lines := seedLines(records); len(lines) != len(tt.wantLines) || len(lines) > 0 && !reflect.DeepEqual(lines, tt.wantLines) {
+			t.Fatalf("ParseSeed(%q) lines = %v want %v", tt.data, lines, tt.wantLines)
+		}
+
+		for i, record := range records {
+			if !reflect.DeepEqual(record.Federation, wantFederations[i]) {
+				t.Fatalf("ParseSeed(%q)[%d] = %v want %v", tt.data, i, record.Federation, wantFederations[i])
+			}
+		}
+	}
+}
+
+// test ParseSeed(data) with invalid and duplicated records
+// should report every one of them with its line
+func TestParseSeedInvalid(t *testing.T) {
+	// arrange
+	data := `{"id":1,"owner":"Owner 1"}
+{"id":0,"owner":"Owner 0"}
+{"id":2}
+{"id":1,"owner":"Owner 1 again"}
+{"id":3,"owner":"Owner 3","version":4}
+{"id":4,"owner":"Owner 4"}`
+	wantLines := []int{2, 3, 4, 5}
+
+	// act
+	records, err := ParseSeed([]byte(data))
+
+	// assert
+	if records != nil || !errors.Is(err, ErrValidation) {
+		t.Fatalf("ParseSeed(data) = %v, %v want <nil>, %v", records, err, ErrValidation)
+	}
+
+	if lines := seedErrorLines(err); !reflect.DeepEqual(lines, wantLines) {
+		t.Fatalf("ParseSeed(data) error lines = %v want %v: %v", lines, wantLines, err)
+	}
+}
+
+// test ParseSeed(data) with malformed JSON
+// should report the line of the malformed record
+func TestParseSeedMalformed(t *testing.T) {
+	// arrange
+	tests := []struct {
+		data     string
+		wantLine int
+	}{
+		{"{\"id\":1,\"owner\":\"Owner 1\"}\n{\"id\":2,\n", 2},
+		{"{\"id\":1,\"owner\":\"Owner 1\",\"color\":\"red\"}\n", 1},
+		{"[\n{\"id\":1,\"owner\":\"Owner 1\"},\n{\"id\":\"two\"}\n]", 3},
+		{"[\n{\"id\":1,\"owner\":\"Owner 1\"}\n]\n{}", 4},
+	}
+
+	for _, tt := range tests {
+		// act
+		_, err := ParseSeed([]byte(tt.data))
+
+		// assert
+		var seedErr *SeedError
+		if !errors.As(err, &seedErr) || seedErr.Line != tt.wantLine {
+			t.Fatalf("ParseSeed(%q) = %v want an error on line %d", tt.data, err, tt.wantLine)
+		}
+	}
+}
+
+// test Seed(ctx, repo, records, mode) with stored federations
+// should skip or update them according to the mode
+func TestSeed(t *testing.T) {
+	// arrange
+	records := []SeedRecord{
+		{Line: 1, Federation: &api.Federation{Id: 1, Owner: "Seeded 1"}},
+		{Line: 2, Federation: &api.Federation{Id: 2, Owner: "Owner 2"}},
+		{Line: 3, Federation: &api.Federation{Id: 3, Owner: "Seeded 3"}},
+		{Line: 4, Federation: &api.Federation{Id: 4, Owner: "Seeded 4"}},
+	}
+	tests := []struct {
+		mode       string
+		wantReport SeedReport
+		wantOwner  string
+	}{
+		{SeedSkip, SeedReport{Added: 1, Skipped: 3}, "Owner 1"},
+		{SeedUpsert, SeedReport{Added: 1, Updated: 1, Skipped: 2}, "Seeded 1"},
+	}
+
+	for _, tt := range tests {
+		sut := newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"}, &api.Federation{Id: 4, Owner: "Owner 4"})
+		sut.DeleteFederation(context.Background(), 4, 0)
+
+		// act
+		report, err := Seed(context.Background(), sut, records, tt.mode)
+		again, _ := Seed(context.Background(), sut, records, tt.mode)
+
+		// assert
+		if err != nil || report != tt.wantReport {
+			t.Fatalf("Seed(%s) = %+v, %v want %+v", tt.mode, report, err, tt.wantReport)
+		}
+
+		if again != (SeedReport{Skipped: len(records)}) {
+			t.Fatalf("Seed(%s) again = %+v want every record skipped", tt.mode, again)
+		}
+
+		if fed, _ := sut.GetFederation(context.Background(), 1); fed.Owner != tt.wantOwner {
+			t.Fatalf("GetFederation(1) = %v want %s", fed, tt.wantOwner)
+		}
+
+		if changes, _ := sut.GetHistory(context.Background(), 3, HistoryQuery{}); changes.Changes[0].Principal != SeedPrincipal {
+			t.Fatalf("GetHistory(3)[0].Principal = %s want %s", changes.Changes[0].Principal, SeedPrincipal)
+		}
+	}
+}
+
+// test Seed(ctx, repo, records, mode) with a failing repository
+// should stop and report the line of the failing record
+func TestSeedError(t *testing.T) {
+	// arrange
+	records := []SeedRecord{
+		{Line: 1, Federation: &api.Federation{Id: 1, Owner: "Owner 1"}},
+		{Line: 2, Federation: &api.Federation{Id: 2, Owner: "Owner 2"}},
+	}
+	sut := NewFaultInjector(newMockDb(), FaultConfig{AnyMethod: {ErrorRate: 1}}, 1)
+
+	// act
+	report, err := Seed(context.Background(), sut, records, SeedSkip)
+	_, modeErr := Seed(context.Background(), newMockDb(), records, "merge")
+
+	// assert
+	var seedErr *SeedError
+	if !errors.As(err, &seedErr) || seedErr.Line != 1 || !errors.Is(err, ErrInjectedFault) || report != (SeedReport{}) {
+		t.Fatalf("Seed(failing repository) = %+v, %v want a fault on line 1", report, err)
+	}
+
+	if !errors.Is(modeErr, ErrValidation) {
+		t.Fatalf("Seed(merge) = %v want %v", modeErr, ErrValidation)
+	}
+}
+
+// conflictingRepository fails every update with ErrConflict, like a
+// concurrent write would.
+type conflictingRepository struct {
+	FederationRepository
+}
+
+func (r conflictingRepository) UpdateFederation(_ context.Context, federation *api.Federation) (*api.Federation, error) {
+	return nil, &FederationError{Id: federation.Id, Err: ErrConflict}
+}
+
+// test Seed(ctx, repo, records, SeedUpsert) with updates failing on a conflict
+// should stop and report the conflict instead of skipping the record
+func TestSeedConflict(t *testing.T) {
+	// arrange
+	records := []SeedRecord{{Line: 1, Federation: &api.Federation{Id: 1, Owner: "Seeded 1"}}}
+	sut := conflictingRepository{newMockDb(&api.Federation{Id: 1, Owner: "Owner 1"})}
+
+	// act
+	report, err := Seed(context.Background(), sut, records, SeedUpsert)
+
+	// assert
+	var seedErr *SeedError
+	if !errors.As(err, &seedErr) || seedErr.Line != 1 || !errors.Is(err, ErrConflict) || report != (SeedReport{}) {
+		t.Fatalf("Seed(conflicting repository) = %+v, %v want a conflict on line 1", report, err)
+	}
+}
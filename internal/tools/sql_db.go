@@ -0,0 +1,1110 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorest/api"
+)
+
+// placeholder styles understood by sqlDb.
+const (
+	PlaceholderQuestion = "question" // ?, used by mysql and sqlite drivers
+	PlaceholderDollar   = "dollar"   // $1, used by postgres drivers
+)
+
+// sqlDb is a FederationRepository backed by database/sql.
+// queries are written in standard SQL with ? placeholders and rebound to
+// the driver's placeholder style, so any driver registered with
+// database/sql can be used.
+type sqlDb struct {
+	driver      string
+	dsn         string
+	placeholder string
+
+	ids IdGenerator
+	// deletePolicy says what happens to the live children of deleted
+	// federations, see DeleteRestrict.
+	deletePolicy string
+	// dependents drop their data of deleted federations.
+	dependents
+
+	mu sync.Mutex
+	db *sql.DB
+}
+
+// federationColumns are the columns read by scanFederation, in order.
+const federationColumns = `id, owner, version, deleted_at, name, description, labels, created_at, updated_at, state, state_changed_at, parent_id`
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanFederation reads a row selected with federationColumns. the labels
+// are stored as JSON.
+func scanFederation(row scanner) (*api.Federation, error) {
+	fed := new(api.Federation)
+	var deletedAt, createdAt, updatedAt, stateChangedAt sql.NullTime
+	var labels, state sql.NullString
+	var parentId sql.NullInt64
+	if err := row.Scan(&fed.Id, &fed.Owner, &fed.Version, &deletedAt, &fed.Name, &fed.Description, &labels, &createdAt, &updatedAt, &state, &stateChangedAt, &parentId); err != nil {
+		return nil, err
+	}
+	if parentId.Valid {
+		id := int(parentId.Int64)
+		fed.ParentId = &id
+	}
+	fed.DeletedAt = nullTime(deletedAt)
+	fed.CreatedAt = nullTime(createdAt)
+	fed.UpdatedAt = nullTime(updatedAt)
+	fed.State = state.String
+	fed.StateChangedAt = nullTime(stateChangedAt)
+	if labels.Valid && labels.String != "" {
+		if err := json.Unmarshal([]byte(labels.String), &fed.Labels); err != nil {
+			return nil, fmt.Errorf("corrupt labels of federation %d: %w", fed.Id, err)
+		}
+	}
+	return fed, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// stateColumn returns the state column of fed, NULL for federations
+// stored before states existed.
+func stateColumn(fed *api.Federation) sql.NullString {
+	return sql.NullString{String: fed.State, Valid: fed.State != ""}
+}
+
+// parentColumn returns the parent_id column of fed, NULL at the top.
+func parentColumn(fed *api.Federation) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(parentOf(fed)), Valid: fed.ParentId != nil}
+}
+
+// labelsColumn returns the labels column of fed, NULL without labels.
+func labelsColumn(fed *api.Federation) (sql.NullString, error) {
+	if len(fed.Labels) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(fed.Labels)
+	return sql.NullString{String: string(data), Valid: true}, err
+}
+
+// NewSqlDb returns a FederationRepository that stores federations in the
+// database identified by driver and dsn. the driver must be registered by
+// the program, usually with a blank import.
+func NewSqlDb(driver, dsn, placeholder string) FederationRepository {
+	return newSqlDb(driver, dsn, placeholder)
+}
+
+func newSqlDb(driver, dsn, placeholder string) *sqlDb {
+	if placeholder == "" {
+		placeholder = PlaceholderQuestion
+	}
+
+	return &sqlDb{driver: driver, dsn: dsn, placeholder: placeholder, ids: NewSequenceIds(), deletePolicy: DeleteRestrict}
+}
+
+// Setup opens the database and applies pending migrations.
+// it is safe to call more than once.
+func (s *sqlDb) Setup(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db != nil {
+		return nil
+	}
+
+	db, err := sql.Open(s.driver, s.dsn)
+	if err != nil {
+		return err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return err
+	}
+
+	if err := migrate(ctx, db, s.bind, federationMigrations); err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+	return nil
+}
+
+// Close closes the database.
+func (s *sqlDb) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// conn returns the open database or errRepositoryClosed.
+func (s *sqlDb) conn() (*sql.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return nil, errRepositoryClosed
+	}
+	return s.db, nil
+}
+
+// bind rewrites ? placeholders to the configured style.
+func (s *sqlDb) bind(query string) string {
+	if s.placeholder != PlaceholderDollar {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// setIdGenerator implements idAssigner.
+func (s *sqlDb) setIdGenerator(ids IdGenerator) {
+	s.ids = ids
+}
+
+// setDeletePolicy implements deletePolicer.
+func (s *sqlDb) setDeletePolicy(policy string) {
+	s.deletePolicy = policy
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a transaction that is committed when fn succeeds.
+func (s *sqlDb) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	db, err := s.conn()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return sqlError(tx.Commit())
+}
+
+// deleteTx runs fn like inTx and, once the transaction commits, tells the
+// dependents about the federations fn adds to deleted.
+func (s *sqlDb) deleteTx(ctx context.Context, fn func(tx *sql.Tx, deleted *[]int) error) error {
+	var deleted []int
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(tx, &deleted)
+	})
+	if err != nil {
+		return err
+	}
+	s.dependents.removeFederations(deleted)
+	return nil
+}
+
+// AddFederation inserts federation and returns the stored row. a zero id is
+// replaced by one from the id generator, retrying when a concurrent insert
+// takes it first.
+func (s *sqlDb) AddFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	var fed *api.Federation
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		fed, err = s.add(ctx, tx, federation)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fed, nil
+}
+
+// add implements AddFederation on q.
+func (s *sqlDb) add(ctx context.Context, q querier, federation *api.Federation) (*api.Federation, error) {
+	if err := validateFederation(federation); err != nil {
+		return nil, err
+	}
+
+	fed := copyFederation(federation)
+	fed.Version = firstVersion
+	fed.State = StateDraft
+	fed.DeletedAt = nil
+	stampCreated(fed)
+	if err := checkParent(nil, fed, s.lookup(ctx, q)); err != nil {
+		return nil, err
+	}
+	var err error
+	if fed.Id != 0 {
+		err = s.insert(ctx, q, fed)
+	} else {
+		err = s.insertWithFreeId(ctx, q, fed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.record(ctx, q, ChangeCreate, nil, fed); err != nil {
+		return nil, err
+	}
+	if err := s.reindex(ctx, q, nil, fed); err != nil {
+		return nil, err
+	}
+	if err := s.relabel(ctx, q, nil, fed); err != nil {
+		return nil, err
+	}
+	return fed, nil
+}
+
+// insertWithFreeId inserts federation with an id from the id generator.
+// the candidate is claimed on the federations sequence first, so
+// concurrent inserts never pick the same one and purged ids are not
+// handed out again.
+func (s *sqlDb) insertWithFreeId(ctx context.Context, q querier, federation *api.Federation) error {
+	for i := 0; i < maxIdAttempts; i++ {
+		last, err := s.lastValue(ctx, q, federationsSequence)
+		if err != nil {
+			return err
+		}
+
+		if federation.Id = s.ids.NextId(last); federation.Id <= 0 {
+			continue
+		}
+		claimed, err := s.claimValue(ctx, q, federationsSequence, last, max(last, federation.Id))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		err = s.insert(ctx, q, federation)
+		if !errors.Is(err, ErrAlreadyExists) {
+			return err
+		}
+	}
+	return noFreeId()
+}
+
+// insert writes federation as a new row.
+func (s *sqlDb) insert(ctx context.Context, q querier, federation *api.Federation) error {
+	// some drivers abort the transaction on a key violation, so look for
+	// the row first.
+	if exists, err := s.exists(ctx, q, federation.Id); err != nil {
+		return sqlError(err)
+	} else if exists {
+		return alreadyExists(federation.Id)
+	}
+
+	labels, err := labelsColumn(federation)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, s.bind(`INSERT INTO federations (`+federationColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		federation.Id, federation.Owner, federation.Version, federation.DeletedAt, federation.Name, federation.Description, labels, federation.CreatedAt, federation.UpdatedAt,
+		stateColumn(federation), federation.StateChangedAt, parentColumn(federation))
+	if err != nil {
+		// drivers report key violations differently, so check for the row.
+		if exists, existsErr := s.exists(ctx, q, federation.Id); existsErr == nil && exists {
+			return alreadyExists(federation.Id)
+		}
+		return sqlError(err)
+	}
+	// ids sent by clients move the sequence too, like mockDb.lastId.
+	return s.advanceValue(ctx, q, federationsSequence, federation.Id)
+}
+
+// names of the federation_sequences rows.
+const (
+	// federationsSequence is the largest federation id ever stored.
+	federationsSequence = "federations"
+	// historySequence is the id of the latest history row.
+	historySequence = "federation_history"
+	// hierarchySequence counts the writes moving a federation under a
+	// parent. they bump it before walking the ancestors, so its row lock
+	// makes them take turns: two concurrent moves would each see the
+	// hierarchy without the other and could close a cycle.
+	hierarchySequence = "federation_hierarchy"
+)
+
+// lastValue returns the current value of the sequence name.
+func (s *sqlDb) lastValue(ctx context.Context, q querier, name string) (int, error) {
+	var last int
+	if err := q.QueryRowContext(ctx, s.bind(`SELECT value FROM federation_sequences WHERE name = ?`), name).Scan(&last); err != nil {
+		return 0, sqlError(err)
+	}
+	return last, nil
+}
+
+// claimValue moves the sequence name from last to next. it reports false
+// when another writer moved it since last was read.
+func (s *sqlDb) claimValue(ctx context.Context, q querier, name string, last, next int) (bool, error) {
+	res, err := q.ExecContext(ctx, s.bind(`UPDATE federation_sequences SET value = ? WHERE name = ? AND value = ?`), next, name, last)
+	if err != nil {
+		return false, sqlError(err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, sqlError(err)
+}
+
+// nextValue moves the sequence name on by one and returns it. the update
+// locks the row until the transaction ends, so concurrent writers take
+// turns instead of reading the same value.
+func (s *sqlDb) nextValue(ctx context.Context, q querier, name string) (int, error) {
+	if _, err := q.ExecContext(ctx, s.bind(`UPDATE federation_sequences SET value = value + 1 WHERE name = ?`), name); err != nil {
+		return 0, sqlError(err)
+	}
+	return s.lastValue(ctx, q, name)
+}
+
+// advanceValue moves the sequence name up to value, it never goes back.
+func (s *sqlDb) advanceValue(ctx context.Context, q querier, name string, value int) error {
+	_, err := q.ExecContext(ctx, s.bind(`UPDATE federation_sequences SET value = ? WHERE name = ? AND value < ?`), value, name, value)
+	return sqlError(err)
+}
+
+func (s *sqlDb) GetFederation(ctx context.Context, id int) (*api.Federation, error) {
+	db, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	fed, err := scanFederation(db.QueryRowContext(ctx, s.bind(`SELECT `+federationColumns+` FROM federations WHERE id = ? AND deleted_at IS NULL`), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notFound(id)
+		}
+		return nil, sqlError(err)
+	}
+
+	return fed, nil
+}
+
+func (s *sqlDb) GetFederations(ctx context.Context, query FederationQuery) (*FederationPage, error) {
+	p, err := query.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	filters, args := p.sqlFilters()
+	var total int
+	if err := db.QueryRowContext(ctx, s.bind(`SELECT COUNT(*) FROM federations`+sqlWhere(filters)), args...).Scan(&total); err != nil {
+		return nil, sqlError(err)
+	}
+
+	conditions, pageArgs := filters, args
+	if p.at != nil {
+		keyset, keysetArgs := p.sqlKeyset(*p.at)
+		conditions = append(slices.Clip(filters), keyset)
+		pageArgs = append(slices.Clip(args), keysetArgs...)
+	}
+	before := p.at != nil && p.at.before
+	rows, err := db.QueryContext(ctx, s.bind(`SELECT `+federationColumns+` FROM federations`+sqlWhere(conditions)+p.sqlOrder(before)+` LIMIT ? OFFSET ?`),
+		append(pageArgs, p.Limit, p.Offset)...)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	federations, err := scanFederations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if before {
+		slices.Reverse(federations)
+	}
+
+	if len(federations) == 0 {
+		return p.page(federations, total, false, false), nil
+	}
+	hasPrev, err := s.hasRows(ctx, db, p, filters, args, p.positionOf(federations[0], true))
+	if err != nil {
+		return nil, err
+	}
+	hasNext, err := s.hasRows(ctx, db, p, filters, args, p.positionOf(federations[len(federations)-1], false))
+	if err != nil {
+		return nil, err
+	}
+
+	return p.page(federations, total, hasPrev, hasNext), nil
+}
+
+// hasRows reports whether any federation passing filters lies past at.
+func (s *sqlDb) hasRows(ctx context.Context, db *sql.DB, p *pageQuery, filters []string, args []any, at position) (bool, error) {
+	keyset, keysetArgs := p.sqlKeyset(at)
+	query := `SELECT id FROM federations` + sqlWhere(append(slices.Clip(filters), keyset)) + ` LIMIT 1`
+
+	var id int
+	err := db.QueryRowContext(ctx, s.bind(query), append(slices.Clip(args), keysetArgs...)...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, sqlError(err)
+}
+
+// scanFederations reads every row of rows and closes it.
+func scanFederations(rows *sql.Rows) ([]*api.Federation, error) {
+	defer rows.Close()
+
+	federations := []*api.Federation{}
+	for rows.Next() {
+		fed, err := scanFederation(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		federations = append(federations, fed)
+	}
+
+	return federations, sqlError(rows.Err())
+}
+
+// UpdateFederation changes the owner of a stored federation and returns
+// the new state. federation.Version is the version expected in storage.
+func (s *sqlDb) UpdateFederation(ctx context.Context, federation *api.Federation) (*api.Federation, error) {
+	return s.modify(ctx, ChangeUpdate, federation.Id, federation.Version, false, updateFields(federation))
+}
+
+// PatchFederation applies patch to a live federation and returns the
+// new state.
+func (s *sqlDb) PatchFederation(ctx context.Context, id int, version int, patch FederationPatch) (*api.Federation, error) {
+	return s.modify(ctx, ChangePatch, id, version, false, applyPatch(patch))
+}
+
+// DeleteFederation marks the federation as deleted and applies the delete
+// policy to its live children.
+func (s *sqlDb) DeleteFederation(ctx context.Context, id int, version int) error {
+	return s.deleteTx(ctx, func(tx *sql.Tx, deleted *[]int) error {
+		_, err := s.deleteIn(ctx, tx, id, version, deleted)
+		return err
+	})
+}
+
+// deleteIn implements DeleteFederation on q, adding the ids of the
+// federations it deletes to deleted.
+func (s *sqlDb) deleteIn(ctx context.Context, q querier, id int, version int, deleted *[]int) (*api.Federation, error) {
+	rows, err := q.QueryContext(ctx, s.bind(`SELECT id FROM federations WHERE parent_id = ? AND deleted_at IS NULL ORDER BY id`), id)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	children, err := scanIds(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) > 0 && s.deletePolicy == DeleteRestrict {
+		return nil, hasChildren(id, len(children))
+	}
+
+	fed, err := s.modifyIn(ctx, q, ChangeDelete, id, version, false, markDeleted)
+	if err != nil {
+		return nil, err
+	}
+	*deleted = append(*deleted, id)
+	for _, childId := range children {
+		// a parent cycle, which only concurrent writes could leave behind,
+		// leads back to a federation deleted already.
+		if slices.Contains(*deleted, childId.(int)) {
+			continue
+		}
+		if s.deletePolicy == DeleteCascade {
+			_, err = s.deleteIn(ctx, q, childId.(int), 0, deleted)
+		} else {
+			_, err = s.modifyIn(ctx, q, ChangeOrphan, childId.(int), 0, false, orphanOf(id))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fed, nil
+}
+
+// RestoreFederation undoes the deletion of a federation and returns it.
+func (s *sqlDb) RestoreFederation(ctx context.Context, id int, version int) (*api.Federation, error) {
+	return s.modify(ctx, ChangeRestore, id, version, true, unmarkDeleted)
+}
+
+// TransitionFederation runs a lifecycle action on a live federation and
+// returns the new state.
+func (s *sqlDb) TransitionFederation(ctx context.Context, id int, version int, action string) (*api.Federation, error) {
+	return s.modify(ctx, action, id, version, false, applyTransition(action))
+}
+
+// modify runs modifyIn in its own transaction.
+func (s *sqlDb) modify(ctx context.Context, op string, id int, version int, deleted bool, change func(*api.Federation) error) (*api.Federation, error) {
+	var fed *api.Federation
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		fed, err = s.modifyIn(ctx, tx, op, id, version, deleted, change)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fed, nil
+}
+
+// modifyIn applies change to the stored federation, bumps its version and
+// writes it back. nothing is written when change fails. deleted says
+// whether the federation must be deleted or live. op names the change in
+// the history.
+func (s *sqlDb) modifyIn(ctx context.Context, q querier, op string, id int, version int, deleted bool, change func(*api.Federation) error) (*api.Federation, error) {
+	updated, err := scanFederation(q.QueryRowContext(ctx, s.bind(`SELECT `+federationColumns+` FROM federations WHERE id = ?`), id))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, notFound(id)
+	case err != nil:
+		return nil, sqlError(err)
+	case !deleted && updated.DeletedAt != nil:
+		return nil, notFound(id)
+	case deleted && updated.DeletedAt == nil:
+		return nil, notDeleted(id)
+	case version != 0 && version != updated.Version:
+		return nil, versionMismatch(id)
+	}
+
+	stored := copyFederation(updated)
+	if err := change(updated); err != nil {
+		return nil, err
+	}
+	if movesParent(stored, updated) {
+		if _, err := s.nextValue(ctx, q, hierarchySequence); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkParent(stored, updated, s.lookup(ctx, q)); err != nil {
+		return nil, err
+	}
+	updated.Version++
+	stampUpdated(updated)
+	labels, err := labelsColumn(updated)
+	if err != nil {
+		return nil, err
+	}
+	res, err := q.ExecContext(ctx, s.bind(`UPDATE federations SET owner = ?, name = ?, description = ?, labels = ?, state = ?, state_changed_at = ?, parent_id = ?, version = ?, updated_at = ?, deleted_at = ? WHERE id = ? AND version = ?`),
+		updated.Owner, updated.Name, updated.Description, labels, stateColumn(updated), updated.StateChangedAt, parentColumn(updated), updated.Version, updated.UpdatedAt, updated.DeletedAt, updated.Id, updated.Version-1)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	// another writer got in between the read and the update.
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, versionMismatch(id)
+	}
+
+	if err := s.record(ctx, q, op, stored, updated); err != nil {
+		return nil, err
+	}
+	if err := s.reindex(ctx, q, stored, updated); err != nil {
+		return nil, err
+	}
+	if err := s.relabel(ctx, q, stored, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// errBatchFailed rolls back an atomic batch with a failed operation.
+var errBatchFailed = errors.New("batch failed")
+
+// ApplyBatch runs an atomic batch in one transaction and every operation
+// of other batches in its own.
+func (s *sqlDb) ApplyBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if !atomic {
+		results, _ := runBatch(ops, false, func(op BatchOperation) (*api.Federation, error) {
+			var fed *api.Federation
+			err := s.deleteTx(ctx, func(tx *sql.Tx, deleted *[]int) error {
+				var err error
+				fed, err = s.batchExec(ctx, tx, deleted)(op)
+				return err
+			})
+			return fed, err
+		})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	var results []BatchResult
+	err := s.deleteTx(ctx, func(tx *sql.Tx, deleted *[]int) error {
+		var ok bool
+		if results, ok = runBatch(ops, true, s.batchExec(ctx, tx, deleted)); !ok {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, err
+	}
+	return results, nil
+}
+
+// batchExec returns the function running batch operations on q. deletes
+// add the ids of the federations they delete to deleted.
+func (s *sqlDb) batchExec(ctx context.Context, q querier, deleted *[]int) func(BatchOperation) (*api.Federation, error) {
+	return func(op BatchOperation) (*api.Federation, error) {
+		switch op.Op {
+		case BatchCreate:
+			return s.add(ctx, q, op.Federation)
+		case BatchUpdate:
+			return s.modifyIn(ctx, q, ChangeUpdate, op.Id, op.Version, false, updateFields(op.Federation))
+		default:
+			return s.deleteIn(ctx, q, op.Id, op.Version, deleted)
+		}
+	}
+}
+
+// PurgeFederations removes federations deleted before deletedBefore and
+// their history.
+func (s *sqlDb) PurgeFederations(ctx context.Context, deletedBefore time.Time) (int, error) {
+	var n int
+	err := s.deleteTx(ctx, func(tx *sql.Tx, deleted *[]int) error {
+		rows, err := tx.QueryContext(ctx, s.bind(`SELECT id FROM federations WHERE deleted_at IS NOT NULL AND deleted_at < ?`), deletedBefore)
+		if err != nil {
+			return sqlError(err)
+		}
+		ids, err := scanIds(rows)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		in := sqlIn(len(ids))
+		for _, table := range []string{"federation_history", "federation_labels"} {
+			if _, err := tx.ExecContext(ctx, s.bind(`DELETE FROM `+table+` WHERE federation_id IN `+in), ids...); err != nil {
+				return sqlError(err)
+			}
+		}
+		res, err := tx.ExecContext(ctx, s.bind(`DELETE FROM federations WHERE id IN `+in), ids...)
+		if err != nil {
+			return sqlError(err)
+		}
+		for _, id := range ids {
+			*deleted = append(*deleted, id.(int))
+		}
+		affected, err := res.RowsAffected()
+		n = int(affected)
+		return sqlError(err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// scanIds reads the single integer column of rows and closes it.
+func scanIds(rows *sql.Rows) ([]any, error) {
+	defer rows.Close()
+
+	var ids []any
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, sqlError(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, sqlError(rows.Err())
+}
+
+// sqlIn returns the parenthesized list of n placeholders.
+func sqlIn(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+// changeColumns are the columns read by scanChange, in order.
+const changeColumns = `id, federation_id, principal, changed_at, op, before_state, after_state`
+
+// scanChange reads a row selected with changeColumns. the snapshots are
+// stored as JSON.
+func scanChange(row scanner) (*api.FederationChange, error) {
+	change := new(api.FederationChange)
+	var before sql.NullString
+	var after string
+	if err := row.Scan(&change.Id, &change.FederationId, &change.Principal, &change.At, &change.Op, &before, &after); err != nil {
+		return nil, err
+	}
+	change.At = change.At.UTC()
+
+	if before.Valid {
+		change.Before = new(api.Federation)
+		if err := json.Unmarshal([]byte(before.String), change.Before); err != nil {
+			return nil, fmt.Errorf("corrupt change %d: %w", change.Id, err)
+		}
+	}
+	change.After = new(api.Federation)
+	if err := json.Unmarshal([]byte(after), change.After); err != nil {
+		return nil, fmt.Errorf("corrupt change %d: %w", change.Id, err)
+	}
+	return change, nil
+}
+
+// record writes the history row of op turning before into after.
+func (s *sqlDb) record(ctx context.Context, q querier, op string, before, after *api.Federation) error {
+	change := newChange(PrincipalFrom(ctx), op, before, after)
+
+	var beforeState sql.NullString
+	if before != nil {
+		data, err := json.Marshal(change.Before)
+		if err != nil {
+			return err
+		}
+		beforeState = sql.NullString{String: string(data), Valid: true}
+	}
+	afterState, err := json.Marshal(change.After)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.nextValue(ctx, q, historySequence)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, s.bind(`INSERT INTO federation_history (`+changeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		id, change.FederationId, change.Principal, change.At, change.Op, beforeState, string(afterState))
+	return sqlError(err)
+}
+
+// reindex updates the owner index after a write turned before into after.
+func (s *sqlDb) reindex(ctx context.Context, q querier, before, after *api.Federation) error {
+	if before != nil && before.Owner == after.Owner && (before.DeletedAt == nil) == (after.DeletedAt == nil) {
+		return nil
+	}
+	return indexOwner(ctx, q, s.bind, after)
+}
+
+// indexOwner replaces the owner n-grams of fed in federation_owner_grams.
+// deleted federations are left out of the index.
+func indexOwner(ctx context.Context, q querier, bind func(string) string, fed *api.Federation) error {
+	if _, err := q.ExecContext(ctx, bind(`DELETE FROM federation_owner_grams WHERE federation_id = ?`), fed.Id); err != nil {
+		return sqlError(err)
+	}
+	if fed.DeletedAt != nil {
+		return nil
+	}
+
+	for _, gram := range ownerGrams(fed.Owner) {
+		if _, err := q.ExecContext(ctx, bind(`INSERT INTO federation_owner_grams (gram, federation_id) VALUES (?, ?)`), gram, fed.Id); err != nil {
+			return sqlError(err)
+		}
+	}
+	return nil
+}
+
+// indexOwners indexes the owners of every live federation, for databases
+// created before the index.
+func indexOwners(ctx context.Context, tx *sql.Tx, bind func(string) string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, owner FROM federations WHERE deleted_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	var federations []*api.Federation
+	for rows.Next() {
+		fed := new(api.Federation)
+		if err := rows.Scan(&fed.Id, &fed.Owner); err != nil {
+			rows.Close()
+			return err
+		}
+		federations = append(federations, fed)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, fed := range federations {
+		if err := indexOwner(ctx, tx, bind, fed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relabel updates federation_labels after a write turned before into
+// after. deleted federations keep their labels, listings can include them.
+func (s *sqlDb) relabel(ctx context.Context, q querier, before, after *api.Federation) error {
+	if before != nil {
+		if maps.Equal(before.Labels, after.Labels) {
+			return nil
+		}
+		if _, err := q.ExecContext(ctx, s.bind(`DELETE FROM federation_labels WHERE federation_id = ?`), after.Id); err != nil {
+			return sqlError(err)
+		}
+	}
+
+	for name, value := range after.Labels {
+		if _, err := q.ExecContext(ctx, s.bind(`INSERT INTO federation_labels (federation_id, name, value) VALUES (?, ?, ?)`), after.Id, name, value); err != nil {
+			return sqlError(err)
+		}
+	}
+	return nil
+}
+
+// SearchFederations intersects the ids indexed under every n-gram of the
+// query and ranks the federations they select.
+func (s *sqlDb) SearchFederations(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	q, err := query.resolve()
+	if err != nil {
+		return nil, err
+	}
+	db, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []any
+	for i, gram := range queryGrams(q.q) {
+		rows, err := db.QueryContext(ctx, s.bind(`SELECT federation_id FROM federation_owner_grams WHERE gram = ?`), gram)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		found, err := scanIds(rows)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			previous := make(map[any]bool, len(ids))
+			for _, id := range ids {
+				previous[id] = true
+			}
+			found = slices.DeleteFunc(found, func(id any) bool { return !previous[id] })
+		}
+		if ids = found; len(ids) == 0 {
+			break
+		}
+	}
+
+	// candidates are read in chunks to keep the IN lists short.
+	candidates := []*api.Federation{}
+	for len(ids) > 0 {
+		chunk := ids[:min(len(ids), MaxPageLimit)]
+		ids = ids[len(chunk):]
+		rows, err := db.QueryContext(ctx, s.bind(`SELECT `+federationColumns+` FROM federations WHERE id IN `+sqlIn(len(chunk))), chunk...)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		federations, err := scanFederations(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, federations...)
+	}
+	return pageSearch(candidates, query)
+}
+
+// GetHistory returns a page of the changes of a stored federation.
+func (s *sqlDb) GetHistory(ctx context.Context, id int, query HistoryQuery) (*HistoryPage, error) {
+	h, err := query.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	if exists, err := s.exists(ctx, db, id); err != nil {
+		return nil, sqlError(err)
+	} else if !exists {
+		return nil, notFound(id)
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, s.bind(`SELECT COUNT(*) FROM federation_history WHERE federation_id = ?`), id).Scan(&total); err != nil {
+		return nil, sqlError(err)
+	}
+
+	conditions, args := []string{"federation_id = ?"}, []any{id}
+	if h.before != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, h.before)
+	}
+	// one more row than needed tells whether there is a next page.
+	rows, err := db.QueryContext(ctx, s.bind(`SELECT `+changeColumns+` FROM federation_history`+sqlWhere(conditions)+` ORDER BY id DESC LIMIT ?`),
+		append(args, h.limit+1)...)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	changes := []*api.FederationChange{}
+	for rows.Next() {
+		change, err := scanChange(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqlError(err)
+	}
+
+	hasNext := len(changes) > h.limit
+	if hasNext {
+		changes = changes[:h.limit]
+	}
+	return h.page(changes, total, hasNext), nil
+}
+
+// lookup returns the function reading federations through q for
+// checkParent.
+func (s *sqlDb) lookup(ctx context.Context, q querier) func(int) (*api.Federation, error) {
+	return func(id int) (*api.Federation, error) {
+		fed, err := scanFederation(q.QueryRowContext(ctx, s.bind(`SELECT `+federationColumns+` FROM federations WHERE id = ?`), id))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		case err != nil:
+			return nil, sqlError(err)
+		}
+		return fed, nil
+	}
+}
+
+// exists reports whether a federation with id is stored.
+func (s *sqlDb) exists(ctx context.Context, q querier, id int) (bool, error) {
+	var found int
+	err := q.QueryRowContext(ctx, s.bind(`SELECT id FROM federations WHERE id = ?`), id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// sqlError marks errors caused by a lost connection as ErrUnavailable so
+// callers can tell them from bad queries.
+func sqlError(err error) error {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// likeEscape escapes the LIKE wildcards in s using ! as the escape character.
+var likeEscape = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func sqlWhere(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// sqlFilters returns the conditions and arguments for the filters of p.
+func (p *pageQuery) sqlFilters() ([]string, []any) {
+	var conditions []string
+	var args []any
+	if !p.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if p.Owner != "" {
+		conditions = append(conditions, "owner = ?")
+		args = append(args, p.Owner)
+	}
+	if p.OwnerPrefix != "" {
+		conditions = append(conditions, "owner LIKE ? ESCAPE '!'")
+		args = append(args, likeEscape.Replace(p.OwnerPrefix)+"%")
+	}
+	if p.MinId != 0 {
+		conditions = append(conditions, "id >= ?")
+		args = append(args, p.MinId)
+	}
+	if p.MaxId != 0 {
+		conditions = append(conditions, "id <= ?")
+		args = append(args, p.MaxId)
+	}
+	switch p.State {
+	case "":
+	case StateActive:
+		conditions = append(conditions, "(state = ? OR state IS NULL)")
+		args = append(args, p.State)
+	default:
+		conditions = append(conditions, "state = ?")
+		args = append(args, p.State)
+	}
+	if p.ParentId != 0 {
+		conditions = append(conditions, "parent_id = ?")
+		args = append(args, p.ParentId)
+	}
+	for _, r := range p.labels {
+		labeled := "SELECT federation_id FROM federation_labels WHERE name = ?"
+		args = append(args, r.key)
+		if r.op == labelEquals || r.op == labelNotEquals {
+			labeled += " AND value = ?"
+			args = append(args, r.value)
+		}
+		if r.op == labelEquals || r.op == labelExists {
+			conditions = append(conditions, "id IN ("+labeled+")")
+		} else {
+			conditions = append(conditions, "id NOT IN ("+labeled+")")
+		}
+	}
+	return conditions, args
+}
+
+// sqlKeyset returns the condition selecting the rows past at in the sort
+// order of p.
+func (p *pageQuery) sqlKeyset(at position) (string, []any) {
+	op := ">"
+	if at.before != p.Desc {
+		op = "<"
+	}
+
+	if p.field.column == "id" {
+		return "id " + op + " ?", []any{at.id}
+	}
+	return fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", p.field.column, op), []any{at.value, at.value, at.id}
+}
+
+// sqlOrder returns the ORDER BY clause of p, reversed when paging backwards.
+func (p *pageQuery) sqlOrder(reverse bool) string {
+	dir := "ASC"
+	if p.Desc != reverse {
+		dir = "DESC"
+	}
+
+	if p.field.column == "id" {
+		return " ORDER BY id " + dir
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s", p.field.column, dir, dir)
+}
@@ -0,0 +1,653 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorest/api"
+)
+
+// openSqlDb returns a sqlDb on a fresh fakesql database that is set up
+// and closed on cleanup.
+func openSqlDb(t *testing.T, placeholder string, seed ...*api.Federation) (*sqlDb, *fakeDatabase) {
+	t.Helper()
+	db := newSqlDb("fakesql", t.Name(), placeholder)
+	if err := db.Setup(context.Background()); err != nil {
+		t.Fatalf("Setup() = %v want <nil>", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, fed := range seed {
+		if _, err := db.AddFederation(context.Background(), fed); err != nil {
+			t.Fatalf("AddFederation(%v) = %v want <nil>", fed, err)
+		}
+	}
+	return db, fakeDatabaseFor(t.Name())
+}
+
+// test Setup() on a new database
+// should apply every migration once
+func TestSqlDbSetupMigrates(t *testing.T) {
+	// arrange
+	sut, fake := openSqlDb(t, "")
+	reopened := newSqlDb("fakesql", t.Name(), "")
+	defer reopened.Close()
+
+	// act
+	err := reopened.Setup(context.Background())
+	sut.Setup(context.Background())
+
+	// assert
+	if err != nil {
+		t.Fatalf("Setup() = %v want <nil>", err)
+	}
+
+	if got := len(fake.tables["schema_migrations"].rows); got != len(federationMigrations) {
+		t.Fatalf("schema_migrations = %d rows want %d", got, len(federationMigrations))
+	}
+
+	creates := 0
+	for _, statement := range fake.statements {
+		if strings.Contains(statement, "CREATE TABLE federations") {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Fatalf("CREATE TABLE federations = %d want 1", creates)
+	}
+}
+
+// test Setup() with a failing migration
+// should roll back the migration and resume on the next Setup
+func TestSqlDbSetupMigrationError(t *testing.T) {
+	// arrange
+	fake := fakeDatabaseFor(t.Name())
+	fake.setFailOn("CREATE INDEX")
+	sut := newSqlDb("fakesql", t.Name(), "")
+	defer sut.Close()
+	wantError := "migration 2 (index federations owner)"
+
+	// act
+	err := sut.Setup(context.Background())
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), wantError) {
+		t.Fatalf("Setup() = %v want %q", err, wantError)
+	}
+
+	if got := len(fake.tables["schema_migrations"].rows); got != 1 {
+		t.Fatalf("schema_migrations = %d rows want 1", got)
+	}
+
+	fake.setFailOn("")
+	if err := sut.Setup(context.Background()); err != nil {
+		t.Fatalf("Setup() = %v want <nil>", err)
+	}
+}
+
+// test bind(string) with dollar placeholders
+// should number placeholders
+func TestSqlDbBindDollar(t *testing.T) {
+	// arrange
+	sut := newSqlDb("fakesql", t.Name(), PlaceholderDollar)
+	want := "UPDATE federations SET owner = $1 WHERE id = $2"
+
+	// act
+	query := sut.bind("UPDATE federations SET owner = ? WHERE id = ?")
+
+	// assert
+	if query != want {
+		t.Fatalf("bind(query) = %q want %q", query, want)
+	}
+}
+
+// test sqlDb with dollar placeholders
+// should run every query
+func TestSqlDbDollarPlaceholders(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, PlaceholderDollar, &api.Federation{Id: 1, Owner: "Owner 1"})
+
+	// act
+	_, err := sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "new owner"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("UpdateFederation(federation) = %v want <nil>", err)
+	}
+
+	if fed, _ := sut.GetFederation(context.Background(), 1); fed == nil || fed.Owner != "new owner" {
+		t.Fatalf("GetFederation(1) = %v want %q", fed, "new owner")
+	}
+}
+
+// test AddFederation(*api.Federation) error with duplicated federation
+// should return error
+func TestSqlDbAddFederationDuplicated(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"})
+	wantErr := "federation 1 already exists"
+
+	// act
+	_, err := sut.AddFederation(context.Background(), &api.Federation{Id: 1, Owner: "Owner 2"})
+
+	// assert
+	if err == nil || err.Error() != wantErr {
+		t.Fatalf("AddFederation(federation) = %v want %q", err, wantErr)
+	}
+
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("AddFederation(federation) = %v want %v", err, ErrAlreadyExists)
+	}
+}
+
+// test AddFederation(*api.Federation) without id
+// should insert the row with the next id
+func TestSqlDbAddFederationGeneratedId(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 4, Owner: "Owner 4"})
+
+	// act
+	created, err := sut.AddFederation(context.Background(), &api.Federation{Owner: "new owner"})
+
+	// assert
+	if err != nil || created.Id != 5 {
+		t.Fatalf("AddFederation(federation) = %v, %v want federation 5", created, err)
+	}
+
+	if stored, _ := sut.GetFederation(context.Background(), 5); stored == nil || stored.Owner != "new owner" {
+		t.Fatalf("GetFederation(5) = %v want %q", stored, "new owner")
+	}
+}
+
+// test AddFederation(*api.Federation) error with driver error
+// should return the driver error
+func TestSqlDbAddFederationDriverError(t *testing.T) {
+	// arrange
+	sut, fake := openSqlDb(t, "")
+	fake.setFailOn("INSERT INTO federations")
+
+	// act
+	_, err := sut.AddFederation(context.Background(), &api.Federation{Id: 1})
+
+	// assert
+	if err == nil || errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("AddFederation(federation) = %v want driver error", err)
+	}
+}
+
+// test GetFederation(int) and GetFederations()
+// should return stored federations ordered by id
+func TestSqlDbGetFederations(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut, _ := openSqlDb(t, "",
+		&api.Federation{Id: 2, Owner: "Owner 2"},
+		&api.Federation{Id: 1, Owner: "Owner 1", Name: "one", Description: "the first", Labels: map[string]string{"env": "prod"}},
+	)
+	want := []*api.Federation{
+		{Id: 1, Owner: "Owner 1", Name: "one", Description: "the first", Labels: map[string]string{"env": "prod"}, Version: 1, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at},
+		{Id: 2, Owner: "Owner 2", Version: 1, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at},
+	}
+
+	// act
+	page, _ := sut.GetFederations(context.Background(), FederationQuery{})
+	missing, _ := sut.GetFederation(context.Background(), 3)
+
+	// assert
+	if !reflect.DeepEqual(page.Federations, want) {
+		t.Fatalf("GetFederations(query) = %v want %v", page.Federations, want)
+	}
+
+	if missing != nil {
+		t.Fatalf("GetFederation(3) = %v want <nil>", missing)
+	}
+}
+
+// test GetFederations(ctx, FederationQuery) with filters, sorting and cursors
+// should return the same pages as the in-memory listing
+func TestSqlDbGetFederationsQuery(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, PlaceholderDollar, queryFederations()...)
+	list := func(query FederationQuery) (*FederationPage, error) {
+		return sut.GetFederations(context.Background(), query)
+	}
+	// new federations are drafts, give them the states of the data set,
+	// leaving NULL for federations stored before states existed.
+	for _, fed := range queryFederations() {
+		sut.db.Exec(sut.bind(`UPDATE federations SET state = ? WHERE id = ?`), stateColumn(fed), fed.Id)
+	}
+	wantPages := [][]int{{5, 6}, {2, 3}, {1, 4}, {2, 3}, {5, 6}}
+
+	for _, tt := range queryCases {
+		// act
+		page, err := list(tt.query)
+
+		// assert
+		if err != nil {
+			t.Fatalf("GetFederations(%+v) = %v want <nil>", tt.query, err)
+		}
+
+		if ids := federationIds(page.Federations); !reflect.DeepEqual(ids, tt.want) || page.Total != tt.total {
+			t.Fatalf("GetFederations(%+v) = %v, %d want %v, %d", tt.query, ids, page.Total, tt.want, tt.total)
+		}
+	}
+
+	if pages := walkPages(t, list, FederationQuery{Sort: "owner", Desc: true, Limit: 2}); !reflect.DeepEqual(pages, wantPages) {
+		t.Fatalf("pages = %v want %v", pages, wantPages)
+	}
+}
+
+// test UpdateFederation(*federation) not found
+// should return error
+func TestSqlDbUpdateFederationNotFound(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "")
+	wantError := "federation -1 not found"
+
+	// act
+	_, err := sut.UpdateFederation(context.Background(), &api.Federation{Id: -1})
+
+	// assert
+	if err == nil || err.Error() != wantError {
+		t.Fatalf("UpdateFederation(federation) = %v want %q", err, wantError)
+	}
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateFederation(federation) = %v want %v", err, ErrNotFound)
+	}
+}
+
+// test UpdateFederation(*federation) and DeleteFederation(id, version) with versions
+// should apply matching versions and reject stale ones
+func TestSqlDbVersions(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"})
+
+	// act
+	updated, err := sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "new owner", Version: 1})
+	_, staleErr := sut.UpdateFederation(context.Background(), &api.Federation{Id: 1, Owner: "lost update", Version: 1})
+	staleDeleteErr := sut.DeleteFederation(context.Background(), 1, 1)
+	missingDeleteErr := sut.DeleteFederation(context.Background(), 9, 1)
+	deleteErr := sut.DeleteFederation(context.Background(), 1, 2)
+
+	// assert
+	if err != nil || updated.Version != 2 || updated.Owner != "new owner" {
+		t.Fatalf("UpdateFederation(federation) = %v, %v want version 2", updated, err)
+	}
+
+	if !errors.Is(staleErr, ErrVersionMismatch) {
+		t.Fatalf("UpdateFederation(federation) = %v want %v", staleErr, ErrVersionMismatch)
+	}
+
+	if !errors.Is(staleDeleteErr, ErrVersionMismatch) {
+		t.Fatalf("DeleteFederation(1, 1) = %v want %v", staleDeleteErr, ErrVersionMismatch)
+	}
+
+	if !errors.Is(missingDeleteErr, ErrNotFound) {
+		t.Fatalf("DeleteFederation(9, 1) = %v want %v", missingDeleteErr, ErrNotFound)
+	}
+
+	if fed, _ := sut.GetFederation(context.Background(), 1); deleteErr != nil || fed != nil {
+		t.Fatalf("DeleteFederation(1, 2) = %v want <nil>", deleteErr)
+	}
+}
+
+// test Setup() on a database with federations stored before timestamps
+// should stamp them, so they sort on created_at with the others
+func TestSqlDbBackfillTimestamps(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	ctx := context.Background()
+	db, _ := sql.Open("fakesql", t.Name())
+	if err := migrate(ctx, db, func(query string) string { return query }, federationMigrations[:12]); err != nil {
+		t.Fatalf("migrate(v12) = %v want <nil>", err)
+	}
+	db.ExecContext(ctx, `INSERT INTO federations (id, owner, version, name, description) VALUES (?, ?, ?, ?, ?)`, 1, "Owner 1", 1, "", "")
+	db.Close()
+	sut, _ := openSqlDb(t, "")
+
+	// act
+	fed, err := sut.GetFederation(ctx, 1)
+	page, listErr := sut.GetFederations(ctx, FederationQuery{Sort: "created_at", Desc: true})
+
+	// assert
+	if err != nil || fed.CreatedAt == nil || !fed.CreatedAt.Equal(at) || fed.UpdatedAt == nil || !fed.UpdatedAt.Equal(at) {
+		t.Fatalf("GetFederation(1) = %+v, %v want both timestamps at %v", fed, err, at)
+	}
+
+	if listErr != nil || page.Total != 1 {
+		t.Fatalf("GetFederations(-created_at) = %+v, %v want federation 1", page, listErr)
+	}
+}
+
+// test AddFederation(federation) on a database created before the id sequence
+// should go on from the largest stored id and not reuse purged ids
+func TestSqlDbIdSequence(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	db, _ := sql.Open("fakesql", t.Name())
+	if err := migrate(ctx, db, func(query string) string { return query }, federationMigrations[:10]); err != nil {
+		t.Fatalf("migrate(v10) = %v want <nil>", err)
+	}
+	db.ExecContext(ctx, `INSERT INTO federations (id, owner, version, deleted_at) VALUES (?, ?, ?, ?)`, 5, "Owner 5", 2, time.Now().Add(-time.Hour))
+	db.Close()
+	sut, _ := openSqlDb(t, "")
+
+	// act
+	first, firstErr := sut.AddFederation(ctx, &api.Federation{Owner: "Owner 6"})
+	sut.AddFederation(ctx, &api.Federation{Id: 9, Owner: "Owner 9"})
+	sut.DeleteFederation(ctx, 9, 0)
+	sut.PurgeFederations(ctx, time.Now().Add(time.Hour))
+	next, nextErr := sut.AddFederation(ctx, &api.Federation{Owner: "Owner 10"})
+
+	// assert
+	if firstErr != nil || first.Id != 6 {
+		t.Fatalf("AddFederation(federation) = %v, %v want id 6", first, firstErr)
+	}
+
+	if nextErr != nil || next.Id != 10 {
+		t.Fatalf("AddFederation(federation) after a purge = %v, %v want id 10", next, nextErr)
+	}
+}
+
+// test DeleteFederation(int)
+// should delete federation
+func TestSqlDbDeleteFederation(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"})
+
+	// act
+	err := sut.DeleteFederation(context.Background(), 1, 0)
+
+	// assert
+	if err != nil {
+		t.Fatalf("DeleteFederation(1) = %v want <nil>", err)
+	}
+
+	if fed, _ := sut.GetFederation(context.Background(), 1); fed != nil {
+		t.Fatalf("GetFederation(1) = %v want <nil>", fed)
+	}
+}
+
+// test PatchFederation(id, version, patch)
+// should write the patched federation and nothing when the patch fails
+func TestSqlDbPatchFederation(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"})
+	patch, _ := ParseMergePatch([]byte(`{"owner":"new owner"}`))
+	failing, _ := ParseMergePatch([]byte(`{"owner":"lost","id":7}`))
+	want := &api.Federation{Id: 1, Owner: "new owner", Version: 2, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at}
+
+	// act
+	patched, err := sut.PatchFederation(context.Background(), 1, 1, patch)
+	_, failErr := sut.PatchFederation(context.Background(), 1, 0, failing)
+	stored, _ := sut.GetFederation(context.Background(), 1)
+
+	// assert
+	if err != nil || !reflect.DeepEqual(patched, want) {
+		t.Fatalf("PatchFederation(1, 1, patch) = %v, %v want %v", patched, err, want)
+	}
+
+	if !errors.Is(failErr, ErrValidation) || !reflect.DeepEqual(stored, want) {
+		t.Fatalf("PatchFederation(1, 0, failing) = %v, %v want %v unchanged", failErr, stored, want)
+	}
+}
+
+// test DeleteFederation, RestoreFederation and PurgeFederations
+// should keep deleted rows until they are purged
+func TestSqlDbSoftDelete(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+	sut.DeleteFederation(context.Background(), 1, 0)
+	sut.DeleteFederation(context.Background(), 2, 0)
+
+	// act
+	missingErr := sut.DeleteFederation(context.Background(), 1, 0)
+	live, _ := sut.GetFederations(context.Background(), FederationQuery{})
+	all, _ := sut.GetFederations(context.Background(), FederationQuery{IncludeDeleted: true})
+	restored, restoreErr := sut.RestoreFederation(context.Background(), 2, 2)
+	_, liveErr := sut.RestoreFederation(context.Background(), 2, 0)
+	purged, purgeErr := sut.PurgeFederations(context.Background(), at.Add(time.Second))
+
+	// assert
+	if !errors.Is(missingErr, ErrNotFound) {
+		t.Fatalf("DeleteFederation(1) = %v want %v", missingErr, ErrNotFound)
+	}
+
+	if len(live.Federations) != 0 || live.Total != 0 {
+		t.Fatalf("GetFederations() = %v want none", federationIds(live.Federations))
+	}
+
+	if want := (&api.Federation{Id: 1, Owner: "Owner 1", Version: 2, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at, DeletedAt: &at}); len(all.Federations) != 2 || !reflect.DeepEqual(all.Federations[0], want) {
+		t.Fatalf("GetFederations(includeDeleted) = %v want %v first", all.Federations, want)
+	}
+
+	if want := (&api.Federation{Id: 2, Owner: "Owner 2", Version: 3, State: StateDraft, StateChangedAt: &at, CreatedAt: &at, UpdatedAt: &at}); restoreErr != nil || !reflect.DeepEqual(restored, want) {
+		t.Fatalf("RestoreFederation(2, 2) = %v, %v want %v", restored, restoreErr, want)
+	}
+
+	if !errors.Is(liveErr, ErrConflict) {
+		t.Fatalf("RestoreFederation(2) = %v want %v", liveErr, ErrConflict)
+	}
+
+	if purgeErr != nil || purged != 1 {
+		t.Fatalf("PurgeFederations(cutoff) = %d, %v want 1, <nil>", purged, purgeErr)
+	}
+
+	if exists, _ := sut.exists(context.Background(), sut.db, 1); exists {
+		t.Fatalf("exists(1) = %v want false", exists)
+	}
+}
+
+// test ApplyBatch(ops, atomic)
+// should apply what it can or, atomically, roll everything back
+func TestSqlDbApplyBatch(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2"})
+
+	// act
+	atomicResults, atomicErr := sut.ApplyBatch(context.Background(), batchOperations(), true)
+	stored, _ := sut.GetFederation(context.Background(), 1)
+	results, err := sut.ApplyBatch(context.Background(), batchOperations(), false)
+
+	// assert
+	if atomicErr != nil || err != nil {
+		t.Fatalf("ApplyBatch(ops) = %v, %v want <nil>", atomicErr, err)
+	}
+
+	checkBatchResults(t, atomicResults, nil, []error{ErrBatchAborted, ErrBatchAborted, ErrBatchAborted, ErrBatchAborted, ErrNotFound})
+
+	if stored.Version != 1 {
+		t.Fatalf("ApplyBatch(ops, true) = version %d want 1", stored.Version)
+	}
+
+	checkBatchResults(t, results, []int{3, 4, 1, 2, 0}, []error{nil, nil, nil, nil, ErrNotFound})
+}
+
+// test sqlDb before Setup
+// should fail reads and writes
+func TestSqlDbClosed(t *testing.T) {
+	// arrange
+	sut := newSqlDb("fakesql", t.Name(), "")
+
+	// act
+	_, err := sut.AddFederation(context.Background(), &api.Federation{Id: 1})
+
+	// assert
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("AddFederation(federation) = %v want %v", err, ErrUnavailable)
+	}
+
+	if _, err := sut.GetFederations(context.Background(), FederationQuery{}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("GetFederations(query) = %v want %v", err, ErrUnavailable)
+	}
+}
+
+// test GetFederations(ctx) with cancelled context
+// should return the context error
+func TestSqlDbCancelled(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// act
+	_, err := sut.GetFederations(ctx, FederationQuery{})
+
+	// assert
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetFederations(ctx) = %v want %v", err, context.Canceled)
+	}
+}
+
+// test GetHistory(id, query) after writes to a sqlDb
+// should return every change newest first and drop it on purge
+func TestSqlDbHistory(t *testing.T) {
+	// arrange
+	sut, _ := openSqlDb(t, "")
+	want := recordHistory(t, sut)
+
+	// act & assert
+	checkHistory(t, sut, want)
+
+	sut.DeleteFederation(context.Background(), 3, 0)
+	sut.PurgeFederations(context.Background(), timeNow().Add(time.Second))
+	if _, err := sut.GetHistory(context.Background(), 3, HistoryQuery{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetHistory(3) = %v want %v", err, ErrNotFound)
+	}
+	var rows int
+	sut.db.QueryRow(`SELECT COUNT(*) FROM federation_history`).Scan(&rows)
+	if rows != 0 {
+		t.Fatalf("federation_history holds %d rows want 0", rows)
+	}
+}
+
+// test federation_labels after label changes and purges
+// should hold the labels of every stored federation, deleted or not
+func TestSqlDbLabels(t *testing.T) {
+	// arrange
+	at := stopClock(t)
+	sut, fake := openSqlDb(t, "",
+		&api.Federation{Id: 1, Owner: "Owner 1", Labels: map[string]string{"env": "prod", "tier": "gold"}},
+		&api.Federation{Id: 2, Owner: "Owner 2", Labels: map[string]string{"env": "dev"}},
+	)
+	ctx := context.Background()
+
+	// act
+	sut.UpdateFederation(ctx, &api.Federation{Id: 1, Owner: "Owner 1", Labels: map[string]string{"env": "dev"}})
+	sut.DeleteFederation(ctx, 1, 0)
+	deleted := len(fake.tables["federation_labels"].rows)
+	sut.PurgeFederations(ctx, at.Add(time.Second))
+
+	// assert
+	if deleted != 2 {
+		t.Fatalf("federation_labels = %v want a row for each federation", fake.tables["federation_labels"].rows)
+	}
+
+	if rows := fake.tables["federation_labels"].rows; len(rows) != 1 || rows[0][0] != int64(2) {
+		t.Fatalf("federation_labels = %v want federation 2 only", rows)
+	}
+}
+
+// test DeleteFederation(parent) under DeleteCascade with members in the descendants
+// should remove the members of every federation it deletes once it commits
+func TestSqlDbDeleteCascadeMembers(t *testing.T) {
+	// arrange
+	ctx := context.Background()
+	parent := func(id int) *int { return &id }
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: parent(1)},
+		&api.Federation{Id: 3, Owner: "Owner 3", ParentId: parent(2)})
+	sut.setDeletePolicy(DeleteCascade)
+	members := newMockMembers(sut)
+	for id := 1; id <= 3; id++ {
+		members.AddMember(ctx, id, &api.Member{Organisation: "Acme"})
+	}
+
+	// act
+	err := sut.DeleteFederation(ctx, 1, 0)
+
+	// assert
+	if err != nil {
+		t.Fatalf("DeleteFederation(1) = %v want <nil>", err)
+	}
+
+	if len(members.members) != 0 {
+		t.Fatalf("members = %v want none", members.members)
+	}
+}
+
+// test DeleteFederation(id, version) of a parent under every delete policy
+// should refuse it, delete the descendants along or move the children to the top
+func TestSqlDbDeletePolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		wantErr  error
+		wantLive []int
+		wantTop  []int
+	}{
+		{DeleteRestrict, ErrConflict, []int{1, 2, 3, 4}, []int{1, 4}},
+		{DeleteCascade, nil, []int{4}, []int{4}},
+		{DeleteOrphan, nil, []int{2, 3, 4}, []int{2, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			// arrange
+			parent := func(id int) *int { return &id }
+			sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: parent(1)},
+				&api.Federation{Id: 3, Owner: "Owner 3", ParentId: parent(2)}, &api.Federation{Id: 4, Owner: "Owner 4"})
+			sut.setDeletePolicy(tt.policy)
+
+			// act
+			err := sut.DeleteFederation(context.Background(), 1, 0)
+			live, _ := sut.GetFederations(context.Background(), FederationQuery{})
+			var top []int
+			for _, fed := range live.Federations {
+				if fed.ParentId == nil {
+					top = append(top, fed.Id)
+				}
+			}
+
+			// assert
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteFederation(1) = %v want %v", err, tt.wantErr)
+			}
+
+			if got := federationIds(live.Federations); !reflect.DeepEqual(got, tt.wantLive) || !reflect.DeepEqual(top, tt.wantTop) {
+				t.Fatalf("GetFederations() = %v, top %v want %v, top %v", got, top, tt.wantLive, tt.wantTop)
+			}
+		})
+	}
+}
+
+// test ApplyBatch(ops, true) moving a federation under its own child
+// should reject the move and roll the batch back
+func TestSqlDbParentCycleBatch(t *testing.T) {
+	// arrange
+	parent := func(id int) *int { return &id }
+	sut, _ := openSqlDb(t, "", &api.Federation{Id: 1, Owner: "Owner 1"}, &api.Federation{Id: 2, Owner: "Owner 2", ParentId: parent(1)})
+	ops := []BatchOperation{
+		{Op: BatchUpdate, Id: 2, Federation: &api.Federation{Owner: "changed", ParentId: parent(1)}},
+		{Op: BatchUpdate, Id: 1, Federation: &api.Federation{Owner: "Owner 1", ParentId: parent(2)}},
+	}
+
+	// act
+	results, err := sut.ApplyBatch(context.Background(), ops, true)
+	stored, _ := sut.GetFederation(context.Background(), 2)
+
+	// assert
+	if err != nil || !errors.Is(results[0].Err, ErrBatchAborted) || !errors.Is(results[1].Err, ErrValidation) {
+		t.Fatalf("ApplyBatch(ops, true) = %+v, %v want aborted, invalid", results, err)
+	}
+
+	if stored.Owner != "Owner 2" || parentOf(stored) != 1 {
+		t.Fatalf("GetFederation(2) = %+v want unchanged", stored)
+	}
+}
@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorest/api"
+)
+
+// transfer statuses. a transfer starts pending and settles once.
+const (
+	TransferPending  = "pending"
+	TransferAccepted = "accepted"
+	TransferRejected = "rejected"
+	TransferExpired  = "expired"
+)
+
+// DefaultTransferTTL is how long a transfer stays pending unless
+// configured otherwise.
+const DefaultTransferTTL = 72 * time.Hour
+
+// TransfersRepository stores the ownership transfers of federations.
+// every method stops early and returns ctx.Err() once ctx is done.
+// transfers belong to a live federation: every method reports ErrNotFound
+// for federations that do not exist or are deleted, and the transfers of
+// a federation are removed when it is deleted.
+// a federation has at most one pending transfer, and pending transfers
+// are reported as expired once their time has passed.
+type TransfersRepository interface {
+	// CreateTransfer offers the federation to the owner to, on behalf of
+	// its current owner. it reports ErrForbidden when the organisation of
+	// ctx, see WithOrganisation, is not the owner.
+	CreateTransfer(ctx context.Context, federationId int, to string) (*api.Transfer, error)
+	GetTransfer(ctx context.Context, federationId int, id int) (*api.Transfer, error)
+	// GetTransfers returns the transfers of a federation by id.
+	GetTransfers(ctx context.Context, federationId int) ([]*api.Transfer, error)
+	// AcceptTransfer makes the recipient the owner of the federation, on
+	// behalf of the organisation of ctx, see WithOrganisation. it reports
+	// ErrForbidden when that organisation is not the recipient and
+	// ErrConflict when the transfer is no longer pending or the federation
+	// changed owner since.
+	AcceptTransfer(ctx context.Context, federationId int, id int) (*api.Transfer, error)
+	// RejectTransfer settles the transfer on behalf of the organisation of
+	// ctx, leaving the owner untouched.
+	RejectTransfer(ctx context.Context, federationId int, id int) (*api.Transfer, error)
+}
+
+// transferNotFound returns the error for a missing transfer of a federation.
+func transferNotFound(federationId, id int) error {
+	return &FederationError{Id: federationId, Err: fmt.Errorf("transfer %d %w", id, ErrNotFound)}
+}
+
+// transferSettled returns the error for a transfer that is no longer pending.
+func transferSettled(transfer *api.Transfer) error {
+	return &FederationError{Id: transfer.FederationId, Err: fmt.Errorf("transfer %d is %s: %w", transfer.Id, transfer.Status, ErrConflict)}
+}
+
+// transferPending returns the error for a second pending transfer.
+func transferPending(transfer *api.Transfer) error {
+	return &FederationError{Id: transfer.FederationId, Err: fmt.Errorf("transfer %d to %q is pending: %w", transfer.Id, transfer.To, ErrConflict)}
+}
+
+// transferRecipient returns the error for deciding a transfer on behalf of
+// an organisation it was not offered to, "" when the principal acts for
+// none.
+func transferRecipient(transfer *api.Transfer, organisation string) error {
+	if organisation == "" {
+		return &FederationError{Id: transfer.FederationId, Err: fmt.Errorf("transfer %d: the principal acts for no organisation: %w", transfer.Id, ErrForbidden)}
+	}
+	return &FederationError{Id: transfer.FederationId, Err: fmt.Errorf("transfer %d is not offered to %q: %w", transfer.Id, organisation, ErrForbidden)}
+}
+
+// transferOwner returns the error for offering a federation on behalf of
+// an organisation that does not own it, "" when the principal acts for
+// none.
+func transferOwner(fed *api.Federation, organisation string) error {
+	if organisation == "" {
+		return &FederationError{Id: fed.Id, Err: fmt.Errorf("the principal acts for no organisation: %w", ErrForbidden)}
+	}
+	return &FederationError{Id: fed.Id, Err: fmt.Errorf("%q is not the owner: %w", organisation, ErrForbidden)}
+}
+
+// validateTransfer checks a new transfer of fed against the validate tags
+// of api.Transfer.
+func validateTransfer(fed *api.Federation, transfer *api.Transfer) error {
+	if err := validateStruct(transfer); err != nil {
+		return &FederationError{Id: fed.Id, Err: err}
+	}
+	if sameOrganisation(fed.Owner, transfer.To) {
+		return &FederationError{Id: fed.Id, Err: ValidationErrors{{Field: "to", Message: "is already the owner"}}}
+	}
+	return nil
+}
+
+// expireTransfer marks transfer expired once its time has passed.
+func expireTransfer(transfer *api.Transfer) {
+	if transfer.Status == TransferPending && !timeNow().Before(transfer.ExpiresAt) {
+		transfer.Status = TransferExpired
+	}
+}
+
+// KeepOwner wraps patch so that it fails when it changes the owner.
+// owners then only change through transfers.
+func KeepOwner(patch FederationPatch) FederationPatch {
+	return &ownerKept{patch}
+}
+
+type ownerKept struct {
+	FederationPatch
+}
+
+func (p *ownerKept) apply(doc any) (any, error) {
+	owner := ownerOf(doc)
+	patched, err := p.FederationPatch.apply(doc)
+	if err != nil {
+		return nil, err
+	}
+	if ownerOf(patched) != owner {
+		return nil, ErrOwnerTransferred
+	}
+	return patched, nil
+}
+
+// ownerOf returns the owner field of doc, the JSON form of a federation.
+func ownerOf(doc any) string {
+	fields, _ := doc.(map[string]any)
+	data, _ := json.Marshal(fields["owner"])
+	return string(data)
+}
+
+// ErrOwnerTransferred is returned for writes changing the owner while
+// owners change through transfers only. it lists the owner violation like
+// validateFederation does, so it answers 422.
+var ErrOwnerTransferred = ValidationErrors{{Field: "owner", Message: "is changed by ownership transfers only"}}
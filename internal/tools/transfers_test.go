@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+
+	"gorest/api"
+)
+
+// test patchFederation(federation, KeepOwner(patch)) with patches touching the owner
+// should refuse the ones changing it and apply the others
+func TestKeepOwner(t *testing.T) {
+	// arrange
+	federation := &api.Federation{Id: 1, Owner: "Owner 1", Version: 1}
+	merge := func(doc string) FederationPatch {
+		patch, _ := ParseMergePatch([]byte(doc))
+		return patch
+	}
+	json := func(doc string) FederationPatch {
+		patch, _ := ParseJSONPatch([]byte(doc))
+		return patch
+	}
+	tests := []struct {
+		patch FederationPatch
+		want  error
+	}{
+		{merge(`{"name":"One"}`), nil},
+		{merge(`{"owner":"Owner 1"}`), nil},
+		{json(`[{"op":"test","path":"/owner","value":"Owner 1"}]`), nil},
+		{merge(`{"owner":"Owner 2"}`), ErrValidation},
+		{json(`[{"op":"replace","path":"/owner","value":"Owner 2"}]`), ErrValidation},
+		{json(`[{"op":"remove","path":"/owner"}]`), ErrValidation},
+	}
+
+	for _, tt := range tests {
+		// act
+		patched, err := patchFederation(federation, KeepOwner(tt.patch))
+
+		// assert
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("patchFederation(federation, %+v) = %v want %v", tt.patch, err, tt.want)
+		}
+
+		if err == nil && patched.Owner != "Owner 1" {
+			t.Fatalf("patchFederation(federation, %+v) = %+v want owner Owner 1", tt.patch, patched)
+		}
+	}
+}
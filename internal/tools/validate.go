@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// rule checks a field against the parameter given in its validate tag.
+// it returns a ValidationError per violation, leaving Field empty for the
+// field itself or naming the part of it that is invalid.
+type rule func(value reflect.Value, param string) []*ValidationError
+
+// validationRules are the rules validate tags may use, as in
+// `validate:"required,max=255"`.
+var validationRules = map[string]rule{
+	"required": validateRequired,
+	"min":      validateMin,
+	"max":      validateMax,
+	"pattern":  validatePattern,
+	"oneof":    validateOneOf,
+	"keys":     validateKeys,
+	"values":   validateValues,
+}
+
+// pattern is a named regular expression for the pattern, keys and values
+// rules, with the message reported when a value does not match it.
+type pattern struct {
+	re      *regexp.Regexp
+	message string
+}
+
+var validationPatterns = map[string]pattern{
+	"labelKey":   {labelKey, "key " + labelFormat},
+	"labelValue": {labelValue, labelFormat},
+}
+
+// validateStruct checks the exported fields of the struct v points to
+// against their validate tags. it reports every violation, not only the
+// first, naming fields after their json tags. pointer fields are checked
+// through the value they point to, nil ones are unset and skipped. v must
+// be valid for the rules of its tags, a tag naming an unknown rule panics.
+func validateStruct(v any) error {
+	var violations ValidationErrors
+	value := reflect.Indirect(reflect.ValueOf(v))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Pointer {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		name := fieldName(field)
+		for _, term := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(term, "=")
+			check, ok := validationRules[ruleName]
+			if !ok {
+				panic(fmt.Sprintf("field %s has unknown validation rule %q", field.Name, ruleName))
+			}
+			for _, violation := range check(fieldValue, param) {
+				if violation.Field == "" {
+					violation.Field = name
+				} else {
+					violation.Field = name + "." + violation.Field
+				}
+				violation.Rule = ruleName
+				violations = append(violations, violation)
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return violations
+}
+
+// fieldName returns the json name of field.
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func validateRequired(value reflect.Value, _ string) []*ValidationError {
+	if value.IsZero() || value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" {
+		return invalidField("is required")
+	}
+	return nil
+}
+
+func validateMin(value reflect.Value, param string) []*ValidationError {
+	limit := ruleLimit(param)
+	if value.Kind() == reflect.String && utf8.RuneCountInString(value.String()) < limit {
+		return invalidField(fmt.Sprintf("must be at least %d characters", limit))
+	}
+	if value.CanInt() && value.Int() < int64(limit) {
+		return invalidField(fmt.Sprintf("must be at least %d", limit))
+	}
+	return nil
+}
+
+func validateMax(value reflect.Value, param string) []*ValidationError {
+	limit := ruleLimit(param)
+	if value.Kind() == reflect.String && utf8.RuneCountInString(value.String()) > limit {
+		return invalidField(fmt.Sprintf("must be at most %d characters", limit))
+	}
+	if value.CanInt() && value.Int() > int64(limit) {
+		return invalidField(fmt.Sprintf("must be at most %d", limit))
+	}
+	return nil
+}
+
+func validatePattern(value reflect.Value, param string) []*ValidationError {
+	p := rulePattern(param)
+	if !p.re.MatchString(value.String()) {
+		return invalidField(p.message)
+	}
+	return nil
+}
+
+// validateOneOf checks a string is one of the space separated values of
+// param.
+func validateOneOf(value reflect.Value, param string) []*ValidationError {
+	allowed := strings.Fields(param)
+	if !slices.Contains(allowed, value.String()) {
+		return invalidField("must be one of " + strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// validateKeys checks the keys of a map against a named pattern.
+func validateKeys(value reflect.Value, param string) []*ValidationError {
+	p := rulePattern(param)
+	var violations []*ValidationError
+	for _, key := range mapKeys(value) {
+		if !p.re.MatchString(key) {
+			violations = append(violations, &ValidationError{Field: key, Message: p.message})
+		}
+	}
+	return violations
+}
+
+// validateValues checks the values of a map against a named pattern.
+func validateValues(value reflect.Value, param string) []*ValidationError {
+	p := rulePattern(param)
+	var violations []*ValidationError
+	for _, key := range mapKeys(value) {
+		if !p.re.MatchString(value.MapIndex(reflect.ValueOf(key)).String()) {
+			violations = append(violations, &ValidationError{Field: key, Message: p.message})
+		}
+	}
+	return violations
+}
+
+// mapKeys returns the keys of a map with string keys in order.
+func mapKeys(value reflect.Value) []string {
+	keys := make([]string, 0, value.Len())
+	for _, key := range value.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func invalidField(message string) []*ValidationError {
+	return []*ValidationError{{Message: message}}
+}
+
+func ruleLimit(param string) int {
+	limit, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validation limit %q is not an integer", param))
+	}
+	return limit
+}
+
+func rulePattern(param string) pattern {
+	p, ok := validationPatterns[param]
+	if !ok {
+		panic(fmt.Sprintf("unknown validation pattern %q", param))
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorest/api"
+)
+
+// test validateFederation(federation)
+// should accept valid federations and report every invalid field
+func TestValidateFederation(t *testing.T) {
+	// arrange
+	tests := []struct {
+		federation *api.Federation
+		want       ValidationErrors
+	}{
+		{&api.Federation{Owner: "Owner", Name: "name", Description: "description", Labels: map[string]string{"env": "prod", "example.com/tier": "", "a.b_c-d": "E_1.2-3"}}, nil},
+		{&api.Federation{Id: -1, Owner: " "}, ValidationErrors{
+			{Field: "id", Rule: "min", Message: "must be at least 0"},
+			{Field: "owner", Rule: "required", Message: "is required"},
+		}},
+		{&api.Federation{Owner: strings.Repeat("o", 256), Name: strings.Repeat("n", 256), Description: strings.Repeat("d", 1025)}, ValidationErrors{
+			{Field: "owner", Rule: "max", Message: "must be at most 255 characters"},
+			{Field: "name", Rule: "max", Message: "must be at most 255 characters"},
+			{Field: "description", Rule: "max", Message: "must be at most 1024 characters"},
+		}},
+		{&api.Federation{Owner: "Owner", Labels: map[string]string{"-env": "prod", "a/b/c": "x", strings.Repeat("k", maxLabelLength+1): "", "env": "prod,dev", "tier": "gold_"}}, ValidationErrors{
+			{Field: "labels.-env", Rule: "keys", Message: "key " + labelFormat},
+			{Field: "labels.a/b/c", Rule: "keys", Message: "key " + labelFormat},
+			{Field: "labels." + strings.Repeat("k", maxLabelLength+1), Rule: "keys", Message: "key " + labelFormat},
+			{Field: "labels.env", Rule: "values", Message: labelFormat},
+			{Field: "labels.tier", Rule: "values", Message: labelFormat},
+		}},
+	}
+
+	for _, tt := range tests {
+		// act
+		err := validateFederation(tt.federation)
+
+		// assert
+		var violations ValidationErrors
+		if tt.want == nil && err != nil || tt.want != nil && (!errors.As(err, &violations) || !reflect.DeepEqual(violations, tt.want)) {
+			t.Fatalf("validateFederation(%+v) = %v want %v", tt.federation, err, tt.want)
+		}
+	}
+}
+
+// test validateStruct(v) with every rule
+// should report the violations of each field under its json name
+func TestValidateStruct(t *testing.T) {
+	// arrange
+	type form struct {
+		Code   string            `json:"code" validate:"min=2,pattern=labelValue"`
+		Count  int               `json:"count,omitempty" validate:"required,max=3"`
+		Kind   string            `json:"kind" validate:"oneof=a b"`
+		Tags   map[string]string `validate:"keys=labelKey"`
+		Parent *int              `json:"parent" validate:"min=1"`
+		Ignore string
+	}
+	zero := 0
+	valid := &form{Code: "ab", Count: 3, Kind: "b", Tags: map[string]string{"a": "_"}, Ignore: "_"}
+	invalid := &form{Code: "_", Count: 4, Kind: "c", Tags: map[string]string{"_": ""}, Parent: &zero}
+	want := ValidationErrors{
+		{Field: "code", Rule: "min", Message: "must be at least 2 characters"},
+		{Field: "code", Rule: "pattern", Message: labelFormat},
+		{Field: "count", Rule: "max", Message: "must be at most 3"},
+		{Field: "kind", Rule: "oneof", Message: "must be one of a, b"},
+		{Field: "Tags._", Rule: "keys", Message: "key " + labelFormat},
+		{Field: "parent", Rule: "min", Message: "must be at least 1"},
+	}
+
+	// act
+	validErr := validateStruct(valid)
+	err := validateStruct(invalid)
+
+	// assert
+	if validErr != nil {
+		t.Fatalf("validateStruct(%+v) = %v want nil", valid, validErr)
+	}
+
+	var violations ValidationErrors
+	if !errors.As(err, &violations) || !reflect.DeepEqual(violations, want) {
+		t.Fatalf("validateStruct(%+v) = %v want %v", invalid, err, want)
+	}
+}